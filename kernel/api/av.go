@@ -17,7 +17,10 @@
 package api
 
 import (
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/88250/gulu"
 	"github.com/gin-gonic/gin"
@@ -25,8 +28,99 @@ import (
 	"github.com/siyuan-community/siyuan/kernel/model"
 	"github.com/siyuan-community/siyuan/kernel/treenode"
 	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
 )
 
+func importAttributeView(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	form, err := c.MultipartForm()
+	if nil != err {
+		logging.LogErrorf("parse import attribute view form failed: %s", err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	files := form.File["file"]
+	if 1 > len(files) {
+		ret.Code = -1
+		ret.Msg = "no file found"
+		return
+	}
+	file := files[0]
+	reader, err := file.Open()
+	if nil != err {
+		logging.LogErrorf("read import file failed: %s", err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	defer reader.Close()
+
+	importDir := filepath.Join(util.TempDir, "import", gulu.Rand.String(7))
+	if err = os.MkdirAll(importDir, 0755); nil != err {
+		logging.LogErrorf("make import dir [%s] failed: %s", importDir, err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	defer os.RemoveAll(importDir)
+
+	writePath := filepath.Join(importDir, filepath.Base(file.Filename))
+	writer, err := os.OpenFile(writePath, os.O_RDWR|os.O_CREATE, 0644)
+	if nil != err {
+		logging.LogErrorf("open import file [%s] failed: %s", writePath, err)
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	if _, err = io.Copy(writer, reader); nil != err {
+		logging.LogErrorf("write import file failed: %s", err)
+		writer.Close()
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	writer.Close()
+
+	var avID, docID, matchKey string
+	if values := form.Value["avID"]; 0 < len(values) {
+		avID = values[0]
+	}
+	if values := form.Value["docID"]; 0 < len(values) {
+		docID = values[0]
+	}
+	if values := form.Value["matchKey"]; 0 < len(values) {
+		matchKey = values[0]
+	}
+	bindBlocks := false
+	if values := form.Value["bindBlocks"]; 0 < len(values) {
+		bindBlocks = "true" == values[0]
+	}
+	mapping := map[string]av.KeyType{}
+	if values := form.Value["mapping"]; 0 < len(values) && "" != values[0] {
+		if err = gulu.JSON.UnmarshalJSON([]byte(values[0]), &mapping); nil != err {
+			ret.Code = -1
+			ret.Msg = err.Error()
+			return
+		}
+	}
+
+	result, err := model.ImportAttributeView(writePath, avID, docID, matchKey, mapping, bindBlocks)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = result
+
+	if "" != avID {
+		util.PushReloadAttrView(avID)
+	}
+}
+
 func getMirrorDatabaseBlocks(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -195,7 +195,11 @@ func setBlockReminder(c *gin.Context) {
 
 	id := arg["id"].(string)
 	timed := arg["timed"].(string) // yyyyMMddHHmmss
-	err := model.SetBlockReminder(id, timed)
+	repeat := ""                   // daily/weekly/monthly
+	if nil != arg["repeat"] {
+		repeat = arg["repeat"].(string)
+	}
+	err := model.SetBlockReminder(id, timed, repeat)
 	if nil != err {
 		ret.Code = -1
 		ret.Msg = err.Error()
@@ -204,6 +208,34 @@ func setBlockReminder(c *gin.Context) {
 	}
 }
 
+func snoozeBlockReminder(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	id := arg["id"].(string)
+	minutes := 10
+	if nil != arg["minutes"] {
+		minutes = int(arg["minutes"].(float64))
+	}
+	if err := model.SnoozeBlockReminder(id, minutes); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
+
+func getBlockReminders(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	ret.Data = model.GetBlockReminders()
+}
+
 func checkBlockFold(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -22,6 +22,7 @@ import (
 
 	"github.com/88250/gulu"
 	"github.com/gin-gonic/gin"
+	"github.com/siyuan-community/siyuan/kernel/conf"
 	"github.com/siyuan-community/siyuan/kernel/model"
 	"github.com/siyuan-community/siyuan/kernel/util"
 )
@@ -61,6 +62,129 @@ func searchHistory(c *gin.Context) {
 	}
 }
 
+func searchHistoryOccurrences(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	notebook := ""
+	if nil != arg["notebook"] {
+		notebook = arg["notebook"].(string)
+	}
+	query := arg["query"].(string)
+	page := 1
+	if nil != arg["page"] {
+		page = int(arg["page"].(float64))
+	}
+	occurrences, pageCount, totalCount := model.SearchHistoryOccurrences(query, notebook, page)
+	ret.Data = map[string]interface{}{
+		"occurrences": occurrences,
+		"pageCount":   pageCount,
+		"totalCount":  totalCount,
+	}
+}
+
+func rollbackBlockHistory(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	historyPath := arg["historyPath"].(string)
+	id := arg["id"].(string)
+	transactions, err := model.RollbackBlockHistory(historyPath, id)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	ret.Data = transactions
+	broadcastTransactions(transactions)
+}
+
+func getHistoryRetentionReport(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	// 传入 policy 时预览该策略，否则使用当前配置
+	var policy *conf.HistoryRetention
+	if policyArg, ok := arg["policy"].(map[string]interface{}); ok {
+		var err error
+		if policy, err = parseHistoryRetention(policyArg); nil != err {
+			ret.Code = -1
+			ret.Msg = err.Error()
+			return
+		}
+	}
+
+	ret.Data = model.GetHistoryRetentionReport(policy)
+}
+
+func applyHistoryRetention(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	ret.Data = model.ApplyHistoryRetention()
+}
+
+func getBlockHistory(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	id := arg["id"].(string)
+	if util.InvalidIDPattern(id, ret) {
+		return
+	}
+
+	histories := model.GetBlockHistory(id)
+	ret.Data = map[string]interface{}{
+		"histories": histories,
+	}
+}
+
+func rollbackBlockVersion(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	id := arg["id"].(string)
+	if util.InvalidIDPattern(id, ret) {
+		return
+	}
+	hash := arg["hash"].(string)
+	transactions, err := model.RollbackBlockVersion(id, hash)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	ret.Data = transactions
+	broadcastTransactions(transactions)
+}
+
 func getHistoryItems(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -327,6 +327,12 @@ func setNotebookConf(c *gin.Context) {
 
 	boxConf.DocCreateSavePath = strings.TrimSpace(boxConf.DocCreateSavePath)
 
+	if err = model.NormalizeBoxSync(boxConf); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
 	box.SaveConf(boxConf)
 	ret.Data = boxConf
 }
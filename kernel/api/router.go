@@ -40,6 +40,11 @@ func ServeAPI(ginServer *gin.Engine) {
 
 	ginServer.Handle("POST", "/api/system/getEmojiConf", model.CheckAuth, getEmojiConf)
 	ginServer.Handle("POST", "/api/system/setAPIToken", model.CheckAuth, model.CheckReadonly, setAPIToken)
+	ginServer.Handle("POST", "/api/system/setAPISQL", model.CheckAuth, model.CheckReadonly, setAPISQL)
+	ginServer.Handle("POST", "/api/system/getAPITokens", model.CheckAuth, getAPITokens)
+	ginServer.Handle("POST", "/api/system/addAPIToken", model.CheckAuth, model.CheckReadonly, addAPIToken)
+	ginServer.Handle("POST", "/api/system/updateAPIToken", model.CheckAuth, model.CheckReadonly, updateAPIToken)
+	ginServer.Handle("POST", "/api/system/removeAPIToken", model.CheckAuth, model.CheckReadonly, removeAPIToken)
 	ginServer.Handle("POST", "/api/system/setAccessAuthCode", model.CheckAuth, model.CheckReadonly, setAccessAuthCode)
 	ginServer.Handle("POST", "/api/system/setFollowSystemLockScreen", model.CheckAuth, model.CheckReadonly, setFollowSystemLockScreen)
 	ginServer.Handle("POST", "/api/system/setNetworkServe", model.CheckAuth, model.CheckReadonly, setNetworkServe)
@@ -130,6 +135,12 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/history/reindexHistory", model.CheckAuth, model.CheckReadonly, reindexHistory)
 	ginServer.Handle("POST", "/api/history/searchHistory", model.CheckAuth, searchHistory)
 	ginServer.Handle("POST", "/api/history/getHistoryItems", model.CheckAuth, getHistoryItems)
+	ginServer.Handle("POST", "/api/history/searchHistoryOccurrences", model.CheckAuth, searchHistoryOccurrences)
+	ginServer.Handle("POST", "/api/history/rollbackBlockHistory", model.CheckAuth, model.CheckReadonly, rollbackBlockHistory)
+	ginServer.Handle("POST", "/api/history/getBlockHistory", model.CheckAuth, getBlockHistory)
+	ginServer.Handle("POST", "/api/history/rollbackBlockVersion", model.CheckAuth, model.CheckReadonly, rollbackBlockVersion)
+	ginServer.Handle("POST", "/api/history/getHistoryRetentionReport", model.CheckAuth, getHistoryRetentionReport)
+	ginServer.Handle("POST", "/api/history/applyHistoryRetention", model.CheckAuth, model.CheckReadonly, applyHistoryRetention)
 
 	ginServer.Handle("POST", "/api/outline/getDocOutline", model.CheckAuth, getDocOutline)
 	ginServer.Handle("POST", "/api/bookmark/getBookmark", model.CheckAuth, getBookmark)
@@ -155,8 +166,12 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/search/getEmbedBlock", model.CheckAuth, getEmbedBlock)
 	ginServer.Handle("POST", "/api/search/updateEmbedBlock", model.CheckAuth, updateEmbedBlock)
 	ginServer.Handle("POST", "/api/search/fullTextSearchBlock", model.CheckAuth, fullTextSearchBlock)
+	ginServer.Handle("POST", "/api/search/getSavedSearches", model.CheckAuth, getSavedSearches)
+	ginServer.Handle("POST", "/api/search/runSavedSearch", model.CheckAuth, runSavedSearch)
 	ginServer.Handle("POST", "/api/search/searchAsset", model.CheckAuth, searchAsset)
+	ginServer.Handle("POST", "/api/search/findReplacePreview", model.CheckAuth, findReplacePreview)
 	ginServer.Handle("POST", "/api/search/findReplace", model.CheckAuth, findReplace)
+	ginServer.Handle("POST", "/api/search/undoFindReplace", model.CheckAuth, model.CheckReadonly, undoFindReplace)
 	ginServer.Handle("POST", "/api/search/fullTextSearchAssetContent", model.CheckAuth, fullTextSearchAssetContent)
 	ginServer.Handle("POST", "/api/search/getAssetContent", model.CheckAuth, getAssetContent)
 	ginServer.Handle("POST", "/api/search/listInvalidBlockRefs", model.CheckAuth, listInvalidBlockRefs)
@@ -192,6 +207,8 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/block/foldBlock", model.CheckAuth, model.CheckReadonly, foldBlock)
 	ginServer.Handle("POST", "/api/block/unfoldBlock", model.CheckAuth, model.CheckReadonly, unfoldBlock)
 	ginServer.Handle("POST", "/api/block/setBlockReminder", model.CheckAuth, model.CheckReadonly, setBlockReminder)
+	ginServer.Handle("POST", "/api/block/snoozeBlockReminder", model.CheckAuth, model.CheckReadonly, snoozeBlockReminder)
+	ginServer.Handle("POST", "/api/block/getBlockReminders", model.CheckAuth, getBlockReminders)
 	ginServer.Handle("POST", "/api/block/getHeadingLevelTransaction", model.CheckAuth, getHeadingLevelTransaction)
 	ginServer.Handle("POST", "/api/block/getHeadingDeleteTransaction", model.CheckAuth, getHeadingDeleteTransaction)
 	ginServer.Handle("POST", "/api/block/getHeadingChildrenIDs", model.CheckAuth, getHeadingChildrenIDs)
@@ -229,12 +246,15 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/sync/setSyncProvider", model.CheckAuth, model.CheckReadonly, setSyncProvider)
 	ginServer.Handle("POST", "/api/sync/setSyncProviderS3", model.CheckAuth, model.CheckReadonly, setSyncProviderS3)
 	ginServer.Handle("POST", "/api/sync/setSyncProviderWebDAV", model.CheckAuth, model.CheckReadonly, setSyncProviderWebDAV)
+	ginServer.Handle("POST", "/api/sync/setSyncProviderLocal", model.CheckAuth, model.CheckReadonly, setSyncProviderLocal)
+	ginServer.Handle("POST", "/api/sync/setSyncProviderSFTP", model.CheckAuth, model.CheckReadonly, setSyncProviderSFTP)
 	ginServer.Handle("POST", "/api/sync/setCloudSyncDir", model.CheckAuth, model.CheckReadonly, setCloudSyncDir)
 	ginServer.Handle("POST", "/api/sync/createCloudSyncDir", model.CheckAuth, model.CheckReadonly, createCloudSyncDir)
 	ginServer.Handle("POST", "/api/sync/removeCloudSyncDir", model.CheckAuth, model.CheckReadonly, removeCloudSyncDir)
 	ginServer.Handle("POST", "/api/sync/listCloudSyncDir", model.CheckAuth, listCloudSyncDir)
 	ginServer.Handle("POST", "/api/sync/performSync", model.CheckAuth, model.CheckReadonly, performSync)
 	ginServer.Handle("POST", "/api/sync/performBootSync", model.CheckAuth, model.CheckReadonly, performBootSync)
+	ginServer.Handle("POST", "/api/sync/previewSync", model.CheckAuth, model.CheckReadonly, previewSync)
 	ginServer.Handle("POST", "/api/sync/getBootSync", model.CheckAuth, getBootSync)
 	ginServer.Handle("POST", "/api/sync/getSyncInfo", model.CheckAuth, getSyncInfo)
 	ginServer.Handle("POST", "/api/sync/exportSyncProviderS3", model.CheckAuth, exportSyncProviderS3)
@@ -319,6 +339,8 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/setting/login2faCloudUser", model.CheckAuth, model.CheckReadonly, login2faCloudUser)
 	ginServer.Handle("POST", "/api/setting/setEmoji", model.CheckAuth, model.CheckReadonly, setEmoji)
 	ginServer.Handle("POST", "/api/setting/setFlashcard", model.CheckAuth, model.CheckReadonly, setFlashcard)
+	ginServer.Handle("POST", "/api/setting/setHistoryRetention", model.CheckAuth, model.CheckReadonly, setHistoryRetention)
+	ginServer.Handle("POST", "/api/setting/setReminder", model.CheckAuth, model.CheckReadonly, setReminder)
 	ginServer.Handle("POST", "/api/setting/setAI", model.CheckAuth, model.CheckReadonly, setAI)
 	ginServer.Handle("POST", "/api/setting/setBazaar", model.CheckAuth, model.CheckReadonly, setBazaar)
 	ginServer.Handle("POST", "/api/setting/refreshVirtualBlockRef", model.CheckAuth, model.CheckReadonly, refreshVirtualBlockRef)
@@ -402,6 +424,16 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/snippet/setSnippet", model.CheckAuth, model.CheckReadonly, setSnippet)
 	ginServer.Handle("POST", "/api/snippet/removeSnippet", model.CheckAuth, model.CheckReadonly, removeSnippet)
 
+	ginServer.Handle("POST", "/api/automation/getSchedules", model.CheckAuth, getSchedules)
+	ginServer.Handle("POST", "/api/automation/setSchedule", model.CheckAuth, model.CheckReadonly, setSchedule)
+	ginServer.Handle("POST", "/api/automation/removeSchedule", model.CheckAuth, model.CheckReadonly, removeSchedule)
+	ginServer.Handle("POST", "/api/automation/setScheduleEnabled", model.CheckAuth, model.CheckReadonly, setScheduleEnabled)
+	ginServer.Handle("POST", "/api/automation/runSchedule", model.CheckAuth, model.CheckReadonly, runSchedule)
+
+	ginServer.Handle("POST", "/api/task/getTasks", model.CheckAuth, getTasks)
+	ginServer.Handle("POST", "/api/task/cancelTask", model.CheckAuth, model.CheckReadonly, cancelTask)
+	ginServer.Handle("POST", "/api/task/retryTask", model.CheckAuth, model.CheckReadonly, retryTask)
+
 	ginServer.Handle("POST", "/api/av/renderAttributeView", model.CheckAuth, renderAttributeView)
 	ginServer.Handle("POST", "/api/av/renderHistoryAttributeView", model.CheckAuth, renderHistoryAttributeView)
 	ginServer.Handle("POST", "/api/av/renderSnapshotAttributeView", model.CheckAuth, renderSnapshotAttributeView)
@@ -420,6 +452,7 @@ func ServeAPI(ginServer *gin.Engine) {
 	ginServer.Handle("POST", "/api/av/getAttributeViewPrimaryKeyValues", model.CheckAuth, model.CheckReadonly, getAttributeViewPrimaryKeyValues)
 	ginServer.Handle("POST", "/api/av/setDatabaseBlockView", model.CheckAuth, model.CheckReadonly, setDatabaseBlockView)
 	ginServer.Handle("POST", "/api/av/getMirrorDatabaseBlocks", model.CheckAuth, model.CheckReadonly, getMirrorDatabaseBlocks)
+	ginServer.Handle("POST", "/api/av/importAttributeView", model.CheckAuth, model.CheckReadonly, importAttributeView)
 
 	ginServer.Handle("POST", "/api/ai/chatGPT", model.CheckAuth, chatGPT)
 	ginServer.Handle("POST", "/api/ai/chatGPTWithAction", model.CheckAuth, chatGPTWithAction)
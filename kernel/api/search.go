@@ -102,6 +102,29 @@ func fullTextSearchAssetContent(c *gin.Context) {
 	}
 }
 
+func findReplacePreview(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	k, r, replaceTypes, ids, _, paths, boxes, types, method, orderBy, groupBy := parseFindReplaceArgs(arg)
+	matches, matchCount, err := model.FindReplacePreview(k, r, replaceTypes, ids, paths, boxes, types, method, orderBy, groupBy)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	ret.Data = map[string]interface{}{
+		"matches":    matches,
+		"matchCount": matchCount,
+	}
+}
+
 func findReplace(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -111,17 +134,58 @@ func findReplace(c *gin.Context) {
 		return
 	}
 
-	_, _, _, paths, boxes, types, method, orderBy, groupBy := parseSearchBlockArgs(arg)
+	k, r, replaceTypes, ids, matchIDs, paths, boxes, types, method, orderBy, groupBy := parseFindReplaceArgs(arg)
+	replaceID, err := model.FindReplace(k, r, replaceTypes, ids, matchIDs, paths, boxes, types, method, orderBy, groupBy)
+	if nil != err {
+		ret.Code = 1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	ret.Data = map[string]interface{}{
+		"replaceID": replaceID,
+	}
+	return
+}
 
-	k := arg["k"].(string)
-	r := arg["r"].(string)
-	idsArg := arg["ids"].([]interface{})
-	var ids []string
-	for _, id := range idsArg {
-		ids = append(ids, id.(string))
+func undoFindReplace(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	replaceID := arg["replaceID"].(string)
+	if err := model.UndoFindReplace(replaceID); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+}
+
+func parseFindReplaceArgs(arg map[string]interface{}) (k, r string, replaceTypes map[string]bool, ids, matchIDs []string, paths, boxes []string, types map[string]bool, method, orderBy, groupBy int) {
+	_, _, _, paths, boxes, types, method, orderBy, groupBy = parseSearchBlockArgs(arg)
+
+	k = arg["k"].(string)
+	r = arg["r"].(string)
+	if idsArg, ok := arg["ids"].([]interface{}); ok {
+		for _, id := range idsArg {
+			ids = append(ids, id.(string))
+		}
 	}
 
-	replaceTypes := map[string]bool{}
+	// 仅替换预览中选中的命中
+	if matchIDsArg, ok := arg["matchIDs"].([]interface{}); ok {
+		for _, matchID := range matchIDsArg {
+			matchIDs = append(matchIDs, matchID.(string))
+		}
+	}
+
+	replaceTypes = map[string]bool{}
 	// text, imgText, imgTitle, imgSrc, aText, aTitle, aHref, code, em, strong, inlineMath, inlineMemo, kbd, mark, s, sub, sup, tag, u
 	// docTitle, codeBlock, mathBlock, htmlBlock
 	if nil != arg["replaceTypes"] {
@@ -130,14 +194,6 @@ func findReplace(c *gin.Context) {
 			replaceTypes[t] = b.(bool)
 		}
 	}
-
-	err := model.FindReplace(k, r, replaceTypes, ids, paths, boxes, types, method, orderBy, groupBy)
-	if nil != err {
-		ret.Code = 1
-		ret.Msg = err.Error()
-		ret.Data = map[string]interface{}{"closeTimeout": 5000}
-		return
-	}
 	return
 }
 
@@ -364,13 +420,61 @@ func fullTextSearchBlock(c *gin.Context) {
 	}
 
 	page, pageSize, query, paths, boxes, types, method, orderBy, groupBy := parseSearchBlockArgs(arg)
-	blocks, matchedBlockCount, matchedRootCount, pageCount := model.FullTextSearchBlock(query, boxes, paths, types, method, orderBy, groupBy, page, pageSize)
-	ret.Data = map[string]interface{}{
+
+	// 分面过滤条件
+	var facetFilter *model.SearchFacetFilter
+	if facetFilterArg := arg["facetFilter"]; nil != facetFilterArg {
+		data, err := gulu.JSON.MarshalJSON(facetFilterArg)
+		if nil != err {
+			ret.Code = -1
+			ret.Msg = err.Error()
+			return
+		}
+		facetFilter = &model.SearchFacetFilter{}
+		if err = gulu.JSON.UnmarshalJSON(data, facetFilter); nil != err {
+			ret.Code = -1
+			ret.Msg = err.Error()
+			return
+		}
+	}
+
+	blocks, matchedBlockCount, matchedRootCount, pageCount := model.FullTextSearchBlock(query, boxes, paths, types, facetFilter, method, orderBy, groupBy, page, pageSize)
+	data := map[string]interface{}{
 		"blocks":            blocks,
 		"matchedBlockCount": matchedBlockCount,
 		"matchedRootCount":  matchedRootCount,
 		"pageCount":         pageCount,
 	}
+	if facets, _ := arg["facets"].(bool); facets {
+		data["facets"] = model.GetSearchFacets(query, boxes, paths, types, facetFilter, method)
+	}
+	ret.Data = data
+}
+
+func getSavedSearches(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	ret.Data = model.GetSavedSearches()
+}
+
+func runSavedSearch(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	name := arg["name"].(string)
+	state, err := model.RunSavedSearch(name)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = state
 }
 
 func parseSearchBlockArgs(arg map[string]interface{}) (page, pageSize int, query string, paths, boxes []string, types map[string]bool, method, orderBy, groupBy int) {
@@ -420,7 +524,7 @@ func parseSearchBlockArgs(arg map[string]interface{}) (page, pageSize int, query
 		}
 	}
 
-	// method：0：关键字，1：查询语法，2：SQL，3：正则表达式
+	// method：0：关键字，1：查询语法，2：SQL，3：正则表达式，4：语义，5：混合
 	methodArg := arg["method"]
 	if nil != methodArg {
 		method = int(methodArg.(float64))
@@ -470,7 +574,7 @@ func parseSearchAssetContentArgs(arg map[string]interface{}) (page, pageSize int
 		}
 	}
 
-	// method：0：关键字，1：查询语法，2：SQL，3：正则表达式
+	// method：0：关键字，1：查询语法，2：SQL，3：正则表达式，4：语义，5：混合
 	methodArg := arg["method"]
 	if nil != methodArg {
 		method = int(methodArg.(float64))
@@ -202,8 +202,19 @@ func setAI(c *gin.Context) {
 		ai.OpenAI.APIMaxContexts = 7
 	}
 
+	if nil == ai.Embedding {
+		ai.Embedding = model.Conf.AI.Embedding
+	}
+	if 0 > ai.Embedding.HybridWeight || 1 < ai.Embedding.HybridWeight {
+		ai.Embedding.HybridWeight = conf.NewEmbedding().HybridWeight
+	}
+	if "" == ai.Embedding.Provider {
+		ai.Embedding.Provider = conf.EmbeddingProviderOpenAI
+	}
+
 	model.Conf.AI = ai
 	model.Conf.Save()
+	model.InitEmbedding()
 
 	ret.Data = ai
 }
@@ -245,6 +256,100 @@ func setFlashcard(c *gin.Context) {
 	ret.Data = flashcard
 }
 
+func setHistoryRetention(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	retention, err := parseHistoryRetention(arg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	model.Conf.Editor.HistoryRetention = retention
+	model.Conf.Save()
+
+	ret.Data = retention
+}
+
+func parseHistoryRetention(arg map[string]interface{}) (ret *conf.HistoryRetention, err error) {
+	param, err := gulu.JSON.MarshalJSON(arg)
+	if nil != err {
+		return
+	}
+
+	ret = conf.NewHistoryRetention()
+	if err = gulu.JSON.UnmarshalJSON(param, ret); nil != err {
+		return
+	}
+
+	if 0 > ret.MaxSize {
+		ret.MaxSize = 0
+	}
+	if nil == ret.Doc {
+		ret.Doc = &conf.HistoryRetentionRule{}
+	}
+	if nil == ret.Asset {
+		ret.Asset = &conf.HistoryRetentionRule{}
+	}
+	for _, rule := range []*conf.HistoryRetentionRule{ret.Doc, ret.Asset} {
+		rule.KeepDays = max(rule.KeepDays, 0)
+		rule.KeepLast = max(rule.KeepLast, 0)
+		rule.MaxSize = max(rule.MaxSize, 0)
+	}
+	return
+}
+
+func setReminder(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	param, err := gulu.JSON.MarshalJSON(arg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	reminder := conf.NewReminder()
+	if err = gulu.JSON.UnmarshalJSON(param, reminder); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	if nil == reminder.SMTP {
+		reminder.SMTP = &conf.SMTP{}
+	}
+	if 1 > reminder.SMTP.Port || 65535 < reminder.SMTP.Port {
+		reminder.SMTP.Port = 587
+	}
+	if nil == reminder.SMTP.To {
+		reminder.SMTP.To = []string{}
+	}
+
+	model.Conf.Reminder = reminder
+	model.Conf.Save()
+
+	if "" != strings.TrimSpace(reminder.Webhook) || "" != reminder.SMTP.Host {
+		// 最后配置投递渠道的设备负责投递提醒
+		model.SetBlockReminderDeliveryDevice()
+	}
+
+	ret.Data = reminder
+}
+
 func setAccount(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -307,6 +412,11 @@ func setEditor(c *gin.Context) {
 		editor.KaTexMacros = "{}"
 	}
 
+	if nil == arg["historyRetention"] {
+		// 历史保留策略通过 setHistoryRetention 单独设置
+		editor.HistoryRetention = model.Conf.Editor.HistoryRetention
+	}
+
 	oldVirtualBlockRef := model.Conf.Editor.VirtualBlockRef
 	oldVirtualBlockRefInclude := model.Conf.Editor.VirtualBlockRefInclude
 	oldVirtualBlockRefExclude := model.Conf.Editor.VirtualBlockRefExclude
@@ -447,6 +557,10 @@ func setSearch(c *gin.Context) {
 		s.Limit = 32
 	}
 
+	if 1 > s.FuzzyDistance || 3 < s.FuzzyDistance {
+		s.FuzzyDistance = conf.NewSearch().FuzzyDistance
+	}
+
 	oldCaseSensitive := model.Conf.Search.CaseSensitive
 	oldIndexAssetPath := model.Conf.Search.IndexAssetPath
 
@@ -460,6 +574,7 @@ func setSearch(c *gin.Context) {
 
 	sql.SetCaseSensitive(s.CaseSensitive)
 	sql.SetIndexAssetPath(s.IndexAssetPath)
+	sql.SetFuzzySearch(s.Fuzzy)
 
 	if needFullReindex := s.CaseSensitive != oldCaseSensitive || s.IndexAssetPath != oldIndexAssetPath; needFullReindex {
 		model.FullReindex()
@@ -18,6 +18,7 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/88250/gulu"
 	"github.com/gin-gonic/gin"
@@ -44,7 +45,38 @@ func SQL(c *gin.Context) {
 	}
 
 	stmt := arg["stmt"].(string)
-	result, err := sql.Query(stmt, model.Conf.Search.Limit)
+	var args []interface{}
+	if argsArg := arg["args"]; nil != argsArg {
+		args, ok = argsArg.([]interface{})
+		if !ok {
+			ret.Code = -1
+			ret.Msg = "args must be an array"
+			return
+		}
+	}
+	explain := false
+	if explainArg := arg["explain"]; nil != explainArg {
+		explain = explainArg.(bool)
+	}
+
+	// 默认只允许执行查询语句，允许写入时可通过 Conf.Api.SQL.Writable 开启，限定权限范围的令牌始终不允许写入
+	apiSQL := model.Conf.Api.SQL
+	readOnly := !model.CanWriteSQL(c)
+	timeout := time.Duration(apiSQL.Timeout) * time.Second
+	var result []map[string]interface{}
+	var err error
+	if explain {
+		if readOnly {
+			if err = sql.CheckReadOnlyStmt(stmt); nil != err {
+				ret.Code = 1
+				ret.Msg = err.Error()
+				return
+			}
+		}
+		result, err = sql.ExplainQueryPlan(stmt, args, timeout)
+	} else {
+		result, err = sql.QueryArgs(stmt, args, readOnly, model.Conf.Search.Limit, apiSQL.MaxRows, timeout)
+	}
 	if nil != err {
 		ret.Code = 1
 		ret.Msg = err.Error()
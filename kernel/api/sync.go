@@ -355,10 +355,11 @@ func getSyncInfo(c *gin.Context) {
 	}
 
 	ret.Data = map[string]interface{}{
-		"synced":  model.Conf.Sync.Synced,
-		"stat":    stat,
-		"kernels": model.GetOnlineKernels(),
-		"kernel":  model.KernelID,
+		"synced":    model.Conf.Sync.Synced,
+		"stat":      stat,
+		"kernels":   model.GetOnlineKernels(),
+		"kernel":    model.KernelID,
+		"notebooks": model.GetBoxSyncInfos(),
 	}
 }
 
@@ -420,6 +421,20 @@ func performBootSync(c *gin.Context) {
 	ret.Code = model.BootSyncSucc
 }
 
+func previewSync(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	previews, err := model.PreviewSync()
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+	ret.Data = previews
+}
+
 func listCloudSyncDir(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -620,6 +635,76 @@ func setSyncProviderWebDAV(c *gin.Context) {
 	}
 }
 
+func setSyncProviderLocal(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	localArg := arg["local"].(interface{})
+	data, err := gulu.JSON.MarshalJSON(localArg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	local := &conf.Local{}
+	if err = gulu.JSON.UnmarshalJSON(data, local); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	err = model.SetSyncProviderLocal(local)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+}
+
+func setSyncProviderSFTP(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	sftpArg := arg["sftp"].(interface{})
+	data, err := gulu.JSON.MarshalJSON(sftpArg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	sftp := &conf.SFTP{}
+	if err = gulu.JSON.UnmarshalJSON(data, sftp); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+
+	err = model.SetSyncProviderSFTP(sftp)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		ret.Data = map[string]interface{}{"closeTimeout": 5000}
+		return
+	}
+}
+
 func setCloudSyncDir(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
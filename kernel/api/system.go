@@ -270,6 +270,126 @@ func setAPIToken(c *gin.Context) {
 	model.Conf.Save()
 }
 
+func setAPISQL(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	param, err := gulu.JSON.MarshalJSON(arg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	apiSQL := conf.NewAPISQL()
+	if err = gulu.JSON.UnmarshalJSON(param, apiSQL); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	if 1 > apiSQL.Timeout || 600 < apiSQL.Timeout {
+		apiSQL.Timeout = conf.NewAPISQL().Timeout
+	}
+	if 1 > apiSQL.MaxRows {
+		apiSQL.MaxRows = conf.NewAPISQL().MaxRows
+	}
+
+	model.Conf.Api.SQL = apiSQL
+	model.Conf.Save()
+	ret.Data = apiSQL
+}
+
+func getAPITokens(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	ret.Data = map[string]interface{}{
+		"tokens": model.GetAPITokens(),
+	}
+}
+
+func addAPIToken(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	token, err := parseAPITokenArg(arg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	token, err = model.AddAPIToken(token)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+	ret.Data = token
+}
+
+func updateAPIToken(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	token, err := parseAPITokenArg(arg)
+	if nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+
+	if err = model.UpdateAPIToken(token); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
+
+func removeAPIToken(c *gin.Context) {
+	ret := gulu.Ret.NewResult()
+	defer c.JSON(http.StatusOK, ret)
+
+	arg, ok := util.JsonArg(c, ret)
+	if !ok {
+		return
+	}
+
+	id := arg["id"].(string)
+	if err := model.RemoveAPIToken(id); nil != err {
+		ret.Code = -1
+		ret.Msg = err.Error()
+		return
+	}
+}
+
+func parseAPITokenArg(arg map[string]interface{}) (ret *conf.APIToken, err error) {
+	data, err := gulu.JSON.MarshalJSON(arg)
+	if nil != err {
+		return
+	}
+
+	ret = &conf.APIToken{}
+	err = gulu.JSON.UnmarshalJSON(data, ret)
+	return
+}
+
 func setAccessAuthCode(c *gin.Context) {
 	ret := gulu.Ret.NewResult()
 	defer c.JSON(http.StatusOK, ret)
@@ -60,16 +60,17 @@ func performTransactions(c *gin.Context) {
 		ret.Msg = "parses request failed"
 		return
 	}
+	app := arg["app"].(string)
+	session := arg["session"].(string)
 	for _, transaction := range transactions {
 		transaction.Timestamp = timestamp
+		transaction.Session = session
 	}
 
 	model.PerformTransactions(&transactions)
 
 	ret.Data = transactions
 
-	app := arg["app"].(string)
-	session := arg["session"].(string)
 	pushTransactions(app, session, transactions)
 
 	if model.IsFoldHeading(&transactions) || model.IsUnfoldHeading(&transactions) || model.IsMoveOutlineHeading(&transactions) {
@@ -31,6 +31,7 @@ import (
 	"github.com/88250/lute/ast"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/eventbus"
 	"github.com/siyuan-note/filelock"
 	"github.com/siyuan-note/logging"
 )
@@ -61,6 +62,17 @@ func (kValues *KeyValues) GetValue(blockID string) (ret *Value) {
 	return
 }
 
+// getValuesByBlockID 返回块 ID 到值的映射，和 GetValue 一样同一个块有多个值时使用第一个，用于需要逐行查找值的场景。
+func (kValues *KeyValues) getValuesByBlockID() (ret map[string]*Value) {
+	ret = make(map[string]*Value, len(kValues.Values))
+	for _, v := range kValues.Values {
+		if _, ok := ret[v.BlockID]; !ok {
+			ret[v.BlockID] = v
+		}
+	}
+	return
+}
+
 type KeyType string
 
 const (
@@ -81,6 +93,9 @@ const (
 	KeyTypeRelation   KeyType = "relation"
 	KeyTypeRollup     KeyType = "rollup"
 	KeyTypeLineNumber KeyType = "lineNumber"
+	KeyTypeFormula    KeyType = "formula"
+	KeyTypeUniqueID   KeyType = "uniqueID"
+	KeyTypeCreatedBy  KeyType = "createdBy"
 )
 
 // Key 描述了属性视图属性列的基础结构。
@@ -101,6 +116,9 @@ type Key struct {
 	// 模板
 	Template string `json:"template"` // 模板内容
 
+	// 公式
+	Formula string `json:"formula,omitempty"` // 公式内容
+
 	// 关联
 	Relation *Relation `json:"relation,omitempty"` // 关联信息
 
@@ -109,6 +127,9 @@ type Key struct {
 
 	// 日期
 	Date *Date `json:"date,omitempty"` // 日期设置
+
+	// 唯一 ID
+	UniqueID *UniqueID `json:"uniqueID,omitempty"` // 唯一 ID 设置
 }
 
 func NewKey(id, name, icon string, keyType KeyType) *Key {
@@ -153,17 +174,35 @@ type View struct {
 	Name             string `json:"name"`             // 视图名称
 	HideAttrViewName bool   `json:"hideAttrViewName"` // 是否隐藏属性视图名称
 
-	LayoutType LayoutType   `json:"type"`            // 当前布局类型
-	Table      *LayoutTable `json:"table,omitempty"` // 表格布局
+	LayoutType LayoutType      `json:"type"`               // 当前布局类型
+	Table      *LayoutTable    `json:"table,omitempty"`    // 表格布局
+	Board      *LayoutBoard    `json:"board,omitempty"`    // 看板布局
+	Calendar   *LayoutCalendar `json:"calendar,omitempty"` // 日历布局
+	Timeline   *LayoutTimeline `json:"timeline,omitempty"` // 时间线布局
+
+	Group *ViewGroup `json:"group,omitempty"` // 分组设置
 }
 
 // LayoutType 描述了视图布局的类型。
 type LayoutType string
 
 const (
-	LayoutTypeTable LayoutType = "table" // 属性视图类型 - 表格
+	LayoutTypeTable    LayoutType = "table"    // 属性视图类型 - 表格
+	LayoutTypeBoard    LayoutType = "board"    // 属性视图类型 - 看板
+	LayoutTypeCalendar LayoutType = "calendar" // 属性视图类型 - 日历
+	LayoutTypeTimeline LayoutType = "timeline" // 属性视图类型 - 时间线
 )
 
+// GetLayoutTable 返回视图使用的表格布局数据。看板、日历和时间线视图的列、过滤、排序和分页都保存在表格布局中，
+// 所以这些布局也返回表格布局；不使用表格布局数据的视图返回 nil。
+func (view *View) GetLayoutTable() *LayoutTable {
+	switch view.LayoutType {
+	case LayoutTypeTable, LayoutTypeBoard, LayoutTypeCalendar, LayoutTypeTimeline:
+		return view.Table
+	}
+	return nil
+}
+
 func NewTableView() (ret *View) {
 	ret = &View{
 		ID:         ast.NewNodeID(),
@@ -180,6 +219,48 @@ func NewTableView() (ret *View) {
 	return
 }
 
+// NewBoardView 创建看板视图，groupKeyID 为分组列 ID，必须是单选列或者复选框列。
+func NewBoardView(groupKeyID string) (ret *View) {
+	ret = NewTableView()
+	ret.Name = getI18nName("board")
+	ret.LayoutType = LayoutTypeBoard
+	ret.Board = &LayoutBoard{
+		Spec:       0,
+		ID:         ast.NewNodeID(),
+		GroupKeyID: groupKeyID,
+		Lanes:      []*ViewBoardLane{},
+	}
+	return
+}
+
+// NewCalendarView 创建日历视图，startKeyID 为开始日期列 ID。
+func NewCalendarView(startKeyID string) (ret *View) {
+	ret = NewTableView()
+	ret.Name = getI18nName("calendar")
+	ret.LayoutType = LayoutTypeCalendar
+	ret.Calendar = &LayoutCalendar{
+		Spec:       0,
+		ID:         ast.NewNodeID(),
+		StartKeyID: startKeyID,
+		Mode:       CalendarModeMonth,
+	}
+	return
+}
+
+// NewTimelineView 创建时间线视图，startKeyID 为开始日期列 ID。
+func NewTimelineView(startKeyID string) (ret *View) {
+	ret = NewTableView()
+	ret.Name = getI18nName("timeline")
+	ret.LayoutType = LayoutTypeTimeline
+	ret.Timeline = &LayoutTimeline{
+		Spec:       0,
+		ID:         ast.NewNodeID(),
+		StartKeyID: startKeyID,
+		Scale:      TimelineScaleDay,
+	}
+	return
+}
+
 func NewTableViewWithBlockKey(blockKeyID string) (view *View, blockKey, selectKey *Key) {
 	name := getI18nName("table")
 	view = &View{
@@ -407,9 +488,8 @@ func SaveAttributeView(av *AttributeView) (err error) {
 				}
 
 				for _, view := range av.Views {
-					switch view.LayoutType {
-					case LayoutTypeTable:
-						for _, column := range view.Table.Columns {
+					if table := view.GetLayoutTable(); nil != table {
+						for _, column := range table.Columns {
 							if "" == column.ID {
 								column.ID = kv.Key.ID
 								break
@@ -446,7 +526,7 @@ func SaveAttributeView(av *AttributeView) (err error) {
 	// 补全过滤器 Value
 	for _, view := range av.Views {
 		if nil != view.Table {
-			for _, f := range view.Table.Filters {
+			for _, f := range GetLeafFilters(view.Table.Filters) {
 				if nil != f.Value {
 					continue
 				}
@@ -477,6 +557,10 @@ func SaveAttributeView(av *AttributeView) (err error) {
 	}
 	blockValues.Values = tmp
 
+	// 唯一 ID 按照行的创建时间分配编号，需要在补全块创建时间和值去重之后进行
+	av.FillUniqueIDs()
+	av.FillCreatedBy()
+
 	// 视图值去重
 	for _, view := range av.Views {
 		if nil != view.Table {
@@ -487,6 +571,13 @@ func SaveAttributeView(av *AttributeView) (err error) {
 				view.Table.PageSize = 50
 			}
 		}
+
+		if nil != view.Board {
+			// 泳道内行去重
+			for _, lane := range view.Board.Lanes {
+				lane.RowIDs = gulu.Str.RemoveDuplicatedElem(lane.RowIDs)
+			}
+		}
 	}
 
 	var data []byte
@@ -505,9 +596,14 @@ func SaveAttributeView(av *AttributeView) (err error) {
 		logging.LogErrorf("save attribute view [%s] failed: %s", av.ID, err)
 		return
 	}
+
+	eventbus.Publish(EvtAttributeViewSaved, av.ID)
 	return
 }
 
+// EvtAttributeViewSaved 属性视图保存后发布的事件，参数为属性视图 ID。
+const EvtAttributeViewSaved = "av.saved"
+
 func (av *AttributeView) GetView(viewID string) (ret *View) {
 	for _, v := range av.Views {
 		if v.ID == viewID {
@@ -651,6 +747,10 @@ func (av *AttributeView) ShallowClone() (ret *AttributeView) {
 		keyIDMap[kv.Key.ID] = newID
 		kv.Key.ID = newID
 		kv.Values = []*Value{}
+		if nil != kv.Key.UniqueID {
+			// 复制后没有行，编号重新开始
+			kv.Key.UniqueID.Next = 1
+		}
 	}
 
 	for _, view := range ret.Views {
@@ -661,12 +761,40 @@ func (av *AttributeView) ShallowClone() (ret *AttributeView) {
 		}
 		view.Table.RowIDs = []string{}
 
-		for _, f := range view.Table.Filters {
+		for _, f := range GetLeafFilters(view.Table.Filters) {
 			f.Column = keyIDMap[f.Column]
 		}
 		for _, s := range view.Table.Sorts {
 			s.Column = keyIDMap[s.Column]
 		}
+
+		if nil != view.Board {
+			view.Board.ID = ast.NewNodeID()
+			view.Board.GroupKeyID = keyIDMap[view.Board.GroupKeyID]
+			for _, lane := range view.Board.Lanes {
+				lane.RowIDs = []string{}
+			}
+		}
+
+		if nil != view.Calendar {
+			view.Calendar.ID = ast.NewNodeID()
+			view.Calendar.StartKeyID = keyIDMap[view.Calendar.StartKeyID]
+			view.Calendar.EndKeyID = keyIDMap[view.Calendar.EndKeyID]
+		}
+
+		if nil != view.Timeline {
+			view.Timeline.ID = ast.NewNodeID()
+			view.Timeline.StartKeyID = keyIDMap[view.Timeline.StartKeyID]
+			view.Timeline.EndKeyID = keyIDMap[view.Timeline.EndKeyID]
+		}
+
+		if nil != view.Group {
+			view.Group.Field = keyIDMap[view.Group.Field]
+			if key, _ := ret.GetKey(view.Group.Field); nil != key && KeyTypeRelation == key.Type {
+				// 关联列的分组 ID 为块 ID，克隆后不再有效
+				view.Group.Groups = []*ViewGroupState{}
+			}
+		}
 	}
 	ret.ViewID = ret.Views[0].ID
 	return
@@ -691,6 +819,12 @@ func getI18nName(name string) string {
 var (
 	ErrViewNotFound = errors.New("view not found")
 	ErrKeyNotFound  = errors.New("key not found")
+
+	ErrInvalidGroupKey    = errors.New("invalid group key")
+	ErrInvalidGroupMethod = errors.New("invalid group method")
+	ErrInvalidDateKey     = errors.New("invalid date key")
+
+	ErrInvalidFilterConjunction = errors.New("invalid filter conjunction")
 )
 
 const (
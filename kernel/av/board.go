@@ -0,0 +1,310 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"sort"
+
+	"github.com/88250/gulu"
+)
+
+// LayoutBoard 描述了看板布局的结构。
+//
+// 看板视图的字段、过滤、排序和行顺序仍然保存在视图的表格布局 LayoutTable 中，这里仅保存看板特有的分组和泳道设置。
+type LayoutBoard struct {
+	Spec int    `json:"spec"` // 布局格式版本
+	ID   string `json:"id"`   // 布局 ID
+
+	GroupKeyID string           `json:"groupKeyID"` // 分组列 ID，仅支持单选列和复选框列
+	Lanes      []*ViewBoardLane `json:"lanes"`      // 泳道
+}
+
+type ViewBoardLane struct {
+	ID     string   `json:"id"`     // 泳道 ID，单选列为选项名，复选框列为 BoardLaneChecked/BoardLaneUnchecked，未设置值的泳道为空字符串
+	Hidden bool     `json:"hidden"` // 是否隐藏
+	RowIDs []string `json:"rowIds"` // 行 ID，用于泳道内自定义排序
+}
+
+const (
+	BoardLaneNone      = ""          // 未设置值的泳道
+	BoardLaneChecked   = "checked"   // 复选框列已勾选的泳道
+	BoardLaneUnchecked = "unchecked" // 复选框列未勾选的泳道
+)
+
+// IsBoardGroupKeyType 判断列类型是否可以作为看板分组列。
+func IsBoardGroupKeyType(typ KeyType) bool {
+	return KeyTypeSelect == typ || KeyTypeCheckbox == typ
+}
+
+// SetGroupKey 设置分组列，分组列变化后原有的泳道设置将被清空。
+func (board *LayoutBoard) SetGroupKey(keyID string) {
+	if board.GroupKeyID == keyID {
+		return
+	}
+
+	board.GroupKeyID = keyID
+	board.Lanes = []*ViewBoardLane{}
+}
+
+func (board *LayoutBoard) GetLane(laneID string) (ret *ViewBoardLane) {
+	for _, lane := range board.Lanes {
+		if lane.ID == laneID {
+			ret = lane
+			return
+		}
+	}
+	return
+}
+
+// GetOrAddLane 获取泳道，如果不存在则添加到末尾。
+func (board *LayoutBoard) GetOrAddLane(laneID string) (ret *ViewBoardLane) {
+	if ret = board.GetLane(laneID); nil != ret {
+		return
+	}
+
+	ret = &ViewBoardLane{ID: laneID, RowIDs: []string{}}
+	board.Lanes = append(board.Lanes, ret)
+	return
+}
+
+// RemoveRow 从所有泳道中移除行。
+func (board *LayoutBoard) RemoveRow(rowID string) {
+	for _, lane := range board.Lanes {
+		lane.RowIDs = gulu.Str.RemoveElem(lane.RowIDs, rowID)
+	}
+}
+
+// ReplaceRow 将泳道中的行 ID 替换为新的行 ID。
+func (board *LayoutBoard) ReplaceRow(oldRowID, newRowID string) {
+	for _, lane := range board.Lanes {
+		for i, rowID := range lane.RowIDs {
+			if rowID == oldRowID {
+				lane.RowIDs[i] = newRowID
+			}
+		}
+	}
+}
+
+// Board 描述了看板实例的结构。
+type Board struct {
+	ID               string         `json:"id"`               // 看板布局 ID
+	Icon             string         `json:"icon"`             // 看板图标
+	Name             string         `json:"name"`             // 看板名称
+	HideAttrViewName bool           `json:"hideAttrViewName"` // 是否隐藏属性视图名称
+	Filters          []*ViewFilter  `json:"filters"`          // 过滤规则
+	Sorts            []*ViewSort    `json:"sorts"`            // 排序规则
+	GroupKey         *TableColumn   `json:"groupKey"`         // 分组列
+	Fields           []*TableColumn `json:"fields"`           // 卡片字段
+	Lanes            []*BoardLane   `json:"lanes"`            // 泳道
+	CardCount        int            `json:"cardCount"`        // 看板总卡片数
+
+	table  *Table       // 看板的行数据，过滤和排序复用表格的实现
+	layout *LayoutBoard // 看板布局设置
+}
+
+type BoardLane struct {
+	ID        string      `json:"id"`        // 泳道 ID
+	Name      string      `json:"name"`      // 泳道名称
+	Color     string      `json:"color"`     // 泳道颜色
+	Hidden    bool        `json:"hidden"`    // 是否隐藏
+	Cards     []*TableRow `json:"cards"`     // 卡片
+	CardCount int         `json:"cardCount"` // 泳道卡片数
+}
+
+// NewBoard 使用已经渲染好的表格实例构造看板实例。
+func NewBoard(view *View, table *Table) (ret *Board) {
+	if nil == view.Board {
+		view.Board = &LayoutBoard{Lanes: []*ViewBoardLane{}}
+	}
+
+	ret = &Board{
+		ID:               table.ID,
+		Icon:             table.Icon,
+		Name:             table.Name,
+		HideAttrViewName: table.HideAttrViewName,
+		Filters:          table.Filters,
+		Sorts:            table.Sorts,
+		Fields:           table.Columns,
+		Lanes:            []*BoardLane{},
+		table:            table,
+		layout:           view.Board,
+	}
+
+	for _, col := range table.Columns {
+		if col.ID == view.Board.GroupKeyID {
+			ret.GroupKey = col
+			break
+		}
+	}
+	return
+}
+
+func (board *Board) GetType() LayoutType {
+	return LayoutTypeBoard
+}
+
+func (board *Board) GetID() string {
+	return board.ID
+}
+
+func (board *Board) FilterRows(attrView *AttributeView) {
+	board.table.FilterRows(attrView)
+}
+
+func (board *Board) SortRows(attrView *AttributeView) {
+	board.table.SortRows(attrView)
+}
+
+func (board *Board) CalcCols() {
+	// 看板不支持列计算
+}
+
+// GroupCards 将过滤和排序后的行按照分组列分配到泳道中。
+func (board *Board) GroupCards() {
+	board.CardCount = len(board.table.Rows)
+
+	groupKeyIndex := -1
+	for i, col := range board.table.Columns {
+		if nil != board.GroupKey && col.ID == board.GroupKey.ID {
+			groupKeyIndex = i
+			break
+		}
+	}
+
+	// 按照分组列生成泳道，单选列按选项顺序，复选框列先未勾选后勾选，最后根据布局中保存的泳道顺序重排
+	lanes := []*BoardLane{{ID: BoardLaneNone, Cards: []*TableRow{}}}
+	if nil != board.GroupKey {
+		switch board.GroupKey.Type {
+		case KeyTypeSelect:
+			for _, opt := range board.GroupKey.Options {
+				lanes = append(lanes, &BoardLane{ID: opt.Name, Name: opt.Name, Color: opt.Color, Cards: []*TableRow{}})
+			}
+		case KeyTypeCheckbox:
+			lanes = []*BoardLane{{ID: BoardLaneUnchecked, Cards: []*TableRow{}}, {ID: BoardLaneChecked, Cards: []*TableRow{}}}
+		}
+	}
+
+	laneIndexes := map[string]int{}
+	for i, lane := range board.layout.Lanes {
+		laneIndexes[lane.ID] = i
+	}
+	var sortedLanes, unsortedLanes []*BoardLane
+	for _, lane := range lanes {
+		if _, ok := laneIndexes[lane.ID]; ok {
+			sortedLanes = append(sortedLanes, lane)
+		} else {
+			unsortedLanes = append(unsortedLanes, lane)
+		}
+	}
+	sort.SliceStable(sortedLanes, func(i, j int) bool {
+		return laneIndexes[sortedLanes[i].ID] < laneIndexes[sortedLanes[j].ID]
+	})
+	board.Lanes = append(sortedLanes, unsortedLanes...)
+
+	lanesByID := map[string]*BoardLane{}
+	for _, lane := range board.Lanes {
+		lanesByID[lane.ID] = lane
+		if viewLane := board.layout.GetLane(lane.ID); nil != viewLane {
+			lane.Hidden = viewLane.Hidden
+		}
+	}
+
+	for _, row := range board.table.Rows {
+		laneID := BoardLaneNone
+		if -1 < groupKeyIndex {
+			laneID = GetBoardLaneID(row.Cells[groupKeyIndex].Value)
+		}
+
+		lane := lanesByID[laneID]
+		if nil == lane {
+			// 选项已经被删除，但是值还存在
+			lane = lanesByID[BoardLaneNone]
+		}
+		if nil == lane {
+			lane = lanesByID[BoardLaneUnchecked]
+		}
+		lane.Cards = append(lane.Cards, row)
+	}
+
+	// 没有设置排序规则时使用泳道内自定义排序
+	if 1 > len(board.Sorts) {
+		for _, lane := range board.Lanes {
+			viewLane := board.layout.GetLane(lane.ID)
+			if nil == viewLane || 1 > len(viewLane.RowIDs) {
+				continue
+			}
+
+			cards := map[string]*TableRow{}
+			for _, card := range lane.Cards {
+				cards[card.ID] = card
+			}
+
+			sorted := []*TableRow{}
+			for _, rowID := range viewLane.RowIDs {
+				if card := cards[rowID]; nil != card {
+					sorted = append(sorted, card)
+					delete(cards, rowID)
+				}
+			}
+			for _, card := range lane.Cards {
+				if _, ok := cards[card.ID]; ok {
+					sorted = append(sorted, card)
+				}
+			}
+			lane.Cards = sorted
+		}
+	}
+
+	for _, lane := range board.Lanes {
+		lane.CardCount = len(lane.Cards)
+	}
+
+	// 没有选项值的泳道为空时不显示
+	if 0 < len(board.Lanes) && nil != board.GroupKey && KeyTypeSelect == board.GroupKey.Type {
+		var tmp []*BoardLane
+		for _, lane := range board.Lanes {
+			if BoardLaneNone == lane.ID && 1 > lane.CardCount {
+				continue
+			}
+			tmp = append(tmp, lane)
+		}
+		board.Lanes = tmp
+	}
+	if 1 > len(board.Lanes) {
+		board.Lanes = []*BoardLane{}
+	}
+}
+
+// GetBoardLaneID 获取值所在的泳道 ID。
+func GetBoardLaneID(value *Value) string {
+	if nil == value {
+		return BoardLaneNone
+	}
+
+	switch value.Type {
+	case KeyTypeSelect:
+		if 0 < len(value.MSelect) {
+			return value.MSelect[0].Content
+		}
+	case KeyTypeCheckbox:
+		if nil != value.Checkbox && value.Checkbox.Checked {
+			return BoardLaneChecked
+		}
+		return BoardLaneUnchecked
+	}
+	return BoardLaneNone
+}
@@ -0,0 +1,196 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+// LayoutCalendar 描述了日历布局的结构。
+//
+// 和看板一样，日历视图的字段、过滤和排序保存在视图的表格布局 LayoutTable 中。
+type LayoutCalendar struct {
+	Spec int    `json:"spec"` // 布局格式版本
+	ID   string `json:"id"`   // 布局 ID
+
+	StartKeyID string       `json:"startKeyID"` // 开始日期列 ID
+	EndKeyID   string       `json:"endKeyID"`   // 结束日期列 ID，为空时使用开始日期列的结束时间
+	Mode       CalendarMode `json:"mode"`       // 显示模式
+}
+
+type CalendarMode string
+
+const (
+	CalendarModeMonth CalendarMode = "month" // 按月显示
+	CalendarModeWeek  CalendarMode = "week"  // 按周显示
+)
+
+// RemoveKey 在日期列被删除或者类型变更时清空对应的设置。
+func (calendar *LayoutCalendar) RemoveKey(keyID string) {
+	if calendar.StartKeyID == keyID {
+		calendar.StartKeyID = ""
+	}
+	if calendar.EndKeyID == keyID {
+		calendar.EndKeyID = ""
+	}
+}
+
+// IsDateLayoutKeyType 判断列类型是否可以作为日历和时间线的日期列。
+func IsDateLayoutKeyType(typ KeyType) bool {
+	return KeyTypeDate == typ
+}
+
+// Calendar 描述了日历实例的结构。
+type Calendar struct {
+	ID               string         `json:"id"`               // 日历布局 ID
+	Icon             string         `json:"icon"`             // 日历图标
+	Name             string         `json:"name"`             // 日历名称
+	HideAttrViewName bool           `json:"hideAttrViewName"` // 是否隐藏属性视图名称
+	Filters          []*ViewFilter  `json:"filters"`          // 过滤规则
+	Sorts            []*ViewSort    `json:"sorts"`            // 排序规则
+	Mode             CalendarMode   `json:"mode"`             // 显示模式
+	StartKey         *TableColumn   `json:"startKey"`         // 开始日期列
+	EndKey           *TableColumn   `json:"endKey"`           // 结束日期列
+	Fields           []*TableColumn `json:"fields"`           // 条目字段
+	Items            []*DateItem    `json:"items"`            // 已安排日期的条目
+	Unscheduled      []*TableRow    `json:"unscheduled"`      // 未安排日期的条目
+	ItemCount        int            `json:"itemCount"`        // 总条目数
+
+	table *Table // 日历的行数据，过滤和排序复用表格的实现
+}
+
+// DateItem 描述了日历和时间线中按日期放置的条目。
+type DateItem struct {
+	ID        string    `json:"id"`        // 行 ID
+	Start     int64     `json:"start"`     // 开始时间
+	End       int64     `json:"end"`       // 结束时间，没有结束时间时和开始时间相同
+	IsNotTime bool      `json:"isNotTime"` // 是否仅包含日期
+	Row       *TableRow `json:"row"`       // 行
+}
+
+// NewCalendar 使用已经渲染好的表格实例构造日历实例。
+func NewCalendar(view *View, table *Table) (ret *Calendar) {
+	if nil == view.Calendar {
+		view.Calendar = &LayoutCalendar{Mode: CalendarModeMonth}
+	}
+	if "" == view.Calendar.Mode {
+		view.Calendar.Mode = CalendarModeMonth
+	}
+
+	ret = &Calendar{
+		ID:               table.ID,
+		Icon:             table.Icon,
+		Name:             table.Name,
+		HideAttrViewName: table.HideAttrViewName,
+		Filters:          table.Filters,
+		Sorts:            table.Sorts,
+		Mode:             view.Calendar.Mode,
+		Fields:           table.Columns,
+		Items:            []*DateItem{},
+		Unscheduled:      []*TableRow{},
+		table:            table,
+	}
+	ret.StartKey, ret.EndKey = getDateLayoutKeys(table, view.Calendar.StartKeyID, view.Calendar.EndKeyID)
+	return
+}
+
+func (calendar *Calendar) GetType() LayoutType {
+	return LayoutTypeCalendar
+}
+
+func (calendar *Calendar) GetID() string {
+	return calendar.ID
+}
+
+func (calendar *Calendar) FilterRows(attrView *AttributeView) {
+	calendar.table.FilterRows(attrView)
+}
+
+func (calendar *Calendar) SortRows(attrView *AttributeView) {
+	calendar.table.SortRows(attrView)
+}
+
+func (calendar *Calendar) CalcCols() {
+	// 日历不支持列计算
+}
+
+// PlaceItems 将过滤和排序后的行按照日期列放置到日历中。
+func (calendar *Calendar) PlaceItems() {
+	calendar.ItemCount = len(calendar.table.Rows)
+	calendar.Items, calendar.Unscheduled = placeDateItems(calendar.table, calendar.StartKey, calendar.EndKey)
+}
+
+func getDateLayoutKeys(table *Table, startKeyID, endKeyID string) (startKey, endKey *TableColumn) {
+	for _, col := range table.Columns {
+		if !IsDateLayoutKeyType(col.Type) {
+			continue
+		}
+
+		if col.ID == startKeyID {
+			startKey = col
+		}
+		if "" != endKeyID && col.ID == endKeyID {
+			endKey = col
+		}
+	}
+	return
+}
+
+// placeDateItems 根据开始和结束日期列将表格行转换为日期条目，没有开始日期的行作为未安排条目返回。
+func placeDateItems(table *Table, startKey, endKey *TableColumn) (items []*DateItem, unscheduled []*TableRow) {
+	items = []*DateItem{}
+	unscheduled = []*TableRow{}
+
+	startIndex, endIndex := -1, -1
+	for i, col := range table.Columns {
+		if nil != startKey && col.ID == startKey.ID {
+			startIndex = i
+		}
+		if nil != endKey && col.ID == endKey.ID {
+			endIndex = i
+		}
+	}
+
+	for _, row := range table.Rows {
+		if -1 == startIndex {
+			unscheduled = append(unscheduled, row)
+			continue
+		}
+
+		startVal := row.Cells[startIndex].Value
+		if nil == startVal || nil == startVal.Date || !startVal.Date.IsNotEmpty {
+			unscheduled = append(unscheduled, row)
+			continue
+		}
+
+		item := &DateItem{ID: row.ID, Start: startVal.Date.Content, End: startVal.Date.Content, IsNotTime: startVal.Date.IsNotTime, Row: row}
+		if -1 < endIndex {
+			// 使用单独的结束日期列
+			if endVal := row.Cells[endIndex].Value; nil != endVal && nil != endVal.Date && endVal.Date.IsNotEmpty {
+				item.End = endVal.Date.Content
+				if endVal.Date.HasEndDate && endVal.Date.IsNotEmpty2 {
+					item.End = endVal.Date.Content2
+				}
+			}
+		} else if startVal.Date.HasEndDate && startVal.Date.IsNotEmpty2 {
+			// 使用开始日期列的结束时间
+			item.End = startVal.Date.Content2
+		}
+
+		if item.End < item.Start {
+			item.End = item.Start
+		}
+		items = append(items, item)
+	}
+	return
+}
@@ -0,0 +1,66 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"github.com/88250/lute/ast"
+	"github.com/siyuan-community/siyuan/kernel/util"
+)
+
+type ValueCreatedBy struct {
+	Content string `json:"content"` // 添加该行的设备名称
+}
+
+// FillCreatedBy 按照行的创建者刷新创建者列中的值。
+//
+// 创建者在行添加时记录在主键值 Block.CreatedBy 中，创建者列只是它的只读展示，旧数据中没有创建者的行保持为空。
+func (av *AttributeView) FillCreatedBy() {
+	blockValues := av.GetBlockKeyValues()
+	if nil == blockValues {
+		return
+	}
+
+	now := util.CurrentTimeMillis()
+	for _, kv := range av.KeyValues {
+		if KeyTypeCreatedBy != kv.Key.Type {
+			continue
+		}
+
+		values := kv.getValuesByBlockID()
+		for _, row := range blockValues.Values {
+			createdBy := ""
+			if nil != row.Block {
+				createdBy = row.Block.CreatedBy
+			}
+
+			v := values[row.BlockID]
+			if nil != v && KeyTypeCreatedBy == v.Type && nil != v.CreatedBy && createdBy == v.CreatedBy.Content {
+				continue
+			}
+
+			if nil == v {
+				v = &Value{ID: ast.NewNodeID(), KeyID: kv.Key.ID, BlockID: row.BlockID, CreatedAt: now}
+				kv.Values = append(kv.Values, v)
+				values[row.BlockID] = v
+			}
+
+			// 列类型从其他类型变更为创建者时原来的值会被替换
+			*v = Value{ID: v.ID, KeyID: v.KeyID, BlockID: v.BlockID, Type: KeyTypeCreatedBy, IsDetached: row.IsDetached, CreatedAt: v.CreatedAt, UpdatedAt: now,
+				CreatedBy: &ValueCreatedBy{Content: createdBy}}
+		}
+	}
+}
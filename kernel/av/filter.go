@@ -28,12 +28,103 @@ type Filterable interface {
 	FilterRows(attrView *AttributeView)
 }
 
+// ViewFilter 描述了过滤条件或者过滤组。
+//
+// 视图中的过滤规则是一棵树，顶层的过滤规则之间使用 AND 连接。Conjunction 不为空时为过滤组，
+// 过滤组中的子过滤规则使用 Conjunction 连接，这样旧版本保存的平铺过滤规则不需要迁移。
 type ViewFilter struct {
 	Column        string         `json:"column"`
 	Operator      FilterOperator `json:"operator"`
 	Value         *Value         `json:"value"`
 	RelativeDate  *RelativeDate  `json:"relativeDate"`
 	RelativeDate2 *RelativeDate  `json:"relativeDate2"`
+
+	SubKeyID    string            `json:"subKeyID,omitempty"`    // 关联或汇总列指向的数据库中的列 ID，不为空时使用关联块的该列值过滤
+	Not         bool              `json:"not,omitempty"`         // 是否对过滤结果取反
+	Conjunction FilterConjunction `json:"conjunction,omitempty"` // 过滤组的连接方式
+	Filters     []*ViewFilter     `json:"filters,omitempty"`     // 过滤组的子过滤规则
+}
+
+type FilterConjunction string
+
+const (
+	FilterConjunctionAnd FilterConjunction = "and"
+	FilterConjunctionOr  FilterConjunction = "or"
+)
+
+// IsGroup 判断是否是过滤组。
+func (filter *ViewFilter) IsGroup() bool {
+	return "" != filter.Conjunction
+}
+
+// Clone 复制过滤规则，过滤组会递归复制子过滤规则。
+func (filter *ViewFilter) Clone() (ret *ViewFilter) {
+	ret = &ViewFilter{
+		Column:        filter.Column,
+		Operator:      filter.Operator,
+		Value:         filter.Value,
+		RelativeDate:  filter.RelativeDate,
+		RelativeDate2: filter.RelativeDate2,
+		SubKeyID:      filter.SubKeyID,
+		Not:           filter.Not,
+		Conjunction:   filter.Conjunction,
+	}
+	for _, f := range filter.Filters {
+		ret.Filters = append(ret.Filters, f.Clone())
+	}
+	return
+}
+
+// GetLeafFilters 获取过滤规则树中的所有过滤条件，不包含过滤组本身。
+func GetLeafFilters(filters []*ViewFilter) (ret []*ViewFilter) {
+	for _, f := range filters {
+		if f.IsGroup() {
+			ret = append(ret, GetLeafFilters(f.Filters)...)
+			continue
+		}
+		ret = append(ret, f)
+	}
+	return
+}
+
+// PruneFilters 删除过滤规则树中 keep 返回 false 的过滤条件，删除后为空的过滤组也一并删除。
+func PruneFilters(filters []*ViewFilter, keep func(filter *ViewFilter) bool) (ret []*ViewFilter) {
+	ret = []*ViewFilter{}
+	for _, f := range filters {
+		if f.IsGroup() {
+			f.Filters = PruneFilters(f.Filters, keep)
+			if 0 < len(f.Filters) {
+				ret = append(ret, f)
+			}
+			continue
+		}
+
+		if keep(f) {
+			ret = append(ret, f)
+		}
+	}
+	return
+}
+
+// NormalizeFilters 校验过滤规则树，包含子过滤规则但是没有设置连接方式的过滤组默认使用 AND 连接。
+func NormalizeFilters(filters []*ViewFilter) (err error) {
+	for _, f := range filters {
+		if "" == f.Conjunction && 0 < len(f.Filters) {
+			f.Conjunction = FilterConjunctionAnd
+		}
+
+		if !f.IsGroup() {
+			continue
+		}
+
+		if FilterConjunctionAnd != f.Conjunction && FilterConjunctionOr != f.Conjunction {
+			return ErrInvalidFilterConjunction
+		}
+		if err = NormalizeFilters(f.Filters); nil != err {
+			return
+		}
+	}
+	return
 }
 
 type RelativeDateUnit int
@@ -160,6 +251,72 @@ func (value *Value) Filter(filter *ViewFilter, attrView *AttributeView, rowID st
 	return value.filter(filter.Value, filter.RelativeDate, filter.RelativeDate2, filter.Operator)
 }
 
+// filterRelatedValues 使用关联块在目标数据库中 SubKeyID 列的值过滤，任意一个关联块满足条件即通过。
+//
+// destAvs 缓存已经解析过的目标数据库，避免每一行都重新解析。
+func filterRelatedValues(filter *ViewFilter, attrView *AttributeView, rowID string, destAvs map[string]*AttributeView) bool {
+	key, _ := attrView.GetKey(filter.Column)
+	if nil == key {
+		return false
+	}
+
+	relKeyID := key.ID
+	if KeyTypeRollup == key.Type {
+		if nil == key.Rollup {
+			return false
+		}
+		relKeyID = key.Rollup.RelationKeyID
+	} else if KeyTypeRelation != key.Type {
+		return false
+	}
+
+	relKey, _ := attrView.GetKey(relKeyID)
+	if nil == relKey || nil == relKey.Relation {
+		return false
+	}
+
+	relVal := attrView.GetValue(relKey.ID, rowID)
+	if nil == relVal || nil == relVal.Relation || 1 > len(relVal.Relation.BlockIDs) {
+		return FilterOperatorIsEmpty == filter.Operator
+	}
+
+	destAv, ok := destAvs[relKey.Relation.AvID]
+	if !ok {
+		destAv, _ = ParseAttributeView(relKey.Relation.AvID)
+		destAvs[relKey.Relation.AvID] = destAv
+	}
+	if nil == destAv {
+		return false
+	}
+
+	destKey, _ := destAv.GetKey(filter.SubKeyID)
+	if nil == destKey {
+		return false
+	}
+
+	if nil != filter.Value && destKey.Type != filter.Value.Type {
+		// 由于字段类型被用户编辑过导致和过滤器值类型不匹配，该情况下不过滤
+		return true
+	}
+
+	for _, blockID := range relVal.Relation.BlockIDs {
+		destVal := destAv.GetValue(destKey.ID, blockID)
+		if nil == destVal {
+			if destAv.ExistBlock(blockID) { // 数据库中存在行但是列值不存在是数据未初始化，这里补一个默认值
+				destVal = GetAttributeViewDefaultValue(ast.NewNodeID(), destKey.ID, blockID, destKey.Type)
+			}
+			if nil == destVal {
+				continue
+			}
+		}
+
+		if destVal.filter(filter.Value, filter.RelativeDate, filter.RelativeDate2, filter.Operator) {
+			return true
+		}
+	}
+	return false
+}
+
 func (value *Value) filter(other *Value, relativeDate, relativeDate2 *RelativeDate, operator FilterOperator) bool {
 	switch value.Type {
 	case KeyTypeBlock:
@@ -522,6 +679,35 @@ func (value *Value) filter(other *Value, relativeDate, relativeDate2 *RelativeDa
 				return !value.Checkbox.Checked
 			}
 		}
+	case KeyTypeUniqueID:
+		if nil != value.UniqueID && nil != other && nil != other.UniqueID {
+			// 唯一 ID 按照格式化后的文本过滤
+			text := &Value{Type: KeyTypeText, Text: &ValueText{Content: value.UniqueID.Content}}
+			return text.filter(&Value{Type: KeyTypeText, Text: &ValueText{Content: other.UniqueID.Content}}, relativeDate, relativeDate2, operator)
+		}
+	case KeyTypeCreatedBy:
+		if nil != value.CreatedBy && nil != other && nil != other.CreatedBy {
+			// 创建者按照名称文本过滤
+			text := &Value{Type: KeyTypeText, Text: &ValueText{Content: value.CreatedBy.Content}}
+			return text.filter(&Value{Type: KeyTypeText, Text: &ValueText{Content: other.CreatedBy.Content}}, relativeDate, relativeDate2, operator)
+		}
+	case KeyTypeFormula:
+		if nil != value.Formula && nil != value.Formula.Result {
+			// 使用公式计算结果进行过滤，过滤值为同样结果类型的值
+			result := value.Formula.Result
+			var otherResult *Value
+			if nil != other && nil != other.Formula && nil != other.Formula.Result {
+				otherResult = other.Formula.Result
+			}
+			if nil != otherResult && otherResult.Type != result.Type {
+				// 公式被用户编辑过导致结果类型和过滤器值类型不匹配，该情况下不过滤
+				return true
+			}
+			if nil == otherResult {
+				otherResult = GetAttributeViewDefaultValue("", "", "", result.Type)
+			}
+			return result.filter(otherResult, relativeDate, relativeDate2, operator)
+		}
 	}
 
 	switch operator {
@@ -673,8 +859,13 @@ func calcRelativeTimeRegion(count int, unit RelativeDateUnit, direction Relative
 }
 
 func (filter *ViewFilter) GetAffectValue(key *Key, defaultVal *Value) (ret *Value) {
+	if filter.IsGroup() || filter.Not || "" != filter.SubKeyID {
+		// 过滤组、取反和关联列子字段的过滤条件无法确定默认值
+		return nil
+	}
+
 	if nil != filter.Value {
-		if KeyTypeRelation == filter.Value.Type || KeyTypeTemplate == filter.Value.Type || KeyTypeRollup == filter.Value.Type || KeyTypeUpdated == filter.Value.Type || KeyTypeCreated == filter.Value.Type {
+		if KeyTypeRelation == filter.Value.Type || KeyTypeTemplate == filter.Value.Type || KeyTypeRollup == filter.Value.Type || KeyTypeUpdated == filter.Value.Type || KeyTypeCreated == filter.Value.Type || KeyTypeFormula == filter.Value.Type || KeyTypeUniqueID == filter.Value.Type || KeyTypeCreatedBy == filter.Value.Type {
 			// 所有生成的数据都不设置默认值
 			return nil
 		}
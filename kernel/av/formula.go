@@ -0,0 +1,1738 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 公式列使用类型化的表达式语言，例如：
+//
+//	if(prop("数量") > 0, prop("单价") * prop("数量"), 0)
+//	dateBetween(prop("截止日期"), today(), "days")
+//	concat(prop("名称"), " - ", format(prop("进度") * 100), "%")
+//
+// 通过 prop("列名") 引用同一行中其他列的值，计算结果的类型只能是数字、日期、文本或者勾选框。
+
+type ValueFormula struct {
+	Content string `json:"content"`         // 格式化后的计算结果
+	Result  *Value `json:"result"`          // 计算结果，类型为数字、日期、文本或者勾选框
+	Error   string `json:"error,omitempty"` // 解析或者计算出错时的错误信息
+}
+
+// GetResult 获取公式计算结果，结果为空时返回对应结果类型的空值。
+func (formula *ValueFormula) GetResult(resultType KeyType) *Value {
+	if nil != formula && nil != formula.Result {
+		return formula.Result
+	}
+	return GetAttributeViewDefaultValue("", "", "", resultType)
+}
+
+var (
+	ErrFormulaSyntax   = errors.New("formula syntax error")
+	ErrFormulaType     = errors.New("formula type error")
+	ErrFormulaCircular = errors.New("formula circular reference")
+)
+
+// Formula 描述了解析后的公式。
+type Formula struct {
+	ResultType KeyType // 结果类型
+
+	root formulaNode
+}
+
+// FormulaEvaluator 用于计算属性视图中所有公式列的值，每个公式仅解析一次。
+type FormulaEvaluator struct {
+	keys     map[string]*Key
+	formulas map[string]*Formula
+	errs     map[string]error
+	order    []string // 按照依赖关系排序的公式列 ID
+}
+
+// NewFormulaEvaluator 解析属性视图中所有的公式列。
+func NewFormulaEvaluator(attrView *AttributeView) (ret *FormulaEvaluator) {
+	ret = &FormulaEvaluator{keys: map[string]*Key{}, formulas: map[string]*Formula{}, errs: map[string]error{}}
+	var keys []*Key
+	for _, kv := range attrView.KeyValues {
+		keys = append(keys, kv.Key)
+		ret.keys[kv.Key.ID] = kv.Key
+	}
+
+	compiler := &formulaCompiler{keys: keys, compiled: ret.formulas, errs: ret.errs, visiting: map[string]bool{}}
+	for _, key := range keys {
+		if KeyTypeFormula != key.Type {
+			continue
+		}
+
+		compiler.compileKey(key)
+		ret.order = append(ret.order, compiler.ordered...)
+		compiler.ordered = nil
+	}
+	return
+}
+
+// GetResultType 获取公式列的结果类型，公式有误时结果类型为文本。
+func (evaluator *FormulaEvaluator) GetResultType(keyID string) KeyType {
+	if formula := evaluator.formulas[keyID]; nil != formula {
+		return formula.ResultType
+	}
+	return KeyTypeText
+}
+
+// Eval 计算一行中所有公式列的值，values 为该行各列的值（以列 ID 为键）。
+func (evaluator *FormulaEvaluator) Eval(values map[string]*Value) (ret map[string]*ValueFormula) {
+	ret = map[string]*ValueFormula{}
+	for _, keyID := range evaluator.order {
+		key := evaluator.keys[keyID]
+		formula := evaluator.formulas[keyID]
+		var result *ValueFormula
+		if err := evaluator.errs[keyID]; nil != err {
+			result = &ValueFormula{Result: GetAttributeViewDefaultValue("", "", "", KeyTypeText), Error: err.Error()}
+		} else {
+			result = formula.eval(key, values)
+		}
+		ret[keyID] = result
+
+		// 写回该行的值，后面的公式可以引用
+		val := values[keyID]
+		if nil == val {
+			val = &Value{KeyID: keyID, Type: KeyTypeFormula}
+			values[keyID] = val
+		}
+		val.Formula = result
+	}
+	return
+}
+
+// RenderTableFormulaCols 渲染表格中的公式列，rows 为各行的列值，公式可以引用其中已经渲染好的关联、汇总、创建时间和更新时间等列值。
+func RenderTableFormulaCols(attrView *AttributeView, table *Table, rows map[string][]*KeyValues) {
+	hasFormula := false
+	for _, col := range table.Columns {
+		if KeyTypeFormula == col.Type {
+			hasFormula = true
+			break
+		}
+	}
+	if !hasFormula {
+		return
+	}
+
+	evaluator := NewFormulaEvaluator(attrView)
+	for _, row := range table.Rows {
+		values := map[string]*Value{}
+		for _, kv := range rows[row.ID] {
+			if nil != kv.Key && 0 < len(kv.Values) {
+				values[kv.Key.ID] = kv.Values[0]
+			}
+		}
+		for _, cell := range row.Cells {
+			if nil != cell.Value && KeyTypeFormula != cell.ValueType {
+				values[cell.Value.KeyID] = cell.Value
+			}
+		}
+
+		results := evaluator.Eval(values)
+		for _, cell := range row.Cells {
+			if KeyTypeFormula == cell.ValueType && nil != cell.Value {
+				cell.Value.Formula = results[cell.Value.KeyID]
+			}
+		}
+	}
+}
+
+// RenderKeyValuesFormulas 渲染某一行的公式列，keyValues 中每列仅包含该行的一个值。
+func RenderKeyValuesFormulas(attrView *AttributeView, keyValues []*KeyValues) {
+	values := map[string]*Value{}
+	hasFormula := false
+	for _, kv := range keyValues {
+		if 0 < len(kv.Values) {
+			values[kv.Key.ID] = kv.Values[0]
+		}
+		if KeyTypeFormula == kv.Key.Type {
+			hasFormula = true
+		}
+	}
+	if !hasFormula {
+		return
+	}
+
+	results := NewFormulaEvaluator(attrView).Eval(values)
+	for _, kv := range keyValues {
+		if KeyTypeFormula == kv.Key.Type && 0 < len(kv.Values) {
+			kv.Values[0].Formula = results[kv.Key.ID]
+		}
+	}
+}
+
+// RenameFormulaProp 在列重命名后更新所有公式中对该列的引用。
+func (av *AttributeView) RenameFormulaProp(oldName, newName string) {
+	if oldName == newName {
+		return
+	}
+
+	for _, kv := range av.KeyValues {
+		if KeyTypeFormula != kv.Key.Type || "" == kv.Key.Formula {
+			continue
+		}
+
+		tokens, err := lexFormula(kv.Key.Formula)
+		if nil != err {
+			continue
+		}
+
+		// 从后往前替换 prop("oldName")，这样前面的位置不会变化
+		formula := kv.Key.Formula
+		for i := len(tokens) - 3; 0 <= i; i-- {
+			if formulaTokenIdent == tokens[i].kind && "prop" == tokens[i].text &&
+				formulaTokenOperator == tokens[i+1].kind && "(" == tokens[i+1].text &&
+				formulaTokenString == tokens[i+2].kind && oldName == tokens[i+2].text {
+				quoted := "\"" + strings.ReplaceAll(strings.ReplaceAll(newName, "\\", "\\\\"), "\"", "\\\"") + "\""
+				formula = formula[:tokens[i+2].pos] + quoted + formula[tokens[i+2].end:]
+			}
+		}
+		kv.Key.Formula = formula
+	}
+}
+
+// CompileFormula 解析公式并推导结果类型，keys 为公式可以引用的列。
+func CompileFormula(expr string, keys []*Key) (ret *Formula, err error) {
+	compiler := &formulaCompiler{keys: keys, compiled: map[string]*Formula{}, errs: map[string]error{}, visiting: map[string]bool{}}
+	return compiler.compile(expr)
+}
+
+func (formula *Formula) eval(key *Key, values map[string]*Value) (ret *ValueFormula) {
+	v, err := formula.root.eval(&formulaContext{values: values, now: time.Now()})
+	if nil != err {
+		ret = &ValueFormula{Result: GetAttributeViewDefaultValue("", "", "", formula.ResultType), Error: err.Error()}
+		return
+	}
+
+	result, err := v.toValue(formula.ResultType, key.NumberFormat)
+	if nil != err {
+		ret = &ValueFormula{Result: GetAttributeViewDefaultValue("", "", "", formula.ResultType), Error: err.Error()}
+		return
+	}
+	ret = &ValueFormula{Content: result.String(true), Result: result}
+	return
+}
+
+// formulaType 为公式表达式在解析阶段推导出的类型。
+type formulaType int
+
+const (
+	formulaTypeAny formulaType = iota // 运行时才能确定的类型，比如带计算的汇总列
+	formulaTypeNumber
+	formulaTypeText
+	formulaTypeDate
+	formulaTypeCheckbox
+	formulaTypeList
+)
+
+func (typ formulaType) String() string {
+	switch typ {
+	case formulaTypeNumber:
+		return "number"
+	case formulaTypeText:
+		return "text"
+	case formulaTypeDate:
+		return "date"
+	case formulaTypeCheckbox:
+		return "checkbox"
+	case formulaTypeList:
+		return "list"
+	default:
+		return "any"
+	}
+}
+
+func (typ formulaType) accepts(other formulaType) bool {
+	return formulaTypeAny == typ || formulaTypeAny == other || typ == other
+}
+
+// formulaValue 为公式表达式在计算阶段的值。
+type formulaValue struct {
+	typ       formulaType
+	empty     bool
+	num       float64
+	str       string
+	checked   bool
+	date      time.Time
+	date2     time.Time
+	hasEnd    bool
+	isNotTime bool
+	list      []*formulaValue
+}
+
+func newFormulaNumber(num float64) *formulaValue {
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return &formulaValue{typ: formulaTypeNumber, empty: true}
+	}
+	return &formulaValue{typ: formulaTypeNumber, num: num}
+}
+
+func newFormulaText(str string) *formulaValue {
+	return &formulaValue{typ: formulaTypeText, str: str, empty: "" == str}
+}
+
+func newFormulaCheckbox(checked bool) *formulaValue {
+	return &formulaValue{typ: formulaTypeCheckbox, checked: checked}
+}
+
+func newFormulaDate(t time.Time, isNotTime bool) *formulaValue {
+	return &formulaValue{typ: formulaTypeDate, date: t, isNotTime: isNotTime}
+}
+
+func newFormulaEmpty(typ formulaType) *formulaValue {
+	return &formulaValue{typ: typ, empty: true}
+}
+
+// newFormulaValue 将列值转换为公式值，typ 为该列在公式中的类型。
+func newFormulaValue(value *Value, typ formulaType) *formulaValue {
+	if nil == value {
+		return newFormulaEmpty(typ)
+	}
+
+	switch value.Type {
+	case KeyTypeNumber:
+		if nil == value.Number || !value.Number.IsNotEmpty {
+			return newFormulaEmpty(formulaTypeNumber)
+		}
+		return newFormulaNumber(value.Number.Content)
+	case KeyTypeDate:
+		if nil == value.Date || !value.Date.IsNotEmpty {
+			return newFormulaEmpty(formulaTypeDate)
+		}
+		ret := newFormulaDate(time.UnixMilli(value.Date.Content), value.Date.IsNotTime)
+		if value.Date.HasEndDate && value.Date.IsNotEmpty2 {
+			ret.hasEnd = true
+			ret.date2 = time.UnixMilli(value.Date.Content2)
+		}
+		return ret
+	case KeyTypeCreated:
+		if nil == value.Created || !value.Created.IsNotEmpty {
+			return newFormulaEmpty(formulaTypeDate)
+		}
+		return newFormulaDate(time.UnixMilli(value.Created.Content), false)
+	case KeyTypeUpdated:
+		if nil == value.Updated || !value.Updated.IsNotEmpty {
+			return newFormulaEmpty(formulaTypeDate)
+		}
+		return newFormulaDate(time.UnixMilli(value.Updated.Content), false)
+	case KeyTypeCheckbox:
+		return newFormulaCheckbox(nil != value.Checkbox && value.Checkbox.Checked)
+	case KeyTypeMSelect:
+		ret := &formulaValue{typ: formulaTypeList}
+		for _, opt := range value.MSelect {
+			ret.list = append(ret.list, newFormulaText(opt.Content))
+		}
+		ret.empty = 1 > len(ret.list)
+		return ret
+	case KeyTypeMAsset:
+		ret := &formulaValue{typ: formulaTypeList}
+		for _, asset := range value.MAsset {
+			ret.list = append(ret.list, newFormulaText(asset.Content))
+		}
+		ret.empty = 1 > len(ret.list)
+		return ret
+	case KeyTypeRelation:
+		ret := &formulaValue{typ: formulaTypeList}
+		if nil != value.Relation {
+			for _, content := range value.Relation.Contents {
+				ret.list = append(ret.list, newFormulaValue(content, formulaTypeText))
+			}
+		}
+		ret.empty = 1 > len(ret.list)
+		return ret
+	case KeyTypeRollup:
+		ret := &formulaValue{typ: formulaTypeList}
+		if nil != value.Rollup {
+			for _, content := range value.Rollup.Contents {
+				ret.list = append(ret.list, newFormulaValue(content, formulaTypeAny))
+			}
+		}
+		ret.empty = 1 > len(ret.list)
+		if formulaTypeList != typ {
+			// 设置了计算方式的汇总列只有一个计算结果
+			if 0 < len(ret.list) {
+				return ret.list[0]
+			}
+			return newFormulaEmpty(typ)
+		}
+		return ret
+	case KeyTypeFormula:
+		if nil == value.Formula || nil == value.Formula.Result || "" != value.Formula.Error {
+			return newFormulaEmpty(typ)
+		}
+		return newFormulaValue(value.Formula.Result, typ)
+	default:
+		return newFormulaText(value.String(false))
+	}
+}
+
+// toValue 将公式值转换为结果类型的列值。
+func (v *formulaValue) toValue(resultType KeyType, numberFormat NumberFormat) (ret *Value, err error) {
+	ret = &Value{Type: resultType}
+	switch resultType {
+	case KeyTypeNumber:
+		num, isEmpty, convErr := v.toNumber()
+		if nil != convErr {
+			err = convErr
+			return
+		}
+		if isEmpty {
+			ret.Number = &ValueNumber{Format: numberFormat}
+			return
+		}
+		ret.Number = NewFormattedValueNumber(num, numberFormat)
+	case KeyTypeDate:
+		if formulaTypeDate != v.typ && !v.empty {
+			err = fmt.Errorf("%w: expected date but got %s", ErrFormulaType, v.typ)
+			return
+		}
+		if v.empty {
+			ret.Date = &ValueDate{}
+			return
+		}
+		var content2 int64
+		if v.hasEnd {
+			content2 = v.date2.UnixMilli()
+		}
+		ret.Date = NewFormattedValueDate(v.date.UnixMilli(), content2, DateFormatNone, v.isNotTime, v.hasEnd)
+		ret.Date.IsNotTime = v.isNotTime
+	case KeyTypeCheckbox:
+		ret.Checkbox = &ValueCheckbox{Checked: v.toBool()}
+	default:
+		ret.Type = KeyTypeText
+		ret.Text = &ValueText{Content: v.toText()}
+	}
+	return
+}
+
+func (v *formulaValue) toNumber() (ret float64, isEmpty bool, err error) {
+	switch v.typ {
+	case formulaTypeNumber:
+		return v.num, v.empty, nil
+	case formulaTypeCheckbox:
+		if v.checked {
+			return 1, false, nil
+		}
+		return 0, false, nil
+	case formulaTypeText:
+		if v.empty {
+			return 0, true, nil
+		}
+		num, parseErr := strconv.ParseFloat(strings.TrimSpace(v.str), 64)
+		if nil != parseErr {
+			return 0, true, fmt.Errorf("%w: can not convert [%s] to number", ErrFormulaType, v.str)
+		}
+		return num, false, nil
+	case formulaTypeDate:
+		if v.empty {
+			return 0, true, nil
+		}
+		return float64(v.date.UnixMilli()), false, nil
+	case formulaTypeList:
+		if 1 == len(v.list) {
+			return v.list[0].toNumber()
+		}
+		if v.empty {
+			return 0, true, nil
+		}
+	}
+	return 0, true, fmt.Errorf("%w: can not convert %s to number", ErrFormulaType, v.typ)
+}
+
+func (v *formulaValue) toText() string {
+	if v.empty && formulaTypeCheckbox != v.typ {
+		return ""
+	}
+
+	switch v.typ {
+	case formulaTypeNumber:
+		return strconv.FormatFloat(v.num, 'f', -1, 64)
+	case formulaTypeText:
+		return v.str
+	case formulaTypeCheckbox:
+		if v.checked {
+			return "true"
+		}
+		return "false"
+	case formulaTypeDate:
+		layout := "2006-01-02 15:04"
+		if v.isNotTime {
+			layout = "2006-01-02"
+		}
+		ret := v.date.Format(layout)
+		if v.hasEnd {
+			ret += " → " + v.date2.Format(layout)
+		}
+		return ret
+	case formulaTypeList:
+		var items []string
+		for _, item := range v.list {
+			if s := item.toText(); "" != s {
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, ", ")
+	}
+	return ""
+}
+
+func (v *formulaValue) toBool() bool {
+	switch v.typ {
+	case formulaTypeCheckbox:
+		return v.checked
+	case formulaTypeNumber:
+		return !v.empty && 0 != v.num
+	default:
+		return !v.empty
+	}
+}
+
+// compare 比较两个公式值，类型不同时无法比较。
+func (v *formulaValue) compare(other *formulaValue) (ret int, err error) {
+	typ := v.typ
+	if formulaTypeNumber == typ || formulaTypeNumber == other.typ {
+		n1, _, err1 := v.toNumber()
+		n2, _, err2 := other.toNumber()
+		if nil == err1 && nil == err2 {
+			if n1 < n2 {
+				return -1, nil
+			} else if n1 > n2 {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	if typ != other.typ {
+		return 0, fmt.Errorf("%w: can not compare %s with %s", ErrFormulaType, v.typ, other.typ)
+	}
+
+	switch typ {
+	case formulaTypeDate:
+		return v.date.Compare(other.date), nil
+	case formulaTypeCheckbox:
+		if v.checked == other.checked {
+			return 0, nil
+		} else if v.checked {
+			return 1, nil
+		}
+		return -1, nil
+	default:
+		return strings.Compare(v.toText(), other.toText()), nil
+	}
+}
+
+func (v *formulaValue) equal(other *formulaValue) bool {
+	if v.empty && other.empty {
+		return true
+	}
+	if ret, err := v.compare(other); nil == err {
+		return 0 == ret
+	}
+	return v.toText() == other.toText()
+}
+
+// 以下是公式的词法分析
+
+type formulaTokenKind int
+
+const (
+	formulaTokenEOF formulaTokenKind = iota
+	formulaTokenNumber
+	formulaTokenString
+	formulaTokenIdent
+	formulaTokenOperator
+)
+
+type formulaToken struct {
+	kind formulaTokenKind
+	text string
+	pos  int // 起始位置
+	end  int // 结束位置
+}
+
+func lexFormula(expr string) (ret []*formulaToken, err error) {
+	for i := 0; i < len(expr); {
+		r, size := utf8.DecodeRuneInString(expr[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case ('0' <= r && '9' >= r) || ('.' == r && i+1 < len(expr) && '0' <= expr[i+1] && '9' >= expr[i+1]):
+			// 数字只识别 ASCII 数字，全角数字等其他数字字符不能作为数字的开头，否则下面的循环无法前进
+			start := i
+			for i < len(expr) && (('0' <= expr[i] && '9' >= expr[i]) || '.' == expr[i]) {
+				i++
+			}
+			if i < len(expr) && ('e' == expr[i] || 'E' == expr[i]) {
+				i++
+				if i < len(expr) && ('+' == expr[i] || '-' == expr[i]) {
+					i++
+				}
+				for i < len(expr) && '0' <= expr[i] && '9' >= expr[i] {
+					i++
+				}
+			}
+			ret = append(ret, &formulaToken{kind: formulaTokenNumber, text: expr[start:i], pos: start, end: i})
+		case '"' == r || '\'' == r:
+			start := i
+			i++
+			buf := strings.Builder{}
+			closed := false
+			for i < len(expr) {
+				c := expr[i]
+				if '\\' == c && i+1 < len(expr) {
+					switch expr[i+1] {
+					case 'n':
+						buf.WriteByte('\n')
+					case 't':
+						buf.WriteByte('\t')
+					default:
+						buf.WriteByte(expr[i+1])
+					}
+					i += 2
+					continue
+				}
+				if rune(c) == r {
+					closed = true
+					i++
+					break
+				}
+				buf.WriteByte(c)
+				i++
+			}
+			if !closed {
+				err = fmt.Errorf("%w: unterminated string at %d", ErrFormulaSyntax, start)
+				return
+			}
+			ret = append(ret, &formulaToken{kind: formulaTokenString, text: buf.String(), pos: start, end: i})
+		case unicode.IsLetter(r) || '_' == r:
+			start := i
+			for i < len(expr) {
+				c, s := utf8.DecodeRuneInString(expr[i:])
+				if !unicode.IsLetter(c) && !unicode.IsDigit(c) && '_' != c {
+					break
+				}
+				i += s
+			}
+			ret = append(ret, &formulaToken{kind: formulaTokenIdent, text: expr[start:i], pos: start, end: i})
+		default:
+			op := ""
+			if i+1 < len(expr) {
+				switch expr[i : i+2] {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					op = expr[i : i+2]
+				}
+			}
+			if "" == op {
+				switch r {
+				case '+', '-', '*', '/', '%', '^', '(', ')', ',', '<', '>', '!', '=':
+					op = string(r)
+				default:
+					err = fmt.Errorf("%w: unexpected character [%c] at %d", ErrFormulaSyntax, r, i)
+					return
+				}
+			}
+			size = len(op)
+			if "=" == op {
+				op = "=="
+			}
+			ret = append(ret, &formulaToken{kind: formulaTokenOperator, text: op, pos: i, end: i + size})
+			i += size
+		}
+	}
+	ret = append(ret, &formulaToken{kind: formulaTokenEOF, pos: len(expr), end: len(expr)})
+	return
+}
+
+// 以下是公式的语法分析和类型推导
+
+type formulaCompiler struct {
+	keys     []*Key
+	compiled map[string]*Formula
+	errs     map[string]error
+	visiting map[string]bool
+	ordered  []string
+
+	tokens []*formulaToken
+	pos    int
+}
+
+// compileKey 解析公式列，被引用的公式列会先被解析。
+func (compiler *formulaCompiler) compileKey(key *Key) {
+	if _, ok := compiler.compiled[key.ID]; ok {
+		return
+	}
+	if _, ok := compiler.errs[key.ID]; ok {
+		return
+	}
+
+	if compiler.visiting[key.ID] {
+		compiler.errs[key.ID] = fmt.Errorf("%w: [%s]", ErrFormulaCircular, key.Name)
+		return
+	}
+	compiler.visiting[key.ID] = true
+	defer delete(compiler.visiting, key.ID)
+
+	sub := &formulaCompiler{keys: compiler.keys, compiled: compiler.compiled, errs: compiler.errs, visiting: compiler.visiting}
+	formula, err := sub.compile(key.Formula)
+	compiler.ordered = append(compiler.ordered, sub.ordered...)
+	if _, ok := compiler.errs[key.ID]; ok {
+		// 循环引用
+		compiler.ordered = append(compiler.ordered, key.ID)
+		return
+	}
+	if nil != err {
+		compiler.errs[key.ID] = err
+	} else {
+		compiler.compiled[key.ID] = formula
+	}
+	compiler.ordered = append(compiler.ordered, key.ID)
+}
+
+func (compiler *formulaCompiler) compile(expr string) (ret *Formula, err error) {
+	if "" == strings.TrimSpace(expr) {
+		ret = &Formula{ResultType: KeyTypeText, root: &formulaLiteral{value: newFormulaText("")}}
+		return
+	}
+
+	compiler.tokens, err = lexFormula(expr)
+	if nil != err {
+		return
+	}
+
+	root, err := compiler.parseExpr(0)
+	if nil != err {
+		return
+	}
+	if tok := compiler.peek(); formulaTokenEOF != tok.kind {
+		err = fmt.Errorf("%w: unexpected [%s] at %d", ErrFormulaSyntax, tok.text, tok.pos)
+		return
+	}
+
+	ret = &Formula{root: root}
+	switch root.typ() {
+	case formulaTypeNumber:
+		ret.ResultType = KeyTypeNumber
+	case formulaTypeDate:
+		ret.ResultType = KeyTypeDate
+	case formulaTypeCheckbox:
+		ret.ResultType = KeyTypeCheckbox
+	default:
+		ret.ResultType = KeyTypeText
+	}
+	return
+}
+
+func (compiler *formulaCompiler) peek() *formulaToken {
+	return compiler.tokens[compiler.pos]
+}
+
+func (compiler *formulaCompiler) next() *formulaToken {
+	ret := compiler.tokens[compiler.pos]
+	if formulaTokenEOF != ret.kind {
+		compiler.pos++
+	}
+	return ret
+}
+
+func (compiler *formulaCompiler) expect(op string) error {
+	tok := compiler.next()
+	if formulaTokenOperator != tok.kind || op != tok.text {
+		if formulaTokenEOF == tok.kind {
+			return fmt.Errorf("%w: expected [%s] but reached the end", ErrFormulaSyntax, op)
+		}
+		return fmt.Errorf("%w: expected [%s] but got [%s] at %d", ErrFormulaSyntax, op, tok.text, tok.pos)
+	}
+	return nil
+}
+
+// binaryPrecedence 返回二元运算符的优先级，0 表示不是二元运算符。
+func binaryPrecedence(tok *formulaToken) (op string, precedence int) {
+	switch tok.kind {
+	case formulaTokenIdent:
+		switch tok.text {
+		case "or":
+			return "||", 1
+		case "and":
+			return "&&", 2
+		}
+	case formulaTokenOperator:
+		switch tok.text {
+		case "||":
+			return tok.text, 1
+		case "&&":
+			return tok.text, 2
+		case "==", "!=":
+			return tok.text, 3
+		case "<", "<=", ">", ">=":
+			return tok.text, 4
+		case "+", "-":
+			return tok.text, 5
+		case "*", "/", "%":
+			return tok.text, 6
+		case "^":
+			return tok.text, 8
+		}
+	}
+	return "", 0
+}
+
+func (compiler *formulaCompiler) parseExpr(minPrecedence int) (ret formulaNode, err error) {
+	ret, err = compiler.parseUnary()
+	if nil != err {
+		return
+	}
+
+	for {
+		op, precedence := binaryPrecedence(compiler.peek())
+		if 0 == precedence || precedence < minPrecedence {
+			return
+		}
+		compiler.next()
+
+		nextMin := precedence + 1
+		if "^" == op {
+			nextMin = precedence // 乘方为右结合
+		}
+		var right formulaNode
+		right, err = compiler.parseExpr(nextMin)
+		if nil != err {
+			return
+		}
+		ret, err = newFormulaBinary(op, ret, right)
+		if nil != err {
+			return
+		}
+	}
+}
+
+func (compiler *formulaCompiler) parseUnary() (ret formulaNode, err error) {
+	tok := compiler.peek()
+	if (formulaTokenOperator == tok.kind && ("-" == tok.text || "!" == tok.text || "+" == tok.text)) || (formulaTokenIdent == tok.kind && "not" == tok.text) {
+		compiler.next()
+		var operand formulaNode
+		operand, err = compiler.parseExpr(7)
+		if nil != err {
+			return
+		}
+
+		op := tok.text
+		if "not" == op {
+			op = "!"
+		}
+		switch op {
+		case "-", "+":
+			if !formulaTypeNumber.accepts(operand.typ()) {
+				err = fmt.Errorf("%w: operator [%s] can not be applied to %s", ErrFormulaType, op, operand.typ())
+				return
+			}
+		}
+		ret = &formulaUnary{op: op, operand: operand}
+		return
+	}
+	return compiler.parsePrimary()
+}
+
+func (compiler *formulaCompiler) parsePrimary() (ret formulaNode, err error) {
+	tok := compiler.next()
+	switch tok.kind {
+	case formulaTokenNumber:
+		num, parseErr := strconv.ParseFloat(tok.text, 64)
+		if nil != parseErr {
+			err = fmt.Errorf("%w: invalid number [%s] at %d", ErrFormulaSyntax, tok.text, tok.pos)
+			return
+		}
+		ret = &formulaLiteral{value: newFormulaNumber(num)}
+	case formulaTokenString:
+		ret = &formulaLiteral{value: newFormulaText(tok.text)}
+	case formulaTokenIdent:
+		switch tok.text {
+		case "true":
+			ret = &formulaLiteral{value: newFormulaCheckbox(true)}
+			return
+		case "false":
+			ret = &formulaLiteral{value: newFormulaCheckbox(false)}
+			return
+		}
+
+		if err = compiler.expect("("); nil != err {
+			return
+		}
+		var args []formulaNode
+		if next := compiler.peek(); formulaTokenOperator != next.kind || ")" != next.text {
+			for {
+				var arg formulaNode
+				arg, err = compiler.parseExpr(1)
+				if nil != err {
+					return
+				}
+				args = append(args, arg)
+
+				if next = compiler.peek(); formulaTokenOperator == next.kind && "," == next.text {
+					compiler.next()
+					continue
+				}
+				break
+			}
+		}
+		if err = compiler.expect(")"); nil != err {
+			return
+		}
+
+		if "prop" == tok.text {
+			ret, err = compiler.newProp(args)
+			return
+		}
+		ret, err = newFormulaCall(tok.text, args)
+	case formulaTokenOperator:
+		if "(" != tok.text {
+			err = fmt.Errorf("%w: unexpected [%s] at %d", ErrFormulaSyntax, tok.text, tok.pos)
+			return
+		}
+		ret, err = compiler.parseExpr(1)
+		if nil != err {
+			return
+		}
+		err = compiler.expect(")")
+	default:
+		err = fmt.Errorf("%w: unexpected end of formula", ErrFormulaSyntax)
+	}
+	return
+}
+
+// newProp 解析列引用 prop("列名")。
+func (compiler *formulaCompiler) newProp(args []formulaNode) (ret formulaNode, err error) {
+	if 1 != len(args) {
+		err = fmt.Errorf("%w: prop() requires 1 argument", ErrFormulaSyntax)
+		return
+	}
+	literal, ok := args[0].(*formulaLiteral)
+	if !ok || formulaTypeText != literal.value.typ {
+		err = fmt.Errorf("%w: prop() requires a field name", ErrFormulaSyntax)
+		return
+	}
+
+	name := literal.value.str
+	var key *Key
+	for _, k := range compiler.keys {
+		if k.Name == name {
+			key = k
+			break
+		}
+	}
+	if nil == key {
+		err = fmt.Errorf("%w: field [%s] not found", ErrFormulaSyntax, name)
+		return
+	}
+
+	var typ formulaType
+	switch key.Type {
+	case KeyTypeNumber, KeyTypeLineNumber:
+		typ = formulaTypeNumber
+	case KeyTypeDate, KeyTypeCreated, KeyTypeUpdated:
+		typ = formulaTypeDate
+	case KeyTypeCheckbox:
+		typ = formulaTypeCheckbox
+	case KeyTypeMSelect, KeyTypeMAsset, KeyTypeRelation:
+		typ = formulaTypeList
+	case KeyTypeRollup:
+		typ = formulaTypeList
+		if nil != key.Rollup && nil != key.Rollup.Calc {
+			switch key.Rollup.Calc.Operator {
+			case CalcOperatorNone:
+			case CalcOperatorEarliest, CalcOperatorLatest:
+				typ = formulaTypeDate
+			case CalcOperatorRange:
+				typ = formulaTypeAny
+			default:
+				typ = formulaTypeNumber
+			}
+		}
+	case KeyTypeFormula:
+		compiler.compileKey(key)
+		if circularErr, ok := compiler.errs[key.ID]; ok && errors.Is(circularErr, ErrFormulaCircular) {
+			err = circularErr
+			return
+		}
+		typ = formulaTypeText
+		if formula := compiler.compiled[key.ID]; nil != formula {
+			switch formula.ResultType {
+			case KeyTypeNumber:
+				typ = formulaTypeNumber
+			case KeyTypeDate:
+				typ = formulaTypeDate
+			case KeyTypeCheckbox:
+				typ = formulaTypeCheckbox
+			}
+		}
+	default:
+		typ = formulaTypeText
+	}
+	ret = &formulaProp{keyID: key.ID, name: name, valueType: typ}
+	return
+}
+
+// 以下是公式的语法树和计算
+
+type formulaContext struct {
+	values map[string]*Value
+	now    time.Time
+}
+
+type formulaNode interface {
+	typ() formulaType
+	eval(ctx *formulaContext) (*formulaValue, error)
+}
+
+type formulaLiteral struct {
+	value *formulaValue
+}
+
+func (n *formulaLiteral) typ() formulaType {
+	return n.value.typ
+}
+
+func (n *formulaLiteral) eval(*formulaContext) (*formulaValue, error) {
+	return n.value, nil
+}
+
+type formulaProp struct {
+	keyID     string
+	name      string
+	valueType formulaType
+}
+
+func (n *formulaProp) typ() formulaType {
+	return n.valueType
+}
+
+func (n *formulaProp) eval(ctx *formulaContext) (*formulaValue, error) {
+	value := ctx.values[n.keyID]
+	if nil != value && KeyTypeFormula == value.Type && nil != value.Formula && "" != value.Formula.Error {
+		return nil, fmt.Errorf("field [%s]: %s", n.name, value.Formula.Error)
+	}
+	return newFormulaValue(value, n.valueType), nil
+}
+
+type formulaUnary struct {
+	op      string
+	operand formulaNode
+}
+
+func (n *formulaUnary) typ() formulaType {
+	if "!" == n.op {
+		return formulaTypeCheckbox
+	}
+	return formulaTypeNumber
+}
+
+func (n *formulaUnary) eval(ctx *formulaContext) (*formulaValue, error) {
+	v, err := n.operand.eval(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	if "!" == n.op {
+		return newFormulaCheckbox(!v.toBool()), nil
+	}
+
+	num, isEmpty, err := v.toNumber()
+	if nil != err {
+		return nil, err
+	}
+	if isEmpty {
+		return newFormulaEmpty(formulaTypeNumber), nil
+	}
+	if "-" == n.op {
+		num = -num
+	}
+	return newFormulaNumber(num), nil
+}
+
+type formulaBinary struct {
+	op          string
+	left, right formulaNode
+	resultType  formulaType
+}
+
+func newFormulaBinary(op string, left, right formulaNode) (ret *formulaBinary, err error) {
+	ret = &formulaBinary{op: op, left: left, right: right}
+	lt, rt := left.typ(), right.typ()
+	switch op {
+	case "+":
+		if formulaTypeText == lt || formulaTypeText == rt {
+			ret.resultType = formulaTypeText
+		} else if formulaTypeNumber.accepts(lt) && formulaTypeNumber.accepts(rt) {
+			if formulaTypeAny == lt || formulaTypeAny == rt {
+				ret.resultType = formulaTypeAny
+			} else {
+				ret.resultType = formulaTypeNumber
+			}
+		} else {
+			err = fmt.Errorf("%w: operator [+] can not be applied to %s and %s", ErrFormulaType, lt, rt)
+		}
+	case "-", "*", "/", "%", "^":
+		if formulaTypeDate == lt && formulaTypeDate == rt && "-" == op {
+			// 两个日期相减得到相差的毫秒数
+			ret.resultType = formulaTypeNumber
+		} else if formulaTypeNumber.accepts(lt) && formulaTypeNumber.accepts(rt) {
+			ret.resultType = formulaTypeNumber
+		} else {
+			err = fmt.Errorf("%w: operator [%s] can not be applied to %s and %s", ErrFormulaType, op, lt, rt)
+		}
+	case "==", "!=":
+		ret.resultType = formulaTypeCheckbox
+	case "<", "<=", ">", ">=":
+		if !lt.accepts(rt) && !(formulaTypeNumber == lt && formulaTypeList != rt) && !(formulaTypeNumber == rt && formulaTypeList != lt) {
+			err = fmt.Errorf("%w: operator [%s] can not be applied to %s and %s", ErrFormulaType, op, lt, rt)
+		}
+		ret.resultType = formulaTypeCheckbox
+	case "&&", "||":
+		ret.resultType = formulaTypeCheckbox
+	}
+	return
+}
+
+func (n *formulaBinary) typ() formulaType {
+	return n.resultType
+}
+
+func (n *formulaBinary) eval(ctx *formulaContext) (*formulaValue, error) {
+	left, err := n.left.eval(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	// 逻辑运算短路求值
+	switch n.op {
+	case "&&":
+		if !left.toBool() {
+			return newFormulaCheckbox(false), nil
+		}
+	case "||":
+		if left.toBool() {
+			return newFormulaCheckbox(true), nil
+		}
+	}
+
+	right, err := n.right.eval(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return newFormulaCheckbox(right.toBool()), nil
+	case "==":
+		return newFormulaCheckbox(left.equal(right)), nil
+	case "!=":
+		return newFormulaCheckbox(!left.equal(right)), nil
+	case "<", "<=", ">", ">=":
+		if left.empty || right.empty {
+			return newFormulaCheckbox(false), nil
+		}
+		c, cmpErr := left.compare(right)
+		if nil != cmpErr {
+			return nil, cmpErr
+		}
+		switch n.op {
+		case "<":
+			return newFormulaCheckbox(0 > c), nil
+		case "<=":
+			return newFormulaCheckbox(0 >= c), nil
+		case ">":
+			return newFormulaCheckbox(0 < c), nil
+		default:
+			return newFormulaCheckbox(0 <= c), nil
+		}
+	case "+":
+		if formulaTypeText == left.typ || formulaTypeText == right.typ || formulaTypeText == n.resultType {
+			return newFormulaText(left.toText() + right.toText()), nil
+		}
+	case "-":
+		if formulaTypeDate == left.typ && formulaTypeDate == right.typ {
+			if left.empty || right.empty {
+				return newFormulaEmpty(formulaTypeNumber), nil
+			}
+			return newFormulaNumber(float64(left.date.Sub(right.date).Milliseconds())), nil
+		}
+	}
+
+	// 数字运算，空值视为 0，两边都为空时结果为空
+	n1, empty1, err := left.toNumber()
+	if nil != err {
+		return nil, err
+	}
+	n2, empty2, err := right.toNumber()
+	if nil != err {
+		return nil, err
+	}
+	if empty1 && empty2 {
+		return newFormulaEmpty(formulaTypeNumber), nil
+	}
+
+	switch n.op {
+	case "+":
+		return newFormulaNumber(n1 + n2), nil
+	case "-":
+		return newFormulaNumber(n1 - n2), nil
+	case "*":
+		return newFormulaNumber(n1 * n2), nil
+	case "/":
+		if 0 == n2 {
+			return newFormulaEmpty(formulaTypeNumber), nil
+		}
+		return newFormulaNumber(n1 / n2), nil
+	case "%":
+		if 0 == n2 {
+			return newFormulaEmpty(formulaTypeNumber), nil
+		}
+		return newFormulaNumber(math.Mod(n1, n2)), nil
+	case "^":
+		return newFormulaNumber(math.Pow(n1, n2)), nil
+	}
+	return nil, fmt.Errorf("%w: unknown operator [%s]", ErrFormulaSyntax, n.op)
+}
+
+type formulaIf struct {
+	cond, then, els formulaNode
+	resultType      formulaType
+}
+
+func (n *formulaIf) typ() formulaType {
+	return n.resultType
+}
+
+func (n *formulaIf) eval(ctx *formulaContext) (*formulaValue, error) {
+	cond, err := n.cond.eval(ctx)
+	if nil != err {
+		return nil, err
+	}
+	if cond.toBool() {
+		return n.then.eval(ctx)
+	}
+	return n.els.eval(ctx)
+}
+
+type formulaCall struct {
+	name string
+	fn   *formulaFunc
+	args []formulaNode
+}
+
+func (n *formulaCall) typ() formulaType {
+	return n.fn.result
+}
+
+func (n *formulaCall) eval(ctx *formulaContext) (*formulaValue, error) {
+	var args []*formulaValue
+	for _, arg := range n.args {
+		v, err := arg.eval(ctx)
+		if nil != err {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	ret, err := n.fn.call(ctx, args)
+	if nil != err {
+		return nil, fmt.Errorf("%s(): %w", n.name, err)
+	}
+	return ret, nil
+}
+
+func newFormulaCall(name string, args []formulaNode) (ret formulaNode, err error) {
+	if "if" == name {
+		if 3 != len(args) {
+			err = fmt.Errorf("%w: if() requires 3 arguments", ErrFormulaSyntax)
+			return
+		}
+
+		thenType, elseType := args[1].typ(), args[2].typ()
+		if !thenType.accepts(elseType) {
+			err = fmt.Errorf("%w: if() branches must have the same type but got %s and %s", ErrFormulaType, thenType, elseType)
+			return
+		}
+		typ := thenType
+		if formulaTypeAny == typ {
+			typ = elseType
+		}
+		ret = &formulaIf{cond: args[0], then: args[1], els: args[2], resultType: typ}
+		return
+	}
+
+	fn := formulaFuncs[name]
+	if nil == fn {
+		err = fmt.Errorf("%w: unknown function [%s]", ErrFormulaSyntax, name)
+		return
+	}
+	if len(args) < fn.minArgs || (-1 != fn.maxArgs && len(args) > fn.maxArgs) {
+		err = fmt.Errorf("%w: wrong number of arguments for %s()", ErrFormulaSyntax, name)
+		return
+	}
+	for i, arg := range args {
+		want := fn.params[min(i, len(fn.params)-1)]
+		if !want.accepts(arg.typ()) {
+			err = fmt.Errorf("%w: argument %d of %s() expects %s but got %s", ErrFormulaType, i+1, name, want, arg.typ())
+			return
+		}
+	}
+	ret = &formulaCall{name: name, fn: fn, args: args}
+	return
+}
+
+// 以下是公式的内置函数
+
+type formulaFunc struct {
+	minArgs int
+	maxArgs int           // -1 表示不限制参数个数
+	params  []formulaType // 参数类型，参数个数超过时使用最后一个参数的类型
+	result  formulaType   // 返回值类型
+	call    func(ctx *formulaContext, args []*formulaValue) (*formulaValue, error)
+}
+
+var (
+	formulaNumberParam   = []formulaType{formulaTypeNumber}
+	formulaTextParam     = []formulaType{formulaTypeText}
+	formulaDateParam     = []formulaType{formulaTypeDate}
+	formulaAnyParam      = []formulaType{formulaTypeAny}
+	formulaDateUnitParam = []formulaType{formulaTypeDate, formulaTypeNumber, formulaTypeText}
+)
+
+var formulaFuncs = map[string]*formulaFunc{
+	// 逻辑
+	"empty": {1, 1, formulaAnyParam, formulaTypeCheckbox, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaCheckbox(args[0].empty), nil
+	}},
+	"not": {1, 1, formulaAnyParam, formulaTypeCheckbox, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaCheckbox(!args[0].toBool()), nil
+	}},
+
+	// 数字
+	"abs":   {1, 1, formulaNumberParam, formulaTypeNumber, formulaMathFunc(math.Abs)},
+	"ceil":  {1, 1, formulaNumberParam, formulaTypeNumber, formulaMathFunc(math.Ceil)},
+	"floor": {1, 1, formulaNumberParam, formulaTypeNumber, formulaMathFunc(math.Floor)},
+	"sqrt":  {1, 1, formulaNumberParam, formulaTypeNumber, formulaMathFunc(math.Sqrt)},
+	"round": {1, 2, formulaNumberParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		num, isEmpty, err := args[0].toNumber()
+		if nil != err || isEmpty {
+			return newFormulaEmpty(formulaTypeNumber), err
+		}
+		precision := 0.0
+		if 1 < len(args) {
+			if precision, _, err = args[1].toNumber(); nil != err {
+				return nil, err
+			}
+		}
+		return newFormulaNumber(Round(num, int(precision))), nil
+	}},
+	"pow": {2, 2, formulaNumberParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		nums, err := formulaNumbers(args)
+		if nil != err || 2 > len(nums) {
+			return newFormulaEmpty(formulaTypeNumber), err
+		}
+		return newFormulaNumber(math.Pow(nums[0], nums[1])), nil
+	}},
+	"sum": {1, -1, formulaAnyParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		nums, err := formulaNumbers(args)
+		if nil != err || 1 > len(nums) {
+			return newFormulaEmpty(formulaTypeNumber), err
+		}
+		sum := 0.0
+		for _, num := range nums {
+			sum += num
+		}
+		return newFormulaNumber(sum), nil
+	}},
+	"average": {1, -1, formulaAnyParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		nums, err := formulaNumbers(args)
+		if nil != err || 1 > len(nums) {
+			return newFormulaEmpty(formulaTypeNumber), err
+		}
+		sum := 0.0
+		for _, num := range nums {
+			sum += num
+		}
+		return newFormulaNumber(sum / float64(len(nums))), nil
+	}},
+	"min": {1, -1, formulaAnyParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		nums, err := formulaNumbers(args)
+		if nil != err || 1 > len(nums) {
+			return newFormulaEmpty(formulaTypeNumber), err
+		}
+		ret := nums[0]
+		for _, num := range nums[1:] {
+			ret = math.Min(ret, num)
+		}
+		return newFormulaNumber(ret), nil
+	}},
+	"max": {1, -1, formulaAnyParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		nums, err := formulaNumbers(args)
+		if nil != err || 1 > len(nums) {
+			return newFormulaEmpty(formulaTypeNumber), err
+		}
+		ret := nums[0]
+		for _, num := range nums[1:] {
+			ret = math.Max(ret, num)
+		}
+		return newFormulaNumber(ret), nil
+	}},
+	"count": {1, 1, formulaAnyParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		count := 0
+		for _, item := range formulaFlatten(args) {
+			if !item.empty {
+				count++
+			}
+		}
+		return newFormulaNumber(float64(count)), nil
+	}},
+	"toNumber": {1, 1, formulaAnyParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		num, isEmpty, err := args[0].toNumber()
+		if nil != err || isEmpty {
+			return newFormulaEmpty(formulaTypeNumber), err
+		}
+		return newFormulaNumber(num), nil
+	}},
+
+	// 文本
+	"format": {1, 1, formulaAnyParam, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaText(args[0].toText()), nil
+	}},
+	"concat": {1, -1, formulaAnyParam, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		buf := strings.Builder{}
+		for _, arg := range args {
+			buf.WriteString(arg.toText())
+		}
+		return newFormulaText(buf.String()), nil
+	}},
+	"join": {2, 2, []formulaType{formulaTypeAny, formulaTypeText}, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		var items []string
+		for _, item := range formulaFlatten(args[:1]) {
+			if !item.empty {
+				items = append(items, item.toText())
+			}
+		}
+		return newFormulaText(strings.Join(items, args[1].str)), nil
+	}},
+	"length": {1, 1, formulaAnyParam, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if formulaTypeList == args[0].typ {
+			return newFormulaNumber(float64(len(args[0].list))), nil
+		}
+		return newFormulaNumber(float64(utf8.RuneCountInString(args[0].toText()))), nil
+	}},
+	"contains": {2, 2, []formulaType{formulaTypeAny, formulaTypeText}, formulaTypeCheckbox, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if formulaTypeList == args[0].typ {
+			for _, item := range args[0].list {
+				if item.toText() == args[1].str {
+					return newFormulaCheckbox(true), nil
+				}
+			}
+			return newFormulaCheckbox(false), nil
+		}
+		return newFormulaCheckbox(strings.Contains(args[0].toText(), args[1].str)), nil
+	}},
+	"startsWith": {2, 2, formulaTextParam, formulaTypeCheckbox, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaCheckbox(strings.HasPrefix(args[0].str, args[1].str)), nil
+	}},
+	"endsWith": {2, 2, formulaTextParam, formulaTypeCheckbox, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaCheckbox(strings.HasSuffix(args[0].str, args[1].str)), nil
+	}},
+	"lower": {1, 1, formulaTextParam, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaText(strings.ToLower(args[0].str)), nil
+	}},
+	"upper": {1, 1, formulaTextParam, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaText(strings.ToUpper(args[0].str)), nil
+	}},
+	"trim": {1, 1, formulaTextParam, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaText(strings.TrimSpace(args[0].str)), nil
+	}},
+	"replace": {3, 3, formulaTextParam, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return newFormulaText(strings.ReplaceAll(args[0].str, args[1].str, args[2].str)), nil
+	}},
+	"slice": {2, 3, []formulaType{formulaTypeText, formulaTypeNumber}, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		runes := []rune(args[0].str)
+		start, end := int(args[1].num), len(runes)
+		if 2 < len(args) && !args[2].empty {
+			end = int(args[2].num)
+		}
+		start, end = max(0, min(start, len(runes))), max(0, min(end, len(runes)))
+		if start >= end {
+			return newFormulaText(""), nil
+		}
+		return newFormulaText(string(runes[start:end])), nil
+	}},
+
+	// 日期
+	"now": {0, 0, formulaAnyParam, formulaTypeDate, func(ctx *formulaContext, _ []*formulaValue) (*formulaValue, error) {
+		return newFormulaDate(ctx.now, false), nil
+	}},
+	"today": {0, 0, formulaAnyParam, formulaTypeDate, func(ctx *formulaContext, _ []*formulaValue) (*formulaValue, error) {
+		y, m, d := ctx.now.Date()
+		return newFormulaDate(time.Date(y, m, d, 0, 0, 0, 0, time.Local), true), nil
+	}},
+	"dateAdd": {3, 3, formulaDateUnitParam, formulaTypeDate, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return formulaDateAdd(args[0], args[1], args[2].str, 1)
+	}},
+	"dateSubtract": {3, 3, formulaDateUnitParam, formulaTypeDate, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		return formulaDateAdd(args[0], args[1], args[2].str, -1)
+	}},
+	"dateBetween": {3, 3, []formulaType{formulaTypeDate, formulaTypeDate, formulaTypeText}, formulaTypeNumber, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if args[0].empty || args[1].empty {
+			return newFormulaEmpty(formulaTypeNumber), nil
+		}
+
+		t1, t2 := args[0].date, args[1].date
+		switch formulaDateUnit(args[2].str) {
+		case "years":
+			return newFormulaNumber(float64(monthsBetween(t1, t2) / 12)), nil
+		case "quarters":
+			return newFormulaNumber(float64(monthsBetween(t1, t2) / 3)), nil
+		case "months":
+			return newFormulaNumber(float64(monthsBetween(t1, t2))), nil
+		case "weeks":
+			return newFormulaNumber(math.Trunc(t1.Sub(t2).Hours() / 24 / 7)), nil
+		case "days":
+			return newFormulaNumber(math.Trunc(t1.Sub(t2).Hours() / 24)), nil
+		case "hours":
+			return newFormulaNumber(math.Trunc(t1.Sub(t2).Hours())), nil
+		case "minutes":
+			return newFormulaNumber(math.Trunc(t1.Sub(t2).Minutes())), nil
+		case "seconds":
+			return newFormulaNumber(math.Trunc(t1.Sub(t2).Seconds())), nil
+		}
+		return nil, fmt.Errorf("%w: unknown date unit [%s]", ErrFormulaSyntax, args[2].str)
+	}},
+	"formatDate": {1, 2, []formulaType{formulaTypeDate, formulaTypeText}, formulaTypeText, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if args[0].empty {
+			return newFormulaText(""), nil
+		}
+		if 2 > len(args) || args[1].empty {
+			return newFormulaText(args[0].toText()), nil
+		}
+		return newFormulaText(args[0].date.Format(formulaDateLayout(args[1].str))), nil
+	}},
+	"parseDate": {1, 1, formulaTextParam, formulaTypeDate, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if args[0].empty {
+			return newFormulaEmpty(formulaTypeDate), nil
+		}
+		for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05Z07:00", "20060102150405"} {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(args[0].str), time.Local); nil == err {
+				return newFormulaDate(t, false), nil
+			}
+		}
+		for _, layout := range []string{"2006-01-02", "2006/01/02", "20060102"} {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(args[0].str), time.Local); nil == err {
+				return newFormulaDate(t, true), nil
+			}
+		}
+		return nil, fmt.Errorf("%w: can not parse [%s] as date", ErrFormulaType, args[0].str)
+	}},
+	"start": {1, 1, formulaDateParam, formulaTypeDate, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if args[0].empty {
+			return newFormulaEmpty(formulaTypeDate), nil
+		}
+		return newFormulaDate(args[0].date, args[0].isNotTime), nil
+	}},
+	"end": {1, 1, formulaDateParam, formulaTypeDate, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if args[0].empty {
+			return newFormulaEmpty(formulaTypeDate), nil
+		}
+		if args[0].hasEnd {
+			return newFormulaDate(args[0].date2, args[0].isNotTime), nil
+		}
+		return newFormulaDate(args[0].date, args[0].isNotTime), nil
+	}},
+	"year":   {1, 1, formulaDateParam, formulaTypeNumber, formulaDatePartFunc(func(t time.Time) int { return t.Year() })},
+	"month":  {1, 1, formulaDateParam, formulaTypeNumber, formulaDatePartFunc(func(t time.Time) int { return int(t.Month()) })},
+	"day":    {1, 1, formulaDateParam, formulaTypeNumber, formulaDatePartFunc(func(t time.Time) int { return t.Day() })},
+	"hour":   {1, 1, formulaDateParam, formulaTypeNumber, formulaDatePartFunc(func(t time.Time) int { return t.Hour() })},
+	"minute": {1, 1, formulaDateParam, formulaTypeNumber, formulaDatePartFunc(func(t time.Time) int { return t.Minute() })},
+	"weekday": {1, 1, formulaDateParam, formulaTypeNumber, formulaDatePartFunc(func(t time.Time) int {
+		// 周一为 1，周日为 7
+		if time.Sunday == t.Weekday() {
+			return 7
+		}
+		return int(t.Weekday())
+	})},
+	"timestamp": {1, 1, formulaDateParam, formulaTypeNumber, formulaDatePartFunc(func(t time.Time) int { return int(t.UnixMilli()) })},
+	"fromTimestamp": {1, 1, formulaNumberParam, formulaTypeDate, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if args[0].empty {
+			return newFormulaEmpty(formulaTypeDate), nil
+		}
+		return newFormulaDate(time.UnixMilli(int64(args[0].num)), false), nil
+	}},
+
+	// 列表
+	"first": {1, 1, formulaAnyParam, formulaTypeAny, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if formulaTypeList != args[0].typ {
+			return args[0], nil
+		}
+		if 1 > len(args[0].list) {
+			return newFormulaEmpty(formulaTypeText), nil
+		}
+		return args[0].list[0], nil
+	}},
+	"last": {1, 1, formulaAnyParam, formulaTypeAny, func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if formulaTypeList != args[0].typ {
+			return args[0], nil
+		}
+		if 1 > len(args[0].list) {
+			return newFormulaEmpty(formulaTypeText), nil
+		}
+		return args[0].list[len(args[0].list)-1], nil
+	}},
+}
+
+func formulaMathFunc(fn func(float64) float64) func(*formulaContext, []*formulaValue) (*formulaValue, error) {
+	return func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		num, isEmpty, err := args[0].toNumber()
+		if nil != err || isEmpty {
+			return newFormulaEmpty(formulaTypeNumber), err
+		}
+		return newFormulaNumber(fn(num)), nil
+	}
+}
+
+func formulaDatePartFunc(fn func(time.Time) int) func(*formulaContext, []*formulaValue) (*formulaValue, error) {
+	return func(_ *formulaContext, args []*formulaValue) (*formulaValue, error) {
+		if args[0].empty {
+			return newFormulaEmpty(formulaTypeNumber), nil
+		}
+		return newFormulaNumber(float64(fn(args[0].date))), nil
+	}
+}
+
+// formulaFlatten 展开参数中的列表。
+func formulaFlatten(args []*formulaValue) (ret []*formulaValue) {
+	for _, arg := range args {
+		if formulaTypeList == arg.typ {
+			ret = append(ret, formulaFlatten(arg.list)...)
+			continue
+		}
+		ret = append(ret, arg)
+	}
+	return
+}
+
+// formulaNumbers 将参数（包括列表中的元素）转换为数字，忽略空值。
+func formulaNumbers(args []*formulaValue) (ret []float64, err error) {
+	for _, item := range formulaFlatten(args) {
+		num, isEmpty, convErr := item.toNumber()
+		if nil != convErr {
+			err = convErr
+			return
+		}
+		if !isEmpty {
+			ret = append(ret, num)
+		}
+	}
+	return
+}
+
+func formulaDateUnit(unit string) string {
+	switch strings.TrimSpace(unit) {
+	case "years", "year", "y":
+		return "years"
+	case "quarters", "quarter", "Q":
+		return "quarters"
+	case "months", "month", "M":
+		return "months"
+	case "weeks", "week", "w":
+		return "weeks"
+	case "days", "day", "d":
+		return "days"
+	case "hours", "hour", "h":
+		return "hours"
+	case "minutes", "minute", "m":
+		return "minutes"
+	case "seconds", "second", "s":
+		return "seconds"
+	}
+	return ""
+}
+
+func formulaDateAdd(date, amount *formulaValue, unit string, sign int) (*formulaValue, error) {
+	if date.empty {
+		return newFormulaEmpty(formulaTypeDate), nil
+	}
+
+	n := int(amount.num) * sign
+	t := date.date
+	switch formulaDateUnit(unit) {
+	case "years":
+		t = t.AddDate(n, 0, 0)
+	case "quarters":
+		t = t.AddDate(0, n*3, 0)
+	case "months":
+		t = t.AddDate(0, n, 0)
+	case "weeks":
+		t = t.AddDate(0, 0, n*7)
+	case "days":
+		t = t.AddDate(0, 0, n)
+	case "hours":
+		t = t.Add(time.Duration(n) * time.Hour)
+	case "minutes":
+		t = t.Add(time.Duration(n) * time.Minute)
+	case "seconds":
+		t = t.Add(time.Duration(n) * time.Second)
+	default:
+		return nil, fmt.Errorf("%w: unknown date unit [%s]", ErrFormulaSyntax, unit)
+	}
+
+	isNotTime := date.isNotTime
+	switch formulaDateUnit(unit) {
+	case "hours", "minutes", "seconds":
+		isNotTime = false
+	}
+	return newFormulaDate(t, isNotTime), nil
+}
+
+// monthsBetween 计算两个时间之间相差的整月数。
+func monthsBetween(t1, t2 time.Time) int {
+	sign := 1
+	if t1.Before(t2) {
+		t1, t2 = t2, t1
+		sign = -1
+	}
+
+	months := (t1.Year()-t2.Year())*12 + int(t1.Month()-t2.Month())
+	if t2.AddDate(0, months, 0).After(t1) {
+		months--
+	}
+	return sign * months
+}
+
+var formulaDateLayoutReplacer = strings.NewReplacer(
+	"YYYY", "2006", "MMMM", "January", "dddd", "Monday", "MMM", "Jan", "ddd", "Mon",
+	"YY", "06", "MM", "01", "DD", "02", "HH", "15", "hh", "03", "mm", "04", "ss", "05",
+	"M", "1", "D", "2", "A", "PM",
+)
+
+// formulaDateLayout 将 YYYY-MM-DD HH:mm 形式的日期格式转换为 Go 的时间格式。
+func formulaDateLayout(layout string) string {
+	return formulaDateLayoutReplacer.Replace(layout)
+}
@@ -0,0 +1,160 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLexFormula(t *testing.T) {
+	cases := []struct {
+		expr  string
+		texts []string
+		err   error
+	}{
+		{"1 + 2.5", []string{"1", "+", "2.5", ""}, nil},
+		{".5*1e3", []string{".5", "*", "1e3", ""}, nil},
+		{"prop(\"名称\") = 'a\\'b'", []string{"prop", "(", "名称", ")", "==", "a'b", ""}, nil},
+		{"a1_b >= 2 && !x", []string{"a1_b", ">=", "2", "&&", "!", "x", ""}, nil},
+		{"\"abc", nil, ErrFormulaSyntax},
+		{"1 # 2", nil, ErrFormulaSyntax},
+		// 全角数字不能作为数字开头，之前会在这里死循环
+		{"１", nil, ErrFormulaSyntax},
+		{"1 + ١", nil, ErrFormulaSyntax},
+	}
+
+	for _, c := range cases {
+		done := make(chan struct{})
+		var tokens []*formulaToken
+		var err error
+		go func() {
+			tokens, err = lexFormula(c.expr)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("lex [%s] timeout", c.expr)
+		}
+
+		if nil != c.err {
+			if !errors.Is(err, c.err) {
+				t.Errorf("lex [%s] expected error [%v] but got [%v]", c.expr, c.err, err)
+			}
+			continue
+		}
+		if nil != err {
+			t.Errorf("lex [%s] failed: %s", c.expr, err)
+			continue
+		}
+		if len(c.texts) != len(tokens) {
+			t.Errorf("lex [%s] expected %d tokens but got %d", c.expr, len(c.texts), len(tokens))
+			continue
+		}
+		for i, tok := range tokens {
+			if c.texts[i] != tok.text {
+				t.Errorf("lex [%s] token %d expected [%s] but got [%s]", c.expr, i, c.texts[i], tok.text)
+			}
+		}
+	}
+}
+
+func TestFormulaEval(t *testing.T) {
+	price := NewKey("20240101000000-price00", "Price", "", KeyTypeNumber)
+	name := NewKey("20240101000000-name000", "Name", "", KeyTypeText)
+	done := NewKey("20240101000000-done000", "Done", "", KeyTypeCheckbox)
+	total := NewKey("20240101000000-total00", "Total", "", KeyTypeFormula)
+	total.Formula = "prop(\"Price\") * 2"
+	keys := []*Key{price, name, done, total}
+
+	values := map[string]*Value{
+		price.ID: {Type: KeyTypeNumber, Number: &ValueNumber{Content: 21, IsNotEmpty: true}},
+		name.ID:  {Type: KeyTypeText, Text: &ValueText{Content: " SiYuan "}},
+		done.ID:  {Type: KeyTypeCheckbox, Checkbox: &ValueCheckbox{Checked: true}},
+		total.ID: {Type: KeyTypeFormula, Formula: &ValueFormula{Result: &Value{Type: KeyTypeNumber, Number: &ValueNumber{Content: 42, IsNotEmpty: true}}}},
+	}
+
+	cases := []struct {
+		expr       string
+		resultType KeyType
+		content    string
+	}{
+		{"1 + 2 * 3", KeyTypeNumber, "7"},
+		{"2 ^ 3 ^ 2", KeyTypeNumber, "512"},
+		{"prop(\"Price\") + 1", KeyTypeNumber, "22"},
+		{"prop(\"Total\") - prop(\"Price\")", KeyTypeNumber, "21"},
+		{"upper(trim(prop(\"Name\")))", KeyTypeText, "SIYUAN"},
+		{"\"a\" + 1", KeyTypeText, "a1"},
+		{"if(prop(\"Done\"), \"yes\", \"no\")", KeyTypeText, "yes"},
+		{"prop(\"Price\") > 20 && not(prop(\"Done\"))", KeyTypeCheckbox, "false"},
+		{"", KeyTypeText, ""},
+	}
+
+	for _, c := range cases {
+		formula, err := CompileFormula(c.expr, keys)
+		if nil != err {
+			t.Errorf("compile [%s] failed: %s", c.expr, err)
+			continue
+		}
+		if c.resultType != formula.ResultType {
+			t.Errorf("compile [%s] expected result type [%s] but got [%s]", c.expr, c.resultType, formula.ResultType)
+			continue
+		}
+		ret := formula.eval(total, values)
+		if "" != ret.Error {
+			t.Errorf("eval [%s] failed: %s", c.expr, ret.Error)
+			continue
+		}
+		content := ret.Content
+		if KeyTypeCheckbox == c.resultType {
+			content = strconv.FormatBool(ret.Result.Checkbox.Checked)
+		}
+		if c.content != content {
+			t.Errorf("eval [%s] expected [%s] but got [%s]", c.expr, c.content, content)
+		}
+	}
+}
+
+func TestCompileFormulaErrors(t *testing.T) {
+	a := NewKey("20240101000000-aaaaaaa", "A", "", KeyTypeFormula)
+	b := NewKey("20240101000000-bbbbbbb", "B", "", KeyTypeFormula)
+	a.Formula = "prop(\"B\") + 1"
+	b.Formula = "prop(\"A\") + 1"
+	num := NewKey("20240101000000-nnnnnnn", "N", "", KeyTypeNumber)
+	keys := []*Key{a, b, num}
+
+	cases := []struct {
+		expr string
+		err  error
+	}{
+		{"1 +", ErrFormulaSyntax},
+		{"prop(\"Missing\")", ErrFormulaSyntax},
+		{"unknown(1)", ErrFormulaSyntax},
+		{"abs(\"x\")", ErrFormulaType},
+		{"if(true, 1, \"x\")", ErrFormulaType},
+		{"prop(\"A\")", ErrFormulaCircular},
+		{"１ + 1", ErrFormulaSyntax},
+	}
+	for _, c := range cases {
+		if _, err := CompileFormula(c.expr, keys); !errors.Is(err, c.err) {
+			t.Errorf("compile [%s] expected error [%v] but got [%v]", c.expr, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ViewGroup 描述了视图分组的设置。
+type ViewGroup struct {
+	Field     string            `json:"field"`     // 分组列 ID
+	Method    GroupMethod       `json:"method"`    // 分组方式
+	Order     SortOrder         `json:"order"`     // 分组排序，为空时使用手动排序
+	HideEmpty bool              `json:"hideEmpty"` // 是否隐藏空白分组
+	Groups    []*ViewGroupState `json:"groups"`    // 分组的顺序、折叠和隐藏状态
+}
+
+type ViewGroupState struct {
+	ID     string `json:"id"`     // 分组 ID
+	Folded bool   `json:"folded"` // 是否折叠
+	Hidden bool   `json:"hidden"` // 是否隐藏
+}
+
+type GroupMethod string
+
+const (
+	GroupMethodValue GroupMethod = "value" // 按值分组
+	GroupMethodDay   GroupMethod = "day"   // 日期按天分组
+	GroupMethodWeek  GroupMethod = "week"  // 日期按周分组
+	GroupMethodMonth GroupMethod = "month" // 日期按月分组
+	GroupMethodYear  GroupMethod = "year"  // 日期按年分组
+)
+
+const (
+	GroupNone      = ""          // 空白分组
+	GroupChecked   = "checked"   // 复选框列已勾选的分组
+	GroupUnchecked = "unchecked" // 复选框列未勾选的分组
+)
+
+// IsGroupKeyType 判断列类型是否可以作为分组列，主键和序号列每行都不同，没有分组的意义。
+func IsGroupKeyType(typ KeyType) bool {
+	return KeyTypeBlock != typ && KeyTypeLineNumber != typ
+}
+
+// IsDateGroupKeyType 判断列类型是否可以按日期分组。
+func IsDateGroupKeyType(typ KeyType) bool {
+	return KeyTypeDate == typ || KeyTypeCreated == typ || KeyTypeUpdated == typ
+}
+
+// GetDefaultGroupMethod 获取列类型默认的分组方式。
+func GetDefaultGroupMethod(typ KeyType) GroupMethod {
+	if IsDateGroupKeyType(typ) {
+		return GroupMethodDay
+	}
+	return GroupMethodValue
+}
+
+// IsValidGroupMethod 判断分组方式是否适用于列类型。
+func IsValidGroupMethod(typ KeyType, method GroupMethod) bool {
+	switch method {
+	case GroupMethodValue:
+		return !IsDateGroupKeyType(typ)
+	case GroupMethodDay, GroupMethodWeek, GroupMethodMonth, GroupMethodYear:
+		return IsDateGroupKeyType(typ)
+	}
+	return false
+}
+
+func (group *ViewGroup) GetState(groupID string) (ret *ViewGroupState) {
+	for _, state := range group.Groups {
+		if state.ID == groupID {
+			ret = state
+			return
+		}
+	}
+	return
+}
+
+// GetOrAddState 获取分组状态，如果不存在则添加到末尾。
+func (group *ViewGroup) GetOrAddState(groupID string) (ret *ViewGroupState) {
+	if ret = group.GetState(groupID); nil != ret {
+		return
+	}
+
+	ret = &ViewGroupState{ID: groupID}
+	group.Groups = append(group.Groups, ret)
+	return
+}
+
+// RemoveState 删除分组状态。
+func (group *ViewGroup) RemoveState(groupID string) {
+	for i, state := range group.Groups {
+		if state.ID == groupID {
+			group.Groups = append(group.Groups[:i], group.Groups[i+1:]...)
+			return
+		}
+	}
+}
+
+// TableGroup 描述了表格分组实例的结构。
+type TableGroup struct {
+	ID       string                 `json:"id"`       // 分组 ID
+	Name     string                 `json:"name"`     // 分组名称
+	Color    string                 `json:"color"`    // 分组颜色
+	Folded   bool                   `json:"folded"`   // 是否折叠
+	Hidden   bool                   `json:"hidden"`   // 是否隐藏
+	Rows     []*TableRow            `json:"rows"`     // 分组行
+	RowCount int                    `json:"rowCount"` // 分组总行数
+	Calcs    map[string]*ColumnCalc `json:"calcs"`    // 分组列计算结果，键为列 ID
+
+	sortKey *Value // 分组排序使用的值
+}
+
+// GroupRows 将过滤和排序后的行按照分组列分配到分组中，并计算每个分组的列计算结果。
+//
+// 多选列和关联列的行会出现在其包含的每个值对应的分组中。
+func (table *Table) GroupRows(group *ViewGroup) {
+	table.Groups = nil
+	table.Group = nil
+	if nil == group || "" == group.Field {
+		return
+	}
+
+	fieldIndex := -1
+	for i, col := range table.Columns {
+		if col.ID == group.Field {
+			fieldIndex = i
+			break
+		}
+	}
+	if -1 == fieldIndex {
+		return
+	}
+	table.Group = group
+
+	field := table.Columns[fieldIndex]
+	method := group.Method
+	if !IsValidGroupMethod(field.Type, method) {
+		method = GetDefaultGroupMethod(field.Type)
+	}
+
+	groups := map[string]*TableGroup{}
+	var naturalGroups []*TableGroup
+	addRow := func(groupID, name, color string, sortKey *Value, row *TableRow) {
+		g := groups[groupID]
+		if nil == g {
+			g = &TableGroup{ID: groupID, Name: name, Color: color, Rows: []*TableRow{}, sortKey: sortKey}
+			groups[groupID] = g
+			naturalGroups = append(naturalGroups, g)
+		}
+		g.Rows = append(g.Rows, row)
+	}
+
+	// 单选和多选按照选项顺序排列分组
+	if KeyTypeSelect == field.Type || KeyTypeMSelect == field.Type {
+		for i, opt := range field.Options {
+			g := &TableGroup{ID: opt.Name, Name: opt.Name, Color: opt.Color, Rows: []*TableRow{}, sortKey: &Value{Type: KeyTypeNumber, Number: NewFormattedValueNumber(float64(i), NumberFormatNone)}}
+			groups[g.ID] = g
+			naturalGroups = append(naturalGroups, g)
+		}
+	}
+	if KeyTypeCheckbox == field.Type {
+		for i, id := range []string{GroupUnchecked, GroupChecked} {
+			g := &TableGroup{ID: id, Name: id, Rows: []*TableRow{}, sortKey: &Value{Type: KeyTypeNumber, Number: NewFormattedValueNumber(float64(i), NumberFormatNone)}}
+			groups[g.ID] = g
+			naturalGroups = append(naturalGroups, g)
+		}
+	}
+
+	for _, row := range table.Rows {
+		value := row.Cells[fieldIndex].Value
+		if nil == value || (value.IsEmpty() && KeyTypeCheckbox != value.Type) {
+			addRow(GroupNone, "", "", nil, row)
+			continue
+		}
+
+		switch value.Type {
+		case KeyTypeSelect, KeyTypeMSelect:
+			for _, opt := range value.MSelect {
+				addRow(opt.Content, opt.Content, opt.Color, &Value{Type: KeyTypeNumber, Number: NewFormattedValueNumber(float64(len(field.Options)), NumberFormatNone)}, row)
+			}
+		case KeyTypeCheckbox:
+			if nil != value.Checkbox && value.Checkbox.Checked {
+				addRow(GroupChecked, GroupChecked, "", nil, row)
+			} else {
+				addRow(GroupUnchecked, GroupUnchecked, "", nil, row)
+			}
+		case KeyTypeRelation:
+			added := map[string]bool{}
+			for _, content := range value.Relation.Contents {
+				if nil == content || added[content.BlockID] {
+					continue
+				}
+				added[content.BlockID] = true
+
+				name := content.String(true)
+				addRow(content.BlockID, name, "", &Value{Type: KeyTypeText, Text: &ValueText{Content: name}}, row)
+			}
+		case KeyTypeDate, KeyTypeCreated, KeyTypeUpdated:
+			var mills int64
+			switch value.Type {
+			case KeyTypeDate:
+				mills = value.Date.Content
+			case KeyTypeCreated:
+				mills = value.Created.Content
+			case KeyTypeUpdated:
+				mills = value.Updated.Content
+			}
+			start := getDateGroupStart(time.UnixMilli(mills), method)
+			groupID := start.Format("2006-01-02")
+			switch method {
+			case GroupMethodMonth:
+				groupID = start.Format("2006-01")
+			case GroupMethodYear:
+				groupID = start.Format("2006")
+			}
+			addRow(groupID, groupID, "", &Value{Type: KeyTypeDate, Date: &ValueDate{Content: start.UnixMilli(), IsNotEmpty: true}}, row)
+		default:
+			content := value.String(true)
+			addRow(content, content, "", value, row)
+		}
+	}
+
+	// 空白分组放在最后
+	if g := groups[GroupNone]; nil != g {
+		for i, ng := range naturalGroups {
+			if ng == g {
+				naturalGroups = append(append(naturalGroups[:i:i], naturalGroups[i+1:]...), g)
+				break
+			}
+		}
+	}
+
+	switch group.Order {
+	case SortOrderAsc, SortOrderDesc:
+		sort.SliceStable(naturalGroups, func(i, j int) bool {
+			gi, gj := naturalGroups[i], naturalGroups[j]
+			if GroupNone == gi.ID || GroupNone == gj.ID {
+				return GroupNone == gj.ID && GroupNone != gi.ID
+			}
+
+			result := compareGroupSortKey(gi, gj)
+			if SortOrderDesc == group.Order {
+				return 0 < result
+			}
+			return 0 > result
+		})
+	default:
+		if !isNaturalGroupOrder(field.Type) {
+			sort.SliceStable(naturalGroups, func(i, j int) bool {
+				gi, gj := naturalGroups[i], naturalGroups[j]
+				if GroupNone == gi.ID || GroupNone == gj.ID {
+					return GroupNone == gj.ID && GroupNone != gi.ID
+				}
+				return 0 > compareGroupSortKey(gi, gj)
+			})
+		}
+
+		// 手动排序，根据保存的分组顺序重排
+		stateIndexes := map[string]int{}
+		for i, state := range group.Groups {
+			stateIndexes[state.ID] = i
+		}
+		var sortedGroups, unsortedGroups []*TableGroup
+		for _, g := range naturalGroups {
+			if _, ok := stateIndexes[g.ID]; ok {
+				sortedGroups = append(sortedGroups, g)
+			} else {
+				unsortedGroups = append(unsortedGroups, g)
+			}
+		}
+		sort.SliceStable(sortedGroups, func(i, j int) bool {
+			return stateIndexes[sortedGroups[i].ID] < stateIndexes[sortedGroups[j].ID]
+		})
+		naturalGroups = append(sortedGroups, unsortedGroups...)
+	}
+
+	table.Groups = []*TableGroup{}
+	for _, g := range naturalGroups {
+		if GroupNone == g.ID && (group.HideEmpty || 1 > len(g.Rows)) {
+			continue
+		}
+
+		if state := group.GetState(g.ID); nil != state {
+			g.Folded = state.Folded
+			g.Hidden = state.Hidden
+		}
+		g.RowCount = len(g.Rows)
+		g.Calcs = table.calcGroupCols(g.Rows)
+		table.Groups = append(table.Groups, g)
+	}
+}
+
+// PaginateGroupRows 按照分组展开后的行进行分页，start 和 end 是展开后行的位置，隐藏的分组不参与分页。
+//
+// 分页后表格的行为当前页所有分组中的行，多选列和关联列分组中重复出现的行只保留一次。
+func (table *Table) PaginateGroupRows(start, end int) {
+	table.Rows = []*TableRow{}
+	added := map[string]bool{}
+	offset := 0
+	for _, g := range table.Groups {
+		if g.Hidden {
+			g.Rows = []*TableRow{}
+			continue
+		}
+
+		count := len(g.Rows)
+		g.Rows = g.Rows[min(max(start-offset, 0), count):min(max(end-offset, 0), count)]
+		offset += count
+		for _, row := range g.Rows {
+			if !added[row.ID] {
+				added[row.ID] = true
+				table.Rows = append(table.Rows, row)
+			}
+		}
+	}
+}
+
+// GroupedRowCount 返回分组展开后可见的行数，用于分组后的分页。
+func (table *Table) GroupedRowCount() (ret int) {
+	for _, g := range table.Groups {
+		if !g.Hidden {
+			ret += len(g.Rows)
+		}
+	}
+	return
+}
+
+// calcGroupCols 使用表格列的计算方式计算分组中的行。
+func (table *Table) calcGroupCols(rows []*TableRow) (ret map[string]*ColumnCalc) {
+	ret = map[string]*ColumnCalc{}
+	groupTable := &Table{Rows: rows}
+	for _, col := range table.Columns {
+		groupCol := *col
+		if nil != col.Calc {
+			groupCol.Calc = &ColumnCalc{Operator: col.Calc.Operator}
+		}
+		groupTable.Columns = append(groupTable.Columns, &groupCol)
+	}
+	groupTable.CalcCols()
+
+	for _, col := range groupTable.Columns {
+		if nil != col.Calc && CalcOperatorNone != col.Calc.Operator {
+			ret[col.ID] = col.Calc
+		}
+	}
+	return
+}
+
+// isNaturalGroupOrder 判断分组是否已经按照列本身的顺序排列，比如单选列的选项顺序。
+func isNaturalGroupOrder(typ KeyType) bool {
+	return KeyTypeSelect == typ || KeyTypeMSelect == typ || KeyTypeCheckbox == typ
+}
+
+func compareGroupSortKey(g1, g2 *TableGroup) int {
+	if nil != g1.sortKey && nil != g2.sortKey && g1.sortKey.Type == g2.sortKey.Type {
+		if result := g1.sortKey.Compare(g2.sortKey, nil); 0 != result {
+			return result
+		}
+	}
+	return strings.Compare(g1.Name, g2.Name)
+}
+
+// getDateGroupStart 获取时间所在分组的开始时间。
+func getDateGroupStart(t time.Time, method GroupMethod) time.Time {
+	year, month, day := t.Date()
+	switch method {
+	case GroupMethodWeek:
+		// 每周从周一开始
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case GroupMethodMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	case GroupMethodYear:
+		return time.Date(year, 1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
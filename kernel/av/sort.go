@@ -296,6 +296,28 @@ func (value *Value) Compare(other *Value, attrView *AttributeView) int {
 			oContent := strings.TrimSpace(oContentBuf.String())
 			return strings.Compare(vContent, oContent)
 		}
+	case KeyTypeFormula:
+		if nil != value.Formula && nil != other.Formula && nil != value.Formula.Result && nil != other.Formula.Result {
+			// 按照公式计算结果的类型比较
+			if value.Formula.Result.Type == other.Formula.Result.Type {
+				return value.Formula.Result.Compare(other.Formula.Result, attrView)
+			}
+			return strings.Compare(value.Formula.Result.String(false), other.Formula.Result.String(false))
+		}
+	case KeyTypeUniqueID:
+		if nil != value.UniqueID && nil != other.UniqueID {
+			if value.UniqueID.Number == other.UniqueID.Number {
+				return 0
+			}
+			if value.UniqueID.Number > other.UniqueID.Number {
+				return 1
+			}
+			return -1
+		}
+	case KeyTypeCreatedBy:
+		if nil != value.CreatedBy && nil != other.CreatedBy {
+			return strings.Compare(value.CreatedBy.Content, other.CreatedBy.Content)
+		}
 	}
 	return 0
 }
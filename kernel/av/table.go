@@ -91,6 +91,8 @@ type Table struct {
 	Rows             []*TableRow    `json:"rows"`             // 表格行
 	RowCount         int            `json:"rowCount"`         // 表格总行数
 	PageSize         int            `json:"pageSize"`         // 每页行数
+	Group            *ViewGroup     `json:"group,omitempty"`  // 分组设置
+	Groups           []*TableGroup  `json:"groups,omitempty"` // 分组
 }
 
 type TableColumn struct {
@@ -109,6 +111,7 @@ type TableColumn struct {
 	Options      []*SelectOption `json:"options,omitempty"`  // 选项列表
 	NumberFormat NumberFormat    `json:"numberFormat"`       // 数字列格式化
 	Template     string          `json:"template"`           // 模板列内容
+	Formula      string          `json:"formula,omitempty"`  // 公式列内容
 	Relation     *Relation       `json:"relation,omitempty"` // 关联列
 	Rollup       *Rollup         `json:"rollup,omitempty"`   // 汇总列
 	Date         *Date           `json:"date,omitempty"`     // 日期设置
@@ -273,46 +276,85 @@ func (table *Table) FilterRows(attrView *AttributeView) {
 		return
 	}
 
-	var colIndexes []int
-	for _, f := range table.Filters {
-		for i, c := range table.Columns {
-			if c.ID == f.Column {
-				colIndexes = append(colIndexes, i)
-				break
-			}
-		}
+	colIndexes := map[string]int{}
+	for i, c := range table.Columns {
+		colIndexes[c.ID] = i
 	}
 
+	// 关联列的目标数据库在一次过滤中只解析一次
+	destAvs := map[string]*AttributeView{}
 	rows := []*TableRow{}
 	for _, row := range table.Rows {
-		pass := true
-		for j, index := range colIndexes {
-			operator := table.Filters[j].Operator
-
-			if nil == row.Cells[index].Value {
-				if FilterOperatorIsNotEmpty == operator {
-					pass = false
-				} else if FilterOperatorIsEmpty == operator {
-					pass = true
-					break
-				}
+		// 顶层的过滤规则之间使用 AND 连接
+		if pass, _ := filterRow(row, table.Filters, FilterConjunctionAnd, colIndexes, attrView, destAvs); pass {
+			rows = append(rows, row)
+		}
+	}
+	table.Rows = rows
+}
 
-				if KeyTypeText != row.Cells[index].ValueType {
-					pass = false
-				}
-				break
-			}
+// filterRow 使用 conjunction 连接过滤规则判断行是否通过过滤，applied 为 false 时说明没有可用的过滤规则。
+func filterRow(row *TableRow, filters []*ViewFilter, conjunction FilterConjunction, colIndexes map[string]int, attrView *AttributeView, destAvs map[string]*AttributeView) (pass, applied bool) {
+	pass = FilterConjunctionOr != conjunction
+	for _, f := range filters {
+		var fPass, fApplied bool
+		if f.IsGroup() {
+			fPass, fApplied = filterRow(row, f.Filters, f.Conjunction, colIndexes, attrView, destAvs)
+		} else {
+			fPass, fApplied = filterCell(row, f, colIndexes, attrView, destAvs)
+		}
+		if !fApplied {
+			// 列已经被删除或者过滤组为空，忽略该过滤规则
+			continue
+		}
 
-			if !row.Cells[index].Value.Filter(table.Filters[j], attrView, row.ID) {
-				pass = false
-				break
+		if f.Not {
+			fPass = !fPass
+		}
+
+		applied = true
+		if FilterConjunctionOr == conjunction {
+			if fPass {
+				return true, true
 			}
+		} else if !fPass {
+			return false, true
 		}
-		if pass {
-			rows = append(rows, row)
+	}
+
+	if !applied {
+		pass = true
+	}
+	return
+}
+
+func filterCell(row *TableRow, filter *ViewFilter, colIndexes map[string]int, attrView *AttributeView, destAvs map[string]*AttributeView) (pass, applied bool) {
+	index, ok := colIndexes[filter.Column]
+	if !ok {
+		return
+	}
+	applied = true
+
+	if "" != filter.SubKeyID {
+		pass = filterRelatedValues(filter, attrView, row.ID, destAvs)
+		return
+	}
+
+	if nil == row.Cells[index].Value {
+		switch filter.Operator {
+		case FilterOperatorIsNotEmpty:
+			return
+		case FilterOperatorIsEmpty:
+			pass = true
+			return
 		}
+
+		pass = KeyTypeText == row.Cells[index].ValueType
+		return
 	}
-	table.Rows = rows
+
+	pass = row.Cells[index].Value.Filter(filter, attrView, row.ID)
+	return
 }
 
 func (table *Table) CalcCols() {
@@ -358,6 +400,12 @@ func (table *Table) CalcCols() {
 			table.calcColRelation(col, i)
 		case KeyTypeRollup:
 			table.calcColRollup(col, i)
+		case KeyTypeFormula:
+			table.calcColFormula(col, i)
+		case KeyTypeUniqueID:
+			table.calcColUniqueID(col, i)
+		case KeyTypeCreatedBy:
+			table.calcColCreatedBy(col, i)
 		}
 	}
 }
@@ -1737,3 +1785,70 @@ func (table *Table) calcColRollup(col *TableColumn, colIndex int) {
 		}
 	}
 }
+
+// calcColUniqueID 按照格式化后的编号文本复用文本列计算。
+func (table *Table) calcColUniqueID(col *TableColumn, colIndex int) {
+	table.calcColAsText(col, colIndex, func(value *Value) string {
+		if nil == value.UniqueID {
+			return ""
+		}
+		return value.UniqueID.Content
+	})
+}
+
+// calcColCreatedBy 按照创建者名称复用文本列计算。
+func (table *Table) calcColCreatedBy(col *TableColumn, colIndex int) {
+	table.calcColAsText(col, colIndex, func(value *Value) string {
+		if nil == value.CreatedBy {
+			return ""
+		}
+		return value.CreatedBy.Content
+	})
+}
+
+func (table *Table) calcColAsText(col *TableColumn, colIndex int, content func(value *Value) string) {
+	texts := &Table{}
+	for _, row := range table.Rows {
+		text := &Value{Type: KeyTypeText, Text: &ValueText{}}
+		if cell := row.Cells[colIndex]; nil != cell && nil != cell.Value {
+			text.Text.Content = content(cell.Value)
+		}
+		texts.Rows = append(texts.Rows, &TableRow{ID: row.ID, Cells: []*TableCell{{Value: text, ValueType: KeyTypeText}}})
+	}
+	texts.calcColText(&TableColumn{ID: col.ID, Type: KeyTypeText, Calc: col.Calc}, 0)
+}
+
+// calcColFormula 按照公式计算结果的类型复用对应类型的列计算。
+func (table *Table) calcColFormula(col *TableColumn, colIndex int) {
+	resultType := KeyTypeText
+	for _, row := range table.Rows {
+		if cell := row.Cells[colIndex]; nil != cell && nil != cell.Value && nil != cell.Value.Formula && nil != cell.Value.Formula.Result {
+			resultType = cell.Value.Formula.Result.Type
+			break
+		}
+	}
+
+	results := &Table{}
+	for _, row := range table.Rows {
+		var result *Value
+		if cell := row.Cells[colIndex]; nil != cell && nil != cell.Value {
+			result = cell.Value.Formula.GetResult(resultType)
+		}
+		if nil == result || resultType != result.Type {
+			result = GetAttributeViewDefaultValue("", col.ID, row.ID, resultType)
+		}
+		results.Rows = append(results.Rows, &TableRow{ID: row.ID, Cells: []*TableCell{{Value: result, ValueType: resultType}}})
+	}
+
+	resultCol := &TableColumn{ID: col.ID, Type: resultType, Calc: col.Calc, NumberFormat: col.NumberFormat}
+	switch resultType {
+	case KeyTypeNumber:
+		results.calcColNumber(resultCol, 0)
+	case KeyTypeDate:
+		results.calcColDate(resultCol, 0)
+	case KeyTypeCheckbox:
+		results.calcColCheckbox(resultCol, 0)
+	default:
+		results.calcColText(resultCol, 0)
+	}
+}
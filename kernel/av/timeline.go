@@ -0,0 +1,142 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"sort"
+)
+
+// LayoutTimeline 描述了时间线（甘特图）布局的结构。
+//
+// 和看板一样，时间线视图的字段、过滤和排序保存在视图的表格布局 LayoutTable 中。
+type LayoutTimeline struct {
+	Spec int    `json:"spec"` // 布局格式版本
+	ID   string `json:"id"`   // 布局 ID
+
+	StartKeyID string        `json:"startKeyID"` // 开始日期列 ID
+	EndKeyID   string        `json:"endKeyID"`   // 结束日期列 ID，为空时使用开始日期列的结束时间
+	Scale      TimelineScale `json:"scale"`      // 时间刻度
+}
+
+type TimelineScale string
+
+const (
+	TimelineScaleDay     TimelineScale = "day"
+	TimelineScaleWeek    TimelineScale = "week"
+	TimelineScaleMonth   TimelineScale = "month"
+	TimelineScaleQuarter TimelineScale = "quarter"
+	TimelineScaleYear    TimelineScale = "year"
+)
+
+// RemoveKey 在日期列被删除或者类型变更时清空对应的设置。
+func (timeline *LayoutTimeline) RemoveKey(keyID string) {
+	if timeline.StartKeyID == keyID {
+		timeline.StartKeyID = ""
+	}
+	if timeline.EndKeyID == keyID {
+		timeline.EndKeyID = ""
+	}
+}
+
+// Timeline 描述了时间线实例的结构。
+type Timeline struct {
+	ID               string         `json:"id"`               // 时间线布局 ID
+	Icon             string         `json:"icon"`             // 时间线图标
+	Name             string         `json:"name"`             // 时间线名称
+	HideAttrViewName bool           `json:"hideAttrViewName"` // 是否隐藏属性视图名称
+	Filters          []*ViewFilter  `json:"filters"`          // 过滤规则
+	Sorts            []*ViewSort    `json:"sorts"`            // 排序规则
+	Scale            TimelineScale  `json:"scale"`            // 时间刻度
+	StartKey         *TableColumn   `json:"startKey"`         // 开始日期列
+	EndKey           *TableColumn   `json:"endKey"`           // 结束日期列
+	Fields           []*TableColumn `json:"fields"`           // 条目字段
+	Items            []*DateItem    `json:"items"`            // 已安排日期的条目
+	Unscheduled      []*TableRow    `json:"unscheduled"`      // 未安排日期的条目
+	ItemCount        int            `json:"itemCount"`        // 总条目数
+	Start            int64          `json:"start"`            // 所有条目中最早的开始时间
+	End              int64          `json:"end"`              // 所有条目中最晚的结束时间
+
+	table *Table // 时间线的行数据，过滤和排序复用表格的实现
+}
+
+// NewTimeline 使用已经渲染好的表格实例构造时间线实例。
+func NewTimeline(view *View, table *Table) (ret *Timeline) {
+	if nil == view.Timeline {
+		view.Timeline = &LayoutTimeline{Scale: TimelineScaleDay}
+	}
+	if "" == view.Timeline.Scale {
+		view.Timeline.Scale = TimelineScaleDay
+	}
+
+	ret = &Timeline{
+		ID:               table.ID,
+		Icon:             table.Icon,
+		Name:             table.Name,
+		HideAttrViewName: table.HideAttrViewName,
+		Filters:          table.Filters,
+		Sorts:            table.Sorts,
+		Scale:            view.Timeline.Scale,
+		Fields:           table.Columns,
+		Items:            []*DateItem{},
+		Unscheduled:      []*TableRow{},
+		table:            table,
+	}
+	ret.StartKey, ret.EndKey = getDateLayoutKeys(table, view.Timeline.StartKeyID, view.Timeline.EndKeyID)
+	return
+}
+
+func (timeline *Timeline) GetType() LayoutType {
+	return LayoutTypeTimeline
+}
+
+func (timeline *Timeline) GetID() string {
+	return timeline.ID
+}
+
+func (timeline *Timeline) FilterRows(attrView *AttributeView) {
+	timeline.table.FilterRows(attrView)
+}
+
+func (timeline *Timeline) SortRows(attrView *AttributeView) {
+	timeline.table.SortRows(attrView)
+}
+
+func (timeline *Timeline) CalcCols() {
+	// 时间线不支持列计算
+}
+
+// PlaceItems 将过滤和排序后的行按照日期列放置到时间线中。
+func (timeline *Timeline) PlaceItems() {
+	timeline.ItemCount = len(timeline.table.Rows)
+	timeline.Items, timeline.Unscheduled = placeDateItems(timeline.table, timeline.StartKey, timeline.EndKey)
+
+	if 1 > len(timeline.Sorts) {
+		// 没有设置排序规则时按开始时间排序
+		sort.SliceStable(timeline.Items, func(i, j int) bool {
+			return timeline.Items[i].Start < timeline.Items[j].Start
+		})
+	}
+
+	for i, item := range timeline.Items {
+		if 0 == i || item.Start < timeline.Start {
+			timeline.Start = item.Start
+		}
+		if 0 == i || item.End > timeline.End {
+			timeline.End = item.End
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package av
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/88250/lute/ast"
+	"github.com/siyuan-community/siyuan/kernel/util"
+)
+
+// UniqueID 描述了唯一 ID 列的设置。
+//
+// 和序号列不同，唯一 ID 在行添加时分配并保存在值中，不会随着视图排序变化。
+type UniqueID struct {
+	Prefix string `json:"prefix"` // 前缀，比如 TASK-
+	Digits int    `json:"digits"` // 编号最少位数，不足时前面补 0
+	Next   int64  `json:"next"`   // 下一个分配的编号，只增不减，删除行后编号也不会被重新使用
+}
+
+// Format 格式化编号，比如前缀为 TASK-、位数为 4 时编号 42 格式化为 TASK-0042。
+func (uniqueID *UniqueID) Format(number int64) string {
+	return fmt.Sprintf("%s%0*d", uniqueID.Prefix, uniqueID.Digits, number)
+}
+
+type ValueUniqueID struct {
+	Number  int64  `json:"number"`  // 编号
+	Content string `json:"content"` // 格式化后的内容，用于搜索和过滤
+}
+
+// FillUniqueIDs 为唯一 ID 列中还没有编号的行按照行的创建顺序分配编号，并按照列设置刷新已有编号的格式化内容。
+func (av *AttributeView) FillUniqueIDs() {
+	blockValues := av.GetBlockKeyValues()
+	if nil == blockValues {
+		return
+	}
+
+	var rows []*Value
+	for _, kv := range av.KeyValues {
+		if KeyTypeUniqueID != kv.Key.Type {
+			continue
+		}
+
+		if nil == rows {
+			rows = append([]*Value{}, blockValues.Values...)
+			sort.SliceStable(rows, func(i, j int) bool {
+				return rows[i].Block.Created < rows[j].Block.Created
+			})
+		}
+
+		if nil == kv.Key.UniqueID {
+			kv.Key.UniqueID = &UniqueID{}
+		}
+		uniqueID := kv.Key.UniqueID
+		for _, v := range kv.Values {
+			if nil == v.UniqueID {
+				continue
+			}
+
+			if v.UniqueID.Number >= uniqueID.Next {
+				// 历史数据回滚等情况下下一个编号可能落后于已经分配的编号
+				uniqueID.Next = v.UniqueID.Number + 1
+			}
+			v.UniqueID.Content = uniqueID.Format(v.UniqueID.Number)
+		}
+		if 1 > uniqueID.Next {
+			uniqueID.Next = 1
+		}
+
+		now := util.CurrentTimeMillis()
+		values := kv.getValuesByBlockID()
+		for _, row := range rows {
+			v := values[row.BlockID]
+			if nil != v && KeyTypeUniqueID == v.Type && nil != v.UniqueID && 0 < v.UniqueID.Number {
+				continue
+			}
+
+			if nil == v {
+				v = &Value{ID: ast.NewNodeID(), KeyID: kv.Key.ID, BlockID: row.BlockID, CreatedAt: now}
+				kv.Values = append(kv.Values, v)
+				values[row.BlockID] = v
+			}
+
+			// 列类型从其他类型变更为唯一 ID 时原来的值会被替换
+			*v = Value{ID: v.ID, KeyID: v.KeyID, BlockID: v.BlockID, Type: KeyTypeUniqueID, IsDetached: row.IsDetached, CreatedAt: v.CreatedAt, UpdatedAt: now,
+				UniqueID: &ValueUniqueID{Number: uniqueID.Next, Content: uniqueID.Format(uniqueID.Next)}}
+			uniqueID.Next++
+		}
+	}
+}
@@ -41,21 +41,24 @@ type Value struct {
 	CreatedAt int64 `json:"createdAt,omitempty"`
 	UpdatedAt int64 `json:"updatedAt,omitempty"`
 
-	Block    *ValueBlock    `json:"block,omitempty"`
-	Text     *ValueText     `json:"text,omitempty"`
-	Number   *ValueNumber   `json:"number,omitempty"`
-	Date     *ValueDate     `json:"date,omitempty"`
-	MSelect  []*ValueSelect `json:"mSelect,omitempty"`
-	URL      *ValueURL      `json:"url,omitempty"`
-	Email    *ValueEmail    `json:"email,omitempty"`
-	Phone    *ValuePhone    `json:"phone,omitempty"`
-	MAsset   []*ValueAsset  `json:"mAsset,omitempty"`
-	Template *ValueTemplate `json:"template,omitempty"`
-	Created  *ValueCreated  `json:"created,omitempty"`
-	Updated  *ValueUpdated  `json:"updated,omitempty"`
-	Checkbox *ValueCheckbox `json:"checkbox,omitempty"`
-	Relation *ValueRelation `json:"relation,omitempty"`
-	Rollup   *ValueRollup   `json:"rollup,omitempty"`
+	Block     *ValueBlock     `json:"block,omitempty"`
+	Text      *ValueText      `json:"text,omitempty"`
+	Number    *ValueNumber    `json:"number,omitempty"`
+	Date      *ValueDate      `json:"date,omitempty"`
+	MSelect   []*ValueSelect  `json:"mSelect,omitempty"`
+	URL       *ValueURL       `json:"url,omitempty"`
+	Email     *ValueEmail     `json:"email,omitempty"`
+	Phone     *ValuePhone     `json:"phone,omitempty"`
+	MAsset    []*ValueAsset   `json:"mAsset,omitempty"`
+	Template  *ValueTemplate  `json:"template,omitempty"`
+	Created   *ValueCreated   `json:"created,omitempty"`
+	Updated   *ValueUpdated   `json:"updated,omitempty"`
+	Checkbox  *ValueCheckbox  `json:"checkbox,omitempty"`
+	Relation  *ValueRelation  `json:"relation,omitempty"`
+	Rollup    *ValueRollup    `json:"rollup,omitempty"`
+	Formula   *ValueFormula   `json:"formula,omitempty"`
+	UniqueID  *ValueUniqueID  `json:"uniqueID,omitempty"`
+	CreatedBy *ValueCreatedBy `json:"createdBy,omitempty"`
 }
 
 func (value *Value) SetUpdatedAt(mills int64) {
@@ -174,6 +177,21 @@ func (value *Value) String(format bool) string {
 			ret = append(ret, v.String(format))
 		}
 		return strings.TrimSpace(strings.Join(ret, ", "))
+	case KeyTypeFormula:
+		if nil == value.Formula || nil == value.Formula.Result {
+			return ""
+		}
+		return value.Formula.Result.String(format)
+	case KeyTypeUniqueID:
+		if nil == value.UniqueID {
+			return ""
+		}
+		return value.UniqueID.Content
+	case KeyTypeCreatedBy:
+		if nil == value.CreatedBy {
+			return ""
+		}
+		return value.CreatedBy.Content
 	default:
 		return ""
 	}
@@ -290,6 +308,18 @@ func (value *Value) IsEmpty() bool {
 		return 1 > len(value.Relation.Contents)
 	case KeyTypeRollup:
 		return 1 > len(value.Rollup.Contents)
+	case KeyTypeFormula:
+		if nil == value.Formula || nil == value.Formula.Result {
+			return true
+		}
+		if KeyTypeCheckbox == value.Formula.Result.Type {
+			return false
+		}
+		return value.Formula.Result.IsEmpty()
+	case KeyTypeUniqueID:
+		return nil == value.UniqueID || 1 > value.UniqueID.Number
+	case KeyTypeCreatedBy:
+		return nil == value.CreatedBy || "" == value.CreatedBy.Content
 	}
 	return false
 }
@@ -328,6 +358,12 @@ func (value *Value) SetValByType(typ KeyType, val interface{}) {
 		value.Relation = val.(*ValueRelation)
 	case KeyTypeRollup:
 		value.Rollup = val.(*ValueRollup)
+	case KeyTypeFormula:
+		value.Formula = val.(*ValueFormula)
+	case KeyTypeUniqueID:
+		value.UniqueID = val.(*ValueUniqueID)
+	case KeyTypeCreatedBy:
+		value.CreatedBy = val.(*ValueCreatedBy)
 	}
 }
 
@@ -365,15 +401,22 @@ func (value *Value) GetValByType(typ KeyType) (ret interface{}) {
 		return value.Relation
 	case KeyTypeRollup:
 		return value.Rollup
+	case KeyTypeFormula:
+		return value.Formula
+	case KeyTypeUniqueID:
+		return value.UniqueID
+	case KeyTypeCreatedBy:
+		return value.CreatedBy
 	}
 	return
 }
 
 type ValueBlock struct {
-	ID      string `json:"id"`
-	Content string `json:"content"`
-	Created int64  `json:"created"`
-	Updated int64  `json:"updated"`
+	ID        string `json:"id"`
+	Content   string `json:"content"`
+	Created   int64  `json:"created"`
+	Updated   int64  `json:"updated"`
+	CreatedBy string `json:"createdBy,omitempty"` // 添加该行的设备名称
 }
 
 type ValueText struct {
@@ -953,6 +996,12 @@ func GetAttributeViewDefaultValue(valueID, keyID, blockID string, typ KeyType) (
 		ret.Relation = &ValueRelation{}
 	case KeyTypeRollup:
 		ret.Rollup = &ValueRollup{}
+	case KeyTypeFormula:
+		ret.Formula = &ValueFormula{}
+	case KeyTypeUniqueID:
+		ret.UniqueID = &ValueUniqueID{}
+	case KeyTypeCreatedBy:
+		ret.CreatedBy = &ValueCreatedBy{}
 	}
 	return
 }
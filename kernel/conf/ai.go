@@ -26,7 +26,8 @@ import (
 )
 
 type AI struct {
-	OpenAI *OpenAI `json:"openAI"`
+	OpenAI    *OpenAI    `json:"openAI"`
+	Embedding *Embedding `json:"embedding"`
 }
 
 type OpenAI struct {
@@ -43,6 +44,29 @@ type OpenAI struct {
 	APIVersion     string  `json:"apiVersion"`  // Azure API version
 }
 
+const (
+	EmbeddingProviderOpenAI = "OpenAI" // 使用 OpenAI 兼容接口，复用 OpenAI 配置的地址和密钥
+	EmbeddingProviderLocal  = "Local"  // 使用本地 HTTP 服务
+)
+
+// Embedding 描述了语义搜索使用的向量化配置。
+type Embedding struct {
+	Enabled      bool    `json:"enabled"`
+	Provider     string  `json:"provider"`     // OpenAI, Local
+	Model        string  `json:"model"`        // 向量化模型
+	LocalURL     string  `json:"localURL"`     // 本地向量化服务地址
+	HybridWeight float64 `json:"hybridWeight"` // 混合搜索时向量相似度的权重，取值 [0, 1]
+}
+
+func NewEmbedding() *Embedding {
+	return &Embedding{
+		Provider:     EmbeddingProviderOpenAI,
+		Model:        string(openai.SmallEmbedding3),
+		LocalURL:     "http://127.0.0.1:11434/v1/embeddings",
+		HybridWeight: 0.5,
+	}
+}
+
 func NewAI() *AI {
 	openAI := &OpenAI{
 		APITemperature: 1.0,
@@ -95,5 +119,5 @@ func NewAI() *AI {
 	if userAgent := os.Getenv("SIYUAN_OPENAI_API_USER_AGENT"); "" != userAgent {
 		openAI.APIUserAgent = userAgent
 	}
-	return &AI{OpenAI: openAI}
+	return &AI{OpenAI: openAI, Embedding: NewEmbedding()}
 }
@@ -19,11 +19,43 @@ package conf
 import "github.com/88250/gulu"
 
 type API struct {
-	Token string `json:"token"`
+	Token  string      `json:"token"`  // 拥有全部权限的令牌
+	Tokens []*APIToken `json:"tokens"` // 限定权限范围的令牌
+	SQL    *APISQL     `json:"sql"`    // 接口 /api/query/sql 的限制
 }
 
 func NewAPI() *API {
 	return &API{
-		Token: gulu.Rand.String(16),
+		Token:  gulu.Rand.String(16),
+		Tokens: []*APIToken{},
+		SQL:    NewAPISQL(),
 	}
 }
+
+// APISQL 描述了接口 /api/query/sql 的限制。
+type APISQL struct {
+	Writable bool `json:"writable"` // 是否允许执行 SELECT 和 WITH 以外的语句，限定权限范围的令牌始终不允许
+	Timeout  int  `json:"timeout"`  // 查询超时时间，单位：秒
+	MaxRows  int  `json:"maxRows"`  // 最多返回的行数
+}
+
+func NewAPISQL() *APISQL {
+	return &APISQL{
+		Writable: false,
+		Timeout:  10,
+		MaxRows:  4096,
+	}
+}
+
+// APIToken 描述了限定权限范围的 API 令牌。
+type APIToken struct {
+	ID        string   `json:"id"`        // 令牌 ID
+	Name      string   `json:"name"`      // 令牌名称
+	Token     string   `json:"token"`     // 令牌
+	ReadOnly  bool     `json:"readOnly"`  // 是否只读，只读令牌无法调用会修改数据的接口
+	Routes    []string `json:"routes"`    // 允许访问的路由前缀，为空时允许访问开放给令牌的全部路由
+	Notebooks []string `json:"notebooks"` // 允许访问的笔记本 ID，为空时允许访问全部笔记本
+	Expired   int64    `json:"expired"`   // 过期时间，为 0 时不过期
+	Created   int64    `json:"created"`   // 创建时间
+	LastUsed  int64    `json:"lastUsed"`  // 最后使用时间
+}
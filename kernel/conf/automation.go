@@ -0,0 +1,68 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package conf
+
+type Automation struct {
+	Schedules []*Schedule `json:"schedules"` // 用户定义的定时任务
+}
+
+func NewAutomation() *Automation {
+	return &Automation{
+		Schedules: []*Schedule{},
+	}
+}
+
+// Schedule 描述了用户定义的定时任务，Cron 和 Interval 二选一，Cron 优先。
+type Schedule struct {
+	ID       string          `json:"id"`       // 任务 ID
+	Name     string          `json:"name"`     // 任务名称
+	Enabled  bool            `json:"enabled"`  // 是否启用
+	Cron     string          `json:"cron"`     // cron 表达式：分 时 日 月 周
+	Interval int             `json:"interval"` // 执行间隔，单位：秒
+	Action   *ScheduleAction `json:"action"`   // 执行的动作
+
+	NextRun   int64          `json:"nextRun"`   // 下次执行时间
+	LastRun   int64          `json:"lastRun"`   // 上次执行时间
+	LastError string         `json:"lastError"` // 上次执行的错误信息，执行成功时为空
+	Runs      []*ScheduleRun `json:"runs"`      // 最近的执行记录，最新的在前
+}
+
+const (
+	ScheduleActionDailyNote      = "dailyNote"      // 使用笔记本设置的日记模板创建日记
+	ScheduleActionSQL            = "sql"            // 执行 SQL 查询并将结果追加到文档
+	ScheduleActionSnapshot       = "snapshot"       // 创建数据快照
+	ScheduleActionExportNotebook = "exportNotebook" // 导出笔记本 .sy.zip
+)
+
+// ScheduleAction 描述了定时任务执行的动作，不同动作使用不同的参数。
+type ScheduleAction struct {
+	Type     string `json:"type"`               // 动作类型
+	Notebook string `json:"notebook,omitempty"` // 日记和导出使用的笔记本 ID
+	Stmt     string `json:"stmt,omitempty"`     // SQL 查询语句
+	DocID    string `json:"docID,omitempty"`    // SQL 查询结果追加到的文档 ID
+	Memo     string `json:"memo,omitempty"`     // 快照备注
+	Dir      string `json:"dir,omitempty"`      // 导出文件保存的文件夹，为工作空间下的相对路径
+}
+
+// ScheduleRun 描述了定时任务的一次执行。
+type ScheduleRun struct {
+	Started int64  `json:"started"` // 开始时间
+	Ended   int64  `json:"ended"`   // 结束时间
+	Manual  bool   `json:"manual"`  // 是否是手动执行
+	Result  string `json:"result"`  // 执行结果，比如创建的日记路径、导出文件路径
+	Error   string `json:"error"`   // 错误信息
+}
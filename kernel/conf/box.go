@@ -20,19 +20,33 @@ import "github.com/siyuan-community/siyuan/kernel/util"
 
 // BoxConf 维护 .siyuan/conf.json 笔记本配置。
 type BoxConf struct {
-	Name                  string `json:"name"`                  // 笔记本名称
-	Sort                  int    `json:"sort"`                  // 排序字段
-	Icon                  string `json:"icon"`                  // 图标
-	Closed                bool   `json:"closed"`                // 是否处于关闭状态
-	RefCreateSaveBox      string `json:"refCreateSaveBox"`      // 块引时新建文档存储笔记本
-	RefCreateSavePath     string `json:"refCreateSavePath"`     // 块引时新建文档存储路径
-	DocCreateSaveBox      string `json:"docCreateSaveBox"`      // 新建文档存储笔记本
-	DocCreateSavePath     string `json:"docCreateSavePath"`     // 新建文档存储路径
-	DailyNoteSavePath     string `json:"dailyNoteSavePath"`     // 新建日记存储路径
-	DailyNoteTemplatePath string `json:"dailyNoteTemplatePath"` // 新建日记使用的模板路径
-	SortMode              int    `json:"sortMode"`              // 排序方式
+	Name                  string   `json:"name"`                  // 笔记本名称
+	Sort                  int      `json:"sort"`                  // 排序字段
+	Icon                  string   `json:"icon"`                  // 图标
+	Closed                bool     `json:"closed"`                // 是否处于关闭状态
+	RefCreateSaveBox      string   `json:"refCreateSaveBox"`      // 块引时新建文档存储笔记本
+	RefCreateSavePath     string   `json:"refCreateSavePath"`     // 块引时新建文档存储路径
+	DocCreateSaveBox      string   `json:"docCreateSaveBox"`      // 新建文档存储笔记本
+	DocCreateSavePath     string   `json:"docCreateSavePath"`     // 新建文档存储路径
+	DailyNoteSavePath     string   `json:"dailyNoteSavePath"`     // 新建日记存储路径
+	DailyNoteTemplatePath string   `json:"dailyNoteTemplatePath"` // 新建日记使用的模板路径
+	SortMode              int      `json:"sortMode"`              // 排序方式
+	Sync                  *BoxSync `json:"sync"`                  // 数据同步配置
 }
 
+// BoxSync 描述了笔记本的数据同步配置。
+type BoxSync struct {
+	Policy    int      `json:"policy"`    // 同步策略，0：同步到工作空间的云端同步目录，1：同步到指定的云端同步目录，2：仅保存在本地
+	CloudName string   `json:"cloudName"` // 指定的云端同步目录名称，同步策略为 1 时有效
+	Ignores   []string `json:"ignores"`   // 笔记本内不同步的路径，使用 .gitignore 语法，相对于笔记本根路径，! 开头表示重新包含
+}
+
+const (
+	BoxSyncPolicyDefault = 0 // 同步到工作空间的云端同步目录
+	BoxSyncPolicyTarget  = 1 // 同步到指定的云端同步目录
+	BoxSyncPolicyLocal   = 2 // 仅保存在本地，笔记本配置仍然同步，这样其他设备也将其视为仅保存在本地
+)
+
 func NewBoxConf() *BoxConf {
 	return &BoxConf{
 		Name:                  "Untitled",
@@ -40,5 +54,6 @@ func NewBoxConf() *BoxConf {
 		DailyNoteSavePath:     "/daily note/{{now | date \"2006/01\"}}/{{now | date \"2006-01-02\"}}",
 		DailyNoteTemplatePath: "",
 		SortMode:              util.SortModeFileTree,
+		Sync:                  &BoxSync{},
 	}
 }
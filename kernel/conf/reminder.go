@@ -0,0 +1,40 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package conf
+
+// Reminder 描述了本地块提醒的投递配置，提醒到期时总是通过界面消息通知，以下渠道为可选。
+// 多台设备同步时只有最后配置了渠道的设备通过以下渠道投递。
+type Reminder struct {
+	Webhook string `json:"webhook"` // 提醒到期时以 POST JSON 方式调用的地址，为空表示不调用
+	SMTP    *SMTP  `json:"smtp"`    // 提醒到期时发送邮件使用的 SMTP 中继
+}
+
+func NewReminder() *Reminder {
+	return &Reminder{
+		SMTP: &SMTP{Port: 587},
+	}
+}
+
+// SMTP 描述了 SMTP 中继配置，Host 为空表示不发送邮件。
+type SMTP struct {
+	Host     string   `json:"host"`     // 服务器地址
+	Port     int      `json:"port"`     // 服务器端口
+	Username string   `json:"username"` // 用户名，为空表示不认证
+	Password string   `json:"password"` // 密码
+	From     string   `json:"from"`     // 发件人
+	To       []string `json:"to"`       // 收件人
+}
@@ -45,6 +45,8 @@ type Search struct {
 
 	Limit         int  `json:"limit"`
 	CaseSensitive bool `json:"caseSensitive"`
+	Fuzzy         bool `json:"fuzzy"`         // 模糊搜索，容忍拼写错误并补全最后一个关键字的前缀
+	FuzzyDistance int  `json:"fuzzyDistance"` // 模糊搜索允许的最大编辑距离
 
 	Name  bool `json:"name"`
 	Alias bool `json:"alias"`
@@ -87,6 +89,8 @@ func NewSearch() *Search {
 
 		Limit:         64,
 		CaseSensitive: false,
+		Fuzzy:         false,
+		FuzzyDistance: 2,
 
 		Name:  true,
 		Alias: true,
@@ -27,6 +27,8 @@ type Sync struct {
 	Provider            int     `json:"provider"`            // 云端存储服务提供者
 	S3                  *S3     `json:"s3"`                  // S3 对象存储服务配置
 	WebDAV              *WebDAV `json:"webdav"`              // WebDAV 服务配置
+	Local               *Local  `json:"local"`               // 本地文件夹配置
+	SFTP                *SFTP   `json:"sftp"`                // SFTP 服务配置
 }
 
 func NewSync() *Sync {
@@ -59,10 +61,27 @@ type WebDAV struct {
 	Timeout       int    `json:"timeout"`       // 超时时间，单位：秒
 }
 
+type Local struct {
+	Endpoint string `json:"endpoint"` // 文件夹绝对路径，可以是挂载的网络驱动器或者 Syncthing 等工具同步的文件夹
+}
+
+type SFTP struct {
+	Endpoint   string `json:"endpoint"`   // 服务端点，格式为 host:port
+	Username   string `json:"username"`   // 用户名
+	Password   string `json:"password"`   // 密码
+	PrivateKey string `json:"privateKey"` // PEM 格式的私钥，配置后优先使用私钥认证
+	Passphrase string `json:"passphrase"` // 私钥密码
+	HostKey    string `json:"hostKey"`    // 服务端主机密钥 SHA256 指纹，为空时在首次连接时记录，之后主机密钥不一致时拒绝连接
+	Path       string `json:"path"`       // 服务端存储目录
+	Timeout    int    `json:"timeout"`    // 超时时间，单位：秒
+}
+
 const (
 	ProviderSiYuan = 0 // ProviderSiYuan 为思源官方提供的云端存储服务
 	ProviderS3     = 2 // ProviderS3 为 S3 协议对象存储提供的云端存储服务
 	ProviderWebDAV = 3 // ProviderWebDAV 为 WebDAV 协议提供的云端存储服务
+	ProviderLocal  = 4 // ProviderLocal 为本地文件夹提供的存储服务
+	ProviderSFTP   = 5 // ProviderSFTP 为 SFTP 协议提供的存储服务
 )
 
 func ProviderToStr(provider int) string {
@@ -73,6 +92,10 @@ func ProviderToStr(provider int) string {
 		return "S3"
 	case ProviderWebDAV:
 		return "WebDAV"
+	case ProviderLocal:
+		return "Local"
+	case ProviderSFTP:
+		return "SFTP"
 	}
 	return "Unknown"
 }
@@ -43,6 +43,10 @@ func StartCron() {
 	go every(30*time.Second, model.OCRAssetsJob)
 	go every(30*time.Second, model.FlushAssetsTextsJob)
 	go every(30*time.Second, model.HookDesktopUIProcJob)
+	go every(10*time.Second, model.AutomationJob)
+	go every(10*time.Second, model.ReminderJob)
+	go every(10*time.Second, sql.EmbeddingJob)
+	go every(5*time.Second, model.SavedSearchJob)
 }
 
 func every(interval time.Duration, f func()) {
@@ -24,6 +24,7 @@ import (
 	"github.com/siyuan-community/siyuan/kernel/model"
 	"github.com/siyuan-community/siyuan/kernel/server"
 	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/task"
 	"github.com/siyuan-community/siyuan/kernel/util"
 )
 
@@ -38,15 +39,18 @@ func main() {
 	sql.InitAssetContentDatabase(false)
 	sql.SetCaseSensitive(model.Conf.Search.CaseSensitive)
 	sql.SetIndexAssetPath(model.Conf.Search.IndexAssetPath)
+	sql.SetFuzzySearch(model.Conf.Search.Fuzzy)
 
 	model.BootSyncData()
 	model.InitBoxes()
 	model.LoadFlashcards()
+	model.InitEmbedding()
 	util.LoadAssetsTexts()
 
 	util.SetBooted()
 	util.PushClearAllMsg()
 
+	task.ResumeTasks()
 	job.StartCron()
 	go model.AutoGenerateFileHistory()
 	go cache.LoadAssets()
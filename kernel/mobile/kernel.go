@@ -28,6 +28,7 @@ import (
 	"github.com/siyuan-community/siyuan/kernel/model"
 	"github.com/siyuan-community/siyuan/kernel/server"
 	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/task"
 	"github.com/siyuan-community/siyuan/kernel/util"
 	"github.com/siyuan-note/filelock"
 	"github.com/siyuan-note/logging"
@@ -54,15 +55,18 @@ func StartKernel(container, appDir, workspaceBaseDir, timezoneID, localIPs, lang
 		sql.InitAssetContentDatabase(false)
 		sql.SetCaseSensitive(model.Conf.Search.CaseSensitive)
 		sql.SetIndexAssetPath(model.Conf.Search.IndexAssetPath)
+		sql.SetFuzzySearch(model.Conf.Search.Fuzzy)
 
 		model.BootSyncData()
 		model.InitBoxes()
 		model.LoadFlashcards()
+		model.InitEmbedding()
 		util.LoadAssetsTexts()
 
 		util.SetBooted()
 		util.PushClearAllMsg()
 
+		task.ResumeTasks()
 		job.StartCron()
 		go model.AutoGenerateFileHistory()
 		go cache.LoadAssets()
@@ -0,0 +1,510 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute/ast"
+	"github.com/gin-gonic/gin"
+	"github.com/siyuan-community/siyuan/kernel/av"
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
+)
+
+var (
+	ErrAPITokenNotFound = errors.New("API token not found")
+
+	apiTokenLock = sync.RWMutex{}
+)
+
+const apiTokenCtxKey = "apiToken"
+
+// apiTokenRoute 描述了限定权限范围的令牌可以访问的路由。
+type apiTokenRoute struct {
+	write    bool // 是否会修改数据，只读令牌无法访问
+	notebook bool // 是否可以按照请求参数中的块 ID 和笔记本 ID 限定访问范围，限定了笔记本的令牌只能访问这类路由
+	path     bool // 请求参数中的 path 和 newPath 为工作空间下的文件路径，只能访问笔记本文件夹和 data/assets/ 下的文件
+}
+
+// apiTokenRoutes 描述了限定权限范围的令牌可以访问的全部路由，不在其中的路由（比如设置、同步、定时任务等）始终无法访问。
+var apiTokenRoutes = map[string]*apiTokenRoute{
+	"/api/notebook/lsNotebooks":     {},
+	"/api/notebook/getNotebookConf": {notebook: true},
+	"/api/notebook/openNotebook":    {write: true, notebook: true},
+	"/api/notebook/closeNotebook":   {write: true, notebook: true},
+	"/api/notebook/setNotebookConf": {write: true, notebook: true},
+	"/api/notebook/createNotebook":  {write: true},
+	"/api/notebook/removeNotebook":  {write: true, notebook: true},
+	"/api/notebook/renameNotebook":  {write: true, notebook: true},
+
+	"/api/filetree/searchDocs":       {},
+	"/api/filetree/listDocsByPath":   {notebook: true},
+	"/api/filetree/getDoc":           {notebook: true},
+	"/api/filetree/getHPathByPath":   {notebook: true},
+	"/api/filetree/getHPathByID":     {notebook: true},
+	"/api/filetree/getFullHPathByID": {notebook: true},
+	"/api/filetree/getIDsByHPath":    {notebook: true},
+	"/api/filetree/createDocWithMd":  {write: true, notebook: true},
+	"/api/filetree/createDailyNote":  {write: true, notebook: true},
+	"/api/filetree/renameDoc":        {write: true, notebook: true},
+	"/api/filetree/removeDoc":        {write: true, notebook: true},
+	"/api/filetree/moveDocs":         {write: true, notebook: true},
+
+	"/api/block/getBlockInfo":           {notebook: true},
+	"/api/block/getBlockDOM":            {notebook: true},
+	"/api/block/getBlockKramdown":       {notebook: true},
+	"/api/block/getChildBlocks":         {notebook: true},
+	"/api/block/getBlockBreadcrumb":     {notebook: true},
+	"/api/block/getDocInfo":             {notebook: true},
+	"/api/block/getRefText":             {notebook: true},
+	"/api/block/getTreeStat":            {notebook: true},
+	"/api/block/getBlocksWordCount":     {notebook: true},
+	"/api/block/checkBlockExist":        {notebook: true},
+	"/api/block/getBlockReminders":      {notebook: true},
+	"/api/block/getRecentUpdatedBlocks": {},
+	"/api/block/insertBlock":            {write: true, notebook: true},
+	"/api/block/prependBlock":           {write: true, notebook: true},
+	"/api/block/appendBlock":            {write: true, notebook: true},
+	"/api/block/appendDailyNoteBlock":   {write: true, notebook: true},
+	"/api/block/updateBlock":            {write: true, notebook: true},
+	"/api/block/deleteBlock":            {write: true, notebook: true},
+	"/api/block/moveBlock":              {write: true, notebook: true},
+	"/api/block/foldBlock":              {write: true, notebook: true},
+	"/api/block/unfoldBlock":            {write: true, notebook: true},
+	"/api/block/transferBlockRef":       {write: true, notebook: true},
+	"/api/block/setBlockReminder":       {write: true, notebook: true},
+	"/api/transactions":                 {write: true, notebook: true},
+
+	"/api/attr/getBookmarkLabels":  {},
+	"/api/attr/getBlockAttrs":      {notebook: true},
+	"/api/attr/setBlockAttrs":      {write: true, notebook: true},
+	"/api/attr/batchSetBlockAttrs": {write: true, notebook: true},
+
+	"/api/outline/getDocOutline":   {notebook: true},
+	"/api/ref/refreshBacklink":     {notebook: true},
+	"/api/ref/getBacklink2":        {notebook: true},
+	"/api/ref/getBacklinkDoc":      {notebook: true},
+	"/api/ref/getBackmentionDoc":   {notebook: true},
+	"/api/export/exportMdContent":  {notebook: true},
+	"/api/tag/getTag":              {},
+	"/api/bookmark/getBookmark":    {},
+	"/api/lute/spinBlockDOM":       {},
+	"/api/notification/pushMsg":    {},
+	"/api/notification/pushErrMsg": {},
+
+	"/api/query/sql":                  {},
+	"/api/sqlite/flushTransaction":    {write: true},
+	"/api/search/fullTextSearchBlock": {},
+	"/api/search/searchRefBlock":      {},
+	"/api/search/searchEmbedBlock":    {},
+	"/api/search/findReplacePreview":  {},
+	"/api/search/findReplace":         {write: true},
+	"/api/search/getSavedSearches":    {},
+	"/api/search/runSavedSearch":      {},
+	"/api/search/searchAsset":         {},
+	"/api/search/searchTag":           {},
+
+	"/api/file/getFile":    {notebook: true, path: true},
+	"/api/file/readDir":    {notebook: true, path: true},
+	"/api/file/putFile":    {write: true, notebook: true, path: true},
+	"/api/file/removeFile": {write: true, notebook: true, path: true},
+	"/api/file/renameFile": {write: true, notebook: true, path: true},
+	"/api/asset/upload":    {write: true},
+
+	"/api/av/renderAttributeView":       {notebook: true},
+	"/api/av/getAttributeView":          {notebook: true},
+	"/api/av/getAttributeViewKeys":      {notebook: true},
+	"/api/av/exportAttributeView":       {notebook: true},
+	"/api/av/setAttributeViewBlockAttr": {write: true, notebook: true},
+	"/api/av/addAttributeViewKey":       {write: true, notebook: true},
+	"/api/av/removeAttributeViewKey":    {write: true, notebook: true},
+	"/api/av/addAttributeViewValues":    {write: true, notebook: true},
+	"/api/av/removeAttributeViewValues": {write: true, notebook: true},
+	"/api/av/importAttributeView":       {write: true, notebook: true},
+
+	"/api/riff/getRiffDecks":    {},
+	"/api/riff/getRiffCards":    {},
+	"/api/riff/getRiffDueCards": {},
+	"/api/riff/addRiffCards":    {write: true, notebook: true},
+	"/api/riff/removeRiffCards": {write: true, notebook: true},
+	"/api/riff/reviewRiffCard":  {write: true},
+}
+
+func GetAPITokens() (ret []*conf.APIToken) {
+	apiTokenLock.RLock()
+	defer apiTokenLock.RUnlock()
+
+	ret = []*conf.APIToken{}
+	for _, token := range Conf.Api.Tokens {
+		t := *token
+		ret = append(ret, &t)
+	}
+	return
+}
+
+// AddAPIToken 新建令牌，令牌值由内核生成。
+func AddAPIToken(token *conf.APIToken) (ret *conf.APIToken, err error) {
+	apiTokenLock.Lock()
+	defer apiTokenLock.Unlock()
+
+	normalizeAPIToken(token)
+	token.ID = ast.NewNodeID()
+	token.Token = gulu.Rand.String(32)
+	token.Created = util.CurrentTimeMillis()
+	token.LastUsed = 0
+	Conf.Api.Tokens = append(Conf.Api.Tokens, token)
+	Conf.Save()
+
+	t := *token
+	ret = &t
+	return
+}
+
+// UpdateAPIToken 更新令牌的名称和权限范围，令牌值保持不变。
+func UpdateAPIToken(token *conf.APIToken) (err error) {
+	apiTokenLock.Lock()
+	defer apiTokenLock.Unlock()
+
+	existing := getAPITokenByID(token.ID)
+	if nil == existing {
+		return ErrAPITokenNotFound
+	}
+
+	normalizeAPIToken(token)
+	existing.Name = token.Name
+	existing.ReadOnly = token.ReadOnly
+	existing.Routes = token.Routes
+	existing.Notebooks = token.Notebooks
+	existing.Expired = token.Expired
+	Conf.Save()
+	return
+}
+
+func RemoveAPIToken(id string) (err error) {
+	apiTokenLock.Lock()
+	defer apiTokenLock.Unlock()
+
+	for i, token := range Conf.Api.Tokens {
+		if id == token.ID {
+			Conf.Api.Tokens = append(Conf.Api.Tokens[:i], Conf.Api.Tokens[i+1:]...)
+			Conf.Save()
+			return
+		}
+	}
+	return ErrAPITokenNotFound
+}
+
+func normalizeAPIToken(token *conf.APIToken) {
+	token.Name = strings.TrimSpace(token.Name)
+	var routes []string
+	for _, route := range token.Routes {
+		if route = strings.TrimSpace(route); "" != route {
+			if !strings.HasPrefix(route, "/") {
+				route = "/" + route
+			}
+			routes = append(routes, route)
+		}
+	}
+	token.Routes = routes
+	if nil == token.Routes {
+		token.Routes = []string{}
+	}
+
+	var notebooks []string
+	for _, notebook := range token.Notebooks {
+		if notebook = strings.TrimSpace(notebook); "" != notebook {
+			notebooks = append(notebooks, notebook)
+		}
+	}
+	token.Notebooks = notebooks
+	if nil == token.Notebooks {
+		token.Notebooks = []string{}
+	}
+	if 0 > token.Expired {
+		token.Expired = 0
+	}
+}
+
+func getAPITokenByID(id string) *conf.APIToken {
+	for _, token := range Conf.Api.Tokens {
+		if id == token.ID {
+			return token
+		}
+	}
+	return nil
+}
+
+// getAuthorizationToken 从请求头 Authorization 中获取令牌。
+func getAuthorizationToken(c *gin.Context) (ret string) {
+	authHeader := c.GetHeader("Authorization")
+	for _, prefix := range []string{"Token ", "token ", "Bearer ", "bearer "} {
+		if strings.HasPrefix(authHeader, prefix) {
+			return strings.TrimPrefix(authHeader, prefix)
+		}
+	}
+	return
+}
+
+// checkAPIToken 检查请求中限定权限范围的令牌，presented 为 true 时表示请求使用了这类令牌，校验失败时请求会被中止。
+func checkAPIToken(c *gin.Context) (presented bool) {
+	tokenValue := getAuthorizationToken(c)
+	if "" == tokenValue || Conf.Api.Token == tokenValue {
+		return
+	}
+
+	apiTokenLock.Lock()
+	var token *conf.APIToken
+	for _, t := range Conf.Api.Tokens {
+		if t.Token == tokenValue {
+			token = t
+			break
+		}
+	}
+	if nil == token {
+		apiTokenLock.Unlock()
+		return
+	}
+
+	presented = true
+	now := util.CurrentTimeMillis()
+	if 0 < token.Expired && now >= token.Expired {
+		apiTokenLock.Unlock()
+		c.JSON(http.StatusUnauthorized, map[string]interface{}{"code": -1, "msg": "Auth failed [token expired]"})
+		c.Abort()
+		return
+	}
+
+	save := false
+	if now-token.LastUsed > 60*1000 {
+		// 最后使用时间最多每分钟持久化一次，修改时持有配置锁，避免和保存配置时的序列化并发读写
+		Conf.m.Lock()
+		token.LastUsed = now
+		Conf.m.Unlock()
+		save = true
+	}
+	t := *token
+	apiTokenLock.Unlock()
+	if save {
+		Conf.Save()
+	}
+
+	if msg := checkAPITokenScope(c, &t); "" != msg {
+		logging.LogWarnf("API token [%s] access [%s] denied: %s", t.Name, c.Request.URL.Path, msg)
+		c.JSON(http.StatusForbidden, map[string]interface{}{"code": -1, "msg": "Access denied [" + msg + "]"})
+		c.Abort()
+		return
+	}
+
+	c.Set(apiTokenCtxKey, &t)
+	return
+}
+
+func checkAPITokenScope(c *gin.Context, token *conf.APIToken) (msg string) {
+	p := c.Request.URL.Path
+	route := apiTokenRoutes[p]
+	if nil == route {
+		return "route"
+	}
+
+	if 0 < len(token.Routes) {
+		allowed := false
+		for _, r := range token.Routes {
+			if strings.HasPrefix(p, r) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "route"
+		}
+	}
+
+	if route.write && token.ReadOnly {
+		return "read-only token"
+	}
+
+	if 0 < len(token.Notebooks) && !route.notebook {
+		return "notebook"
+	}
+
+	if !route.path && 1 > len(token.Notebooks) {
+		return
+	}
+
+	// 收集请求参数中出现的所有字符串
+	var values []string
+	for _, vals := range c.Request.URL.Query() {
+		values = append(values, vals...)
+	}
+	var filePaths []string
+	if nil != c.Request.Body {
+		data, err := io.ReadAll(c.Request.Body)
+		if nil != err {
+			return "body"
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			// 上传文件的表单解析后由 gin 缓存，接口中可以继续读取
+			if err = c.Request.ParseMultipartForm(32 << 20); nil != err {
+				return "body"
+			}
+			for key, vals := range c.Request.MultipartForm.Value {
+				values = append(values, vals...)
+				if "path" == key {
+					filePaths = append(filePaths, vals...)
+				}
+			}
+		} else if 0 < len(bytes.TrimSpace(data)) {
+			var arg interface{}
+			if err = gulu.JSON.UnmarshalJSON(data, &arg); nil != err {
+				// 无法解析的请求体无法确定访问的笔记本和文件
+				return "body"
+			}
+			values = append(values, collectJSONStrings(arg)...)
+			if m, ok := arg.(map[string]interface{}); ok {
+				for _, key := range []string{"path", "newPath"} {
+					if filePath, ok := m[key].(string); ok {
+						filePaths = append(filePaths, filePath)
+					}
+				}
+			}
+		}
+	}
+
+	if route.path {
+		if 1 > len(filePaths) {
+			return "path"
+		}
+		for _, filePath := range filePaths {
+			if !isAPITokenFilePathAllowed(filePath, token) {
+				return "path"
+			}
+		}
+	}
+
+	if 1 > len(token.Notebooks) {
+		return
+	}
+
+	// 检查请求参数中出现的所有块 ID、笔记本 ID 和属性视图 ID
+	for _, id := range values {
+		if !ast.IsNodeIDPattern(id) {
+			continue
+		}
+
+		var boxIDs []string
+		if bt := treenode.GetBlockTree(id); nil != bt {
+			boxIDs = append(boxIDs, bt.BoxID)
+		} else if nil != Conf.GetBox(id) {
+			boxIDs = append(boxIDs, id)
+		} else if av.IsAttributeViewExist(id) {
+			if boxIDs = getAttributeViewBoxIDs(id); 1 > len(boxIDs) {
+				// 没有绑定到任何文档的属性视图无法确定所属的笔记本
+				return "notebook"
+			}
+		}
+
+		for _, boxID := range boxIDs {
+			if !gulu.Str.Contains(boxID, token.Notebooks) {
+				return "notebook"
+			}
+		}
+	}
+	return
+}
+
+// apiTokenDeniedDataDirs 描述了令牌始终无法访问的 data/ 下的文件夹，这些文件夹下的代码和配置会以完整权限加载。
+var apiTokenDeniedDataDirs = []string{"plugins", "widgets", "templates", "snippets", "storage"}
+
+// isAPITokenFilePathAllowed 检查令牌是否可以访问工作空间下的文件路径，只允许访问笔记本文件夹和 data/assets/ 下的文件，限定了笔记本时只允许访问这些笔记本文件夹下的文件。
+func isAPITokenFilePathAllowed(filePath string, token *conf.APIToken) bool {
+	filePath = path.Clean("/" + strings.ReplaceAll(filePath, "\\", "/"))
+	if !strings.HasPrefix(filePath, "/data/") {
+		return false
+	}
+
+	dir := strings.Split(strings.TrimPrefix(filePath, "/data/"), "/")[0]
+	if gulu.Str.Contains(dir, apiTokenDeniedDataDirs) {
+		return false
+	}
+	if 0 < len(token.Notebooks) {
+		return gulu.Str.Contains(dir, token.Notebooks)
+	}
+	if "assets" == dir {
+		return true
+	}
+	return ast.IsNodeIDPattern(dir) && nil != Conf.GetBox(dir)
+}
+
+// getAttributeViewBoxIDs 返回属性视图所属的笔记本，包括数据库块所在的笔记本和行绑定的块所在的笔记本。
+func getAttributeViewBoxIDs(avID string) (ret []string) {
+	blockIDs := av.GetBlockRels()[avID]
+	if attrView, _ := av.ParseAttributeView(avID); nil != attrView {
+		if blockValues := attrView.GetBlockKeyValues(); nil != blockValues {
+			for _, v := range blockValues.Values {
+				if !v.IsDetached {
+					blockIDs = append(blockIDs, v.BlockID)
+				}
+			}
+		}
+	}
+
+	for _, blockID := range blockIDs {
+		if bt := treenode.GetBlockTree(blockID); nil != bt && !gulu.Str.Contains(bt.BoxID, ret) {
+			ret = append(ret, bt.BoxID)
+		}
+	}
+	return
+}
+
+func collectJSONStrings(v interface{}) (ret []string) {
+	switch val := v.(type) {
+	case string:
+		ret = append(ret, val)
+	case []interface{}:
+		for _, item := range val {
+			ret = append(ret, collectJSONStrings(item)...)
+		}
+	case map[string]interface{}:
+		for _, item := range val {
+			ret = append(ret, collectJSONStrings(item)...)
+		}
+	}
+	return
+}
+
+func getRequestAPIToken(c *gin.Context) *conf.APIToken {
+	if token, ok := c.Get(apiTokenCtxKey); ok {
+		return token.(*conf.APIToken)
+	}
+	return nil
+}
+
+// CanWriteSQL 返回请求是否允许通过 /api/query/sql 执行 SELECT 和 WITH 以外的语句。
+func CanWriteSQL(c *gin.Context) bool {
+	return Conf.Api.SQL.Writable && !util.ReadOnly && nil == getRequestAPIToken(c)
+}
@@ -0,0 +1,200 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/gin-gonic/gin"
+	"github.com/siyuan-community/siyuan/kernel/av"
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-community/siyuan/kernel/util"
+)
+
+const (
+	testTokenBoxA   = "20240101000000-boxaaaa"
+	testTokenBoxB   = "20240101000000-boxbbbb"
+	testTokenBlockA = "20240101000001-blockaa"
+	testTokenBlockB = "20240101000001-blockbb"
+	testTokenAvA    = "20240101000002-avaaaaa"
+	testTokenAvB    = "20240101000002-avbbbbb"
+	testTokenAvNone = "20240101000002-avnnnnn"
+)
+
+func TestCheckAPITokenScope(t *testing.T) {
+	dataDir, appConf, lang, attrViewLangs := util.DataDir, Conf, util.Lang, util.AttrViewLangs
+	util.DataDir = t.TempDir()
+	Conf = &AppConf{FileTree: conf.NewFileTree(), m: &sync.Mutex{}}
+	util.Lang, util.AttrViewLangs = "en_US", map[string]map[string]interface{}{"en_US": {"table": "Table", "key": "Key", "select": "Select"}}
+	defer func() { util.DataDir, Conf, util.Lang, util.AttrViewLangs = dataDir, appConf, lang, attrViewLangs }()
+	for _, boxID := range []string{testTokenBoxA, testTokenBoxB} {
+		if err := os.MkdirAll(filepath.Join(util.DataDir, boxID, ".siyuan"), 0755); nil != err {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(util.DataDir, boxID, ".siyuan", "conf.json"), []byte("{}"), 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+	indexTestTokenTree(testTokenBoxA, testTokenBlockA)
+	indexTestTokenTree(testTokenBoxB, testTokenBlockB)
+	saveTestTokenAttributeView(t, testTokenAvA, testTokenBlockA)
+	saveTestTokenAttributeView(t, testTokenAvB, testTokenBlockB)
+	saveTestTokenAttributeView(t, testTokenAvNone, "")
+
+	full := &conf.APIToken{}
+	readOnly := &conf.APIToken{ReadOnly: true}
+	routes := &conf.APIToken{Routes: []string{"/api/block/"}}
+	notebook := &conf.APIToken{Notebooks: []string{testTokenBoxA}}
+
+	cases := []struct {
+		name  string
+		token *conf.APIToken
+		route string
+		body  string
+		msg   string
+	}{
+		{"allowed route", full, "/api/block/getBlockKramdown", `{"id":"` + testTokenBlockB + `"}`, ""},
+		{"conf route", full, "/api/system/getConf", `{}`, "route"},
+		{"token route", full, "/api/system/addAPIToken", `{}`, "route"},
+		{"setting route", full, "/api/setting/setEditor", `{}`, "route"},
+		{"sync provider route", full, "/api/sync/setSyncProviderS3", `{}`, "route"},
+		{"schedule route", full, "/api/automation/setSchedule", `{}`, "route"},
+		{"task route", full, "/api/task/getTasks", `{}`, "route"},
+		{"network serve route", full, "/api/system/setNetworkServe", `{}`, "route"},
+		{"token routes", routes, "/api/block/getBlockKramdown", `{"id":"` + testTokenBlockB + `"}`, ""},
+		{"outside token routes", routes, "/api/attr/getBlockAttrs", `{"id":"` + testTokenBlockB + `"}`, "route"},
+		{"read-only read", readOnly, "/api/search/findReplacePreview", `{}`, ""},
+		{"read-only write", readOnly, "/api/search/findReplace", `{}`, "read-only token"},
+		{"read-only transactions", readOnly, "/api/transactions", `{}`, "read-only token"},
+		{"data file", full, "/api/file/getFile", `{"path":"/data/` + testTokenBoxB + `/a.sy"}`, ""},
+		{"data dir", full, "/api/file/readDir", `{"path":"/data"}`, "path"},
+		{"assets file", full, "/api/file/getFile", `{"path":"/data/assets/a.png"}`, ""},
+		{"plugins file", full, "/api/file/getFile", `{"path":"/data/plugins/a/index.js"}`, "path"},
+		{"widgets dir", full, "/api/file/readDir", `{"path":"/data/widgets"}`, "path"},
+		{"templates file", full, "/api/file/getFile", `{"path":"/data/templates/a.md"}`, "path"},
+		{"snippets file", full, "/api/file/getFile", `{"path":"/data/snippets/conf.json"}`, "path"},
+		{"storage file", full, "/api/file/getFile", `{"path":"/data/storage/local.json"}`, "path"},
+		{"unknown notebook file", full, "/api/file/getFile", `{"path":"/data/20240101000000-unknown/a.sy"}`, "path"},
+		{"template render", full, "/api/template/render", `{"id":"` + testTokenBlockA + `","path":"/conf/conf.json"}`, "route"},
+		{"template sprig", full, "/api/template/renderSprig", `{"template":"{{env \"HOME\"}}"}`, "route"},
+		{"html to block dom", readOnly, "/api/lute/html2BlockDOM", `{"dom":"<img src=\"file:///etc/passwd\">"}`, "route"},
+		{"conf file", full, "/api/file/getFile", `{"path":"/conf/conf.json"}`, "path"},
+		{"escaped conf file", full, "/api/file/getFile", `{"path":"/data/../conf/conf.json"}`, "path"},
+		{"windows conf file", full, "/api/file/readDir", `{"path":"data\\..\\conf"}`, "path"},
+		{"rename out of data", full, "/api/file/renameFile", `{"path":"/data/assets/a.txt","newPath":"/conf/a.txt"}`, "path"},
+		{"missing path", full, "/api/file/getFile", `{}`, "path"},
+		{"notebook block", notebook, "/api/block/getBlockKramdown", `{"id":"` + testTokenBlockA + `"}`, ""},
+		{"other notebook block", notebook, "/api/block/getBlockKramdown", `{"id":"` + testTokenBlockB + `"}`, "notebook"},
+		{"other notebook box", notebook, "/api/notebook/getNotebookConf", `{"notebook":"` + testTokenBoxB + `"}`, "notebook"},
+		{"closed other notebook", notebook, "/api/notebook/openNotebook", `{"notebook":"` + testTokenBoxB + `"}`, "notebook"},
+		{"notebook attribute view", notebook, "/api/av/renderAttributeView", `{"id":"` + testTokenAvA + `"}`, ""},
+		{"other notebook attribute view", notebook, "/api/av/renderAttributeView", `{"id":"` + testTokenAvB + `"}`, "notebook"},
+		{"unbound attribute view", notebook, "/api/av/renderAttributeView", `{"id":"` + testTokenAvNone + `"}`, "notebook"},
+		{"notebook unscoped route", notebook, "/api/query/sql", `{"stmt":"SELECT * FROM blocks"}`, "notebook"},
+		{"notebook file", notebook, "/api/file/getFile", `{"path":"/data/` + testTokenBoxA + `/a.sy"}`, ""},
+		{"other notebook file", notebook, "/api/file/getFile", `{"path":"/data/` + testTokenBoxB + `/a.sy"}`, "path"},
+		{"notebook assets", notebook, "/api/file/readDir", `{"path":"/data/assets"}`, "path"},
+	}
+
+	for _, c := range cases {
+		ctx := newTestTokenContext(c.route, "application/json", []byte(c.body))
+		if msg := checkAPITokenScope(ctx, c.token); msg != c.msg {
+			t.Errorf("%s: expected [%s], got [%s]", c.name, c.msg, msg)
+		}
+	}
+}
+
+func TestCheckAPITokenScopePutFile(t *testing.T) {
+	dataDir, appConf := util.DataDir, Conf
+	util.DataDir = t.TempDir()
+	Conf = &AppConf{FileTree: conf.NewFileTree(), m: &sync.Mutex{}}
+	defer func() { util.DataDir, Conf = dataDir, appConf }()
+	if err := os.MkdirAll(filepath.Join(util.DataDir, testTokenBoxA, ".siyuan"), 0755); nil != err {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(util.DataDir, testTokenBoxA, ".siyuan", "conf.json"), []byte("{}"), 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path string
+		msg  string
+	}{
+		{"/data/" + testTokenBoxA + "/a.sy", ""},
+		{"/data/plugins/a/index.js", "path"},
+		{"/data/widgets/a/index.html", "path"},
+		{"/conf/conf.json", "path"},
+		{"/data/../conf/conf.json", "path"},
+	}
+
+	for _, c := range cases {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("path", c.path)
+		writer.WriteField("isDir", "false")
+		part, _ := writer.CreateFormFile("file", "a.sy")
+		part.Write([]byte("{}"))
+		writer.Close()
+
+		ctx := newTestTokenContext("/api/file/putFile", writer.FormDataContentType(), body.Bytes())
+		if msg := checkAPITokenScope(ctx, &conf.APIToken{}); msg != c.msg {
+			t.Errorf("put file [%s]: expected [%s], got [%s]", c.path, c.msg, msg)
+			continue
+		}
+		if "" == c.msg && c.path != ctx.PostForm("path") {
+			t.Errorf("put file [%s]: form value is not available after the check", c.path)
+		}
+	}
+}
+
+func newTestTokenContext(route, contentType string, body []byte) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, route, bytes.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", contentType)
+	return ctx
+}
+
+func indexTestTokenTree(boxID, rootID string) {
+	root := &ast.Node{Type: ast.NodeDocument, ID: rootID}
+	root.SetIALAttr("id", rootID)
+	tree := &parse.Tree{Root: root, ID: rootID, Box: boxID, Path: "/" + rootID + ".sy", HPath: "/" + strings.ToLower(rootID)}
+	treenode.IndexBlockTree(tree)
+}
+
+func saveTestTokenAttributeView(t *testing.T, avID, blockID string) {
+	attrView := av.NewAttributeView(avID)
+	if "" != blockID {
+		blockValues := attrView.GetBlockKeyValues()
+		blockValues.Values = append(blockValues.Values, &av.Value{ID: ast.NewNodeID(), KeyID: blockValues.Key.ID, BlockID: blockID, Type: av.KeyTypeBlock, CreatedAt: 1, UpdatedAt: 1,
+			Block: &av.ValueBlock{ID: blockID, Created: 1, Updated: 1}})
+	}
+	if err := av.SaveAttributeView(attrView); nil != err {
+		t.Fatal(err)
+	}
+}
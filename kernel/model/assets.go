@@ -1093,7 +1093,7 @@ func assetsLinkDestsInQueryEmbedNodes(tree *parse.Tree) (ret []string) {
 		stmt := n.TokensStr()
 		stmt = html.UnescapeString(stmt)
 		stmt = strings.ReplaceAll(stmt, editor.IALValEscNewLine, "\n")
-		sqlBlocks := sql.SelectBlocksRawStmt(stmt, 1, Conf.Search.Limit)
+		sqlBlocks := sql.SelectBlocksRawStmtReadOnly(stmt, 1, Conf.Search.Limit)
 		for _, sqlBlock := range sqlBlocks {
 			subtree, _ := LoadTreeByBlockID(sqlBlock.ID)
 			if nil == subtree {
@@ -73,11 +73,10 @@ func GetAttributeViewPrimaryKeyValues(avID, keyword string, page, pageSize int)
 	tmp := map[string]*av.Value{}
 	for _, kv := range keyValues.Values {
 		for _, view := range attrView.Views {
-			switch view.LayoutType {
-			case av.LayoutTypeTable:
+			if nil != view.GetLayoutTable() {
 				if !kv.IsDetached {
 					if nil == treenode.GetBlockTree(kv.BlockID) {
-						break
+						continue
 					}
 				}
 
@@ -124,8 +123,7 @@ func GetAttributeViewFilterSort(avID, blockID string) (filters []*av.ViewFilter,
 
 	filters = []*av.ViewFilter{}
 	sorts = []*av.ViewSort{}
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
+	if nil != view.GetLayoutTable() {
 		filters = view.Table.Filters
 		sorts = view.Table.Sorts
 	}
@@ -143,7 +141,7 @@ func SearchAttributeViewNonRelationKey(avID, keyword string) (ret []*av.Key) {
 	}
 
 	for _, keyValues := range attrView.KeyValues {
-		if av.KeyTypeRelation != keyValues.Key.Type && av.KeyTypeRollup != keyValues.Key.Type && av.KeyTypeTemplate != keyValues.Key.Type && av.KeyTypeCreated != keyValues.Key.Type && av.KeyTypeUpdated != keyValues.Key.Type && av.KeyTypeLineNumber != keyValues.Key.Type {
+		if av.KeyTypeRelation != keyValues.Key.Type && av.KeyTypeRollup != keyValues.Key.Type && av.KeyTypeTemplate != keyValues.Key.Type && av.KeyTypeCreated != keyValues.Key.Type && av.KeyTypeUpdated != keyValues.Key.Type && av.KeyTypeLineNumber != keyValues.Key.Type && av.KeyTypeFormula != keyValues.Key.Type {
 			if strings.Contains(strings.ToLower(keyValues.Key.Name), strings.ToLower(keyword)) {
 				ret = append(ret, keyValues.Key)
 			}
@@ -394,6 +392,8 @@ func GetBlockAttributeViewKeys(blockID string) (ret []*BlockAttributeViewKeys) {
 				kValues.Values = append(kValues.Values, &av.Value{ID: ast.NewNodeID(), KeyID: kValues.Key.ID, BlockID: blockID, Type: av.KeyTypeCreated})
 			case av.KeyTypeUpdated:
 				kValues.Values = append(kValues.Values, &av.Value{ID: ast.NewNodeID(), KeyID: kValues.Key.ID, BlockID: blockID, Type: av.KeyTypeUpdated})
+			case av.KeyTypeFormula:
+				kValues.Values = append(kValues.Values, &av.Value{ID: ast.NewNodeID(), KeyID: kValues.Key.ID, BlockID: blockID, Type: av.KeyTypeFormula, Formula: &av.ValueFormula{}})
 			}
 
 			if 0 < len(kValues.Values) {
@@ -524,6 +524,9 @@ func GetBlockAttributeViewKeys(blockID string) (ret []*BlockAttributeViewKeys) {
 			util.PushErrMsg(fmt.Sprintf(Conf.Language(44), util.EscapeHTML(renderTemplateErr.Error())), 30000)
 		}
 
+		// 计算公式列
+		av.RenderKeyValuesFormulas(attrView, keyValues)
+
 		// Attribute Panel - Database sort attributes by view column order https://github.com/siyuan-note/siyuan/issues/9319
 		viewID := attrs[av.NodeAttrView]
 		view, _ := attrView.GetCurrentView(viewID)
@@ -789,8 +792,8 @@ func renderAttributeView(attrView *av.AttributeView, viewID, query string, page,
 
 	// 补全过滤器 Value
 	if nil != view.Table {
-		for _, f := range view.Table.Filters {
-			if nil != f.Value {
+		for _, f := range av.GetLeafFilters(view.Table.Filters) {
+			if nil != f.Value || "" != f.SubKeyID {
 				continue
 			}
 
@@ -800,16 +803,12 @@ func renderAttributeView(attrView *av.AttributeView, viewID, query string, page,
 		}
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
+	if nil != view.GetLayoutTable() {
 		// 列删除以后需要删除设置的过滤和排序
-		tmpFilters := []*av.ViewFilter{}
-		for _, f := range view.Table.Filters {
-			if k, _ := attrView.GetKey(f.Column); nil != k {
-				tmpFilters = append(tmpFilters, f)
-			}
-		}
-		view.Table.Filters = tmpFilters
+		view.Table.Filters = av.PruneFilters(view.Table.Filters, func(f *av.ViewFilter) bool {
+			k, _ := attrView.GetKey(f.Column)
+			return nil != k
+		})
 
 		tmpSorts := []*av.ViewSort{}
 		for _, s := range view.Table.Sorts {
@@ -819,7 +818,23 @@ func renderAttributeView(attrView *av.AttributeView, viewID, query string, page,
 		}
 		view.Table.Sorts = tmpSorts
 
-		viewable, err = renderAttributeViewTable(attrView, view, query)
+		// 看板、日历和时间线复用表格的行渲染，过滤排序后再按分组列或者日期列放置
+		var table *av.Table
+		table, err = renderAttributeViewTable(attrView, view, query)
+		if nil != err {
+			return
+		}
+
+		switch view.LayoutType {
+		case av.LayoutTypeTable:
+			viewable = table
+		case av.LayoutTypeBoard:
+			viewable = av.NewBoard(view, table)
+		case av.LayoutTypeCalendar:
+			viewable = av.NewCalendar(view, table)
+		case av.LayoutTypeTimeline:
+			viewable = av.NewTimeline(view, table)
+		}
 	}
 
 	viewable.FilterRows(attrView)
@@ -828,8 +843,19 @@ func renderAttributeView(attrView *av.AttributeView, viewID, query string, page,
 
 	// 分页
 	switch viewable.GetType() {
+	case av.LayoutTypeBoard:
+		// 看板、日历和时间线不分页
+		board := viewable.(*av.Board)
+		board.GroupCards()
+	case av.LayoutTypeCalendar:
+		calendar := viewable.(*av.Calendar)
+		calendar.PlaceItems()
+	case av.LayoutTypeTimeline:
+		timeline := viewable.(*av.Timeline)
+		timeline.PlaceItems()
 	case av.LayoutTypeTable:
 		table := viewable.(*av.Table)
+		table.GroupRows(view.Group)
 		table.RowCount = len(table.Rows)
 		if 1 > view.Table.PageSize {
 			view.Table.PageSize = 50
@@ -841,10 +867,17 @@ func renderAttributeView(attrView *av.AttributeView, viewID, query string, page,
 
 		start := (page - 1) * pageSize
 		end := start + pageSize
+		if nil != table.Group {
+			// 分组后按照分组展开的行分页，一页中可能包含多个分组的行
+			table.RowCount = table.GroupedRowCount()
+			table.PaginateGroupRows(start, end)
+			break
+		}
+
 		if len(table.Rows) < end {
 			end = len(table.Rows)
 		}
-		table.Rows = table.Rows[start:end]
+		table.Rows = table.Rows[min(start, end):end]
 	}
 	return
 }
@@ -989,6 +1022,7 @@ func renderAttributeViewTable(attrView *av.AttributeView, view *av.View, query s
 			Options:      key.Options,
 			NumberFormat: key.NumberFormat,
 			Template:     key.Template,
+			Formula:      key.Formula,
 			Relation:     key.Relation,
 			Rollup:       key.Rollup,
 			Date:         key.Date,
@@ -1079,6 +1113,8 @@ func renderAttributeViewTable(attrView *av.AttributeView, view *av.View, query s
 				}
 			case av.KeyTypeTemplate: // 渲染模板列
 				tableCell.Value = &av.Value{ID: tableCell.ID, KeyID: col.ID, BlockID: rowID, Type: av.KeyTypeTemplate, Template: &av.ValueTemplate{Content: col.Template}}
+			case av.KeyTypeFormula: // 填充公式列值，后面再计算
+				tableCell.Value = &av.Value{ID: tableCell.ID, KeyID: col.ID, BlockID: rowID, Type: av.KeyTypeFormula, Formula: &av.ValueFormula{}}
 			case av.KeyTypeCreated: // 填充创建时间列值，后面再渲染
 				tableCell.Value = &av.Value{ID: tableCell.ID, KeyID: col.ID, BlockID: rowID, Type: av.KeyTypeCreated}
 			case av.KeyTypeUpdated: // 填充更新时间列值，后面再渲染
@@ -1259,6 +1295,9 @@ func renderAttributeViewTable(attrView *av.AttributeView, view *av.View, query s
 		util.PushErrMsg(fmt.Sprintf(Conf.Language(44), util.EscapeHTML(renderTemplateErr.Error())), 30000)
 	}
 
+	// 计算公式列，公式可以引用包括模板列在内的所有列值
+	av.RenderTableFormulaCols(attrView, ret, rows)
+
 	// 根据搜索条件过滤
 	query = strings.TrimSpace(query)
 	if "" != query {
@@ -1353,8 +1392,7 @@ func unbindAttributeViewBlock(operation *Operation, tx *Transaction) (err error)
 
 	replacedRowID := false
 	for _, v := range attrView.Views {
-		switch v.LayoutType {
-		case av.LayoutTypeTable:
+		if nil != v.GetLayoutTable() {
 			for i, rowID := range v.Table.RowIDs {
 				if rowID == operation.ID {
 					v.Table.RowIDs[i] = operation.NextID
@@ -1363,6 +1401,10 @@ func unbindAttributeViewBlock(operation *Operation, tx *Transaction) (err error)
 				}
 			}
 
+			if nil != v.Board {
+				v.Board.ReplaceRow(operation.ID, operation.NextID)
+			}
+
 			if !replacedRowID {
 				v.Table.RowIDs = append(v.Table.RowIDs, operation.NextID)
 			}
@@ -1597,8 +1639,7 @@ func updateAttributeViewColRelation(operation *Operation) (err error) {
 		destAv.KeyValues = append(destAv.KeyValues, destKeyValues)
 
 		for _, v := range destAv.Views {
-			switch v.LayoutType {
-			case av.LayoutTypeTable:
+			if nil != v.GetLayoutTable() {
 				v.Table.Columns = append(v.Table.Columns, &av.ViewTableColumn{ID: operation.BackRelationKeyID})
 			}
 		}
@@ -1836,13 +1877,7 @@ func (tx *Transaction) doDuplicateAttrViewView(operation *Operation) (ret *TxErr
 	}
 
 	for _, filter := range masterView.Table.Filters {
-		view.Table.Filters = append(view.Table.Filters, &av.ViewFilter{
-			Column:        filter.Column,
-			Operator:      filter.Operator,
-			Value:         filter.Value,
-			RelativeDate:  filter.RelativeDate,
-			RelativeDate2: filter.RelativeDate2,
-		})
+		view.Table.Filters = append(view.Table.Filters, filter.Clone())
 	}
 
 	for _, s := range masterView.Table.Sorts {
@@ -1855,6 +1890,28 @@ func (tx *Transaction) doDuplicateAttrViewView(operation *Operation) (ret *TxErr
 	view.Table.PageSize = masterView.Table.PageSize
 	view.Table.RowIDs = masterView.Table.RowIDs
 
+	if nil != masterView.Board {
+		view.Board = &av.LayoutBoard{ID: ast.NewNodeID(), GroupKeyID: masterView.Board.GroupKeyID, Lanes: []*av.ViewBoardLane{}}
+		for _, lane := range masterView.Board.Lanes {
+			view.Board.Lanes = append(view.Board.Lanes, &av.ViewBoardLane{ID: lane.ID, Hidden: lane.Hidden, RowIDs: lane.RowIDs})
+		}
+	}
+
+	if nil != masterView.Calendar {
+		view.Calendar = &av.LayoutCalendar{ID: ast.NewNodeID(), StartKeyID: masterView.Calendar.StartKeyID, EndKeyID: masterView.Calendar.EndKeyID, Mode: masterView.Calendar.Mode}
+	}
+
+	if nil != masterView.Timeline {
+		view.Timeline = &av.LayoutTimeline{ID: ast.NewNodeID(), StartKeyID: masterView.Timeline.StartKeyID, EndKeyID: masterView.Timeline.EndKeyID, Scale: masterView.Timeline.Scale}
+	}
+
+	if nil != masterView.Group {
+		view.Group = &av.ViewGroup{Field: masterView.Group.Field, Method: masterView.Group.Method, Order: masterView.Group.Order, HideEmpty: masterView.Group.HideEmpty, Groups: []*av.ViewGroupState{}}
+		for _, state := range masterView.Group.Groups {
+			view.Group.Groups = append(view.Group.Groups, &av.ViewGroupState{ID: state.ID, Folded: state.Folded, Hidden: state.Hidden})
+		}
+	}
+
 	if err = av.SaveAttributeView(attrView); nil != err {
 		logging.LogErrorf("save attribute view [%s] failed: %s", avID, err)
 		return &TxErr{code: TxErrWriteAttributeView, msg: err.Error(), id: avID}
@@ -1896,7 +1953,17 @@ func (tx *Transaction) doAddAttrViewView(operation *Operation) (ret *TxErr) {
 		return
 	}
 
-	view := av.NewTableView()
+	var view *av.View
+	switch operation.Layout {
+	case av.LayoutTypeBoard:
+		view = av.NewBoardView(getBoardGroupKeyID(attrView, operation.KeyID))
+	case av.LayoutTypeCalendar:
+		view = av.NewCalendarView(getDateLayoutKeyID(attrView, operation.KeyID))
+	case av.LayoutTypeTimeline:
+		view = av.NewTimelineView(getDateLayoutKeyID(attrView, operation.KeyID))
+	default:
+		view = av.NewTableView()
+	}
 	view.ID = operation.ID
 	attrView.Views = append(attrView.Views, view)
 	attrView.ViewID = view.ID
@@ -1914,148 +1981,149 @@ func (tx *Transaction) doAddAttrViewView(operation *Operation) (ret *TxErr) {
 	return
 }
 
-func (tx *Transaction) doSetAttrViewViewName(operation *Operation) (ret *TxErr) {
-	var err error
-	avID := operation.AvID
-	attrView, err := av.ParseAttributeView(avID)
-	if nil != err {
-		logging.LogErrorf("parse attribute view [%s] failed: %s", avID, err)
-		return &TxErr{code: TxErrWriteAttributeView, id: avID}
+func getBoardGroupKeyID(attrView *av.AttributeView, keyID string) string {
+	if "" != keyID {
+		if key, _ := attrView.GetKey(keyID); nil != key && av.IsBoardGroupKeyType(key.Type) {
+			return key.ID
+		}
 	}
 
-	viewID := operation.ID
-	view := attrView.GetView(viewID)
-	if nil == view {
-		logging.LogErrorf("get view [%s] failed: %s", viewID, err)
-		return &TxErr{code: TxErrWriteAttributeView, id: viewID}
+	// 未指定分组列时使用第一个单选列或者复选框列
+	for _, kv := range attrView.KeyValues {
+		if av.IsBoardGroupKeyType(kv.Key.Type) {
+			return kv.Key.ID
+		}
 	}
+	return ""
+}
 
-	view.Name = strings.TrimSpace(operation.Data.(string))
-	if err = av.SaveAttributeView(attrView); nil != err {
-		logging.LogErrorf("save attribute view [%s] failed: %s", avID, err)
-		return &TxErr{code: TxErrWriteAttributeView, msg: err.Error(), id: avID}
+func (tx *Transaction) doSetAttrViewBoardGroupKey(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewBoardGroupKey(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
 	}
 	return
 }
 
-func (tx *Transaction) doSetAttrViewViewIcon(operation *Operation) (ret *TxErr) {
-	var err error
-	avID := operation.AvID
-	attrView, err := av.ParseAttributeView(avID)
+func setAttributeViewBoardGroupKey(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
 	if nil != err {
-		logging.LogErrorf("parse attribute view [%s] failed: %s", avID, err)
-		return &TxErr{code: TxErrWriteAttributeView, id: avID}
+		return
 	}
 
-	viewID := operation.ID
-	view := attrView.GetView(viewID)
-	if nil == view {
-		logging.LogErrorf("get view [%s] failed: %s", viewID, err)
-		return &TxErr{code: TxErrWriteAttributeView, id: viewID}
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
 	}
 
-	view.Icon = operation.Data.(string)
-	if err = av.SaveAttributeView(attrView); nil != err {
-		logging.LogErrorf("save attribute view [%s] failed: %s", avID, err)
-		return &TxErr{code: TxErrWriteAttributeView, msg: err.Error(), id: avID}
+	if nil == view.Board {
+		return
+	}
+
+	key, err := attrView.GetKey(operation.KeyID)
+	if nil != err {
+		return
+	}
+
+	if !av.IsBoardGroupKeyType(key.Type) {
+		err = av.ErrInvalidGroupKey
+		return
 	}
+
+	view.Board.SetGroupKey(key.ID)
+	err = av.SaveAttributeView(attrView)
 	return
 }
 
-func (tx *Transaction) doSetAttrViewName(operation *Operation) (ret *TxErr) {
-	err := setAttributeViewName(operation)
+func (tx *Transaction) doSetAttrViewBoardLaneHidden(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewBoardLaneHidden(operation)
 	if nil != err {
 		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
 	}
 	return
 }
 
-const attrAvNameTpl = `<span data-av-id="${avID}" data-popover-url="/api/av/getMirrorDatabaseBlocks" class="popover__block">${avName}</span>`
+func setAttributeViewBoardLaneHidden(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
 
-func setAttributeViewName(operation *Operation) (err error) {
-	avID := operation.ID
-	attrView, err := av.ParseAttributeView(avID)
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
 	if nil != err {
 		return
 	}
 
-	attrView.Name = strings.TrimSpace(operation.Data.(string))
+	if nil == view.Board {
+		return
+	}
+
+	lane := view.Board.GetOrAddLane(operation.ID)
+	lane.Hidden = operation.Data.(bool)
 	err = av.SaveAttributeView(attrView)
+	return
+}
 
-	nodes := getAttrViewBoundNodes(attrView)
-	for _, node := range nodes {
-		avNames := getAvNames(node.IALAttr(av.NodeAttrNameAvs))
-		oldAttrs := parse.IAL2Map(node.KramdownIAL)
-		node.SetIALAttr(av.NodeAttrViewNames, avNames)
-		pushBroadcastAttrTransactions(oldAttrs, node)
+func (tx *Transaction) doSortAttrViewBoardLane(operation *Operation) (ret *TxErr) {
+	err := sortAttributeViewBoardLane(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
 	}
 	return
 }
 
-func getAvNames(avIDs string) (ret string) {
-	if "" == avIDs {
+func sortAttributeViewBoardLane(operation *Operation) (err error) {
+	if operation.ID == operation.PreviousID {
 		return
 	}
-	avNames := bytes.Buffer{}
-	nodeAvIDs := strings.Split(avIDs, ",")
-	for _, nodeAvID := range nodeAvIDs {
-		nodeAvName, getErr := av.GetAttributeViewName(nodeAvID)
-		if nil != getErr {
-			continue
-		}
-		if "" == nodeAvName {
-			nodeAvName = Conf.language(105)
-		}
 
-		tpl := strings.ReplaceAll(attrAvNameTpl, "${avID}", nodeAvID)
-		tpl = strings.ReplaceAll(tpl, "${avName}", nodeAvName)
-		avNames.WriteString(tpl)
-		avNames.WriteString("&nbsp;")
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
 	}
-	if 0 < avNames.Len() {
-		avNames.Truncate(avNames.Len() - 6)
-		ret = avNames.String()
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
 	}
-	return
-}
 
-func getAttrViewBoundNodes(attrView *av.AttributeView) (ret []*ast.Node) {
-	blockKeyValues := attrView.GetBlockKeyValues()
-	treeMap := map[string]*parse.Tree{}
-	for _, blockKeyValue := range blockKeyValues.Values {
-		if blockKeyValue.IsDetached {
-			continue
-		}
+	if nil == view.Board {
+		return
+	}
 
-		var tree *parse.Tree
-		tree = treeMap[blockKeyValue.BlockID]
-		if nil == tree {
-			tree, _ = LoadTreeByBlockID(blockKeyValue.BlockID)
-		}
-		if nil == tree {
-			continue
+	lane := view.Board.GetOrAddLane(operation.ID)
+	for i, l := range view.Board.Lanes {
+		if l.ID == lane.ID {
+			view.Board.Lanes = append(view.Board.Lanes[:i], view.Board.Lanes[i+1:]...)
+			break
 		}
-		treeMap[blockKeyValue.BlockID] = tree
+	}
 
-		node := treenode.GetNodeInTree(tree, blockKeyValue.BlockID)
-		if nil == node {
-			continue
+	previousIndex := 0
+	if "" != operation.PreviousID {
+		// 前一个泳道还没有保存过设置的话需要先补上，否则无法确定位置
+		view.Board.GetOrAddLane(operation.PreviousID)
+		for i, l := range view.Board.Lanes {
+			if l.ID == operation.PreviousID {
+				previousIndex = i + 1
+				break
+			}
 		}
-
-		ret = append(ret, node)
 	}
+	view.Board.Lanes = util.InsertElem(view.Board.Lanes, previousIndex, lane)
+	err = av.SaveAttributeView(attrView)
 	return
 }
 
-func (tx *Transaction) doSetAttrViewFilters(operation *Operation) (ret *TxErr) {
-	err := setAttributeViewFilters(operation)
+func (tx *Transaction) doSetAttrViewGroup(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewGroup(operation)
 	if nil != err {
 		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
 	}
 	return
 }
 
-func setAttributeViewFilters(operation *Operation) (err error) {
+func setAttributeViewGroup(operation *Operation) (err error) {
 	attrView, err := av.ParseAttributeView(operation.AvID)
 	if nil != err {
 		return
@@ -2066,32 +2134,62 @@ func setAttributeViewFilters(operation *Operation) (err error) {
 		return
 	}
 
-	operationData := operation.Data.([]interface{})
-	data, err := gulu.JSON.MarshalJSON(operationData)
+	if nil == operation.Data {
+		// 取消分组
+		view.Group = nil
+		err = av.SaveAttributeView(attrView)
+		return
+	}
+
+	data, err := gulu.JSON.MarshalJSON(operation.Data)
 	if nil != err {
 		return
 	}
+	group := &av.ViewGroup{}
+	if err = gulu.JSON.UnmarshalJSON(data, group); nil != err {
+		return
+	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
-		if err = gulu.JSON.UnmarshalJSON(data, &view.Table.Filters); nil != err {
-			return
-		}
+	key, err := attrView.GetKey(group.Field)
+	if nil != err {
+		return
+	}
+
+	if !av.IsGroupKeyType(key.Type) {
+		err = av.ErrInvalidGroupKey
+		return
 	}
 
+	if "" == group.Method {
+		group.Method = av.GetDefaultGroupMethod(key.Type)
+	}
+	if !av.IsValidGroupMethod(key.Type, group.Method) {
+		err = av.ErrInvalidGroupMethod
+		return
+	}
+
+	if nil != view.Group && view.Group.Field == group.Field && view.Group.Method == group.Method {
+		// 分组列和分组方式都没有变化时保留分组的顺序、折叠和隐藏状态
+		group.Groups = view.Group.Groups
+	}
+	if nil == group.Groups {
+		group.Groups = []*av.ViewGroupState{}
+	}
+
+	view.Group = group
 	err = av.SaveAttributeView(attrView)
 	return
 }
 
-func (tx *Transaction) doSetAttrViewSorts(operation *Operation) (ret *TxErr) {
-	err := setAttributeViewSorts(operation)
+func (tx *Transaction) doFoldAttrViewGroup(operation *Operation) (ret *TxErr) {
+	err := foldAttributeViewGroup(operation)
 	if nil != err {
 		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
 	}
 	return
 }
 
-func setAttributeViewSorts(operation *Operation) (err error) {
+func foldAttributeViewGroup(operation *Operation) (err error) {
 	attrView, err := av.ParseAttributeView(operation.AvID)
 	if nil != err {
 		return
@@ -2102,32 +2200,25 @@ func setAttributeViewSorts(operation *Operation) (err error) {
 		return
 	}
 
-	operationData := operation.Data.([]interface{})
-	data, err := gulu.JSON.MarshalJSON(operationData)
-	if nil != err {
+	if nil == view.Group {
 		return
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
-		if err = gulu.JSON.UnmarshalJSON(data, &view.Table.Sorts); nil != err {
-			return
-		}
-	}
-
+	state := view.Group.GetOrAddState(operation.ID)
+	state.Folded = operation.Data.(bool)
 	err = av.SaveAttributeView(attrView)
 	return
 }
 
-func (tx *Transaction) doSetAttrViewPageSize(operation *Operation) (ret *TxErr) {
-	err := setAttributeViewPageSize(operation)
+func (tx *Transaction) doHideAttrViewGroup(operation *Operation) (ret *TxErr) {
+	err := hideAttributeViewGroup(operation)
 	if nil != err {
 		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
 	}
 	return
 }
 
-func setAttributeViewPageSize(operation *Operation) (err error) {
+func hideAttributeViewGroup(operation *Operation) (err error) {
 	attrView, err := av.ParseAttributeView(operation.AvID)
 	if nil != err {
 		return
@@ -2138,24 +2229,29 @@ func setAttributeViewPageSize(operation *Operation) (err error) {
 		return
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
-		view.Table.PageSize = int(operation.Data.(float64))
+	if nil == view.Group {
+		return
 	}
 
+	state := view.Group.GetOrAddState(operation.ID)
+	state.Hidden = operation.Data.(bool)
 	err = av.SaveAttributeView(attrView)
 	return
 }
 
-func (tx *Transaction) doSetAttrViewColCalc(operation *Operation) (ret *TxErr) {
-	err := setAttributeViewColumnCalc(operation)
+func (tx *Transaction) doSortAttrViewGroup(operation *Operation) (ret *TxErr) {
+	err := sortAttributeViewGroup(operation)
 	if nil != err {
 		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
 	}
 	return
 }
 
-func setAttributeViewColumnCalc(operation *Operation) (err error) {
+func sortAttributeViewGroup(operation *Operation) (err error) {
+	if operation.ID == operation.PreviousID {
+		return
+	}
+
 	attrView, err := av.ParseAttributeView(operation.AvID)
 	if nil != err {
 		return
@@ -2166,53 +2262,562 @@ func setAttributeViewColumnCalc(operation *Operation) (err error) {
 		return
 	}
 
-	operationData := operation.Data.(interface{})
-	data, err := gulu.JSON.MarshalJSON(operationData)
-	if nil != err {
+	if nil == view.Group {
 		return
 	}
 
-	calc := &av.ColumnCalc{}
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
-		if err = gulu.JSON.UnmarshalJSON(data, calc); nil != err {
-			return
-		}
+	state := view.Group.GetOrAddState(operation.ID)
+	view.Group.RemoveState(state.ID)
 
-		for _, column := range view.Table.Columns {
-			if column.ID == operation.ID {
-				column.Calc = calc
+	previousIndex := 0
+	if "" != operation.PreviousID {
+		// 前一个分组还没有保存过状态的话需要先补上，否则无法确定位置
+		view.Group.GetOrAddState(operation.PreviousID)
+		for i, s := range view.Group.Groups {
+			if s.ID == operation.PreviousID {
+				previousIndex = i + 1
 				break
 			}
 		}
 	}
-
+	view.Group.Groups = util.InsertElem(view.Group.Groups, previousIndex, state)
+	// 拖拽排序后使用手动排序
+	view.Group.Order = ""
 	err = av.SaveAttributeView(attrView)
 	return
 }
 
-func (tx *Transaction) doInsertAttrViewBlock(operation *Operation) (ret *TxErr) {
-	err := AddAttributeViewBlock(tx, operation.Srcs, operation.AvID, operation.BlockID, operation.PreviousID, operation.IgnoreFillFilterVal)
+func (tx *Transaction) doMoveAttrViewBoardCard(operation *Operation) (ret *TxErr) {
+	err := moveAttributeViewBoardCard(operation, tx)
 	if nil != err {
 		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
 	}
 	return
 }
 
-func AddAttributeViewBlock(tx *Transaction, srcs []map[string]interface{}, avID, blockID, previousBlockID string, ignoreFillFilter bool) (err error) {
-	for _, src := range srcs {
-		srcID := src["id"].(string)
-		isDetached := src["isDetached"].(bool)
-		var tree *parse.Tree
-		if !isDetached {
-			var loadErr error
-			if nil != tx {
-				tree, loadErr = tx.loadTree(srcID)
-			} else {
-				tree, loadErr = LoadTreeByBlockID(srcID)
-			}
-			if nil != loadErr {
-				logging.LogErrorf("load tree [%s] failed: %s", srcID, loadErr)
+func moveAttributeViewBoardCard(operation *Operation, tx *Transaction) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
+	}
+
+	if nil == view.Board {
+		return
+	}
+
+	rowID := operation.RowID
+	laneID := operation.ID
+	if "" != view.Board.GroupKeyID {
+		groupKey, getErr := attrView.GetKey(view.Board.GroupKeyID)
+		if nil != getErr {
+			err = getErr
+			return
+		}
+
+		val := attrView.GetValue(groupKey.ID, rowID)
+		if av.GetBoardLaneID(val) != laneID {
+			// 移动到其他泳道时需要更新分组列的值
+			cellID := ast.NewNodeID()
+			if nil != val {
+				cellID = val.ID
+			}
+
+			var valueData interface{}
+			switch groupKey.Type {
+			case av.KeyTypeSelect:
+				mSelect := []*av.ValueSelect{}
+				if av.BoardLaneNone != laneID {
+					opt := &av.ValueSelect{Content: laneID}
+					for _, o := range groupKey.Options {
+						if o.Name == laneID {
+							opt.Color = o.Color
+							break
+						}
+					}
+					mSelect = append(mSelect, opt)
+				}
+				valueData = map[string]interface{}{"mSelect": mSelect}
+			case av.KeyTypeCheckbox:
+				valueData = map[string]interface{}{"checkbox": &av.ValueCheckbox{Checked: av.BoardLaneChecked == laneID}}
+			}
+
+			if err = UpdateAttributeViewCell(tx, attrView.ID, groupKey.ID, rowID, cellID, valueData); nil != err {
+				return
+			}
+
+			// 更新单元格时已经保存过属性视图，这里需要重新读取后再更新泳道内排序
+			if attrView, err = av.ParseAttributeView(operation.AvID); nil != err {
+				return
+			}
+			if view, err = getAttrViewViewByBlockID(attrView, operation.BlockID); nil != err {
+				return
+			}
+		}
+	}
+
+	view.Board.RemoveRow(rowID)
+	lane := view.Board.GetOrAddLane(laneID)
+	previousIndex := 0
+	if "" != operation.PreviousID {
+		if !gulu.Str.Contains(operation.PreviousID, lane.RowIDs) {
+			lane.RowIDs = append(lane.RowIDs, operation.PreviousID)
+		}
+		for i, id := range lane.RowIDs {
+			if id == operation.PreviousID {
+				previousIndex = i + 1
+				break
+			}
+		}
+	}
+	lane.RowIDs = util.InsertElem(lane.RowIDs, previousIndex, rowID)
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func getDateLayoutKeyID(attrView *av.AttributeView, keyID string) string {
+	if "" != keyID {
+		if key, _ := attrView.GetKey(keyID); nil != key && av.IsDateLayoutKeyType(key.Type) {
+			return key.ID
+		}
+	}
+
+	// 未指定日期列时使用第一个日期列
+	for _, kv := range attrView.KeyValues {
+		if av.IsDateLayoutKeyType(kv.Key.Type) {
+			return kv.Key.ID
+		}
+	}
+	return ""
+}
+
+func (tx *Transaction) doSetAttrViewDateLayoutKeys(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewDateLayoutKeys(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func setAttributeViewDateLayoutKeys(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
+	}
+
+	data := operation.Data.(map[string]interface{})
+	var startKeyID, endKeyID string
+	if nil != data["startKeyID"] {
+		startKeyID = data["startKeyID"].(string)
+	}
+	if nil != data["endKeyID"] {
+		endKeyID = data["endKeyID"].(string)
+	}
+
+	for _, keyID := range []string{startKeyID, endKeyID} {
+		if "" == keyID {
+			continue
+		}
+
+		key, getErr := attrView.GetKey(keyID)
+		if nil != getErr {
+			err = getErr
+			return
+		}
+		if !av.IsDateLayoutKeyType(key.Type) {
+			err = av.ErrInvalidDateKey
+			return
+		}
+	}
+
+	switch view.LayoutType {
+	case av.LayoutTypeCalendar:
+		view.Calendar.StartKeyID = startKeyID
+		view.Calendar.EndKeyID = endKeyID
+	case av.LayoutTypeTimeline:
+		view.Timeline.StartKeyID = startKeyID
+		view.Timeline.EndKeyID = endKeyID
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func (tx *Transaction) doSetAttrViewCalendarMode(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewCalendarMode(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func setAttributeViewCalendarMode(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
+	}
+
+	if nil == view.Calendar {
+		return
+	}
+
+	mode := av.CalendarMode(operation.Data.(string))
+	switch mode {
+	case av.CalendarModeMonth, av.CalendarModeWeek:
+		view.Calendar.Mode = mode
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func (tx *Transaction) doSetAttrViewTimelineScale(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewTimelineScale(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func setAttributeViewTimelineScale(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
+	}
+
+	if nil == view.Timeline {
+		return
+	}
+
+	scale := av.TimelineScale(operation.Data.(string))
+	switch scale {
+	case av.TimelineScaleDay, av.TimelineScaleWeek, av.TimelineScaleMonth, av.TimelineScaleQuarter, av.TimelineScaleYear:
+		view.Timeline.Scale = scale
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func (tx *Transaction) doSetAttrViewViewName(operation *Operation) (ret *TxErr) {
+	var err error
+	avID := operation.AvID
+	attrView, err := av.ParseAttributeView(avID)
+	if nil != err {
+		logging.LogErrorf("parse attribute view [%s] failed: %s", avID, err)
+		return &TxErr{code: TxErrWriteAttributeView, id: avID}
+	}
+
+	viewID := operation.ID
+	view := attrView.GetView(viewID)
+	if nil == view {
+		logging.LogErrorf("get view [%s] failed: %s", viewID, err)
+		return &TxErr{code: TxErrWriteAttributeView, id: viewID}
+	}
+
+	view.Name = strings.TrimSpace(operation.Data.(string))
+	if err = av.SaveAttributeView(attrView); nil != err {
+		logging.LogErrorf("save attribute view [%s] failed: %s", avID, err)
+		return &TxErr{code: TxErrWriteAttributeView, msg: err.Error(), id: avID}
+	}
+	return
+}
+
+func (tx *Transaction) doSetAttrViewViewIcon(operation *Operation) (ret *TxErr) {
+	var err error
+	avID := operation.AvID
+	attrView, err := av.ParseAttributeView(avID)
+	if nil != err {
+		logging.LogErrorf("parse attribute view [%s] failed: %s", avID, err)
+		return &TxErr{code: TxErrWriteAttributeView, id: avID}
+	}
+
+	viewID := operation.ID
+	view := attrView.GetView(viewID)
+	if nil == view {
+		logging.LogErrorf("get view [%s] failed: %s", viewID, err)
+		return &TxErr{code: TxErrWriteAttributeView, id: viewID}
+	}
+
+	view.Icon = operation.Data.(string)
+	if err = av.SaveAttributeView(attrView); nil != err {
+		logging.LogErrorf("save attribute view [%s] failed: %s", avID, err)
+		return &TxErr{code: TxErrWriteAttributeView, msg: err.Error(), id: avID}
+	}
+	return
+}
+
+func (tx *Transaction) doSetAttrViewName(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewName(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+const attrAvNameTpl = `<span data-av-id="${avID}" data-popover-url="/api/av/getMirrorDatabaseBlocks" class="popover__block">${avName}</span>`
+
+func setAttributeViewName(operation *Operation) (err error) {
+	avID := operation.ID
+	attrView, err := av.ParseAttributeView(avID)
+	if nil != err {
+		return
+	}
+
+	attrView.Name = strings.TrimSpace(operation.Data.(string))
+	err = av.SaveAttributeView(attrView)
+
+	nodes := getAttrViewBoundNodes(attrView)
+	for _, node := range nodes {
+		avNames := getAvNames(node.IALAttr(av.NodeAttrNameAvs))
+		oldAttrs := parse.IAL2Map(node.KramdownIAL)
+		node.SetIALAttr(av.NodeAttrViewNames, avNames)
+		pushBroadcastAttrTransactions(oldAttrs, node)
+	}
+	return
+}
+
+func getAvNames(avIDs string) (ret string) {
+	if "" == avIDs {
+		return
+	}
+	avNames := bytes.Buffer{}
+	nodeAvIDs := strings.Split(avIDs, ",")
+	for _, nodeAvID := range nodeAvIDs {
+		nodeAvName, getErr := av.GetAttributeViewName(nodeAvID)
+		if nil != getErr {
+			continue
+		}
+		if "" == nodeAvName {
+			nodeAvName = Conf.language(105)
+		}
+
+		tpl := strings.ReplaceAll(attrAvNameTpl, "${avID}", nodeAvID)
+		tpl = strings.ReplaceAll(tpl, "${avName}", nodeAvName)
+		avNames.WriteString(tpl)
+		avNames.WriteString("&nbsp;")
+	}
+	if 0 < avNames.Len() {
+		avNames.Truncate(avNames.Len() - 6)
+		ret = avNames.String()
+	}
+	return
+}
+
+func getAttrViewBoundNodes(attrView *av.AttributeView) (ret []*ast.Node) {
+	blockKeyValues := attrView.GetBlockKeyValues()
+	treeMap := map[string]*parse.Tree{}
+	for _, blockKeyValue := range blockKeyValues.Values {
+		if blockKeyValue.IsDetached {
+			continue
+		}
+
+		var tree *parse.Tree
+		tree = treeMap[blockKeyValue.BlockID]
+		if nil == tree {
+			tree, _ = LoadTreeByBlockID(blockKeyValue.BlockID)
+		}
+		if nil == tree {
+			continue
+		}
+		treeMap[blockKeyValue.BlockID] = tree
+
+		node := treenode.GetNodeInTree(tree, blockKeyValue.BlockID)
+		if nil == node {
+			continue
+		}
+
+		ret = append(ret, node)
+	}
+	return
+}
+
+func (tx *Transaction) doSetAttrViewFilters(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewFilters(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func setAttributeViewFilters(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
+	}
+
+	operationData := operation.Data.([]interface{})
+	data, err := gulu.JSON.MarshalJSON(operationData)
+	if nil != err {
+		return
+	}
+
+	if nil != view.GetLayoutTable() {
+		filters := []*av.ViewFilter{}
+		if err = gulu.JSON.UnmarshalJSON(data, &filters); nil != err {
+			return
+		}
+		if err = av.NormalizeFilters(filters); nil != err {
+			return
+		}
+		view.Table.Filters = filters
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func (tx *Transaction) doSetAttrViewSorts(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewSorts(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func setAttributeViewSorts(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
+	}
+
+	operationData := operation.Data.([]interface{})
+	data, err := gulu.JSON.MarshalJSON(operationData)
+	if nil != err {
+		return
+	}
+
+	if nil != view.GetLayoutTable() {
+		if err = gulu.JSON.UnmarshalJSON(data, &view.Table.Sorts); nil != err {
+			return
+		}
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func (tx *Transaction) doSetAttrViewPageSize(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewPageSize(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func setAttributeViewPageSize(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
+	}
+
+	if nil != view.GetLayoutTable() {
+		view.Table.PageSize = int(operation.Data.(float64))
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func (tx *Transaction) doSetAttrViewColCalc(operation *Operation) (ret *TxErr) {
+	err := setAttributeViewColumnCalc(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func setAttributeViewColumnCalc(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	view, err := getAttrViewViewByBlockID(attrView, operation.BlockID)
+	if nil != err {
+		return
+	}
+
+	operationData := operation.Data.(interface{})
+	data, err := gulu.JSON.MarshalJSON(operationData)
+	if nil != err {
+		return
+	}
+
+	calc := &av.ColumnCalc{}
+	if nil != view.GetLayoutTable() {
+		if err = gulu.JSON.UnmarshalJSON(data, calc); nil != err {
+			return
+		}
+
+		for _, column := range view.Table.Columns {
+			if column.ID == operation.ID {
+				column.Calc = calc
+				break
+			}
+		}
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func (tx *Transaction) doInsertAttrViewBlock(operation *Operation) (ret *TxErr) {
+	err := AddAttributeViewBlock(tx, operation.Srcs, operation.AvID, operation.BlockID, operation.PreviousID, operation.IgnoreFillFilterVal)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func AddAttributeViewBlock(tx *Transaction, srcs []map[string]interface{}, avID, blockID, previousBlockID string, ignoreFillFilter bool) (err error) {
+	for _, src := range srcs {
+		srcID := src["id"].(string)
+		isDetached := src["isDetached"].(bool)
+		var tree *parse.Tree
+		if !isDetached {
+			var loadErr error
+			if nil != tx {
+				tree, loadErr = tx.loadTree(srcID)
+			} else {
+				tree, loadErr = LoadTreeByBlockID(srcID)
+			}
+			if nil != loadErr {
+				logging.LogErrorf("load tree [%s] failed: %s", srcID, loadErr)
 				return loadErr
 			}
 		}
@@ -2278,7 +2883,7 @@ func addAttributeViewBlock(avID, blockID, previousBlockID, addingBlockID, adding
 		IsDetached: isDetached,
 		CreatedAt:  now,
 		UpdatedAt:  now,
-		Block:      &av.ValueBlock{ID: addingBlockID, Content: addingBlockContent, Created: now, Updated: now}}
+		Block:      &av.ValueBlock{ID: addingBlockID, Content: addingBlockContent, Created: now, Updated: now, CreatedBy: Conf.System.Name}}
 	blockValues.Values = append(blockValues.Values, blockValue)
 
 	// 如果存在过滤条件，则将过滤条件应用到新添加的块上
@@ -2366,8 +2971,7 @@ func addAttributeViewBlock(avID, blockID, previousBlockID, addingBlockID, adding
 	}
 
 	for _, v := range attrView.Views {
-		switch v.LayoutType {
-		case av.LayoutTypeTable:
+		if nil != v.GetLayoutTable() {
 			if "" != previousBlockID {
 				changed := false
 				for i, id := range v.Table.RowIDs {
@@ -2440,6 +3044,9 @@ func removeAttributeViewBlock(srcIDs []string, avID string, tx *Transaction) (er
 	for _, view := range attrView.Views {
 		for _, blockID := range srcIDs {
 			view.Table.RowIDs = gulu.Str.RemoveElem(view.Table.RowIDs, blockID)
+			if nil != view.Board {
+				view.Board.RemoveRow(blockID)
+			}
 		}
 	}
 
@@ -2511,8 +3118,7 @@ func setAttributeViewColWidth(operation *Operation) (err error) {
 		return
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
+	if nil != view.GetLayoutTable() {
 		for _, column := range view.Table.Columns {
 			if column.ID == operation.ID {
 				column.Width = operation.Data.(string)
@@ -2544,8 +3150,7 @@ func setAttributeViewColWrap(operation *Operation) (err error) {
 		return
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
+	if nil != view.GetLayoutTable() {
 		for _, column := range view.Table.Columns {
 			if column.ID == operation.ID {
 				column.Wrap = operation.Data.(bool)
@@ -2577,8 +3182,7 @@ func setAttributeViewColHidden(operation *Operation) (err error) {
 		return
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
+	if nil != view.GetLayoutTable() {
 		for _, column := range view.Table.Columns {
 			if column.ID == operation.ID {
 				column.Hidden = operation.Data.(bool)
@@ -2610,8 +3214,7 @@ func setAttributeViewColPin(operation *Operation) (err error) {
 		return
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
+	if nil != view.GetLayoutTable() {
 		for _, column := range view.Table.Columns {
 			if column.ID == operation.ID {
 				column.Pin = operation.Data.(bool)
@@ -2688,8 +3291,7 @@ func sortAttributeViewRow(operation *Operation) (err error) {
 		idx = len(view.Table.RowIDs) - 1
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
+	if nil != view.GetLayoutTable() {
 		view.Table.RowIDs = append(view.Table.RowIDs[:idx], view.Table.RowIDs[idx+1:]...)
 		for i, r := range view.Table.RowIDs {
 			if r == operation.PreviousID {
@@ -2728,8 +3330,7 @@ func SortAttributeViewKey(avID, blockID, keyID, previousKeyID string) (err error
 		return
 	}
 
-	switch view.LayoutType {
-	case av.LayoutTypeTable:
+	if nil != view.GetLayoutTable() {
 		var col *av.ViewTableColumn
 		var index, previousIndex int
 		for i, column := range view.Table.Columns {
@@ -2780,7 +3381,7 @@ func AddAttributeViewKey(avID, keyID, keyName, keyType, keyIcon, previousKeyID s
 	switch keyTyp {
 	case av.KeyTypeText, av.KeyTypeNumber, av.KeyTypeDate, av.KeyTypeSelect, av.KeyTypeMSelect, av.KeyTypeURL, av.KeyTypeEmail,
 		av.KeyTypePhone, av.KeyTypeMAsset, av.KeyTypeTemplate, av.KeyTypeCreated, av.KeyTypeUpdated, av.KeyTypeCheckbox,
-		av.KeyTypeRelation, av.KeyTypeRollup, av.KeyTypeLineNumber:
+		av.KeyTypeRelation, av.KeyTypeRollup, av.KeyTypeLineNumber, av.KeyTypeFormula, av.KeyTypeUniqueID, av.KeyTypeCreatedBy:
 
 		key := av.NewKey(keyID, keyName, keyIcon, keyTyp)
 		if av.KeyTypeRollup == keyTyp {
@@ -2790,11 +3391,10 @@ func AddAttributeViewKey(avID, keyID, keyName, keyType, keyIcon, previousKeyID s
 		attrView.KeyValues = append(attrView.KeyValues, &av.KeyValues{Key: key})
 
 		for _, view := range attrView.Views {
-			switch view.LayoutType {
-			case av.LayoutTypeTable:
+			if nil != view.GetLayoutTable() {
 				if "" == previousKeyID {
 					view.Table.Columns = append([]*av.ViewTableColumn{{ID: key.ID}}, view.Table.Columns...)
-					break
+					continue
 				}
 
 				added := false
@@ -2845,6 +3445,86 @@ func updateAttributeViewColTemplate(operation *Operation) (err error) {
 	return
 }
 
+func (tx *Transaction) doUpdateAttrViewColFormula(operation *Operation) (ret *TxErr) {
+	err := updateAttributeViewColFormula(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func updateAttributeViewColFormula(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	colType := av.KeyType(operation.Typ)
+	switch colType {
+	case av.KeyTypeFormula:
+		var keys []*av.Key
+		for _, keyValues := range attrView.KeyValues {
+			keys = append(keys, keyValues.Key)
+		}
+
+		for _, keyValues := range attrView.KeyValues {
+			if keyValues.Key.ID == operation.ID && av.KeyTypeFormula == keyValues.Key.Type {
+				// 保存前先解析公式，公式有误时不保存，循环引用需要使用新公式才能检测出来
+				keyValues.Key.Formula = operation.Data.(string)
+				if _, err = av.CompileFormula(keyValues.Key.Formula, keys); nil != err {
+					return
+				}
+				break
+			}
+		}
+	}
+
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
+func (tx *Transaction) doUpdateAttrViewColUniqueID(operation *Operation) (ret *TxErr) {
+	err := updateAttributeViewColUniqueID(operation)
+	if nil != err {
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	return
+}
+
+func updateAttributeViewColUniqueID(operation *Operation) (err error) {
+	attrView, err := av.ParseAttributeView(operation.AvID)
+	if nil != err {
+		return
+	}
+
+	key, err := attrView.GetKey(operation.ID)
+	if nil != err {
+		return
+	}
+
+	if av.KeyTypeUniqueID != key.Type {
+		return
+	}
+
+	data, err := gulu.JSON.MarshalJSON(operation.Data)
+	if nil != err {
+		return
+	}
+	uniqueID := &av.UniqueID{}
+	if err = gulu.JSON.UnmarshalJSON(data, uniqueID); nil != err {
+		return
+	}
+
+	if nil == key.UniqueID {
+		key.UniqueID = &av.UniqueID{}
+	}
+	// 只能修改前缀和位数，下一个编号由内核维护，保证编号不会重复使用
+	key.UniqueID.Prefix = uniqueID.Prefix
+	key.UniqueID.Digits = max(0, min(uniqueID.Digits, 16))
+	err = av.SaveAttributeView(attrView)
+	return
+}
+
 func (tx *Transaction) doUpdateAttrViewColNumberFormat(operation *Operation) (ret *TxErr) {
 	err := updateAttributeViewColNumberFormat(operation)
 	if nil != err {
@@ -2861,9 +3541,9 @@ func updateAttributeViewColNumberFormat(operation *Operation) (err error) {
 
 	colType := av.KeyType(operation.Typ)
 	switch colType {
-	case av.KeyTypeNumber:
+	case av.KeyTypeNumber, av.KeyTypeFormula: // 公式列的数字结果也使用列数字格式化
 		for _, keyValues := range attrView.KeyValues {
-			if keyValues.Key.ID == operation.ID && av.KeyTypeNumber == keyValues.Key.Type {
+			if keyValues.Key.ID == operation.ID && colType == keyValues.Key.Type {
 				keyValues.Key.NumberFormat = av.NumberFormat(operation.Format)
 				break
 			}
@@ -2892,16 +3572,46 @@ func updateAttributeViewColumn(operation *Operation) (err error) {
 	switch colType {
 	case av.KeyTypeBlock, av.KeyTypeText, av.KeyTypeNumber, av.KeyTypeDate, av.KeyTypeSelect, av.KeyTypeMSelect, av.KeyTypeURL, av.KeyTypeEmail,
 		av.KeyTypePhone, av.KeyTypeMAsset, av.KeyTypeTemplate, av.KeyTypeCreated, av.KeyTypeUpdated, av.KeyTypeCheckbox,
-		av.KeyTypeRelation, av.KeyTypeRollup, av.KeyTypeLineNumber:
+		av.KeyTypeRelation, av.KeyTypeRollup, av.KeyTypeLineNumber, av.KeyTypeFormula, av.KeyTypeUniqueID, av.KeyTypeCreatedBy:
 		for _, keyValues := range attrView.KeyValues {
 			if keyValues.Key.ID == operation.ID {
+				oldName := keyValues.Key.Name
 				keyValues.Key.Name = strings.TrimSpace(operation.Name)
 				keyValues.Key.Type = colType
+				attrView.RenameFormulaProp(oldName, keyValues.Key.Name)
 				break
 			}
 		}
 	}
 
+	if !av.IsBoardGroupKeyType(colType) {
+		// 分组列类型变更为不支持分组的类型后看板不再分组
+		for _, view := range attrView.Views {
+			if nil != view.Board && operation.ID == view.Board.GroupKeyID {
+				view.Board.SetGroupKey("")
+			}
+		}
+	}
+
+	if !av.IsDateLayoutKeyType(colType) {
+		for _, view := range attrView.Views {
+			if nil != view.Calendar {
+				view.Calendar.RemoveKey(operation.ID)
+			}
+			if nil != view.Timeline {
+				view.Timeline.RemoveKey(operation.ID)
+			}
+		}
+	}
+
+	for _, view := range attrView.Views {
+		if nil != view.Group && operation.ID == view.Group.Field && !av.IsValidGroupMethod(colType, view.Group.Method) {
+			// 分组列类型变更后分组方式和分组 ID 都不再适用
+			view.Group.Method = av.GetDefaultGroupMethod(colType)
+			view.Group.Groups = []*av.ViewGroupState{}
+		}
+	}
+
 	err = av.SaveAttributeView(attrView)
 	return
 }
@@ -2948,8 +3658,7 @@ func RemoveAttributeViewKey(avID, keyID string) (err error) {
 				}
 
 				for _, view := range destAv.Views {
-					switch view.LayoutType {
-					case av.LayoutTypeTable:
+					if nil != view.GetLayoutTable() {
 						for i, column := range view.Table.Columns {
 							if column.ID == removedKey.Relation.BackKeyID {
 								view.Table.Columns = append(view.Table.Columns[:i], view.Table.Columns[i+1:]...)
@@ -2980,14 +3689,31 @@ func RemoveAttributeViewKey(avID, keyID string) (err error) {
 	}
 
 	for _, view := range attrView.Views {
-		switch view.LayoutType {
-		case av.LayoutTypeTable:
+		if nil != view.GetLayoutTable() {
 			for i, column := range view.Table.Columns {
 				if column.ID == keyID {
 					view.Table.Columns = append(view.Table.Columns[:i], view.Table.Columns[i+1:]...)
 					break
 				}
 			}
+
+			if nil != view.Board && keyID == view.Board.GroupKeyID {
+				// 分组列被删除后看板不再分组
+				view.Board.SetGroupKey("")
+			}
+
+			// 日期列被删除后日历和时间线中的条目都变为未安排
+			if nil != view.Calendar {
+				view.Calendar.RemoveKey(keyID)
+			}
+			if nil != view.Timeline {
+				view.Timeline.RemoveKey(keyID)
+			}
+		}
+
+		if nil != view.Group && keyID == view.Group.Field {
+			// 分组列被删除后视图不再分组
+			view.Group = nil
 		}
 	}
 
@@ -3055,8 +3781,7 @@ func replaceAttributeViewBlock(operation *Operation, tx *Transaction) (err error
 
 	replacedRowID := false
 	for _, v := range attrView.Views {
-		switch v.LayoutType {
-		case av.LayoutTypeTable:
+		if nil != v.GetLayoutTable() {
 			for i, rowID := range v.Table.RowIDs {
 				if rowID == operation.PreviousID {
 					v.Table.RowIDs[i] = operation.NextID
@@ -3065,6 +3790,10 @@ func replaceAttributeViewBlock(operation *Operation, tx *Transaction) (err error
 				}
 			}
 
+			if nil != v.Board {
+				v.Board.ReplaceRow(operation.PreviousID, operation.NextID)
+			}
+
 			if !replacedRowID {
 				v.Table.RowIDs = append(v.Table.RowIDs, operation.NextID)
 			}
@@ -3118,6 +3847,11 @@ func UpdateAttributeViewCell(tx *Transaction, avID, keyID, rowID, cellID string,
 			continue
 		}
 
+		if av.KeyTypeUniqueID == keyValues.Key.Type || av.KeyTypeCreatedBy == keyValues.Key.Type {
+			// 唯一 ID 和创建者由内核分配，不允许修改
+			return
+		}
+
 		for _, value := range keyValues.Values {
 			if cellID == value.ID || rowID == value.BlockID {
 				val = value
@@ -3442,6 +4176,27 @@ func removeAttributeViewColumnOption(operation *Operation) (err error) {
 		}
 	}
 
+	// 删除选项对应的看板泳道
+	for _, view := range attrView.Views {
+		if nil == view.Board || key.ID != view.Board.GroupKeyID {
+			continue
+		}
+
+		for i, lane := range view.Board.Lanes {
+			if optName == lane.ID {
+				view.Board.Lanes = append(view.Board.Lanes[:i], view.Board.Lanes[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// 删除选项对应的分组状态
+	for _, view := range attrView.Views {
+		if nil != view.Group && key.ID == view.Group.Field {
+			view.Group.RemoveState(optName)
+		}
+	}
+
 	for _, keyValues := range attrView.KeyValues {
 		if keyValues.Key.ID != operation.ID {
 			continue
@@ -3521,14 +4276,35 @@ func updateAttributeViewColumnOption(operation *Operation) (err error) {
 		break
 	}
 
+	// 如果存在选项对应的看板泳道，需要更新泳道 ID
+	for _, view := range attrView.Views {
+		if nil == view.Board || key.ID != view.Board.GroupKeyID {
+			continue
+		}
+
+		if lane := view.Board.GetLane(oldName); nil != lane {
+			lane.ID = newName
+		}
+	}
+
+	// 如果存在选项对应的分组状态，需要更新分组 ID
+	for _, view := range attrView.Views {
+		if nil == view.Group || key.ID != view.Group.Field {
+			continue
+		}
+
+		if state := view.Group.GetState(oldName); nil != state {
+			state.ID = newName
+		}
+	}
+
 	// 如果存在选项对应的过滤器，需要更新过滤器中设置的选项值
 	// Database select field filters follow option editing changes https://github.com/siyuan-note/siyuan/issues/10881
 	for _, view := range attrView.Views {
-		switch view.LayoutType {
-		case av.LayoutTypeTable:
+		if nil != view.GetLayoutTable() {
 			table := view.Table
-			for _, filter := range table.Filters {
-				if filter.Column != key.ID {
+			for _, filter := range av.GetLeafFilters(table.Filters) {
+				if filter.Column != key.ID || "" != filter.SubKeyID {
 					continue
 				}
 
@@ -0,0 +1,612 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/88250/lute/ast"
+	"github.com/araddon/dateparse"
+	"github.com/siyuan-community/siyuan/kernel/av"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
+	"github.com/xuri/excelize/v2"
+)
+
+// AttributeViewImportResult 描述了导入表格文件到属性视图的结果。
+type AttributeViewImportResult struct {
+	AvID    string                      `json:"avID"`    // 属性视图 ID
+	Created int                         `json:"created"` // 新增的行数
+	Updated int                         `json:"updated"` // 更新的行数
+	Skipped int                         `json:"skipped"` // 跳过的空行数
+	Errors  []*AttributeViewImportError `json:"errors"`  // 导入错误
+}
+
+// AttributeViewImportError 描述了导入时某一行的错误，Row 为文件中的行号（表头为第 1 行），为 0 时表示整列的错误。
+type AttributeViewImportError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column"`
+	Msg    string `json:"msg"`
+}
+
+var (
+	ErrImportAvEmptyFile    = errors.New("no header found in file")
+	ErrImportAvUnsupported  = errors.New("unsupported file type, only .csv, .tsv and .xlsx are supported")
+	ErrImportAvMatchKeyMiss = errors.New("match key not found in file header or attribute view")
+	ErrImportAvDocNotFound  = errors.New("doc not found, a doc is required to insert the database block of the new attribute view")
+	ErrImportAvTimeout      = errors.New("import attribute view timeout")
+)
+
+// ImportAttributeView 将 CSV、TSV 或者 XLSX 文件导入到属性视图中。
+//
+// avID 为空时新建属性视图，文件的第一列作为主键，并在 docID 文档末尾插入数据库块；否则按照列名将文件列对应到已有的列上，没有对应上的列会新建。
+// mapping 指定新建列的类型（键为文件列名），没有指定时根据列中的数据推断。
+// matchKey 不为空时使用该列的值匹配已有的行并更新，没有匹配上的行会新增。
+// bindBlocks 为 true 时如果主键列的值是已经存在的块 ID，则绑定该块，否则都新建为非绑定块。
+//
+// 导入在事务中进行，避免和编辑器的事务同时修改属性视图。
+func ImportAttributeView(filePath, avID, docID, matchKey string, mapping map[string]av.KeyType, bindBlocks bool) (ret *AttributeViewImportResult, err error) {
+	records, err := readAttributeViewImportFile(filePath)
+	if nil != err {
+		return
+	}
+	if 1 > len(records) {
+		err = ErrImportAvEmptyFile
+		return
+	}
+	if "" == avID && nil == treenode.GetBlockTree(docID) {
+		// 新建的属性视图需要插入数据库块，否则会成为没有数据库块引用的孤立数据
+		err = ErrImportAvDocNotFound
+		return
+	}
+
+	imp := &attributeViewImport{
+		name:       strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)),
+		records:    records,
+		avID:       avID,
+		matchKey:   matchKey,
+		mapping:    mapping,
+		bindBlocks: bindBlocks,
+		done:       make(chan struct{}),
+	}
+	ops := []*Operation{{Action: "importAttrView", AvID: avID, Data: imp}}
+	var insertOp *Operation
+	if "" == avID {
+		imp.avID, imp.isNew = ast.NewNodeID(), true
+		node := &ast.Node{ID: ast.NewNodeID(), Type: ast.NodeAttributeView, AttributeViewID: imp.avID, AttributeViewType: string(av.LayoutTypeTable)}
+		node.SetIALAttr("id", node.ID)
+		ops[0].AvID, ops[0].BlockID = imp.avID, node.ID
+		insertOp = &Operation{Action: "appendInsert", ParentID: docID, Data: util.NewLute().RenderNodeBlockDOM(node)}
+		ops = append(ops, insertOp)
+	}
+
+	transactions := []*Transaction{{DoOperations: ops}}
+	PerformTransactions(&transactions)
+	select {
+	case <-imp.done:
+	case <-time.After(time.Minute):
+		err = ErrImportAvTimeout
+		return
+	}
+	WaitForWritingFiles()
+
+	ret, err = imp.result, imp.err
+	if nil == err && nil != insertOp {
+		// 只推送插入数据库块的操作，导入操作不需要前端处理
+		evt := util.NewCmdResult("transactions", 0, util.PushModeBroadcast)
+		evt.Data = []*Transaction{{DoOperations: []*Operation{insertOp}}}
+		util.PushEvent(evt)
+	}
+	return
+}
+
+// attributeViewImport 描述了一次导入，在事务中执行导入后写回结果。
+type attributeViewImport struct {
+	name       string
+	records    [][]string
+	avID       string
+	matchKey   string
+	mapping    map[string]av.KeyType
+	bindBlocks bool
+	isNew      bool
+
+	boundBlockIDs []string
+	result        *AttributeViewImportResult
+	err           error
+	done          chan struct{}
+}
+
+func (tx *Transaction) doImportAttrView(operation *Operation) (ret *TxErr) {
+	imp := operation.Data.(*attributeViewImport)
+	defer close(imp.done)
+
+	var attrView *av.AttributeView
+	attrView, imp.result, imp.err = importAttributeView(tx, imp)
+	if nil != imp.err {
+		// 导入数据有误时没有修改任何数据，错误返回给调用方
+		return
+	}
+
+	if err := av.SaveAttributeView(attrView); nil != err {
+		imp.err = err
+		return &TxErr{code: TxErrWriteAttributeView, id: operation.AvID, msg: err.Error()}
+	}
+	if "" != operation.BlockID {
+		av.UpsertBlockRel(attrView.ID, operation.BlockID)
+	}
+	for _, blockID := range imp.boundBlockIDs {
+		bindBlockAv(tx, attrView.ID, blockID)
+	}
+	return
+}
+
+func importAttributeView(tx *Transaction, imp *attributeViewImport) (attrView *av.AttributeView, ret *AttributeViewImportResult, err error) {
+	records := imp.records
+	header := records[0]
+	records = records[1:]
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		if "" == header[i] {
+			header[i] = fmt.Sprintf("Column %d", i+1)
+		}
+	}
+
+	ret = &AttributeViewImportResult{Errors: []*AttributeViewImportError{}}
+	isNewAv := imp.isNew
+	if isNewAv {
+		attrView = av.NewAttributeView(imp.avID)
+		attrView.Name = imp.name
+
+		// 新建的属性视图只保留主键列，主键列使用文件的第一列
+		blockKeyValues := attrView.GetBlockKeyValues()
+		blockKeyValues.Key.Name = header[0]
+		attrView.KeyValues = []*av.KeyValues{blockKeyValues}
+		for _, view := range attrView.Views {
+			view.Table.Columns = []*av.ViewTableColumn{{ID: blockKeyValues.Key.ID}}
+		}
+	} else {
+		attrView, err = av.ParseAttributeView(imp.avID)
+		if nil != err {
+			return
+		}
+	}
+	ret.AvID = attrView.ID
+
+	// 将文件列对应到属性视图的列上
+	columns := make([]*av.KeyValues, len(header))
+	for i, name := range header {
+		if isNewAv && 0 == i {
+			columns[i] = attrView.GetBlockKeyValues()
+			continue
+		}
+
+		for _, keyValues := range attrView.KeyValues {
+			if keyValues.Key.Name == name {
+				columns[i] = keyValues
+				break
+			}
+		}
+		if nil != columns[i] {
+			if !isImportableKeyType(columns[i].Key.Type) {
+				ret.Errors = append(ret.Errors, &AttributeViewImportError{Column: name, Msg: fmt.Sprintf("column type [%s] does not support import", columns[i].Key.Type)})
+				columns[i] = nil
+			}
+			continue
+		}
+
+		keyType := imp.mapping[name]
+		if "" == keyType {
+			keyType = inferAttributeViewImportKeyType(records, i)
+		} else if !isImportableKeyType(keyType) || av.KeyTypeBlock == keyType {
+			ret.Errors = append(ret.Errors, &AttributeViewImportError{Column: name, Msg: fmt.Sprintf("column type [%s] does not support import, use text instead", keyType)})
+			keyType = av.KeyTypeText
+		}
+
+		key := av.NewKey(ast.NewNodeID(), name, "", keyType)
+		columns[i] = &av.KeyValues{Key: key}
+		attrView.KeyValues = append(attrView.KeyValues, columns[i])
+		for _, view := range attrView.Views {
+			if nil != view.GetLayoutTable() {
+				view.Table.Columns = append(view.Table.Columns, &av.ViewTableColumn{ID: key.ID})
+			}
+		}
+	}
+
+	// 根据匹配列的值建立索引，用于更新已有的行
+	matchIndex, matched := -1, map[string]string{}
+	if "" != imp.matchKey && !isNewAv {
+		for i, name := range header {
+			if name == imp.matchKey && nil != columns[i] {
+				matchIndex = i
+				break
+			}
+		}
+		if -1 == matchIndex {
+			err = ErrImportAvMatchKeyMiss
+			return
+		}
+
+		for _, v := range columns[matchIndex].Values {
+			if content := strings.TrimSpace(v.String(false)); "" != content {
+				matched[content] = v.BlockID
+			}
+		}
+	}
+
+	blockKeyValues := attrView.GetBlockKeyValues()
+	blockIndex := -1
+	for i, keyValues := range columns {
+		if keyValues == blockKeyValues {
+			blockIndex = i
+			break
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	for i, record := range records {
+		rowNum := i + 2
+		if isEmptyImportRecord(record) {
+			ret.Skipped++
+			continue
+		}
+
+		var blockID string
+		if -1 < matchIndex && matchIndex < len(record) {
+			blockID = matched[strings.TrimSpace(record[matchIndex])]
+		}
+
+		if "" != blockID {
+			ret.Updated++
+		} else {
+			var content string
+			if -1 < blockIndex && blockIndex < len(record) {
+				content = strings.TrimSpace(record[blockIndex])
+			}
+
+			isDetached := true
+			blockID = ast.NewNodeID()
+			if imp.bindBlocks && ast.IsNodeIDPattern(content) && nil != treenode.GetBlockTree(content) && !attrView.ExistBlock(content) {
+				node, _, getErr := getNodeByBlockID(tx, content)
+				if nil != node {
+					isDetached = false
+					blockID = content
+					content = getNodeRefText(node)
+					imp.boundBlockIDs = append(imp.boundBlockIDs, blockID)
+				} else if nil != getErr {
+					ret.Errors = append(ret.Errors, &AttributeViewImportError{Row: rowNum, Column: header[blockIndex], Msg: getErr.Error()})
+				}
+			}
+
+			blockKeyValues.Values = append(blockKeyValues.Values, &av.Value{
+				ID:         ast.NewNodeID(),
+				KeyID:      blockKeyValues.Key.ID,
+				BlockID:    blockID,
+				Type:       av.KeyTypeBlock,
+				IsDetached: isDetached,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+				Block:      &av.ValueBlock{ID: blockID, Content: content, Created: now, Updated: now, CreatedBy: Conf.System.Name},
+			})
+			for _, view := range attrView.Views {
+				if nil != view.GetLayoutTable() {
+					view.Table.RowIDs = append(view.Table.RowIDs, blockID)
+				}
+			}
+			ret.Created++
+		}
+
+		blockValue := attrView.GetValue(blockKeyValues.Key.ID, blockID)
+		for j, keyValues := range columns {
+			if nil == keyValues || j >= len(record) {
+				continue
+			}
+
+			cell := strings.TrimSpace(record[j])
+			if "" == cell {
+				// 空白单元格不覆盖已有的值
+				continue
+			}
+
+			if keyValues == blockKeyValues {
+				if nil != blockValue && blockValue.IsDetached {
+					blockValue.Block.Content = cell
+					blockValue.Block.Updated = now
+					blockValue.UpdatedAt = now
+				}
+				continue
+			}
+
+			val, parseErr := parseAttributeViewImportValue(keyValues.Key, cell)
+			if nil != parseErr {
+				ret.Errors = append(ret.Errors, &AttributeViewImportError{Row: rowNum, Column: header[j], Msg: parseErr.Error()})
+				continue
+			}
+
+			upsertAttributeViewImportValue(keyValues, blockID, nil != blockValue && blockValue.IsDetached, val, now)
+		}
+	}
+
+	return
+}
+
+func readAttributeViewImportFile(filePath string) (ret [][]string, err error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".csv", ".tsv", ".tab":
+		f, openErr := os.Open(filePath)
+		if nil != openErr {
+			err = openErr
+			logging.LogErrorf("open [%s] failed: %s", filePath, err)
+			return
+		}
+		defer f.Close()
+
+		reader := csv.NewReader(f)
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		if ".csv" != strings.ToLower(filepath.Ext(filePath)) {
+			reader.Comma = '\t'
+		}
+		if ret, err = reader.ReadAll(); nil != err {
+			logging.LogErrorf("read [%s] failed: %s", filePath, err)
+			return
+		}
+	case ".xlsx":
+		x, openErr := excelize.OpenFile(filePath)
+		if nil != openErr {
+			err = openErr
+			logging.LogErrorf("open [%s] failed: %s", filePath, err)
+			return
+		}
+		defer x.Close()
+
+		// 仅导入第一个工作表
+		sheetName := x.GetSheetName(0)
+		if ret, err = x.GetRows(sheetName); nil != err {
+			logging.LogErrorf("get rows from sheet [%s] failed: %s", sheetName, err)
+			return
+		}
+	default:
+		err = ErrImportAvUnsupported
+		return
+	}
+
+	if 0 < len(ret) && 0 < len(ret[0]) {
+		// 去掉 Microsoft Excel 导出时写入的 UTF-8 BOM
+		ret[0][0] = strings.TrimPrefix(ret[0][0], "\xEF\xBB\xBF")
+	}
+	return
+}
+
+func isImportableKeyType(keyType av.KeyType) bool {
+	switch keyType {
+	case av.KeyTypeBlock, av.KeyTypeText, av.KeyTypeNumber, av.KeyTypeDate, av.KeyTypeSelect, av.KeyTypeMSelect, av.KeyTypeURL,
+		av.KeyTypeEmail, av.KeyTypePhone, av.KeyTypeMAsset, av.KeyTypeCheckbox:
+		return true
+	}
+	return false
+}
+
+func isEmptyImportRecord(record []string) bool {
+	for _, cell := range record {
+		if "" != strings.TrimSpace(cell) {
+			return false
+		}
+	}
+	return true
+}
+
+var importEmailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// inferAttributeViewImportKeyType 根据列中所有非空单元格的值推断列类型，无法推断时使用文本类型。
+func inferAttributeViewImportKeyType(records [][]string, index int) av.KeyType {
+	isCheckbox, isNumber, isDate, isURL, isEmail := true, true, true, true, true
+	count := 0
+	for _, record := range records {
+		if index >= len(record) {
+			continue
+		}
+
+		cell := strings.TrimSpace(record[index])
+		if "" == cell {
+			continue
+		}
+		count++
+
+		if isCheckbox {
+			switch strings.ToLower(cell) {
+			case "√", "✓", "true", "false", "yes", "no":
+			default:
+				isCheckbox = false
+			}
+		}
+		if isNumber {
+			if _, err := parseImportNumber(cell); nil != err {
+				isNumber = false
+			}
+		}
+		if isDate && !isNumber {
+			if _, _, _, err := parseImportDate(cell); nil != err {
+				isDate = false
+			}
+		}
+		if isURL && !strings.HasPrefix(cell, "http://") && !strings.HasPrefix(cell, "https://") {
+			isURL = false
+		}
+		if isEmail && !importEmailRegexp.MatchString(cell) {
+			isEmail = false
+		}
+	}
+
+	switch {
+	case 1 > count:
+		return av.KeyTypeText
+	case isCheckbox:
+		return av.KeyTypeCheckbox
+	case isNumber:
+		return av.KeyTypeNumber
+	case isDate:
+		return av.KeyTypeDate
+	case isURL:
+		return av.KeyTypeURL
+	case isEmail:
+		return av.KeyTypeEmail
+	}
+	return av.KeyTypeText
+}
+
+func parseImportNumber(cell string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(cell, ",", ""), 64)
+}
+
+// parseImportDate 解析日期，支持导出 CSV 时使用的 "开始 → 结束" 格式。
+func parseImportDate(cell string) (start, end int64, isNotTime bool, err error) {
+	parts := strings.Split(cell, "→")
+	t, err := dateparse.ParseIn(strings.TrimSpace(parts[0]), time.Now().Location())
+	if nil != err {
+		return
+	}
+	start = t.UnixMilli()
+	isNotTime = !strings.Contains(parts[0], ":")
+
+	if 1 < len(parts) {
+		t2, parseErr := dateparse.ParseIn(strings.TrimSpace(parts[1]), time.Now().Location())
+		if nil != parseErr {
+			err = parseErr
+			return
+		}
+		end = t2.UnixMilli()
+	}
+	return
+}
+
+var importAssetRegexp = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)]+)\)`)
+
+// parseAttributeViewImportValue 按照列类型解析单元格的内容。
+func parseAttributeViewImportValue(key *av.Key, cell string) (ret *av.Value, err error) {
+	ret = &av.Value{Type: key.Type}
+	switch key.Type {
+	case av.KeyTypeText:
+		ret.Text = &av.ValueText{Content: cell}
+	case av.KeyTypeNumber:
+		num, parseErr := parseImportNumber(cell)
+		if nil != parseErr {
+			err = fmt.Errorf("invalid number [%s]", cell)
+			return
+		}
+		ret.Number = av.NewFormattedValueNumber(num, key.NumberFormat)
+	case av.KeyTypeDate:
+		start, end, isNotTime, parseErr := parseImportDate(cell)
+		if nil != parseErr {
+			err = fmt.Errorf("invalid date [%s]", cell)
+			return
+		}
+		ret.Date = av.NewFormattedValueDate(start, end, av.DateFormatNone, isNotTime, 0 != end)
+		ret.Date.IsNotTime = isNotTime
+	case av.KeyTypeSelect, av.KeyTypeMSelect:
+		// 多选使用逗号分隔选项
+		var names []string
+		if av.KeyTypeMSelect == key.Type {
+			names = strings.FieldsFunc(cell, func(r rune) bool { return ',' == r || '，' == r })
+		} else {
+			names = []string{cell}
+		}
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if "" == name {
+				continue
+			}
+			ret.MSelect = append(ret.MSelect, &av.ValueSelect{Content: name, Color: getOrAddImportSelectOption(key, name)})
+		}
+	case av.KeyTypeURL:
+		ret.URL = &av.ValueURL{Content: cell}
+	case av.KeyTypeEmail:
+		ret.Email = &av.ValueEmail{Content: cell}
+	case av.KeyTypePhone:
+		ret.Phone = &av.ValuePhone{Content: cell}
+	case av.KeyTypeCheckbox:
+		switch strings.ToLower(cell) {
+		case "√", "✓", "true", "yes", "1":
+			ret.Checkbox = &av.ValueCheckbox{Checked: true}
+		case "false", "no", "0":
+			ret.Checkbox = &av.ValueCheckbox{Checked: false}
+		default:
+			err = fmt.Errorf("invalid checkbox [%s]", cell)
+			return
+		}
+	case av.KeyTypeMAsset:
+		// 支持导出 CSV 时使用的 Markdown 链接和图片格式，其他内容按空白分隔作为文件链接
+		matches := importAssetRegexp.FindAllStringSubmatch(cell, -1)
+		for _, m := range matches {
+			asset := &av.ValueAsset{Type: av.AssetTypeFile, Name: m[2], Content: m[3]}
+			if "!" == m[1] {
+				asset.Type = av.AssetTypeImage
+			}
+			ret.MAsset = append(ret.MAsset, asset)
+		}
+		for _, link := range strings.Fields(importAssetRegexp.ReplaceAllString(cell, "")) {
+			ret.MAsset = append(ret.MAsset, &av.ValueAsset{Type: av.AssetTypeFile, Name: link, Content: link})
+		}
+	default:
+		err = fmt.Errorf("column type [%s] does not support import", key.Type)
+	}
+	return
+}
+
+// getOrAddImportSelectOption 获取选项的颜色，选项不存在时添加到列上，颜色和前端一样按照选项数量循环使用。
+func getOrAddImportSelectOption(key *av.Key, name string) string {
+	for _, opt := range key.Options {
+		if opt.Name == name {
+			return opt.Color
+		}
+	}
+
+	color := strconv.Itoa(len(key.Options)%13 + 1)
+	key.Options = append(key.Options, &av.SelectOption{Name: name, Color: color})
+	return color
+}
+
+func upsertAttributeViewImportValue(keyValues *av.KeyValues, blockID string, isDetached bool, val *av.Value, now int64) {
+	for i, v := range keyValues.Values {
+		if v.BlockID == blockID {
+			val.ID = v.ID
+			val.KeyID = v.KeyID
+			val.BlockID = v.BlockID
+			val.IsDetached = v.IsDetached
+			val.CreatedAt = v.CreatedAt
+			val.UpdatedAt = now
+			keyValues.Values[i] = val
+			return
+		}
+	}
+
+	val.ID = ast.NewNodeID()
+	val.KeyID = keyValues.Key.ID
+	val.BlockID = blockID
+	val.IsDetached = isDetached
+	val.CreatedAt = now
+	val.UpdatedAt = now
+	keyValues.Values = append(keyValues.Values, val)
+}
@@ -0,0 +1,439 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute/ast"
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
+)
+
+const (
+	maxScheduleRuns     = 20 // 每个定时任务保留的执行记录数
+	minScheduleInterval = 60 // 定时任务最小执行间隔，单位：秒
+)
+
+var (
+	ErrScheduleNotFound      = errors.New("schedule not found")
+	ErrScheduleRunning       = errors.New("schedule is running")
+	ErrScheduleInvalidTiming = fmt.Errorf("schedule must have a cron expression or an interval of at least %d seconds", minScheduleInterval)
+	ErrScheduleInvalidDir    = errors.New("schedule export folder must be a relative path inside the workspace")
+)
+
+var (
+	automationLock    = sync.Mutex{}
+	runningSchedules  = map[string]bool{}
+	initSchedulesOnce = sync.Once{}
+)
+
+// AutomationJob 检查并执行到期的定时任务。
+func AutomationJob() {
+	if util.ReadOnly || !util.IsBooted() {
+		return
+	}
+
+	initSchedulesOnce.Do(initScheduleNextRuns)
+
+	now := time.Now()
+	var dueIDs []string
+	automationLock.Lock()
+	for _, schedule := range Conf.Automation.Schedules {
+		// 下次执行时间在设置任务时计算，为 0 说明 cron 表达式已经没有可以执行的时间
+		if !schedule.Enabled || runningSchedules[schedule.ID] || 1 > schedule.NextRun {
+			continue
+		}
+
+		if now.UnixMilli() >= schedule.NextRun {
+			// 内核停止期间错过的多次执行只补执行一次
+			dueIDs = append(dueIDs, schedule.ID)
+		}
+	}
+	automationLock.Unlock()
+
+	for _, id := range dueIDs {
+		go func(id string) {
+			defer logging.Recover()
+			if _, err := runSchedule(id, false); nil != err {
+				logging.LogWarnf("run schedule [%s] failed: %s", id, err)
+			}
+		}(id)
+	}
+}
+
+// initScheduleNextRuns 为升级前保存的、还没有下次执行时间的已启用任务计算下次执行时间，只在启动后执行一次。
+func initScheduleNextRuns() {
+	automationLock.Lock()
+	defer automationLock.Unlock()
+
+	now := time.Now()
+	changed := false
+	for _, schedule := range Conf.Automation.Schedules {
+		if schedule.Enabled && 1 > schedule.NextRun {
+			schedule.NextRun = getScheduleNextRun(schedule, now)
+			changed = true
+		}
+	}
+	if changed {
+		Conf.Save()
+	}
+}
+
+func GetSchedules() (ret []*conf.Schedule) {
+	automationLock.Lock()
+	defer automationLock.Unlock()
+
+	ret = []*conf.Schedule{}
+	for _, schedule := range Conf.Automation.Schedules {
+		s := *schedule
+		ret = append(ret, &s)
+	}
+	return
+}
+
+// SetSchedule 新建或者更新定时任务，ID 为空时新建，更新时保留执行记录。
+func SetSchedule(schedule *conf.Schedule) (ret *conf.Schedule, err error) {
+	if err = checkSchedule(schedule); nil != err {
+		return
+	}
+
+	automationLock.Lock()
+	defer automationLock.Unlock()
+
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	schedule.NextRun = 0
+	if "" == schedule.ID {
+		schedule.ID = ast.NewNodeID()
+		schedule.Runs = []*conf.ScheduleRun{}
+		Conf.Automation.Schedules = append(Conf.Automation.Schedules, schedule)
+	} else {
+		existing := getSchedule(schedule.ID)
+		if nil == existing {
+			err = ErrScheduleNotFound
+			return
+		}
+
+		schedule.LastRun, schedule.LastError, schedule.Runs = existing.LastRun, existing.LastError, existing.Runs
+		*existing = *schedule
+		schedule = existing
+	}
+	if schedule.Enabled {
+		schedule.NextRun = getScheduleNextRun(schedule, time.Now())
+	}
+	Conf.Save()
+
+	s := *schedule
+	ret = &s
+	return
+}
+
+func SetScheduleEnabled(id string, enabled bool) (err error) {
+	automationLock.Lock()
+	defer automationLock.Unlock()
+
+	schedule := getSchedule(id)
+	if nil == schedule {
+		return ErrScheduleNotFound
+	}
+
+	schedule.Enabled = enabled
+	schedule.NextRun = 0
+	if enabled {
+		schedule.NextRun = getScheduleNextRun(schedule, time.Now())
+	}
+	Conf.Save()
+	return
+}
+
+func RemoveSchedule(id string) (err error) {
+	automationLock.Lock()
+	defer automationLock.Unlock()
+
+	for i, schedule := range Conf.Automation.Schedules {
+		if schedule.ID == id {
+			Conf.Automation.Schedules = append(Conf.Automation.Schedules[:i], Conf.Automation.Schedules[i+1:]...)
+			Conf.Save()
+			return
+		}
+	}
+	return ErrScheduleNotFound
+}
+
+// RunSchedule 立即执行定时任务，不影响下次执行时间。
+func RunSchedule(id string) (ret *conf.ScheduleRun, err error) {
+	return runSchedule(id, true)
+}
+
+func runSchedule(id string, manual bool) (ret *conf.ScheduleRun, err error) {
+	automationLock.Lock()
+	schedule := getSchedule(id)
+	if nil == schedule {
+		automationLock.Unlock()
+		err = ErrScheduleNotFound
+		return
+	}
+	if runningSchedules[id] {
+		automationLock.Unlock()
+		err = ErrScheduleRunning
+		return
+	}
+	runningSchedules[id] = true
+	action := *schedule.Action
+	name := schedule.Name
+	automationLock.Unlock()
+
+	ret = &conf.ScheduleRun{Started: util.CurrentTimeMillis(), Manual: manual}
+	result, runErr := execScheduleAction(name, &action)
+	ret.Ended = util.CurrentTimeMillis()
+	ret.Result = result
+	if nil != runErr {
+		ret.Error = runErr.Error()
+		logging.LogErrorf("run schedule [%s] failed: %s", id, runErr)
+	}
+
+	automationLock.Lock()
+	delete(runningSchedules, id)
+	if schedule = getSchedule(id); nil != schedule { // 执行期间任务可能被删除
+		schedule.LastRun = ret.Started
+		schedule.LastError = ret.Error
+		schedule.Runs = append([]*conf.ScheduleRun{ret}, schedule.Runs...)
+		if maxScheduleRuns < len(schedule.Runs) {
+			schedule.Runs = schedule.Runs[:maxScheduleRuns]
+		}
+		if !manual && schedule.Enabled {
+			schedule.NextRun = getScheduleNextRun(schedule, time.Now())
+		}
+	}
+	Conf.Save()
+	automationLock.Unlock()
+	return
+}
+
+func execScheduleAction(name string, action *conf.ScheduleAction) (result string, err error) {
+	switch action.Type {
+	case conf.ScheduleActionDailyNote:
+		p, existed, createErr := CreateDailyNote(action.Notebook)
+		if nil != createErr {
+			return "", createErr
+		}
+		WaitForWritingFiles()
+		if !existed {
+			util.PushReloadFiletree()
+		}
+		return p, nil
+	case conf.ScheduleActionSQL:
+		return appendScheduleQueryResult(name, action)
+	case conf.ScheduleActionSnapshot:
+		memo := action.Memo
+		if "" == memo {
+			memo = "[Automation] " + name
+		}
+		return "", IndexRepo(memo)
+	case conf.ScheduleActionExportNotebook:
+		zipPath := ExportNotebookSY(action.Notebook)
+		if "" == zipPath {
+			return "", errors.New("export notebook failed")
+		}
+
+		zipName, _ := url.PathUnescape(path.Base(zipPath))
+		exported := filepath.Join(util.TempDir, "export", zipName)
+		if "" == action.Dir {
+			return exported, nil
+		}
+
+		dir, dirErr := getScheduleExportDir(action.Dir)
+		if nil != dirErr {
+			return "", dirErr
+		}
+		if err = os.MkdirAll(dir, 0755); nil != err {
+			return
+		}
+		savePath := filepath.Join(dir, strings.TrimSuffix(zipName, ".sy.zip")+"-"+time.Now().Format("20060102150405")+".sy.zip")
+		if err = gulu.File.Copy(exported, savePath); nil != err {
+			return
+		}
+		os.RemoveAll(exported)
+		return savePath, nil
+	}
+	return "", fmt.Errorf("unknown schedule action [%s]", action.Type)
+}
+
+// appendScheduleQueryResult 执行 SQL 查询并将结果以表格的形式追加到文档末尾。
+func appendScheduleQueryResult(name string, action *conf.ScheduleAction) (result string, err error) {
+	// 定时任务的语句和 API 提交的语句一样只允许在只读连接上执行查询
+	rows, err := sql.QueryArgs(action.Stmt, nil, true, Conf.Search.Limit, Conf.Api.SQL.MaxRows, time.Duration(Conf.Api.SQL.Timeout)*time.Second)
+	if nil != err {
+		return
+	}
+
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("**%s** %s\n\n", escapeScheduleMarkdown(name), time.Now().Format("2006-01-02 15:04:05")))
+	if 1 > len(rows) {
+		buf.WriteString("-\n")
+	} else {
+		var cols []string
+		for col := range rows[0] {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+
+		buf.WriteString("|")
+		for _, col := range cols {
+			buf.WriteString(" " + escapeScheduleMarkdown(col) + " |")
+		}
+		buf.WriteString("\n|")
+		for range cols {
+			buf.WriteString(" --- |")
+		}
+		buf.WriteString("\n")
+		for _, row := range rows {
+			buf.WriteString("|")
+			for _, col := range cols {
+				buf.WriteString(" " + escapeScheduleMarkdown(fmt.Sprint(row[col])) + " |")
+			}
+			buf.WriteString("\n")
+		}
+	}
+
+	luteEngine := util.NewLute()
+	dom := luteEngine.Md2BlockDOM(buf.String(), true)
+	transactions := []*Transaction{{DoOperations: []*Operation{{Action: "appendInsert", Data: dom, ParentID: action.DocID}}}}
+	PerformTransactions(&transactions)
+	WaitForWritingFiles()
+
+	evt := util.NewCmdResult("transactions", 0, util.PushModeBroadcast)
+	evt.Data = transactions
+	util.PushEvent(evt)
+	return fmt.Sprintf("%d rows", len(rows)), nil
+}
+
+func escapeScheduleMarkdown(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func checkSchedule(schedule *conf.Schedule) (err error) {
+	schedule.Cron = strings.TrimSpace(schedule.Cron)
+	if "" != schedule.Cron {
+		cron, parseErr := util.ParseCron(schedule.Cron)
+		if nil != parseErr {
+			return parseErr
+		}
+		if cron.Next(time.Now()).IsZero() {
+			return fmt.Errorf("cron expression [%s] never matches", schedule.Cron)
+		}
+	} else if minScheduleInterval > schedule.Interval {
+		return ErrScheduleInvalidTiming
+	}
+
+	action := schedule.Action
+	if nil == action {
+		return errors.New("schedule action is empty")
+	}
+
+	switch action.Type {
+	case conf.ScheduleActionDailyNote:
+		if nil == Conf.Box(action.Notebook) {
+			return ErrBoxNotFound
+		}
+	case conf.ScheduleActionExportNotebook:
+		if nil == Conf.Box(action.Notebook) {
+			return ErrBoxNotFound
+		}
+		action.Dir = strings.TrimSpace(action.Dir)
+		if _, err = getScheduleExportDir(action.Dir); nil != err {
+			return
+		}
+	case conf.ScheduleActionSQL:
+		if "" == strings.TrimSpace(action.Stmt) {
+			return errors.New("schedule SQL statement is empty")
+		}
+		if err = sql.CheckReadOnlyStmt(action.Stmt); nil != err {
+			return
+		}
+		if nil == treenode.GetBlockTree(action.DocID) {
+			return ErrBlockNotFound
+		}
+	case conf.ScheduleActionSnapshot:
+	default:
+		return fmt.Errorf("unknown schedule action [%s]", action.Type)
+	}
+	return
+}
+
+func getScheduleNextRun(schedule *conf.Schedule, from time.Time) int64 {
+	if "" != schedule.Cron {
+		cron, err := util.ParseCron(schedule.Cron)
+		if nil != err {
+			logging.LogErrorf("parse schedule [%s] cron [%s] failed: %s", schedule.ID, schedule.Cron, err)
+			return 0
+		}
+		next := cron.Next(from)
+		if next.IsZero() {
+			return 0
+		}
+		return next.UnixMilli()
+	}
+	return from.Add(time.Duration(max(schedule.Interval, minScheduleInterval)) * time.Second).UnixMilli()
+}
+
+// getScheduleExportDir 返回导出文件保存的文件夹的绝对路径，文件夹只能是工作空间下的相对路径。
+func getScheduleExportDir(dir string) (ret string, err error) {
+	if "" == dir {
+		return
+	}
+
+	if filepath.IsAbs(dir) || "" != filepath.VolumeName(dir) || strings.HasPrefix(dir, "/") || strings.HasPrefix(dir, "\\") {
+		return "", ErrScheduleInvalidDir
+	}
+	for _, part := range strings.FieldsFunc(dir, func(r rune) bool { return '/' == r || '\\' == r }) {
+		if ".." == strings.TrimSpace(part) {
+			return "", ErrScheduleInvalidDir
+		}
+	}
+
+	ret = filepath.Join(util.WorkspaceDir, dir)
+	if !util.IsSubPath(util.WorkspaceDir, ret) {
+		return "", ErrScheduleInvalidDir
+	}
+	return
+}
+
+func getSchedule(id string) *conf.Schedule {
+	for _, schedule := range Conf.Automation.Schedules {
+		if schedule.ID == id {
+			return schedule
+		}
+	}
+	return nil
+}
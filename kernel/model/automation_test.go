@@ -0,0 +1,78 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/util"
+)
+
+func TestGetScheduleExportDir(t *testing.T) {
+	workspaceDir := util.WorkspaceDir
+	util.WorkspaceDir = filepath.Join(t.TempDir(), "workspace")
+	defer func() { util.WorkspaceDir = workspaceDir }()
+
+	cases := []struct {
+		dir      string
+		expected string
+		err      error
+	}{
+		{"", "", nil},
+		{"export", filepath.Join(util.WorkspaceDir, "export"), nil},
+		{"export/daily", filepath.Join(util.WorkspaceDir, "export", "daily"), nil},
+		{"/tmp/export", "", ErrScheduleInvalidDir},
+		{"\\tmp\\export", "", ErrScheduleInvalidDir},
+		{"../export", "", ErrScheduleInvalidDir},
+		{"export/../../export", "", ErrScheduleInvalidDir},
+		{"export\\..\\..", "", ErrScheduleInvalidDir},
+		{".", "", ErrScheduleInvalidDir},
+	}
+
+	for _, c := range cases {
+		got, err := getScheduleExportDir(c.dir)
+		if err != c.err {
+			t.Errorf("dir [%s]: expected error [%v], got [%v]", c.dir, c.err, err)
+			continue
+		}
+		if got != c.expected {
+			t.Errorf("dir [%s]: expected [%s], got [%s]", c.dir, c.expected, got)
+		}
+	}
+}
+
+func TestCheckScheduleSQL(t *testing.T) {
+	cases := []struct {
+		stmt string
+		err  error
+	}{
+		{"DELETE FROM blocks", sql.ErrStmtNotReadOnly},
+		{"SELECT * FROM blocks; DELETE FROM blocks", sql.ErrStmtMultiple},
+		{"UPDATE blocks SET content = ''", sql.ErrStmtNotReadOnly},
+		{"SELECT * FROM blocks", ErrBlockNotFound}, // 语句检查通过，结果文档不存在
+	}
+
+	for _, c := range cases {
+		schedule := &conf.Schedule{Interval: minScheduleInterval, Action: &conf.ScheduleAction{Type: conf.ScheduleActionSQL, Stmt: c.stmt, DocID: "20240101000000-zzzzzzz"}}
+		if err := checkSchedule(schedule); err != c.err {
+			t.Errorf("statement [%s]: expected [%v], got [%v]", c.stmt, c.err, err)
+		}
+	}
+}
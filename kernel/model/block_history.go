@@ -0,0 +1,267 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute"
+	"github.com/88250/lute/ast"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
+)
+
+var ErrBlockVersionNotFound = errors.New("block version not found")
+
+const (
+	blockHistoryFileName = "blocks.jsonl"
+	blockHistoryMaxRows  = 256 // 单个块最多返回的修改记录数
+)
+
+var blockHistoryLock = sync.Mutex{}
+
+// 会生成块修改记录的事务操作
+var blockHistoryActions = []string{"update", "insert", "delete", "move", "appendInsert", "prependInsert", "setAttrs"}
+
+// GetBlockHistory 返回块的修改记录，按修改时间降序排列。
+func GetBlockHistory(id string) (ret []*sql.BlockHistory) {
+	sql.FlushHistoryQueue()
+	ret = sql.GetBlockHistories(id, blockHistoryMaxRows)
+	return
+}
+
+// RollbackBlockVersion 将块恢复到修改记录中 kramdown 哈希为 hash 的版本。
+// 块仍然存在时更新块，已经被删除时插入到最近一次记录的位置。
+func RollbackBlockVersion(id, hash string) (ret []*Transaction, err error) {
+	sql.FlushHistoryQueue()
+	kramdown, history := sql.GetBlockHistoryVersion(id, hash)
+	if nil == history || "" == kramdown {
+		err = ErrBlockVersionNotFound
+		return
+	}
+
+	luteEngine := util.NewLute()
+	_, tree := luteEngine.Md2BlockDOMTree(kramdown, true)
+	if nil == tree || nil == tree.Root || nil == tree.Root.FirstChild {
+		err = ErrBlockVersionNotFound
+		return
+	}
+
+	var op *Operation
+	if nil != treenode.GetBlockTree(id) {
+		if ast.NodeList == tree.Root.FirstChild.Type && nil != tree.Root.FirstChild.FirstChild && id == tree.Root.FirstChild.FirstChild.ID {
+			// 列表项需要去掉外层的列表，参考 api/block/updateBlock
+			tree.Root.AppendChild(tree.Root.FirstChild.FirstChild)
+			tree.Root.FirstChild.Unlink()
+		}
+		tree.Root.FirstChild.SetIALAttr("id", id)
+		op = &Operation{Action: "update", ID: id, Data: luteEngine.Tree2BlockDOM(tree, luteEngine.RenderOptions)}
+	} else {
+		op = &Operation{Action: "insert", ID: id, Data: luteEngine.Tree2BlockDOM(tree, luteEngine.RenderOptions)}
+		latest := sql.GetBlockHistories(id, 1)
+		if 0 < len(latest) {
+			history = latest[0]
+		}
+		if "" != history.PreviousID && nil != treenode.GetBlockTree(history.PreviousID) {
+			op.PreviousID, op.ParentID = history.PreviousID, history.ParentID
+		} else if "" != history.ParentID && nil != treenode.GetBlockTree(history.ParentID) {
+			op.ParentID = history.ParentID
+		} else {
+			err = ErrBlockNotFound
+			return
+		}
+	}
+
+	ret = []*Transaction{{DoOperations: []*Operation{op}}}
+	PerformTransactions(&ret)
+	WaitForWritingFiles()
+	return
+}
+
+// snapshotBlock 在执行事务操作前记录块的内容，返回 nil 表示该操作不需要记录。
+func (tx *Transaction) snapshotBlock(op *Operation) (ret *sql.BlockHistory) {
+	if "" == op.ID || !gulu.Str.Contains(op.Action, blockHistoryActions) {
+		return
+	}
+
+	ret = &sql.BlockHistory{ID: op.ID, Op: op.Action}
+	if nil == treenode.GetBlockTree(op.ID) {
+		return
+	}
+
+	tree, err := tx.loadTree(op.ID)
+	if nil != err {
+		return
+	}
+	node := treenode.GetNodeInTree(tree, op.ID)
+	if nil == node {
+		return
+	}
+	if ast.NodeDocument == node.Type {
+		return nil
+	}
+
+	ret.RootID, ret.Box = tree.ID, tree.Box
+	ret.OldKramdown = blockHistoryKramdown(node, tx.luteEngine)
+	ret.OldHash = blockHistoryHash(ret.OldKramdown)
+	ret.ParentID, ret.PreviousID = blockHistoryPosition(node)
+	return
+}
+
+// recordBlock 在执行事务操作后记录块的内容，内容没有变化时不记录（移动除外）。
+func (tx *Transaction) recordBlock(op *Operation, history *sql.BlockHistory) {
+	if nil == history {
+		return
+	}
+
+	if nil != treenode.GetBlockTree(op.ID) {
+		if tree, _ := tx.loadTree(op.ID); nil != tree {
+			if node := treenode.GetNodeInTree(tree, op.ID); nil != node && ast.NodeDocument != node.Type {
+				history.RootID, history.Box = tree.ID, tree.Box
+				history.NewKramdown = blockHistoryKramdown(node, tx.luteEngine)
+				history.NewHash = blockHistoryHash(history.NewKramdown)
+				if "delete" != op.Action {
+					// 删除时保留删除前的位置，其他操作记录操作后的位置
+					history.ParentID, history.PreviousID = blockHistoryPosition(node)
+				}
+			}
+		}
+	}
+
+	if "move" != op.Action && history.OldHash == history.NewHash {
+		return
+	}
+	if "" == history.RootID {
+		return
+	}
+
+	history.Device, history.DeviceName = Conf.System.ID, Conf.System.Name
+	history.Session = tx.Session
+	history.Created = time.Now().UnixMilli()
+	tx.blockHistories = append(tx.blockHistories, history)
+}
+
+func blockHistoryKramdown(node *ast.Node, luteEngine *lute.Lute) string {
+	return luteEngine.BlockDOM2Md(luteEngine.RenderNodeBlockDOM(node))
+}
+
+func blockHistoryHash(kramdown string) string {
+	if "" == kramdown {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(kramdown)))[:7]
+}
+
+func blockHistoryPosition(node *ast.Node) (parentID, previousID string) {
+	if nil != node.Parent {
+		parentID = node.Parent.ID
+	}
+	for prev := node.Previous; nil != prev; prev = prev.Previous {
+		if "" != prev.ID {
+			previousID = prev.ID
+			break
+		}
+	}
+	return
+}
+
+// appendBlockHistories 将块修改记录追加到当天的块历史文件中并索引到历史数据库。
+// 块历史文件和文档历史一样存放在 history 文件夹下，所以过期清理和数据库重建都可以复用文档历史的逻辑。
+func appendBlockHistories(histories []*sql.BlockHistory) {
+	if 1 > len(histories) {
+		return
+	}
+
+	blockHistoryLock.Lock()
+	defer blockHistoryLock.Unlock()
+
+	now := time.Now()
+	historyDir, err := getHistoryDir(HistoryOpBlock, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local))
+	if nil != err {
+		return
+	}
+
+	buf := bytes.Buffer{}
+	for _, history := range histories {
+		data, marshalErr := gulu.JSON.MarshalJSON(history)
+		if nil != marshalErr {
+			logging.LogErrorf("marshal block history failed: %s", marshalErr)
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(filepath.Join(historyDir, blockHistoryFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if nil != err {
+		logging.LogErrorf("open block history file failed: %s", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(buf.Bytes()); nil != err {
+		logging.LogErrorf("write block history file failed: %s", err)
+		return
+	}
+
+	sql.IndexBlockHistoriesQueue(histories)
+}
+
+func indexBlockHistoryDir(entryPath string) {
+	f, err := os.Open(filepath.Join(entryPath, blockHistoryFileName))
+	if nil != err {
+		if !os.IsNotExist(err) {
+			logging.LogErrorf("open block history file failed: %s", err)
+		}
+		return
+	}
+	defer f.Close()
+
+	var histories []*sql.BlockHistory
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if 1 > len(bytes.TrimSpace(line)) {
+			continue
+		}
+
+		history := &sql.BlockHistory{}
+		if err = gulu.JSON.UnmarshalJSON(line, history); nil != err {
+			logging.LogWarnf("unmarshal block history failed: %s", err)
+			continue
+		}
+		histories = append(histories, history)
+	}
+	if err = scanner.Err(); nil != err {
+		logging.LogErrorf("read block history file failed: %s", err)
+	}
+
+	if 0 < len(histories) {
+		sql.IndexBlockHistoriesQueue(histories)
+	}
+}
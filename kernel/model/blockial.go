@@ -35,12 +35,9 @@ import (
 	"github.com/siyuan-note/logging"
 )
 
-func SetBlockReminder(id string, timed string) (err error) {
-	if !IsSubscriber() {
-		if "ios" == util.Container {
-			return errors.New(Conf.Language(122))
-		}
-		return errors.New(Conf.Language(29))
+func SetBlockReminder(id, timed, repeat string) (err error) {
+	if !gulu.Str.Contains(repeat, []string{ReminderRepeatNone, ReminderRepeatDaily, ReminderRepeatWeekly, ReminderRepeatMonthly}) {
+		return ErrReminderInvalidRepeat
 	}
 
 	var timedMills int64
@@ -63,18 +60,18 @@ func SetBlockReminder(id string, timed string) (err error) {
 		return errors.New(fmt.Sprintf(Conf.Language(15), id))
 	}
 
-	if ast.NodeDocument != node.Type && node.IsContainerBlock() {
-		node = treenode.FirstLeafBlock(node)
-	}
-	content := treenode.NodeStaticContent(node, nil, false, false, false)
-	content = gulu.Str.SubStr(content, 128)
-	err = SetCloudBlockReminder(id, content, timedMills)
-	if nil != err {
-		return
+	content := reminderContent(node)
+	if IsSubscriber() && ReminderRepeatNone == repeat {
+		// 订阅用户同时使用云端微信提醒，云端不支持重复提醒
+		err = SetCloudBlockReminder(id, content, timedMills)
+		if nil != err {
+			return
+		}
 	}
 
 	attrName := "custom-reminder-wechat"
 	if "0" == timed {
+		removeBlockReminder(id)
 		delete(attrs, attrName)
 		old := node.IALAttr(attrName)
 		oldTimedMills, e := dateparse.ParseIn(old, time.Now().Location())
@@ -83,6 +80,7 @@ func SetBlockReminder(id string, timed string) (err error) {
 		}
 		node.RemoveIALAttr(attrName)
 	} else {
+		putBlockReminder(&BlockReminder{ID: id, RootID: tree.ID, Content: content, Repeat: repeat, Start: timedMills, Scheduled: timedMills, Next: timedMills})
 		attrs[attrName] = timed
 		node.SetIALAttr(attrName, timed)
 		util.PushMsg(fmt.Sprintf(Conf.Language(101), time.UnixMilli(timedMills).Format("2006-01-02 15:04")), 5000)
@@ -518,9 +518,11 @@ func fullReindex() {
 
 	sql.IndexIgnoreCached = false
 	openedBoxes := Conf.GetOpenedBoxes()
-	for _, openedBox := range openedBoxes {
+	for i, openedBox := range openedBoxes {
+		task.SetProgress(i+1, len(openedBoxes))
 		index(openedBox.ID)
 	}
+	indexAttributeViews()
 	treenode.SaveBlockTree(true)
 	LoadFlashcards()
 	debug.FreeOSMemory()
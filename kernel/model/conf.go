@@ -81,6 +81,8 @@ type AppConf struct {
 	CloudRegion    int              `json:"cloudRegion"`    // 云端区域，0：中国大陆，1：北美
 	Snippet        *conf.Snpt       `json:"snippet"`        // 代码片段
 	State          int              `json:"state"`          // 运行状态，0：已经正常退出，1：运行中
+	Automation     *conf.Automation `json:"automation"`     // 自动化
+	Reminder       *conf.Reminder   `json:"reminder"`       // 本地块提醒
 
 	m *sync.Mutex
 }
@@ -243,6 +245,15 @@ func InitConf() {
 	if 1 > Conf.Editor.HistoryRetentionDays {
 		Conf.Editor.HistoryRetentionDays = 30
 	}
+	if nil == Conf.Editor.HistoryRetention {
+		Conf.Editor.HistoryRetention = conf.NewHistoryRetention()
+	}
+	if nil == Conf.Editor.HistoryRetention.Doc {
+		Conf.Editor.HistoryRetention.Doc = &conf.HistoryRetentionRule{}
+	}
+	if nil == Conf.Editor.HistoryRetention.Asset {
+		Conf.Editor.HistoryRetention.Asset = &conf.HistoryRetentionRule{}
+	}
 	if conf.MinDynamicLoadBlocks > Conf.Editor.DynamicLoadBlocks {
 		Conf.Editor.DynamicLoadBlocks = conf.MinDynamicLoadBlocks
 	}
@@ -307,6 +318,20 @@ func InitConf() {
 		Conf.Snippet = conf.NewSnpt()
 	}
 
+	if nil == Conf.Automation {
+		Conf.Automation = conf.NewAutomation()
+	}
+	if nil == Conf.Automation.Schedules {
+		Conf.Automation.Schedules = []*conf.Schedule{}
+	}
+
+	if nil == Conf.Reminder {
+		Conf.Reminder = conf.NewReminder()
+	}
+	if nil == Conf.Reminder.SMTP {
+		Conf.Reminder.SMTP = &conf.SMTP{Port: 587}
+	}
+
 	Conf.System.AppDir = util.WorkingDir
 	Conf.System.ConfDir = util.ConfDir
 	Conf.System.HomeDir = util.HomeDir
@@ -343,6 +368,13 @@ func InitConf() {
 	}
 	Conf.Sync.WebDAV.Endpoint = util.NormalizeEndpoint(Conf.Sync.WebDAV.Endpoint)
 	Conf.Sync.WebDAV.Timeout = util.NormalizeTimeout(Conf.Sync.WebDAV.Timeout)
+	if nil == Conf.Sync.Local {
+		Conf.Sync.Local = &conf.Local{}
+	}
+	if nil == Conf.Sync.SFTP {
+		Conf.Sync.SFTP = &conf.SFTP{}
+	}
+	Conf.Sync.SFTP.Timeout = util.NormalizeTimeout(Conf.Sync.SFTP.Timeout)
 	if util.ContainerDocker == util.Container {
 		Conf.Sync.Perception = false
 	}
@@ -350,6 +382,18 @@ func InitConf() {
 	if nil == Conf.Api {
 		Conf.Api = conf.NewAPI()
 	}
+	if nil == Conf.Api.Tokens {
+		Conf.Api.Tokens = []*conf.APIToken{}
+	}
+	if nil == Conf.Api.SQL {
+		Conf.Api.SQL = conf.NewAPISQL()
+	}
+	if 1 > Conf.Api.SQL.Timeout {
+		Conf.Api.SQL.Timeout = conf.NewAPISQL().Timeout
+	}
+	if 1 > Conf.Api.SQL.MaxRows {
+		Conf.Api.SQL.MaxRows = conf.NewAPISQL().MaxRows
+	}
 
 	if nil == Conf.Bazaar {
 		Conf.Bazaar = conf.NewBazaar()
@@ -380,6 +424,9 @@ func InitConf() {
 	if 1 > Conf.Search.BacklinkMentionKeywordsLimit {
 		Conf.Search.BacklinkMentionKeywordsLimit = 512
 	}
+	if 1 > Conf.Search.FuzzyDistance || 3 < Conf.Search.FuzzyDistance {
+		Conf.Search.FuzzyDistance = conf.NewSearch().FuzzyDistance
+	}
 
 	if nil == Conf.Stat {
 		Conf.Stat = conf.NewStat()
@@ -407,6 +454,9 @@ func InitConf() {
 	if nil == Conf.AI {
 		Conf.AI = conf.NewAI()
 	}
+	if nil == Conf.AI.Embedding {
+		Conf.AI.Embedding = conf.NewEmbedding()
+	}
 	if "" == Conf.AI.OpenAI.APIModel {
 		Conf.AI.OpenAI.APIModel = openai.GPT3Dot5Turbo
 	}
@@ -838,6 +888,7 @@ func InitBoxes() {
 	}
 
 	if !initialized {
+		indexAttributeViews()
 		treenode.SaveBlockTree(true)
 	}
 
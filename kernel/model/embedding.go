@@ -0,0 +1,355 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/search"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
+)
+
+var ErrEmbeddingDisabled = errors.New("embedding is disabled")
+
+// 语义搜索和混合搜索的候选块数量上限
+const embeddingSearchCandidates = 512
+
+// InitEmbedding 根据人工智能配置设置向量化服务，配置变更后需要重新调用。
+func InitEmbedding() {
+	embedding := Conf.AI.Embedding
+	if nil == embedding || !embedding.Enabled {
+		sql.SetEmbeddingProvider("", nil)
+		return
+	}
+
+	openAI := Conf.AI.OpenAI
+	switch embedding.Provider {
+	case conf.EmbeddingProviderLocal:
+		serviceURL, embeddingModel, timeout := embedding.LocalURL, embedding.Model, openAI.APITimeout
+		sql.SetEmbeddingProvider(conf.EmbeddingProviderLocal+":"+serviceURL+":"+embeddingModel, func(texts []string) ([][]float32, error) {
+			return util.LocalEmbeddings(texts, serviceURL, embeddingModel, timeout)
+		})
+	default:
+		client := util.NewOpenAIClient(openAI.APIKey, openAI.APIProxy, openAI.APIBaseURL, openAI.APIUserAgent, openAI.APIVersion, openAI.APIProvider)
+		embeddingModel, timeout := embedding.Model, openAI.APITimeout
+		sql.SetEmbeddingProvider(conf.EmbeddingProviderOpenAI+":"+openAI.APIBaseURL+":"+embeddingModel, func(texts []string) ([][]float32, error) {
+			return util.OpenAIEmbeddings(texts, client, embeddingModel, timeout)
+		})
+	}
+	logging.LogInfof("embedding provider [%s] enabled", embedding.Provider)
+}
+
+func embedQuery(query string) (ret []float32, err error) {
+	embedding := Conf.AI.Embedding
+	if nil == embedding || !embedding.Enabled || !sql.IsEmbeddingEnabled() {
+		err = ErrEmbeddingDisabled
+		return
+	}
+
+	text := sql.EmbeddingText(query)
+	var vectors [][]float32
+	if conf.EmbeddingProviderLocal == embedding.Provider {
+		vectors, err = util.LocalEmbeddings([]string{text}, embedding.LocalURL, embedding.Model, Conf.AI.OpenAI.APITimeout)
+	} else {
+		openAI := Conf.AI.OpenAI
+		client := util.NewOpenAIClient(openAI.APIKey, openAI.APIProxy, openAI.APIBaseURL, openAI.APIUserAgent, openAI.APIVersion, openAI.APIProvider)
+		vectors, err = util.OpenAIEmbeddings([]string{text}, client, embedding.Model, openAI.APITimeout)
+	}
+	if nil != err {
+		return
+	}
+	if 1 > len(vectors) || 1 > len(vectors[0]) {
+		err = errors.New("empty embedding")
+		return
+	}
+	ret = vectors[0]
+	return
+}
+
+type scoredBlock struct {
+	id     string
+	rootID string
+	score  float64
+}
+
+// fullTextSearchBySemantic 按语义相似度搜索块。
+func fullTextSearchBySemantic(query, boxFilter, pathFilter, typeFilter string, orderBy, beforeLen, page, pageSize int) (ret []*Block, matchedBlockCount, matchedRootCount int) {
+	ret = []*Block{}
+	scored, err := semanticScoredBlocks(query, boxFilter, pathFilter, typeFilter)
+	if nil != err {
+		logging.LogErrorf("semantic search failed: %s", err)
+		util.PushErrMsg(err.Error(), 5000)
+		return
+	}
+	return pageScoredBlocks(scored, "", orderBy, beforeLen, page, pageSize)
+}
+
+func semanticScoredBlocks(query, boxFilter, pathFilter, typeFilter string) (ret []*scoredBlock, err error) {
+	vector, err := embedQuery(query)
+	if nil != err {
+		return
+	}
+
+	ret = searchVectorCandidates(vector, nil, boxFilter, pathFilter, typeFilter)
+	return
+}
+
+// searchVectorCandidates 按相似度从高到低分批过滤向量搜索结果，返回满足过滤条件的前 embeddingSearchCandidates 个块，excludes 中的块会被跳过。
+//
+// 候选块数量需要在过滤之后截断，否则限定了笔记本或者路径时相似度更高的其他块会占满候选块。
+func searchVectorCandidates(vector []float32, excludes map[string]*scoredBlock, boxFilter, pathFilter, typeFilter string) (ret []*scoredBlock) {
+	var hits []*sql.VectorHit
+	for _, hit := range sql.SearchVectors(vector, 0, 0) {
+		if nil == excludes[hit.ID] {
+			hits = append(hits, hit)
+		}
+	}
+
+	for start := 0; start < len(hits) && embeddingSearchCandidates > len(ret); start += embeddingSearchCandidates {
+		batch := hits[start:min(start+embeddingSearchCandidates, len(hits))]
+		scores := map[string]float64{}
+		var ids []string
+		for _, hit := range batch {
+			scores[hit.ID] = hit.Score
+			ids = append(ids, hit.ID)
+		}
+
+		filtered := filterCandidateBlocks(ids, boxFilter, pathFilter, typeFilter)
+		for _, b := range filtered {
+			b.score = scores[b.id]
+		}
+		sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].score > filtered[j].score })
+		ret = append(ret, filtered...)
+	}
+	if embeddingSearchCandidates < len(ret) {
+		ret = ret[:embeddingSearchCandidates]
+	}
+	return
+}
+
+// fullTextSearchByHybrid 结合关键字相关度（BM25）和语义相似度搜索块，两者归一化后按 Conf.AI.Embedding.HybridWeight 加权求和。
+func fullTextSearchByHybrid(query, boxFilter, pathFilter, typeFilter string, orderBy, beforeLen, page, pageSize int) (ret []*Block, matchedBlockCount, matchedRootCount int) {
+	ret = []*Block{}
+	scored, err := hybridScoredBlocks(query, boxFilter, pathFilter, typeFilter)
+	if nil != err {
+		logging.LogErrorf("hybrid search failed: %s", err)
+		util.PushErrMsg(err.Error(), 5000)
+		return
+	}
+	return pageScoredBlocks(scored, strings.Join(strings.Fields(query), search.TermSep), orderBy, beforeLen, page, pageSize)
+}
+
+func hybridScoredBlocks(query, boxFilter, pathFilter, typeFilter string) (ret []*scoredBlock, err error) {
+	vector, err := embedQuery(query)
+	if nil != err {
+		return
+	}
+
+	keyword := stringQuery(filterQueryInvisibleChars(query))
+	table := "blocks_fts" // 大小写敏感
+	if !Conf.Search.CaseSensitive {
+		table = "blocks_fts_case_insensitive"
+	}
+	stmt := "SELECT id, root_id, rank FROM " + table + " WHERE (`" + table + "` MATCH '" + columnFilter() + ":(" + keyword + ")'"
+	stmt += ") AND type IN " + typeFilter
+	stmt += boxFilter + pathFilter
+	stmt += " ORDER BY rank LIMIT " + strconv.Itoa(embeddingSearchCandidates)
+	rows, queryErr := sql.QueryNoLimit(stmt)
+	if nil != queryErr {
+		logging.LogErrorf("hybrid search failed: %s", queryErr)
+	}
+
+	// FTS5 的 rank 越小越相关，归一化到 [0, 1]
+	ranks := map[string]float64{}
+	candidates := map[string]*scoredBlock{}
+	minRank, maxRank := 0.0, 0.0
+	for i, row := range rows {
+		id, _ := row["id"].(string)
+		rootID, _ := row["root_id"].(string)
+		rank, _ := row["rank"].(float64)
+		ranks[id] = rank
+		candidates[id] = &scoredBlock{id: id, rootID: rootID}
+		if 0 == i || rank < minRank {
+			minRank = rank
+		}
+		if 0 == i || rank > maxRank {
+			maxRank = rank
+		}
+	}
+
+	for _, b := range searchVectorCandidates(vector, candidates, boxFilter, pathFilter, typeFilter) {
+		candidates[b.id] = b
+	}
+
+	var ids []string
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+	vectorScores := sql.GetVectorScores(vector, ids)
+
+	weight := Conf.AI.Embedding.HybridWeight
+	for id, b := range candidates {
+		keywordScore := 0.0
+		if rank, ok := ranks[id]; ok {
+			keywordScore = 1
+			if maxRank > minRank {
+				keywordScore = (maxRank - rank) / (maxRank - minRank)
+			}
+		}
+		b.score = weight*vectorScores[id] + (1-weight)*keywordScore
+		ret = append(ret, b)
+	}
+	return
+}
+
+// filterCandidateBlocks 按照过滤条件筛选候选块，并从向量索引中移除已经不存在的块。
+func filterCandidateBlocks(ids []string, boxFilter, pathFilter, typeFilter string) (ret []*scoredBlock) {
+	if 1 > len(ids) {
+		return
+	}
+
+	idList := "('" + strings.Join(ids, "','") + "')"
+	stmt := "SELECT id, root_id FROM blocks WHERE id IN " + idList + " AND type IN " + typeFilter + boxFilter + pathFilter
+	rows, err := sql.QueryNoLimit(stmt)
+	if nil != err {
+		logging.LogErrorf("filter candidate blocks failed: %s", err)
+		return
+	}
+
+	found := map[string]bool{}
+	for _, row := range rows {
+		id, _ := row["id"].(string)
+		rootID, _ := row["root_id"].(string)
+		found[id] = true
+		ret = append(ret, &scoredBlock{id: id, rootID: rootID})
+	}
+
+	if len(found) < len(ids) {
+		rows, _ = sql.QueryNoLimit("SELECT id FROM blocks WHERE id IN " + idList)
+		exists := map[string]bool{}
+		for _, row := range rows {
+			id, _ := row["id"].(string)
+			exists[id] = true
+		}
+		var removes []string
+		for _, id := range ids {
+			if !exists[id] {
+				removes = append(removes, id)
+			}
+		}
+		sql.RemoveVectors(removes)
+	}
+	return
+}
+
+// pageScoredBlocks 排序后分页，orderBy 为 1 到 5 时和关键字搜索一样按照创建时间、更新时间或者块类型排序（分值相同时按分值降序），
+// 为 6 时按分值升序，否则按分值降序。
+func pageScoredBlocks(scored []*scoredBlock, terms string, orderBy, beforeLen, page, pageSize int) (ret []*Block, matchedBlockCount, matchedRootCount int) {
+	ret = []*Block{}
+	if 6 == orderBy {
+		sort.SliceStable(scored, func(i, j int) bool { return scored[i].score < scored[j].score })
+	} else {
+		sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+	}
+	if 1 <= orderBy && 5 >= orderBy {
+		sortScoredBlocks(scored, orderBy)
+	}
+
+	roots := map[string]bool{}
+	for _, b := range scored {
+		roots[b.rootID] = true
+	}
+	matchedBlockCount, matchedRootCount = len(scored), len(roots)
+
+	start := (page - 1) * pageSize
+	if 0 > start || start >= len(scored) {
+		return
+	}
+	end := min(start+pageSize, len(scored))
+	var ids []string
+	for _, b := range scored[start:end] {
+		ids = append(ids, b.id)
+	}
+
+	sqlBlocks := sql.GetBlocks(ids)
+	for _, sqlBlock := range sqlBlocks {
+		if nil == sqlBlock {
+			continue
+		}
+		ret = append(ret, fromSQLBlock(sqlBlock, terms, beforeLen))
+	}
+	return
+}
+
+// sortScoredBlocks 按照 buildOrderBy 中 orderBy 为 1 到 5 时的规则排序。
+func sortScoredBlocks(scored []*scoredBlock, orderBy int) {
+	type blockAttrs struct {
+		created, updated string
+		sort             int64
+	}
+
+	attrs := map[string]*blockAttrs{}
+	for start := 0; start < len(scored); start += embeddingSearchCandidates {
+		var ids []string
+		for _, b := range scored[start:min(start+embeddingSearchCandidates, len(scored))] {
+			ids = append(ids, b.id)
+		}
+		rows, err := sql.QueryNoLimit("SELECT id, created, updated, sort FROM blocks WHERE id IN ('" + strings.Join(ids, "','") + "')")
+		if nil != err {
+			logging.LogErrorf("query scored blocks failed: %s", err)
+			return
+		}
+		for _, row := range rows {
+			id, _ := row["id"].(string)
+			created, _ := row["created"].(string)
+			updated, _ := row["updated"].(string)
+			blockSort, _ := row["sort"].(int64)
+			attrs[id] = &blockAttrs{created: created, updated: updated, sort: blockSort}
+		}
+	}
+
+	get := func(id string) *blockAttrs {
+		if a := attrs[id]; nil != a {
+			return a
+		}
+		return &blockAttrs{}
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		a, b := get(scored[i].id), get(scored[j].id)
+		switch orderBy {
+		case 1:
+			return a.created < b.created
+		case 2:
+			return a.created > b.created
+		case 3:
+			return a.updated < b.updated
+		case 4:
+			return a.updated > b.updated
+		default:
+			if a.sort != b.sort {
+				return a.sort < b.sort
+			}
+			return a.updated > b.updated
+		}
+	})
+}
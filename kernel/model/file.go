@@ -193,6 +193,13 @@ func SearchDocsByKeyword(keyword string, flashcard bool) (ret []map[string]strin
 			}
 		}
 		rootBlocks = sql.QueryRootBlockByCondition(condition)
+		if isFuzzySearch() {
+			excludes := map[string]bool{}
+			for _, rootBlock := range rootBlocks {
+				excludes[rootBlock.ID] = true
+			}
+			rootBlocks = append(rootBlocks, fuzzySearchRootBlocks(keyword, excludes)...)
+		}
 	} else {
 		for _, box := range boxes {
 			if flashcard {
@@ -422,8 +422,7 @@ func buildSearchHistoryQueryFilter(query, op, box, table string, typ int) (stmt
 		stmt += " AND path LIKE '%/assets/%'"
 	}
 
-	ago := time.Now().Add(-24 * time.Hour * time.Duration(Conf.Editor.HistoryRetentionDays))
-	stmt += " AND created > '" + fmt.Sprintf("%d", ago.Unix()) + "'"
+	stmt += " AND created > '" + fmt.Sprintf("%d", historyRetentionAgo()) + "'"
 	return
 }
 
@@ -568,35 +567,11 @@ func clearOutdatedHistoryDir(historyDir string) {
 		return
 	}
 
-	dirs, err := os.ReadDir(historyDir)
-	if nil != err {
-		logging.LogErrorf("clear history [%s] failed: %s", historyDir, err)
-		return
-	}
-
-	now := time.Now()
-	ago := now.Add(-24 * time.Hour * time.Duration(Conf.Editor.HistoryRetentionDays)).Unix()
-	var removes []string
-	for _, dir := range dirs {
-		dirInfo, err := dir.Info()
-		if nil != err {
-			logging.LogErrorf("read history dir [%s] failed: %s", dir.Name(), err)
-			continue
-		}
-		if dirInfo.ModTime().Unix() < ago {
-			removes = append(removes, filepath.Join(historyDir, dir.Name()))
-		}
-	}
-	for _, dir := range removes {
-		if err = os.RemoveAll(dir); nil != err {
-			logging.LogWarnf("remove history dir [%s] failed: %s", dir, err)
-			continue
-		}
-		//logging.LogInfof("auto removed history dir [%s]", dir)
-	}
+	historyRetentionLock.Lock()
+	defer historyRetentionLock.Unlock()
 
-	// 清理历史库
-	sql.DeleteOutdatedHistories(fmt.Sprintf("%d", ago))
+	report := planHistoryRetention(historyDir, Conf.Editor.HistoryRetention, time.Now())
+	applyHistoryRetention(report)
 }
 
 var boxLatestHistoryTime = map[string]time.Time{}
@@ -652,6 +627,7 @@ const (
 	HistoryOpSync    = "sync"
 	HistoryOpReplace = "replace"
 	HistoryOpOutline = "outline"
+	HistoryOpBlock   = "block"
 )
 
 func generateOpTypeHistory(tree *parse.Tree, opType string) {
@@ -720,7 +696,7 @@ func fullReindexHistory() {
 	return
 }
 
-var validOps = []string{HistoryOpClean, HistoryOpUpdate, HistoryOpDelete, HistoryOpFormat, HistoryOpSync, HistoryOpReplace, HistoryOpOutline}
+var validOps = []string{HistoryOpClean, HistoryOpUpdate, HistoryOpDelete, HistoryOpFormat, HistoryOpSync, HistoryOpReplace, HistoryOpOutline, HistoryOpBlock}
 
 const (
 	HistoryTypeDocName = 0 // Search docs by doc name
@@ -746,6 +722,11 @@ func indexHistoryDir(name string, luteEngine *lute.Lute) {
 	created := fmt.Sprintf("%d", tt.Unix())
 
 	entryPath := filepath.Join(util.HistoryDir, name)
+	if HistoryOpBlock == op {
+		indexBlockHistoryDir(entryPath)
+		return
+	}
+
 	var docs, assets []string
 	filelock.Walk(entryPath, func(path string, info os.FileInfo, err error) error {
 		if strings.HasSuffix(info.Name(), ".sy") {
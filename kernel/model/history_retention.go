@@ -0,0 +1,353 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/88250/go-humanize"
+	"github.com/88250/gulu"
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
+)
+
+// 保留策略报告中最多列出的待删除历史数
+const historyRetentionReportMaxItems = 1024
+
+// 历史版本类型
+const (
+	historyKindDoc   = "doc"
+	historyKindAsset = "asset"
+	historyKindBlock = "block"
+)
+
+// 历史版本被删除的原因
+const (
+	HistoryRetentionExpired      = "expired"      // 超过保留天数
+	HistoryRetentionThinned      = "thinned"      // 稀疏保留时同一时间段内已经有更新的版本
+	HistoryRetentionDocMaxSize   = "docMaxSize"   // 超过文档历史最大总大小
+	HistoryRetentionAssetMaxSize = "assetMaxSize" // 超过资源文件历史最大总大小
+	HistoryRetentionMaxSize      = "maxSize"      // 超过历史文件夹最大总大小
+)
+
+var historyRetentionLock = sync.Mutex{}
+
+// HistoryRetentionItem 描述了保留策略执行时会删除的一个历史版本。
+type HistoryRetentionItem struct {
+	Path    string `json:"path"`    // 历史文件绝对路径
+	Kind    string `json:"kind"`    // 历史类型，doc：文档，asset：资源文件，block：块修改记录
+	ID      string `json:"id"`      // 文档 ID 或者资源文件路径
+	Op      string `json:"op"`      // 历史操作类型
+	Created int64  `json:"created"` // 历史生成时间，单位为秒
+	Size    int64  `json:"size"`    // 文件大小，单位为字节
+	Reason  string `json:"reason"`  // 删除原因
+}
+
+// HistoryRetentionReport 描述了保留策略的执行结果，Items 只列出最早的一部分待删除历史，数量统计包含全部。
+type HistoryRetentionReport struct {
+	TotalCount  int                     `json:"totalCount"`  // 历史版本总数
+	TotalSize   int64                   `json:"totalSize"`   // 历史版本总大小
+	DeleteCount int                     `json:"deleteCount"` // 待删除的历史版本数
+	DeleteSize  int64                   `json:"deleteSize"`  // 待删除的历史版本大小
+	Reasons     map[string]int          `json:"reasons"`     // 按删除原因统计的待删除历史版本数
+	OverBudget  bool                    `json:"overBudget"`  // 因为需要保留最近版本，执行后仍然超过大小限制
+	Applied     bool                    `json:"applied"`     // 是否已经执行删除
+	Items       []*HistoryRetentionItem `json:"items"`       // 待删除的历史版本，按生成时间升序排列
+
+	deletes []*historyVersion
+	dirs    map[string]int // 历史文件夹 -> 执行后剩余的历史版本数
+}
+
+type historyVersion struct {
+	path      string
+	dir       string
+	kind      string
+	id        string
+	op        string
+	created   time.Time
+	size      int64
+	protected bool   // 属于最近的 KeepLast 个版本
+	reason    string // 为空表示保留
+}
+
+// GetHistoryRetentionReport 返回按照保留策略 policy 会删除的历史，policy 为空时使用当前配置，不会删除任何文件。
+func GetHistoryRetentionReport(policy *conf.HistoryRetention) (ret *HistoryRetentionReport) {
+	if nil == policy {
+		policy = Conf.Editor.HistoryRetention
+	}
+
+	historyRetentionLock.Lock()
+	defer historyRetentionLock.Unlock()
+	ret = planHistoryRetention(util.HistoryDir, policy, time.Now())
+	return
+}
+
+// ApplyHistoryRetention 按照当前配置的保留策略删除历史。
+func ApplyHistoryRetention() (ret *HistoryRetentionReport) {
+	historyRetentionLock.Lock()
+	defer historyRetentionLock.Unlock()
+
+	ret = planHistoryRetention(util.HistoryDir, Conf.Editor.HistoryRetention, time.Now())
+	applyHistoryRetention(ret)
+	return
+}
+
+// historyRetentionAgo 返回历史列表中可以看到的最早生成时间。
+// 设置了保留最近版本数时更早的历史也可能被保留，此时不限制生成时间。
+func historyRetentionAgo() int64 {
+	policy := Conf.Editor.HistoryRetention
+	if 0 < policy.Doc.KeepLast || 0 < policy.Asset.KeepLast {
+		return 0
+	}
+
+	days := max(historyRetentionKeepDays(policy.Doc), historyRetentionKeepDays(policy.Asset))
+	return time.Now().Add(-24 * time.Hour * time.Duration(days)).Unix()
+}
+
+func historyRetentionKeepDays(rule *conf.HistoryRetentionRule) int {
+	if 0 < rule.KeepDays {
+		return rule.KeepDays
+	}
+	return Conf.Editor.HistoryRetentionDays
+}
+
+func planHistoryRetention(historyDir string, policy *conf.HistoryRetention, now time.Time) (ret *HistoryRetentionReport) {
+	ret = &HistoryRetentionReport{Reasons: map[string]int{}, Items: []*HistoryRetentionItem{}, dirs: map[string]int{}}
+	versions, dirs := listHistoryVersions(historyDir)
+	ret.TotalCount = len(versions)
+
+	groups := map[string][]*historyVersion{}
+	for _, v := range versions {
+		ret.TotalSize += v.size
+		ret.dirs[v.dir]++
+		key := v.kind + ":" + v.id
+		groups[key] = append(groups[key], v)
+	}
+
+	// 没有历史版本的文件夹（比如只包含笔记本配置）超过文档保留天数后删除
+	docAgo := now.Add(-24 * time.Hour * time.Duration(historyRetentionKeepDays(policy.Doc)))
+	for dir, created := range dirs {
+		if _, ok := ret.dirs[dir]; !ok && created.Before(docAgo) {
+			ret.dirs[dir] = 0
+		}
+	}
+
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].created.After(group[j].created) })
+
+		rule := policy.Doc
+		if historyKindAsset == group[0].kind {
+			rule = policy.Asset
+		}
+		ago := now.Add(-24 * time.Hour * time.Duration(historyRetentionKeepDays(rule)))
+		buckets := map[string]bool{}
+		for i, v := range group {
+			if historyKindBlock != v.kind && i < rule.KeepLast {
+				v.protected = true
+				if rule.Thinning {
+					buckets[historyRetentionBucket(v.created, now)] = true
+				}
+				continue
+			}
+
+			if v.created.Before(ago) {
+				v.reason = HistoryRetentionExpired
+				continue
+			}
+
+			if historyKindBlock != v.kind && rule.Thinning {
+				bucket := historyRetentionBucket(v.created, now)
+				if buckets[bucket] {
+					v.reason = HistoryRetentionThinned
+					continue
+				}
+				buckets[bucket] = true
+			}
+		}
+	}
+
+	// 超过大小限制时从最早的历史开始删除
+	sort.Slice(versions, func(i, j int) bool { return versions[i].created.Before(versions[j].created) })
+	ret.OverBudget = !trimHistoryVersions(versions, historyKindDoc, policy.Doc.MaxSize, HistoryRetentionDocMaxSize)
+	ret.OverBudget = !trimHistoryVersions(versions, historyKindAsset, policy.Asset.MaxSize, HistoryRetentionAssetMaxSize) || ret.OverBudget
+	ret.OverBudget = !trimHistoryVersions(versions, "", policy.MaxSize, HistoryRetentionMaxSize) || ret.OverBudget
+
+	for _, v := range versions {
+		if "" == v.reason {
+			continue
+		}
+
+		ret.deletes = append(ret.deletes, v)
+		ret.dirs[v.dir]--
+		ret.DeleteCount++
+		ret.DeleteSize += v.size
+		ret.Reasons[v.reason]++
+		if historyRetentionReportMaxItems > len(ret.Items) {
+			ret.Items = append(ret.Items, &HistoryRetentionItem{Path: v.path, Kind: v.kind, ID: v.id, Op: v.op, Created: v.created.Unix(), Size: v.size, Reason: v.reason})
+		}
+	}
+	return
+}
+
+// trimHistoryVersions 删除 kind 类型（为空时表示全部类型）中最早的历史版本，直到总大小不超过 maxSize MB。
+// 受保护的最近版本不会被删除，返回 false 表示删除后仍然超过限制。
+func trimHistoryVersions(versions []*historyVersion, kind string, maxSize int64, reason string) bool {
+	if 1 > maxSize {
+		return true
+	}
+
+	limit := maxSize << 20
+	var size int64
+	for _, v := range versions {
+		if "" == v.reason && ("" == kind || kind == v.kind) {
+			size += v.size
+		}
+	}
+
+	for _, v := range versions {
+		if size <= limit {
+			return true
+		}
+		if "" != v.reason || v.protected || ("" != kind && kind != v.kind) {
+			continue
+		}
+		v.reason = reason
+		size -= v.size
+	}
+	return size <= limit
+}
+
+// historyRetentionBucket 返回稀疏保留时历史所在的时间段：一天内按小时，一个月内按天，之后按周。
+func historyRetentionBucket(created, now time.Time) string {
+	age := now.Sub(created)
+	switch {
+	case 24*time.Hour > age:
+		return created.Format("2006010215")
+	case 30*24*time.Hour > age:
+		return created.Format("20060102")
+	default:
+		year, week := created.ISOWeek()
+		return fmt.Sprintf("%dW%02d", year, week)
+	}
+}
+
+func listHistoryVersions(historyDir string) (ret []*historyVersion, historyDirs map[string]time.Time) {
+	historyDirs = map[string]time.Time{}
+	dirs, err := os.ReadDir(historyDir)
+	if nil != err {
+		if !os.IsNotExist(err) {
+			logging.LogErrorf("read history dir [%s] failed: %s", historyDir, err)
+		}
+		return
+	}
+
+	for _, dir := range dirs {
+		name := dir.Name()
+		if !dir.IsDir() || !strings.Contains(name, "-") {
+			continue
+		}
+
+		op := name[strings.LastIndex(name, "-")+1:]
+		if !gulu.Str.Contains(op, validOps) {
+			continue
+		}
+		created, parseErr := time.ParseInLocation("2006-01-02-150405", name[:strings.LastIndex(name, "-")], time.Local)
+		if nil != parseErr {
+			continue
+		}
+
+		entryPath := filepath.Join(historyDir, name)
+		historyDirs[entryPath] = created
+		filepath.WalkDir(entryPath, func(path string, d fs.DirEntry, err error) error {
+			if nil != err || d.IsDir() {
+				return nil
+			}
+
+			info, infoErr := d.Info()
+			if nil != infoErr {
+				return nil
+			}
+
+			rel := filepath.ToSlash(strings.TrimPrefix(path, entryPath))
+			v := &historyVersion{path: path, dir: entryPath, op: op, created: created, size: info.Size()}
+			switch {
+			case HistoryOpBlock == op:
+				// 块修改记录每天一个文件，使用最后写入时间判断是否过期
+				v.kind, v.id, v.created = historyKindBlock, name, info.ModTime()
+			case strings.HasSuffix(rel, ".sy"):
+				v.kind, v.id = historyKindDoc, strings.TrimSuffix(filepath.Base(rel), ".sy")
+			case strings.Contains(rel, "/assets/"):
+				v.kind, v.id = historyKindAsset, rel[strings.Index(rel, "/assets/")+1:]
+			default:
+				// 笔记本配置等文件跟随历史文件夹一起删除
+				return nil
+			}
+			ret = append(ret, v)
+			return nil
+		})
+	}
+	return
+}
+
+func applyHistoryRetention(report *HistoryRetentionReport) {
+	var paths []string
+	var blockBefore time.Time
+	for _, v := range report.deletes {
+		if err := os.Remove(v.path); nil != err && !os.IsNotExist(err) {
+			logging.LogWarnf("remove history [%s] failed: %s", v.path, err)
+			continue
+		}
+
+		if historyKindBlock == v.kind {
+			if v.created.After(blockBefore) {
+				blockBefore = v.created
+			}
+			continue
+		}
+		paths = append(paths, filepath.ToSlash(strings.TrimPrefix(v.path, util.HistoryDir+string(os.PathSeparator))))
+	}
+
+	for dir, remains := range report.dirs {
+		if 0 < remains {
+			continue
+		}
+		if err := os.RemoveAll(dir); nil != err {
+			logging.LogWarnf("remove history dir [%s] failed: %s", dir, err)
+		}
+	}
+
+	// 清理历史库
+	if 0 < len(paths) {
+		sql.DeleteHistoriesByPathsQueue(paths)
+	}
+	if !blockBefore.IsZero() {
+		sql.DeleteBlockHistoriesBeforeQueue(fmt.Sprintf("%d", blockBefore.Unix()+1))
+	}
+	report.Applied = true
+	if 0 < report.DeleteCount {
+		logging.LogInfof("history retention removed [%d] versions [%s]", report.DeleteCount, humanize.BytesCustomCeil(uint64(report.DeleteSize), 2))
+	}
+}
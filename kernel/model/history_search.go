@@ -0,0 +1,312 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute"
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-community/siyuan/kernel/util"
+)
+
+var ErrInvalidHistoryPath = errors.New("invalid history path")
+
+// 内容历史搜索最多扫描的历史记录数
+const historyOccurrenceMaxRows = 10240
+
+// HistoryOccurrenceEntry 描述了包含搜索内容的一条文档历史。
+type HistoryOccurrenceEntry struct {
+	Path    string `json:"path"`    // 历史文件绝对路径
+	Op      string `json:"op"`      // 历史操作类型
+	Created int64  `json:"created"` // 历史生成时间，单位为秒
+}
+
+// HistoryBlockDiff 描述了历史中包含搜索内容的块和当前文档中同一个块的差异。
+type HistoryBlockDiff struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	Status          string `json:"status"`          // removed：当前文档中已经不存在，modified：内容有变化，unchanged：内容相同
+	Markdown        string `json:"markdown"`        // 历史中的块内容
+	CurrentMarkdown string `json:"currentMarkdown"` // 当前文档中的块内容
+}
+
+// HistoryOccurrence 描述了一个文档的历史中包含搜索内容的时间范围。
+type HistoryOccurrence struct {
+	ID       string                  `json:"id"`       // 文档 ID
+	Title    string                  `json:"title"`    // 最近一次包含搜索内容的历史中的文档标题
+	Notebook string                  `json:"notebook"` // 历史中的笔记本 ID
+	Count    int                     `json:"count"`    // 包含搜索内容的历史数
+	First    *HistoryOccurrenceEntry `json:"first"`    // 最早包含搜索内容的历史
+	Last     *HistoryOccurrenceEntry `json:"last"`     // 最近包含搜索内容的历史
+	Exists   bool                    `json:"exists"`   // 当前文档是否存在
+	Current  bool                    `json:"current"`  // 当前文档是否仍然包含搜索内容
+	Blocks   []*HistoryBlockDiff     `json:"blocks"`   // 最近包含搜索内容的历史中命中的块和当前文档的差异
+}
+
+// SearchHistoryOccurrences 在文档历史中搜索 query，按文档返回最早和最近包含 query 的历史，以及命中块和当前文档的差异。
+// 用于回答“这句话是什么时候消失的”，结果按最近包含时间降序排列。
+func SearchHistoryOccurrences(query, box string, page int) (ret []*HistoryOccurrence, pageCount, totalCount int) {
+	ret = []*HistoryOccurrence{}
+	query = strings.TrimSpace(gulu.Str.RemoveInvisible(query))
+	if "" == query {
+		return
+	}
+
+	table := "histories_fts_case_insensitive"
+	stmt := "SELECT id, title, path, op, created, content FROM " + table + " WHERE " + table + " MATCH '{content}:(" + stringQuery(query) + ")'"
+	stmt += " AND path LIKE '%.sy'"
+	if "" != box {
+		stmt += " AND path LIKE '%/" + box + "/%'"
+	}
+	stmt += " AND created > '" + fmt.Sprintf("%d", historyRetentionAgo()) + "'"
+	stmt += " ORDER BY created DESC LIMIT " + strconv.Itoa(historyOccurrenceMaxRows)
+	rows, err := sql.QueryHistory(stmt)
+	if nil != err {
+		return
+	}
+
+	// 全文索引按词匹配，这里确认历史内容中确实包含完整的 query
+	lowerQuery := strings.ToLower(query)
+	occurrences := map[string]*HistoryOccurrence{}
+	var docIDs []string
+	for _, row := range rows {
+		content, _ := row["content"].(string)
+		if !strings.Contains(strings.ToLower(content), lowerQuery) {
+			continue
+		}
+
+		id, _ := row["id"].(string)
+		title, _ := row["title"].(string)
+		p, _ := row["path"].(string)
+		op, _ := row["op"].(string)
+		createdStr, _ := row["created"].(string)
+		created, _ := strconv.ParseInt(createdStr, 10, 64)
+		entry := &HistoryOccurrenceEntry{Path: filepath.Join(util.HistoryDir, p), Op: op, Created: created}
+
+		occurrence := occurrences[id]
+		if nil == occurrence {
+			// 历史路径为 时间-操作/笔记本/文档路径
+			var notebook string
+			if parts := strings.Split(p, "/"); 2 < len(parts) {
+				notebook = parts[1]
+			}
+			occurrence = &HistoryOccurrence{ID: id, Title: title, Notebook: notebook, First: entry, Last: entry, Blocks: []*HistoryBlockDiff{}}
+			occurrences[id] = occurrence
+			docIDs = append(docIDs, id)
+		}
+		occurrence.Count++
+		if created < occurrence.First.Created {
+			occurrence.First = entry
+		}
+		if created > occurrence.Last.Created {
+			occurrence.Last, occurrence.Title = entry, title
+		}
+	}
+
+	var all []*HistoryOccurrence
+	for _, id := range docIDs {
+		all = append(all, occurrences[id])
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Last.Created > all[j].Last.Created })
+
+	totalCount = len(all)
+	pageCount = int(math.Ceil(float64(totalCount) / float64(fileHistoryPageSize)))
+	start := (page - 1) * fileHistoryPageSize
+	if 0 > start || start >= totalCount {
+		return
+	}
+	end := min(start+fileHistoryPageSize, totalCount)
+
+	luteEngine := util.NewLute()
+	for _, occurrence := range all[start:end] {
+		diffHistoryOccurrence(occurrence, lowerQuery, luteEngine)
+		ret = append(ret, occurrence)
+	}
+	return
+}
+
+// diffHistoryOccurrence 比较最近包含搜索内容的历史和当前文档，列出历史中包含搜索内容的叶子块的变化。
+func diffHistoryOccurrence(occurrence *HistoryOccurrence, lowerQuery string, luteEngine *lute.Lute) {
+	historyTree, err := loadTree(occurrence.Last.Path, luteEngine)
+	if nil != err {
+		return
+	}
+
+	current, _ := LoadTreeByBlockID(occurrence.ID)
+	if nil != current {
+		occurrence.Exists = true
+		occurrence.Current = strings.Contains(strings.ToLower(current.Root.Content()), lowerQuery)
+	}
+
+	ast.Walk(historyTree.Root, func(n *ast.Node, entering bool) ast.WalkStatus {
+		if !entering || !n.IsBlock() || ast.NodeDocument == n.Type || n.IsContainerBlock() {
+			return ast.WalkContinue
+		}
+
+		if !strings.Contains(strings.ToLower(n.Content()), lowerQuery) {
+			return ast.WalkSkipChildren
+		}
+
+		diff := &HistoryBlockDiff{ID: n.ID, Type: treenode.TypeAbbr(n.Type.String()), Status: "removed", Markdown: treenode.ExportNodeStdMd(n, luteEngine)}
+		if nil != current {
+			if currentNode := treenode.GetNodeInTree(current, n.ID); nil != currentNode {
+				diff.CurrentMarkdown = treenode.ExportNodeStdMd(currentNode, luteEngine)
+				diff.Status = "modified"
+				if diff.CurrentMarkdown == diff.Markdown {
+					diff.Status = "unchanged"
+				}
+			}
+		}
+		occurrence.Blocks = append(occurrence.Blocks, diff)
+		return ast.WalkSkipChildren
+	})
+}
+
+// RollbackBlockHistory 将文档历史中的一个块恢复到当前文档中。
+// 当前文档中存在该块时替换，否则插入到历史中仍然存在的前一个兄弟块后面（或者后一个兄弟块前面、父块中），都不存在时追加到文档末尾。
+// 恢复通过事务执行，子块中已经移动到目标块以外（包括其他文档）的块不恢复，避免出现重复的块 ID。
+func RollbackBlockHistory(historyPath, id string) (ret []*Transaction, err error) {
+	if !util.IsSubPath(util.HistoryDir, historyPath) || !strings.HasSuffix(historyPath, ".sy") {
+		err = ErrInvalidHistoryPath
+		return
+	}
+
+	WaitForWritingFiles()
+	luteEngine := util.NewLute()
+	historyTree, err := loadTree(historyPath, luteEngine)
+	if nil != err {
+		return
+	}
+
+	node := treenode.GetNodeInTree(historyTree, id)
+	if nil == node || ast.NodeDocument == node.Type {
+		err = ErrBlockNotFound
+		return
+	}
+
+	tree, _ := LoadTreeByBlockID(historyTree.Root.ID)
+	if nil == tree {
+		err = ErrTreeNotFound
+		return
+	}
+
+	// 恢复前为当前文档生成历史，恢复后仍然可以回退
+	generateOpTypeHistory(tree, HistoryOpUpdate)
+
+	current := treenode.GetNodeInTree(tree, id)
+	removeMovedHistoryBlocks(tree, node, current)
+
+	var op *Operation
+	if nil != current {
+		op = &Operation{Action: "update", ID: id}
+	} else {
+		op = &Operation{Action: "insert", ID: id}
+		setHistoryBlockAnchor(tree, node, op)
+		if ast.NodeListItem == node.Type {
+			// 插入列表项时需要包裹一层列表，参考 doInsert
+			list := &ast.Node{Type: ast.NodeList, ID: ast.NewNodeID(), ListData: node.Parent.ListData}
+			list.SetIALAttr("id", list.ID)
+			node.Unlink()
+			list.AppendChild(node)
+			node = list
+		}
+	}
+
+	node.Unlink()
+	subTree := &parse.Tree{Root: &ast.Node{Type: ast.NodeDocument}, Context: &parse.Context{ParseOption: luteEngine.ParseOptions}}
+	subTree.Root.AppendChild(node)
+	op.Data = luteEngine.Tree2BlockDOM(subTree, luteEngine.RenderOptions)
+
+	ret = []*Transaction{{DoOperations: []*Operation{op}}}
+	PerformTransactions(&ret)
+	WaitForWritingFiles()
+	return
+}
+
+// removeMovedHistoryBlocks 移除历史块中已经存在于当前目标块 current 以外的子块，current 为 nil 时移除所有仍然存在的子块。
+func removeMovedHistoryBlocks(tree *parse.Tree, node, current *ast.Node) {
+	var moved []*ast.Node
+	ast.Walk(node, func(n *ast.Node, entering bool) ast.WalkStatus {
+		if !entering || n == node || "" == n.ID || !n.IsBlock() {
+			return ast.WalkContinue
+		}
+
+		if nil == treenode.GetBlockTree(n.ID) {
+			return ast.WalkContinue
+		}
+		if nil != current {
+			if currentNode := treenode.GetNodeInTree(tree, n.ID); nil != currentNode && isHistoryBlockDescendant(currentNode, current) {
+				return ast.WalkContinue
+			}
+		}
+		moved = append(moved, n)
+		return ast.WalkSkipChildren
+	})
+	for _, n := range moved {
+		n.Unlink()
+	}
+}
+
+func isHistoryBlockDescendant(n, ancestor *ast.Node) bool {
+	for p := n.Parent; nil != p; p = p.Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// setHistoryBlockAnchor 设置插入历史块的位置，使用历史中仍然存在的前一个兄弟块、后一个兄弟块或者父块，都不存在时追加到文档末尾。
+func setHistoryBlockAnchor(tree *parse.Tree, node *ast.Node, op *Operation) {
+	for prev := node.Previous; nil != prev; prev = prev.Previous {
+		if "" != prev.ID && nil != treenode.GetNodeInTree(tree, prev.ID) {
+			op.PreviousID = prev.ID
+			return
+		}
+	}
+
+	for next := node.Next; nil != next; next = next.Next {
+		if "" != next.ID && nil != treenode.GetNodeInTree(tree, next.ID) {
+			op.NextID = next.ID
+			return
+		}
+	}
+
+	if parent := node.Parent; nil != parent && ast.NodeDocument != parent.Type {
+		if anchor := treenode.GetNodeInTree(tree, parent.ID); nil != anchor && anchor.IsContainerBlock() {
+			op.ParentID = parent.ID
+			return
+		}
+	}
+
+	if last := tree.Root.LastChild; nil != last && "" != last.ID {
+		op.PreviousID = last.ID
+		return
+	}
+	op.ParentID = tree.Root.ID
+}
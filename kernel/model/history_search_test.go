@@ -0,0 +1,60 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/88250/lute/ast"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+)
+
+func TestRemoveMovedHistoryBlocks(t *testing.T) {
+	// 目标块 q 中的 a 仍然在 q 中，b 移动到了 q 外面，c 移动到了其他文档，d 已经被删除
+	current := parseSyncMergeTree(syncMergeDoc(quoteKramdown("q", paraKramdown("a", "a")), paraKramdown("b", "b")))
+	current.ID, current.Box, current.Path = current.Root.ID, "20240101000000-histbox", "/"+current.Root.ID+".sy"
+	other := parseSyncMergeTree(paraKramdown("c", "c") + "{: id=\"" + syncMergeID("y") + "\" type=\"doc\"}")
+	other.ID, other.Box, other.Path = other.Root.ID, current.Box, "/"+other.Root.ID+".sy"
+	treenode.IndexBlockTree(current)
+	treenode.IndexBlockTree(other)
+
+	cases := []struct {
+		name     string
+		current  *ast.Node
+		expected string
+	}{
+		{"replace", treenode.GetNodeInTree(current, syncMergeID("q")), "a,d"},
+		{"insert", nil, "d"},
+	}
+
+	for _, c := range cases {
+		history := parseSyncMergeTree(syncMergeDoc(quoteKramdown("q", paraKramdown("a", "a"), paraKramdown("b", "b"), paraKramdown("c", "c"), paraKramdown("d", "d"))))
+		node := treenode.GetNodeInTree(history, syncMergeID("q"))
+		removeMovedHistoryBlocks(current, node, c.current)
+
+		var ids []string
+		for child := node.FirstChild; nil != child; child = child.Next {
+			if "" != child.ID {
+				ids = append(ids, syncMergeShortID(child.ID))
+			}
+		}
+		if c.expected != strings.Join(ids, ",") {
+			t.Errorf("%s: expected [%s], got [%s]", c.name, c.expected, strings.Join(ids, ","))
+		}
+	}
+}
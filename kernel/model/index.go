@@ -20,6 +20,8 @@ import (
 	"bytes"
 	"fmt"
 	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
@@ -119,6 +121,50 @@ func (box *Box) Index() {
 	task.AppendTask(task.DatabaseIndexRef, IndexRefs)
 }
 
+// indexAttributeViews 将所有属性视图（数据库）加入数据库索引队列。
+func indexAttributeViews() {
+	avDir := filepath.Join(util.DataDir, "storage", "av")
+	if !gulu.File.IsDir(avDir) {
+		return
+	}
+
+	entries, err := os.ReadDir(avDir)
+	if nil != err {
+		logging.LogErrorf("read dir [%s] failed: %s", avDir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if id := strings.TrimSuffix(entry.Name(), ".json"); !entry.IsDir() && ast.IsNodeIDPattern(id) {
+			sql.IndexAttributeViewQueue(id)
+		}
+	}
+}
+
+// syncAttributeViewIndex 根据同步或者数据变更的文件路径更新属性视图（数据库）的索引。
+func syncAttributeViewIndex(upserts, removes []string) {
+	for _, p := range upserts {
+		if avID := getAttributeViewIDByPath(p); "" != avID {
+			sql.IndexAttributeViewQueue(avID)
+		}
+	}
+	for _, p := range removes {
+		if avID := getAttributeViewIDByPath(p); "" != avID {
+			sql.RemoveAttributeViewQueue(avID)
+		}
+	}
+}
+
+func getAttributeViewIDByPath(p string) string {
+	if !strings.HasPrefix(p, "/storage/av/") || !strings.HasSuffix(p, ".json") {
+		return ""
+	}
+	if id := strings.TrimSuffix(path.Base(p), ".json"); ast.IsNodeIDPattern(id) {
+		return id
+	}
+	return ""
+}
+
 func index(boxID string) {
 	box := Conf.Box(boxID)
 	if nil == box {
@@ -310,7 +356,7 @@ func autoIndexEmbedBlock(embedBlocks []*sql.Block) {
 			continue
 		}
 
-		queryResultBlocks := sql.SelectBlocksRawStmtNoParse(stmt, 102400)
+		queryResultBlocks := sql.SelectBlocksRawStmtNoParseReadOnly(stmt, 102400)
 		for _, block := range queryResultBlocks {
 			embedBlock.Content += block.Content
 		}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"path/filepath"
 	"strings"
 	"time"
@@ -22,7 +23,7 @@ func OCRAssetsJob() {
 	task.AppendTaskWithTimeout(task.OCRImage, 30*time.Second, autoOCRAssets)
 }
 
-func autoOCRAssets() {
+func autoOCRAssets(ctx context.Context) {
 	if !util.TesseractEnabled {
 		return
 	}
@@ -33,6 +34,11 @@ func autoOCRAssets() {
 	assets := getUnOCRAssetsAbsPaths()
 	if 0 < len(assets) {
 		for i, assetAbsPath := range assets {
+			if nil != ctx.Err() {
+				break
+			}
+
+			task.SetProgress(i+1, min(len(assets), 8))
 			text := util.Tesseract(assetAbsPath)
 			p := strings.TrimPrefix(assetAbsPath, assetsPath)
 			p = "assets" + filepath.ToSlash(p)
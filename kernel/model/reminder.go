@@ -0,0 +1,450 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/88250/lute/ast"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/filelock"
+	"github.com/siyuan-note/httpclient"
+	"github.com/siyuan-note/logging"
+)
+
+var (
+	ErrReminderNotFound      = errors.New("reminder not found")
+	ErrReminderInvalidRepeat = errors.New("invalid reminder repeat")
+)
+
+// 提醒重复方式
+const (
+	ReminderRepeatNone    = ""
+	ReminderRepeatDaily   = "daily"
+	ReminderRepeatWeekly  = "weekly"
+	ReminderRepeatMonthly = "monthly"
+)
+
+// 单次提醒触发后保留的天数，保留期间仍然可以稍后提醒
+const reminderFiredRetentionDays = 7
+
+// BlockReminder 描述了一个本地块提醒。
+//
+// 提醒设置保存在 data/storage/reminders.json 中随数据同步，触发状态（Scheduled、Next 和 LastFired）
+// 是每台设备独立的，保存在 conf/reminders.json 中，避免多台设备互相覆盖。
+type BlockReminder struct {
+	ID        string `json:"id"`        // 块 ID
+	RootID    string `json:"rootID"`    // 文档 ID
+	Content   string `json:"content"`   // 块内容摘要
+	Repeat    string `json:"repeat"`    // 重复方式，为空表示不重复
+	Start     int64  `json:"start"`     // 设置的提醒时间，重复提醒以此计算每次的时间
+	Scheduled int64  `json:"scheduled"` // 当前这次提醒的计划时间
+	Next      int64  `json:"next"`      // 下次触发时间，稍后提醒时晚于计划时间，0 表示已经结束
+	LastFired int64  `json:"lastFired"` // 上次触发时间
+}
+
+// blockReminderSetting 是随数据同步的提醒设置。
+type blockReminderSetting struct {
+	ID      string `json:"id"`
+	RootID  string `json:"rootID"`
+	Content string `json:"content"`
+	Repeat  string `json:"repeat"`
+	Start   int64  `json:"start"`
+}
+
+// blockReminderSettings 是 data/storage/reminders.json 的内容。
+type blockReminderSettings struct {
+	DeliveryDevice string                  `json:"deliveryDevice"` // 负责通过 Webhook 和邮件投递提醒的设备，为空表示不投递
+	Reminders      []*blockReminderSetting `json:"reminders"`
+}
+
+// blockReminderState 是提醒在本设备上的触发状态，Start 和 Repeat 用于发现同步后变化了的提醒设置。
+type blockReminderState struct {
+	Start     int64  `json:"start"`
+	Repeat    string `json:"repeat"`
+	Scheduled int64  `json:"scheduled"`
+	Next      int64  `json:"next"`
+	LastFired int64  `json:"lastFired"`
+}
+
+var (
+	blockReminders              []*BlockReminder
+	blockReminderDeliveryDevice string
+	blockRemindersLoaded        bool
+	blockRemindersLock          = sync.Mutex{}
+)
+
+// SetBlockReminderDeliveryDevice 将本设备设置为通过 Webhook 和邮件投递提醒的设备。
+// 提醒在每台设备上都会通过界面消息通知，但是只由一台设备投递到外部渠道，避免重复投递。
+func SetBlockReminderDeliveryDevice() {
+	loadBlockReminders()
+	blockRemindersLock.Lock()
+	defer blockRemindersLock.Unlock()
+
+	if Conf.System.ID == blockReminderDeliveryDevice {
+		return
+	}
+	blockReminderDeliveryDevice = Conf.System.ID
+	saveBlockReminderSettings()
+}
+
+// reloadBlockReminders 在同步下载了提醒设置后重新加载提醒。
+func reloadBlockReminders() {
+	blockRemindersLock.Lock()
+	defer blockRemindersLock.Unlock()
+
+	blockRemindersLoaded = false
+}
+
+// SnoozeBlockReminder 将块提醒推迟 minutes 分钟，重复提醒的后续计划时间不受影响。
+func SnoozeBlockReminder(id string, minutes int) (err error) {
+	if 1 > minutes {
+		minutes = 10
+	}
+
+	loadBlockReminders()
+	blockRemindersLock.Lock()
+	defer blockRemindersLock.Unlock()
+
+	for _, reminder := range blockReminders {
+		if reminder.ID == id {
+			reminder.Next = time.Now().Add(time.Duration(minutes) * time.Minute).UnixMilli()
+			return saveBlockReminderStates()
+		}
+	}
+	return ErrReminderNotFound
+}
+
+// GetBlockReminders 返回所有块提醒，按下次触发时间升序排列，已经结束的排在最后。
+func GetBlockReminders() (ret []*BlockReminder) {
+	loadBlockReminders()
+	blockRemindersLock.Lock()
+	defer blockRemindersLock.Unlock()
+
+	ret = []*BlockReminder{}
+	for _, reminder := range blockReminders {
+		r := *reminder
+		ret = append(ret, &r)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if 0 == ret[i].Next || 0 == ret[j].Next {
+			return 0 != ret[i].Next
+		}
+		return ret[i].Next < ret[j].Next
+	})
+	return
+}
+
+// ReminderJob 触发到期的块提醒。
+func ReminderJob() {
+	if util.ReadOnly || !util.IsBooted() {
+		return
+	}
+
+	loadBlockReminders()
+	blockRemindersLock.Lock()
+	now := time.Now()
+	deliver := Conf.System.ID == blockReminderDeliveryDevice
+	var dues []*BlockReminder
+	var remains []*BlockReminder
+	changed, removed := false, false
+	for _, reminder := range blockReminders {
+		if 0 == reminder.Next {
+			if reminder.LastFired < now.AddDate(0, 0, -reminderFiredRetentionDays).UnixMilli() {
+				removed = true
+				continue
+			}
+		} else if now.UnixMilli() >= reminder.Next {
+			// 内核停止期间错过的多次提醒只触发一次
+			reminder.LastFired = now.UnixMilli()
+			reminder.Next = 0
+			if ReminderRepeatNone != reminder.Repeat {
+				reminder.Scheduled = nextReminderOccurrence(time.UnixMilli(reminder.Start), reminder.Repeat, now).UnixMilli()
+				reminder.Next = reminder.Scheduled
+			}
+			r := *reminder
+			dues = append(dues, &r)
+			changed = true
+		}
+		remains = append(remains, reminder)
+	}
+	blockReminders = remains
+	if changed || removed {
+		saveBlockReminderStates()
+	}
+	if removed {
+		saveBlockReminderSettings()
+	}
+	blockRemindersLock.Unlock()
+
+	for _, reminder := range dues {
+		go deliverBlockReminder(reminder, deliver)
+	}
+}
+
+// deliverBlockReminder 通过界面消息通知到期的提醒，deliver 为 true 时还通过 Webhook 和邮件投递。
+func deliverBlockReminder(reminder *BlockReminder, deliver bool) {
+	defer logging.Recover()
+
+	if tree, _ := LoadTreeByBlockID(reminder.ID); nil != tree {
+		if node := treenode.GetNodeInTree(tree, reminder.ID); nil != node {
+			reminder.Content = reminderContent(node)
+		}
+	} else {
+		logging.LogWarnf("block [%s] of reminder not found", reminder.ID)
+		if deliver {
+			// 其他设备上的块可能还没有同步下来，只由投递设备清理提醒
+			removeBlockReminder(reminder.ID)
+		}
+		return
+	}
+
+	util.PushMsg(fmt.Sprintf(Conf.Language(247), html.EscapeString(reminder.Content)), 0)
+	evt := util.NewCmdResult("blockReminder", 0, util.PushModeBroadcast)
+	evt.Data = reminder
+	util.PushEvent(evt)
+
+	if !deliver {
+		return
+	}
+
+	if webhook := strings.TrimSpace(Conf.Reminder.Webhook); "" != webhook {
+		resp, err := httpclient.NewBrowserRequest().SetBody(reminder).Post(webhook)
+		if nil != err {
+			logging.LogErrorf("post reminder webhook failed: %s", err)
+		} else if 200 > resp.StatusCode || 300 <= resp.StatusCode {
+			logging.LogErrorf("post reminder webhook failed: %d", resp.StatusCode)
+		}
+	}
+
+	if err := sendReminderMail(reminder); nil != err {
+		logging.LogErrorf("send reminder mail failed: %s", err)
+	}
+}
+
+// sendReminderMail 通过 SMTP 中继发送提醒邮件，服务器支持时使用 STARTTLS。
+func sendReminderMail(reminder *BlockReminder) error {
+	smtpConf := Conf.Reminder.SMTP
+	if nil == smtpConf || "" == smtpConf.Host || 1 > len(smtpConf.To) {
+		return nil
+	}
+
+	from := smtpConf.From
+	if "" == from {
+		from = smtpConf.Username
+	}
+	subject := fmt.Sprintf(Conf.Language(247), gulu.Str.SubStr(reminder.Content, 32))
+	body := bytes.Buffer{}
+	body.WriteString("From: " + from + "\r\n")
+	body.WriteString("To: " + strings.Join(smtpConf.To, ", ") + "\r\n")
+	body.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", subject) + "\r\n")
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(reminder.Content + "\r\n\r\n")
+	body.WriteString("siyuan://blocks/" + reminder.ID + "\r\n")
+
+	var auth smtp.Auth
+	if "" != smtpConf.Username {
+		auth = smtp.PlainAuth("", smtpConf.Username, smtpConf.Password, smtpConf.Host)
+	}
+	addr := net.JoinHostPort(smtpConf.Host, strconv.Itoa(smtpConf.Port))
+	return smtp.SendMail(addr, auth, from, smtpConf.To, body.Bytes())
+}
+
+// nextReminderOccurrence 返回从 start 开始按 repeat 重复的、晚于 after 的第一次提醒时间。
+func nextReminderOccurrence(start time.Time, repeat string, after time.Time) time.Time {
+	for i := 1; ; i++ {
+		var ret time.Time
+		switch repeat {
+		case ReminderRepeatDaily:
+			ret = start.AddDate(0, 0, i)
+		case ReminderRepeatWeekly:
+			ret = start.AddDate(0, 0, 7*i)
+		default:
+			// 按月重复时，没有对应日期的月份使用月末，比如 31 日的提醒在 2 月使用 28 日或 29 日
+			first := time.Date(start.Year(), start.Month()+time.Month(i), 1, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+			lastDay := first.AddDate(0, 1, -1).Day()
+			ret = first.AddDate(0, 0, min(start.Day(), lastDay)-1)
+		}
+		if ret.After(after) {
+			return ret
+		}
+	}
+}
+
+func reminderContent(node *ast.Node) string {
+	if ast.NodeDocument != node.Type && node.IsContainerBlock() {
+		node = treenode.FirstLeafBlock(node)
+	}
+	content := treenode.NodeStaticContent(node, nil, false, false, false)
+	return gulu.Str.SubStr(content, 128)
+}
+
+func putBlockReminder(reminder *BlockReminder) {
+	loadBlockReminders()
+	blockRemindersLock.Lock()
+	defer blockRemindersLock.Unlock()
+
+	replaced := false
+	for i, r := range blockReminders {
+		if r.ID == reminder.ID {
+			blockReminders[i], replaced = reminder, true
+			break
+		}
+	}
+	if !replaced {
+		blockReminders = append(blockReminders, reminder)
+	}
+	saveBlockReminderSettings()
+	saveBlockReminderStates()
+}
+
+func removeBlockReminder(id string) {
+	loadBlockReminders()
+	blockRemindersLock.Lock()
+	defer blockRemindersLock.Unlock()
+
+	for i, r := range blockReminders {
+		if r.ID == id {
+			blockReminders = append(blockReminders[:i], blockReminders[i+1:]...)
+			saveBlockReminderSettings()
+			saveBlockReminderStates()
+			return
+		}
+	}
+}
+
+func loadBlockReminders() {
+	blockRemindersLock.Lock()
+	defer blockRemindersLock.Unlock()
+
+	if blockRemindersLoaded {
+		return
+	}
+	blockRemindersLoaded = true
+
+	settings := &blockReminderSettings{}
+	dataPath := filepath.Join(util.DataDir, "storage", "reminders.json")
+	if filelock.IsExist(dataPath) {
+		data, err := filelock.ReadFile(dataPath)
+		if nil != err {
+			logging.LogErrorf("read storage [reminders] failed: %s", err)
+			return
+		}
+		if err = gulu.JSON.UnmarshalJSON(data, settings); nil != err {
+			logging.LogErrorf("unmarshal storage [reminders] failed: %s", err)
+			return
+		}
+	}
+
+	states := map[string]*blockReminderState{}
+	statePath := filepath.Join(util.ConfDir, "reminders.json")
+	if filelock.IsExist(statePath) {
+		data, err := filelock.ReadFile(statePath)
+		if nil != err {
+			logging.LogErrorf("read reminder states failed: %s", err)
+		} else if err = gulu.JSON.UnmarshalJSON(data, &states); nil != err {
+			logging.LogErrorf("unmarshal reminder states failed: %s", err)
+		}
+	}
+
+	blockReminderDeliveryDevice = settings.DeliveryDevice
+	blockReminders = mergeBlockReminders(settings.Reminders, states, time.Now())
+}
+
+// mergeBlockReminders 合并提醒设置和本设备的触发状态。
+//
+// 没有触发状态或者设置已经变化的提醒按照设置重新计算状态，此时已经过去的单次提醒视为已经触发，
+// 避免在同步下载了其他设备设置的提醒后重复触发。
+func mergeBlockReminders(settings []*blockReminderSetting, states map[string]*blockReminderState, now time.Time) (ret []*BlockReminder) {
+	for _, setting := range settings {
+		reminder := &BlockReminder{ID: setting.ID, RootID: setting.RootID, Content: setting.Content, Repeat: setting.Repeat, Start: setting.Start}
+		if state := states[setting.ID]; nil != state && state.Start == setting.Start && state.Repeat == setting.Repeat {
+			reminder.Scheduled, reminder.Next, reminder.LastFired = state.Scheduled, state.Next, state.LastFired
+		} else if setting.Start > now.UnixMilli() {
+			reminder.Scheduled, reminder.Next = setting.Start, setting.Start
+		} else if ReminderRepeatNone == setting.Repeat {
+			reminder.Scheduled, reminder.LastFired = setting.Start, setting.Start
+		} else {
+			reminder.Scheduled = nextReminderOccurrence(time.UnixMilli(setting.Start), setting.Repeat, now).UnixMilli()
+			reminder.Next = reminder.Scheduled
+		}
+		ret = append(ret, reminder)
+	}
+	return
+}
+
+func saveBlockReminderSettings() (err error) {
+	dirPath := filepath.Join(util.DataDir, "storage")
+	if err = os.MkdirAll(dirPath, 0755); nil != err {
+		logging.LogErrorf("create storage [reminders] dir failed: %s", err)
+		return
+	}
+
+	settings := &blockReminderSettings{DeliveryDevice: blockReminderDeliveryDevice, Reminders: []*blockReminderSetting{}}
+	for _, reminder := range blockReminders {
+		settings.Reminders = append(settings.Reminders, &blockReminderSetting{ID: reminder.ID, RootID: reminder.RootID, Content: reminder.Content, Repeat: reminder.Repeat, Start: reminder.Start})
+	}
+	data, err := gulu.JSON.MarshalIndentJSON(settings, "", "  ")
+	if nil != err {
+		logging.LogErrorf("marshal storage [reminders] failed: %s", err)
+		return
+	}
+
+	lsPath := filepath.Join(dirPath, "reminders.json")
+	err = filelock.WriteFile(lsPath, data)
+	if nil != err {
+		logging.LogErrorf("write storage [reminders] failed: %s", err)
+		return
+	}
+	return
+}
+
+func saveBlockReminderStates() (err error) {
+	states := map[string]*blockReminderState{}
+	for _, reminder := range blockReminders {
+		states[reminder.ID] = &blockReminderState{Start: reminder.Start, Repeat: reminder.Repeat, Scheduled: reminder.Scheduled, Next: reminder.Next, LastFired: reminder.LastFired}
+	}
+	data, err := gulu.JSON.MarshalIndentJSON(states, "", "  ")
+	if nil != err {
+		logging.LogErrorf("marshal reminder states failed: %s", err)
+		return
+	}
+
+	statePath := filepath.Join(util.ConfDir, "reminders.json")
+	err = filelock.WriteFile(statePath, data)
+	if nil != err {
+		logging.LogErrorf("write reminder states failed: %s", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,61 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeBlockReminders(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	past, future := now.Add(-time.Hour).UnixMilli(), now.Add(time.Hour).UnixMilli()
+	tomorrowPast := now.Add(23 * time.Hour).UnixMilli()
+
+	cases := []struct {
+		name      string
+		setting   *blockReminderSetting
+		state     *blockReminderState
+		scheduled int64
+		next      int64
+		lastFired int64
+	}{
+		{"new future", &blockReminderSetting{Start: future}, nil, future, future, 0},
+		{"new past once", &blockReminderSetting{Start: past}, nil, past, 0, past},
+		{"new past daily", &blockReminderSetting{Start: past, Repeat: ReminderRepeatDaily}, nil, tomorrowPast, tomorrowPast, 0},
+		{"local state", &blockReminderSetting{Start: past}, &blockReminderState{Start: past, Scheduled: past, Next: future, LastFired: past}, past, future, past},
+		{"start changed", &blockReminderSetting{Start: future}, &blockReminderState{Start: past, Scheduled: past, LastFired: past}, future, future, 0},
+		{"repeat changed", &blockReminderSetting{Start: past, Repeat: ReminderRepeatDaily}, &blockReminderState{Start: past, Scheduled: past, LastFired: past}, tomorrowPast, tomorrowPast, 0},
+	}
+
+	for _, c := range cases {
+		c.setting.ID = "20240101000000-aaaaaaa"
+		states := map[string]*blockReminderState{}
+		if nil != c.state {
+			states[c.setting.ID] = c.state
+		}
+
+		reminders := mergeBlockReminders([]*blockReminderSetting{c.setting}, states, now)
+		if 1 != len(reminders) {
+			t.Fatalf("case [%s]: expected 1 reminder, got [%d]", c.name, len(reminders))
+		}
+		r := reminders[0]
+		if r.Scheduled != c.scheduled || r.Next != c.next || r.LastFired != c.lastFired {
+			t.Errorf("case [%s]: expected [%d, %d, %d], got [%d, %d, %d]", c.name, c.scheduled, c.next, c.lastFired, r.Scheduled, r.Next, r.LastFired)
+		}
+	}
+}
@@ -678,7 +678,7 @@ func DownloadCloudSnapshot(tag, id string) (err error) {
 			util.PushErrMsg(Conf.Language(29), 5000)
 			return
 		}
-	case conf.ProviderWebDAV, conf.ProviderS3:
+	case conf.ProviderWebDAV, conf.ProviderS3, conf.ProviderLocal, conf.ProviderSFTP:
 		if !IsPaidUser() {
 			util.PushErrMsg(Conf.Language(214), 5000)
 			return
@@ -720,7 +720,7 @@ func UploadCloudSnapshot(tag, id string) (err error) {
 			util.PushErrMsg(Conf.Language(29), 5000)
 			return
 		}
-	case conf.ProviderWebDAV, conf.ProviderS3:
+	case conf.ProviderWebDAV, conf.ProviderS3, conf.ProviderLocal, conf.ProviderSFTP:
 		if !IsPaidUser() {
 			util.PushErrMsg(Conf.Language(214), 5000)
 			return
@@ -766,7 +766,7 @@ func RemoveCloudRepoTag(tag string) (err error) {
 			util.PushErrMsg(Conf.Language(29), 5000)
 			return
 		}
-	case conf.ProviderWebDAV, conf.ProviderS3:
+	case conf.ProviderWebDAV, conf.ProviderS3, conf.ProviderLocal, conf.ProviderSFTP:
 		if !IsPaidUser() {
 			util.PushErrMsg(Conf.Language(214), 5000)
 			return
@@ -798,7 +798,7 @@ func GetCloudRepoTagSnapshots() (ret []*dejavu.Log, err error) {
 			util.PushErrMsg(Conf.Language(29), 5000)
 			return
 		}
-	case conf.ProviderWebDAV, conf.ProviderS3:
+	case conf.ProviderWebDAV, conf.ProviderS3, conf.ProviderLocal, conf.ProviderSFTP:
 		if !IsPaidUser() {
 			util.PushErrMsg(Conf.Language(214), 5000)
 			return
@@ -834,7 +834,7 @@ func GetCloudRepoSnapshots(page int) (ret []*dejavu.Log, pageCount, totalCount i
 			util.PushErrMsg(Conf.Language(29), 5000)
 			return
 		}
-	case conf.ProviderWebDAV, conf.ProviderS3:
+	case conf.ProviderWebDAV, conf.ProviderS3, conf.ProviderLocal, conf.ProviderSFTP:
 		if !IsPaidUser() {
 			util.PushErrMsg(Conf.Language(214), 5000)
 			return
@@ -1004,7 +1004,7 @@ func syncRepoDownload() (err error) {
 		return
 	}
 
-	repo, err := newRepository()
+	repo, err := newSyncRepository()
 	if nil != err {
 		planSyncAfter(fixSyncInterval)
 
@@ -1031,6 +1031,7 @@ func syncRepoDownload() (err error) {
 	}
 
 	syncContext := map[string]interface{}{eventbus.CtxPushMsg: eventbus.CtxPushMsgToStatusBar}
+	baseIndex := getLatestSyncIndex(repo)
 	mergeResult, trafficStat, err := repo.SyncDownload(syncContext)
 	elapsed := time.Since(start)
 	if nil != err {
@@ -1060,7 +1061,8 @@ func syncRepoDownload() (err error) {
 	autoSyncErrCount = 0
 	BootSyncSucc = 0
 
-	processSyncMergeResult(false, true, mergeResult, trafficStat, "d", elapsed)
+	processSyncMergeResult(false, true, repo, baseIndex, mergeResult, trafficStat, "d", elapsed)
+	syncRepoTargets(false, true, "d")
 	return
 }
 
@@ -1075,7 +1077,7 @@ func syncRepoUpload() (err error) {
 		return
 	}
 
-	repo, err := newRepository()
+	repo, err := newSyncRepository()
 	if nil != err {
 		planSyncAfter(fixSyncInterval)
 
@@ -1131,7 +1133,8 @@ func syncRepoUpload() (err error) {
 	autoSyncErrCount = 0
 	BootSyncSucc = 0
 
-	processSyncMergeResult(false, true, &dejavu.MergeResult{}, trafficStat, "u", elapsed)
+	processSyncMergeResult(false, true, repo, nil, &dejavu.MergeResult{}, trafficStat, "u", elapsed)
+	syncRepoTargets(false, true, "u")
 	return
 }
 
@@ -1149,7 +1152,7 @@ func bootSyncRepo() (err error) {
 		return
 	}
 
-	repo, err := newRepository()
+	repo, err := newSyncRepository()
 	if nil != err {
 		autoSyncErrCount++
 		planSyncAfter(fixSyncInterval)
@@ -1244,6 +1247,13 @@ func bootSyncRepo() (err error) {
 		}()
 	} else {
 		isBootSyncing.Store(false)
+
+		// 工作空间的云端同步目录没有变更时仍然需要同步指定到其他云端同步目录的笔记本
+		go func() {
+			lockSync()
+			defer unlockSync()
+			syncRepoTargets(false, false, "a")
+		}()
 	}
 	return
 }
@@ -1260,7 +1270,7 @@ func syncRepo(exit, byHand bool) (dataChanged bool, err error) {
 		return
 	}
 
-	repo, err := newRepository()
+	repo, err := newSyncRepository()
 	if nil != err {
 		autoSyncErrCount++
 		planSyncAfter(fixSyncInterval)
@@ -1294,6 +1304,7 @@ func syncRepo(exit, byHand bool) (dataChanged bool, err error) {
 	}
 
 	syncContext := map[string]interface{}{eventbus.CtxPushMsg: eventbus.CtxPushMsgToStatusBar}
+	baseIndex := getLatestSyncIndex(repo)
 	mergeResult, trafficStat, err := repo.Sync(syncContext)
 	elapsed := time.Since(start)
 	if nil != err {
@@ -1330,7 +1341,10 @@ func syncRepo(exit, byHand bool) (dataChanged bool, err error) {
 	Conf.Save()
 	autoSyncErrCount = 0
 
-	processSyncMergeResult(exit, byHand, mergeResult, trafficStat, "a", elapsed)
+	processSyncMergeResult(exit, byHand, repo, baseIndex, mergeResult, trafficStat, "a", elapsed)
+	if syncRepoTargets(exit, byHand, "a") {
+		dataChanged = true
+	}
 
 	if !exit {
 		// 首次数据同步执行完成后再执行索引订正 Index fixing should not be performed before data synchronization https://github.com/siyuan-note/siyuan/issues/10761
@@ -1339,7 +1353,7 @@ func syncRepo(exit, byHand bool) (dataChanged bool, err error) {
 	return
 }
 
-func processSyncMergeResult(exit, byHand bool, mergeResult *dejavu.MergeResult, trafficStat *dejavu.TrafficStat, mode string, elapsed time.Duration) {
+func processSyncMergeResult(exit, byHand bool, repo *dejavu.Repo, baseIndex *entity.Index, mergeResult *dejavu.MergeResult, trafficStat *dejavu.TrafficStat, mode string, elapsed time.Duration) {
 	logging.LogInfof("synced data repo [device=%s, kernel=%s, provider=%d, mode=%s/%t, ufc=%d, dfc=%d, ucc=%d, dcc=%d, ub=%s, db=%s] in [%.2fs], merge result [conflicts=%d, upserts=%d, removes=%d]\n\n",
 		Conf.System.ID, KernelID, Conf.Sync.Provider, mode, byHand,
 		trafficStat.UploadFileCount, trafficStat.DownloadFileCount, trafficStat.UploadChunkCount, trafficStat.DownloadChunkCount, humanize.BytesCustomCeil(uint64(trafficStat.UploadBytes), 2), humanize.BytesCustomCeil(uint64(trafficStat.DownloadBytes), 2),
@@ -1349,35 +1363,71 @@ func processSyncMergeResult(exit, byHand bool, mergeResult *dejavu.MergeResult,
 	//logSyncMergeResult(mergeResult)
 
 	var needReloadFiletree bool
+	var mergedConflicts []string
+	var unmergedConflicts int
 	if 0 < len(mergeResult.Conflicts) {
 		luteEngine := util.NewLute()
-		if Conf.Sync.GenerateConflictDoc {
-			// 云端同步发生冲突时生成副本 https://github.com/siyuan-note/siyuan/issues/5687
 
-			for _, file := range mergeResult.Conflicts {
-				if !strings.HasSuffix(file.Path, ".sy") {
-					continue
-				}
+		// 同步冲突的文档使用同步前的同步点作为共同祖先进行块级三方合并
+		baseFiles := map[string]*entity.File{}
+		if nil != baseIndex {
+			files, getFilesErr := repo.GetFiles(baseIndex)
+			if nil != getFilesErr {
+				logging.LogWarnf("get sync merge base files failed: %s", getFilesErr)
+			}
+			for _, file := range files {
+				baseFiles[file.Path] = file
+			}
+		}
+
+		for _, file := range mergeResult.Conflicts {
+			if !strings.HasSuffix(file.Path, ".sy") {
+				continue
+			}
 
-				parts := strings.Split(file.Path[1:], "/")
-				if 2 > len(parts) {
+			parts := strings.Split(file.Path[1:], "/")
+			if 2 > len(parts) {
+				continue
+			}
+			boxID := parts[0]
+
+			absPath := filepath.Join(util.TempDir, "repo", "sync", "conflicts", mergeResult.Time.Format("2006-01-02-150405"), file.Path)
+			conflictTree, mergeErr := mergeSyncConflictDoc(repo, baseFiles[file.Path], boxID, file.Path, absPath, luteEngine)
+			if nil == mergeErr {
+				mergedConflicts = append(mergedConflicts, file.Path)
+				if nil == conflictTree {
 					continue
 				}
-				boxID := parts[0]
 
-				absPath := filepath.Join(util.TempDir, "repo", "sync", "conflicts", mergeResult.Time.Format("2006-01-02-150405"), file.Path)
-				tree, loadTreeErr := loadTree(absPath, luteEngine)
-				if nil != loadTreeErr {
-					logging.LogErrorf("load conflicted file [%s] failed: %s", absPath, loadTreeErr)
-					continue
+				unmergedConflicts++
+				if Conf.Sync.GenerateConflictDoc {
+					// 只包含两方都修改了的块
+					resetTree(conflictTree, "Conflicted")
+					createTreeTx(conflictTree)
+					needReloadFiletree = true
 				}
-				tree.Box = boxID
-				tree.Path = strings.TrimPrefix(file.Path, "/"+boxID)
+				continue
+			}
 
-				resetTree(tree, "Conflicted")
-				createTreeTx(tree)
+			if !errors.Is(mergeErr, errSyncMergeBaseNotFound) {
+				logging.LogWarnf("merge sync conflicted file [%s] failed: %s", file.Path, mergeErr)
+			}
+			unmergedConflicts++
+			if !Conf.Sync.GenerateConflictDoc {
+				continue
+			}
+
+			// 云端同步发生冲突时生成副本 https://github.com/siyuan-note/siyuan/issues/5687
+			tree, loadTreeErr := loadTree(absPath, luteEngine)
+			if nil != loadTreeErr {
+				logging.LogErrorf("load conflicted file [%s] failed: %s", absPath, loadTreeErr)
+				continue
 			}
+			tree.Box = boxID
+			tree.Path = strings.TrimPrefix(file.Path, "/"+boxID)
 
+			resetTree(tree, "Conflicted")
+			createTreeTx(tree)
 			needReloadFiletree = true
 		}
 
@@ -1405,7 +1455,7 @@ func processSyncMergeResult(exit, byHand bool, mergeResult *dejavu.MergeResult,
 	var upserts, removes []string
 	var upsertTrees int
 	// 可能需要重新加载部分功能
-	var needReloadFlashcard, needReloadOcrTexts, needReloadPlugin bool
+	var needReloadFlashcard, needReloadOcrTexts, needReloadPlugin, needReloadReminders bool
 	for _, file := range mergeResult.Upserts {
 		upserts = append(upserts, file.Path)
 		if strings.HasPrefix(file.Path, "/storage/riff/") {
@@ -1424,10 +1474,21 @@ func processSyncMergeResult(exit, byHand bool, mergeResult *dejavu.MergeResult,
 			needReloadPlugin = true
 		}
 
+		if "/storage/reminders.json" == file.Path {
+			needReloadReminders = true
+		}
+
 		if strings.HasSuffix(file.Path, ".sy") {
 			upsertTrees++
 		}
 	}
+	for _, p := range mergedConflicts {
+		// 合并后的文档已经写入工作空间，需要重建索引
+		if !gulu.Str.Contains(p, upserts) {
+			upserts = append(upserts, p)
+			upsertTrees++
+		}
+	}
 
 	clearWidgetsDir := hashset.New()
 	for _, file := range mergeResult.Removes {
@@ -1448,6 +1509,10 @@ func processSyncMergeResult(exit, byHand bool, mergeResult *dejavu.MergeResult,
 			needReloadPlugin = true
 		}
 
+		if "/storage/reminders.json" == file.Path {
+			needReloadReminders = true
+		}
+
 		if strings.HasPrefix(file.Path, "/widgets/") {
 			if parts := strings.Split(file.Path, "/"); 2 < len(parts) {
 				clearWidgetsDir.Add(parts[2])
@@ -1459,6 +1524,8 @@ func processSyncMergeResult(exit, byHand bool, mergeResult *dejavu.MergeResult,
 		LoadFlashcards()
 	}
 
+	syncAttributeViewIndex(upserts, removes)
+
 	if needReloadOcrTexts {
 		util.LoadAssetsTexts()
 	}
@@ -1467,6 +1534,10 @@ func processSyncMergeResult(exit, byHand bool, mergeResult *dejavu.MergeResult,
 		pushReloadPlugin()
 	}
 
+	if needReloadReminders {
+		reloadBlockReminders()
+	}
+
 	for _, widgetDir := range clearWidgetsDir.Values() {
 		widgetDirPath := filepath.Join(util.DataDir, "widgets", widgetDir.(string))
 		gulu.File.RemoveEmptyDirs(widgetDirPath)
@@ -1501,19 +1572,11 @@ func processSyncMergeResult(exit, byHand bool, mergeResult *dejavu.MergeResult,
 		time.Sleep(2 * time.Second)
 		util.PushStatusBar(fmt.Sprintf(Conf.Language(149), elapsed.Seconds()))
 
-		if 0 < len(mergeResult.Conflicts) {
-			syConflict := false
-			for _, file := range mergeResult.Conflicts {
-				if strings.HasSuffix(file.Path, ".sy") {
-					syConflict = true
-					break
-				}
-			}
-
-			if syConflict {
-				// 数据同步发生冲突时在界面上进行提醒 https://github.com/siyuan-note/siyuan/issues/7332
-				util.PushMsg(Conf.Language(108), 7000)
-			}
+		if 0 < unmergedConflicts {
+			// 数据同步发生冲突时在界面上进行提醒 https://github.com/siyuan-note/siyuan/issues/7332
+			util.PushMsg(Conf.Language(108), 7000)
+		} else if 0 < len(mergedConflicts) {
+			util.PushMsg(fmt.Sprintf(Conf.Language(249), len(mergedConflicts)), 7000)
 		}
 	}()
 }
@@ -1615,14 +1678,29 @@ func newRepository() (ret *dejavu.Repo, err error) {
 		return
 	}
 
-	var cloudRepo cloud.Cloud
+	cloudRepo, err := newCloudRepository(cloudConf)
+	if nil != err {
+		return
+	}
+
+	ignoreLines := getSyncIgnoreLines()
+	ignoreLines = append(ignoreLines, "/.siyuan/conf.json") // 忽略旧版同步配置
+	ret, err = dejavu.NewRepo(util.DataDir, util.RepoDir, util.HistoryDir, util.TempDir, Conf.System.ID, Conf.System.Name, Conf.System.OS, Conf.Repo.Key, ignoreLines, cloudRepo)
+	if nil != err {
+		logging.LogErrorf("init data repo failed: %s", err)
+		return
+	}
+	return
+}
+
+func newCloudRepository(cloudConf *cloud.Conf) (ret cloud.Cloud, err error) {
 	switch Conf.Sync.Provider {
 	case conf.ProviderSiYuan:
-		cloudRepo = cloud.NewSiYuan(&cloud.BaseCloud{Conf: cloudConf})
+		ret = cloud.NewSiYuan(&cloud.BaseCloud{Conf: cloudConf})
 	case conf.ProviderS3:
 		s3HTTPClient := &http.Client{Transport: httpclient.NewTransport(cloudConf.S3.SkipTlsVerify)}
 		s3HTTPClient.Timeout = time.Duration(cloudConf.S3.Timeout) * time.Second
-		cloudRepo = cloud.NewS3(&cloud.BaseCloud{Conf: cloudConf}, s3HTTPClient)
+		ret = cloud.NewS3(&cloud.BaseCloud{Conf: cloudConf}, s3HTTPClient)
 	case conf.ProviderWebDAV:
 		webdavClient := gowebdav.NewClient(cloudConf.WebDAV.Endpoint, cloudConf.WebDAV.Username, cloudConf.WebDAV.Password)
 		a := cloudConf.WebDAV.Username + ":" + cloudConf.WebDAV.Password
@@ -1631,24 +1709,22 @@ func newRepository() (ret *dejavu.Repo, err error) {
 		webdavClient.SetHeader("User-Agent", util.UserAgent)
 		webdavClient.SetTimeout(time.Duration(cloudConf.WebDAV.Timeout) * time.Second)
 		webdavClient.SetTransport(httpclient.NewTransport(cloudConf.WebDAV.SkipTlsVerify))
-		cloudRepo = cloud.NewWebDAV(&cloud.BaseCloud{Conf: cloudConf}, webdavClient)
+		ret = cloud.NewWebDAV(&cloud.BaseCloud{Conf: cloudConf}, webdavClient)
+	case conf.ProviderLocal, conf.ProviderSFTP:
+		ret, err = newSyncFSCloud(cloudConf)
 	default:
 		err = fmt.Errorf("unknown cloud provider [%d]", Conf.Sync.Provider)
-		return
-	}
-
-	ignoreLines := getSyncIgnoreLines()
-	ignoreLines = append(ignoreLines, "/.siyuan/conf.json") // 忽略旧版同步配置
-	ret, err = dejavu.NewRepo(util.DataDir, util.RepoDir, util.HistoryDir, util.TempDir, Conf.System.ID, Conf.System.Name, Conf.System.OS, Conf.Repo.Key, ignoreLines, cloudRepo)
-	if nil != err {
-		logging.LogErrorf("init data repo failed: %s", err)
-		return
 	}
 	return
 }
 
 func init() {
 	subscribeRepoEvents()
+
+	task.RegisterResumable(task.RepoCheckout, checkoutRepo)
+	task.RegisterResumable(task.DatabaseIndexFull, fullReindex)
+	task.RegisterResumable(task.DatabaseIndexRef, IndexRefs)
+	task.RegisterResumable(task.OCRImage, autoOCRAssets)
 }
 
 func subscribeRepoEvents() {
@@ -1914,6 +1990,10 @@ func buildCloudConf() (ret *cloud.Conf, err error) {
 			SkipTlsVerify: Conf.Sync.WebDAV.SkipTlsVerify,
 			Timeout:       Conf.Sync.WebDAV.Timeout,
 		}
+	case conf.ProviderLocal:
+		ret.Endpoint = Conf.Sync.Local.Endpoint
+	case conf.ProviderSFTP:
+		ret.Endpoint = Conf.Sync.SFTP.Endpoint
 	default:
 		err = fmt.Errorf("invalid provider [%d]", Conf.Sync.Provider)
 		return
@@ -1981,6 +2061,10 @@ func GetCloudSpace() (s *Sync, b *Backup, hSize, hAssetSize, hTotalSize, hExchan
 		hTrafficDownloadSize = humanize.BytesCustomCeil(uint64(u.UserTrafficDownload), 2)
 		hTrafficAPIGet = humanize.SIWithDigits(u.UserTrafficAPIGet, 2, "")
 		hTrafficAPIPut = humanize.SIWithDigits(u.UserTrafficAPIPut, 2, "")
+	} else if conf.ProviderLocal == Conf.Sync.Provider || conf.ProviderSFTP == Conf.Sync.Provider {
+		// 本地文件夹和 SFTP 统计的是同步目录实际占用的空间，标记快照和同步共用数据对象，所以不单独统计标记快照大小
+		s.HSize = humanize.BytesCustomCeil(uint64(syncSize), 2)
+		hSize = humanize.BytesCustomCeil(uint64(syncSize), 2)
 	}
 	return
 }
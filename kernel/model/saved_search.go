@@ -0,0 +1,293 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/eventbus"
+	"github.com/siyuan-note/logging"
+)
+
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+// 保存的搜索最多跟踪的结果数
+const savedSearchMaxResults = 1024
+
+// 数据库索引提交后至少间隔一段时间再执行，避免连续编辑时频繁执行
+const savedSearchMinInterval = 5 * time.Second
+
+// SavedSearchState 描述了保存的搜索在本机最近一次执行的结果，不参与同步。
+type SavedSearchState struct {
+	Name    string   `json:"name"`
+	Count   int      `json:"count"`   // 结果总数
+	IDs     []string `json:"ids"`     // 结果块 ID，最多 savedSearchMaxResults 个
+	Added   []string `json:"added"`   // 相比上一次执行新增的块 ID
+	Removed []string `json:"removed"` // 相比上一次执行移除的块 ID
+	Updated int64    `json:"updated"` // 最近一次执行时间
+}
+
+// SavedSearch 描述了保存的搜索条件及其结果。
+type SavedSearch struct {
+	*Criterion
+	State *SavedSearchState `json:"state"`
+}
+
+var (
+	savedSearchStates     = map[string]*SavedSearchState{}
+	savedSearchStatesLock = sync.Mutex{}
+	savedSearchLoaded     bool
+	savedSearchCommitted  time.Time // 最近一次数据库索引提交时间
+	savedSearchRunning    = sync.Mutex{}
+)
+
+func init() {
+	eventbus.Subscribe(util.EvtSQLIndexCommitted, func() {
+		savedSearchStatesLock.Lock()
+		savedSearchCommitted = time.Now()
+		savedSearchStatesLock.Unlock()
+	})
+}
+
+func GetSavedSearches() (ret []*SavedSearch) {
+	ret = []*SavedSearch{}
+	loadSavedSearchStates()
+
+	savedSearchStatesLock.Lock()
+	defer savedSearchStatesLock.Unlock()
+	for _, criterion := range GetCriteria() {
+		savedSearch := &SavedSearch{Criterion: criterion}
+		if state := savedSearchStates[criterion.Name]; nil != state {
+			s := *state
+			savedSearch.State = &s
+		}
+		ret = append(ret, savedSearch)
+	}
+	return
+}
+
+// RunSavedSearch 立即执行保存的搜索并返回结果变化。
+func RunSavedSearch(name string) (ret *SavedSearchState, err error) {
+	var criterion *Criterion
+	for _, c := range GetCriteria() {
+		if c.Name == name {
+			criterion = c
+			break
+		}
+	}
+	if nil == criterion {
+		err = ErrSavedSearchNotFound
+		return
+	}
+
+	loadSavedSearchStates()
+	savedSearchRunning.Lock()
+	defer savedSearchRunning.Unlock()
+	ret = runSavedSearch(criterion)
+	saveSavedSearchStates()
+	return
+}
+
+// SavedSearchJob 执行到期的保存的搜索，在结果增加时推送 savedSearchChanged 事件。
+func SavedSearchJob() {
+	if !util.IsBooted() {
+		return
+	}
+
+	var watched []*Criterion
+	for _, criterion := range GetCriteria() {
+		if criterion.Watch {
+			watched = append(watched, criterion)
+		}
+	}
+	if 1 > len(watched) {
+		return
+	}
+
+	loadSavedSearchStates()
+	savedSearchRunning.Lock()
+	defer savedSearchRunning.Unlock()
+
+	now := time.Now()
+	changed := false
+	for _, criterion := range watched {
+		savedSearchStatesLock.Lock()
+		state := savedSearchStates[criterion.Name]
+		committed := savedSearchCommitted
+		savedSearchStatesLock.Unlock()
+
+		due := nil == state
+		if !due {
+			lastRun := time.UnixMilli(state.Updated)
+			due = committed.After(lastRun) && now.Sub(lastRun) >= savedSearchMinInterval
+			if 0 < criterion.Interval && now.Sub(lastRun) >= time.Duration(criterion.Interval)*time.Second {
+				due = true
+			}
+		}
+		if !due {
+			continue
+		}
+
+		first := nil == state
+		result := runSavedSearch(criterion)
+		changed = true
+		if !first && 0 < len(result.Added) {
+			evt := util.NewCmdResult("savedSearchChanged", 0, util.PushModeBroadcast)
+			evt.Data = map[string]interface{}{
+				"name":    result.Name,
+				"count":   result.Count,
+				"added":   result.Added,
+				"removed": result.Removed,
+			}
+			util.PushEvent(evt)
+		}
+	}
+
+	if changed {
+		saveSavedSearchStates()
+	}
+}
+
+func runSavedSearch(criterion *Criterion) (ret *SavedSearchState) {
+	boxes, paths := splitSearchPaths(criterion.IDPath)
+	var types map[string]bool
+	if nil != criterion.Types {
+		if data, err := gulu.JSON.MarshalJSON(criterion.Types); nil == err {
+			gulu.JSON.UnmarshalJSON(data, &types)
+		}
+	}
+
+	blocks, matchedBlockCount, _, _ := FullTextSearchBlock(criterion.K, boxes, paths, types, nil, criterion.Method, criterion.Sort, 0, 1, savedSearchMaxResults)
+	ret = &SavedSearchState{Name: criterion.Name, Count: matchedBlockCount, IDs: []string{}, Added: []string{}, Removed: []string{}, Updated: util.CurrentTimeMillis()}
+	for _, b := range blocks {
+		ret.IDs = append(ret.IDs, b.ID)
+	}
+
+	savedSearchStatesLock.Lock()
+	defer savedSearchStatesLock.Unlock()
+	if previous := savedSearchStates[criterion.Name]; nil != previous {
+		previousIDs := map[string]bool{}
+		for _, id := range previous.IDs {
+			previousIDs[id] = true
+		}
+		currentIDs := map[string]bool{}
+		for _, id := range ret.IDs {
+			currentIDs[id] = true
+			if !previousIDs[id] {
+				ret.Added = append(ret.Added, id)
+			}
+		}
+		for _, id := range previous.IDs {
+			if !currentIDs[id] {
+				ret.Removed = append(ret.Removed, id)
+			}
+		}
+	}
+	savedSearchStates[criterion.Name] = ret
+
+	s := *ret
+	ret = &s
+	return
+}
+
+// splitSearchPaths 将 box/path 形式的路径拆分为笔记本和路径过滤条件。
+func splitSearchPaths(idPaths []string) (boxes, paths []string) {
+	for _, p := range idPaths {
+		box := strings.TrimSpace(strings.Split(p, "/")[0])
+		if "" != box {
+			boxes = append(boxes, box)
+		}
+		if p = strings.TrimSpace(strings.TrimPrefix(p, box)); "" != p {
+			paths = append(paths, p)
+		}
+	}
+	boxes = gulu.Str.RemoveDuplicatedElem(boxes)
+	paths = gulu.Str.RemoveDuplicatedElem(paths)
+	return
+}
+
+func getSavedSearchStatesPath() string {
+	return filepath.Join(util.TempDir, "saved_searches.json")
+}
+
+func loadSavedSearchStates() {
+	savedSearchStatesLock.Lock()
+	defer savedSearchStatesLock.Unlock()
+
+	if savedSearchLoaded {
+		return
+	}
+	savedSearchLoaded = true
+
+	p := getSavedSearchStatesPath()
+	if !gulu.File.IsExist(p) {
+		return
+	}
+
+	data, err := os.ReadFile(p)
+	if nil != err {
+		logging.LogErrorf("read saved search states [%s] failed: %s", p, err)
+		return
+	}
+
+	var states []*SavedSearchState
+	if err = gulu.JSON.UnmarshalJSON(data, &states); nil != err {
+		logging.LogErrorf("unmarshal saved search states [%s] failed: %s", p, err)
+		return
+	}
+	for _, state := range states {
+		savedSearchStates[state.Name] = state
+	}
+}
+
+func saveSavedSearchStates() {
+	// 移除已经删除的搜索条件
+	names := map[string]bool{}
+	for _, criterion := range GetCriteria() {
+		names[criterion.Name] = true
+	}
+
+	savedSearchStatesLock.Lock()
+	defer savedSearchStatesLock.Unlock()
+
+	var states []*SavedSearchState
+	for name, state := range savedSearchStates {
+		if !names[name] {
+			delete(savedSearchStates, name)
+			continue
+		}
+		states = append(states, state)
+	}
+
+	data, err := gulu.JSON.MarshalJSON(states)
+	if nil != err {
+		logging.LogErrorf("marshal saved search states failed: %s", err)
+		return
+	}
+
+	p := getSavedSearchStatesPath()
+	if err = gulu.File.WriteFileSafer(p, data, 0644); nil != err {
+		logging.LogErrorf("write saved search states [%s] failed: %s", p, err)
+	}
+}
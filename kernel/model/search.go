@@ -18,6 +18,7 @@ package model
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"math"
@@ -40,6 +41,7 @@ import (
 	"github.com/88250/vitess-sqlparser/sqlparser"
 	"github.com/jinzhu/copier"
 	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/filesys"
 	"github.com/siyuan-community/siyuan/kernel/search"
 	"github.com/siyuan-community/siyuan/kernel/sql"
 	"github.com/siyuan-community/siyuan/kernel/task"
@@ -222,7 +224,7 @@ func GetEmbedBlock(embedBlockID string, includeIDs []string, headingMode int, br
 
 func getEmbedBlock(embedBlockID string, includeIDs []string, headingMode int, breadcrumb bool) (ret []*EmbedBlock) {
 	stmt := "SELECT * FROM `blocks` WHERE `id` IN ('" + strings.Join(includeIDs, "','") + "')"
-	sqlBlocks := sql.SelectBlocksRawStmtNoParse(stmt, 1024)
+	sqlBlocks := sql.SelectBlocksRawStmtNoParseReadOnly(stmt, 1024)
 
 	// 根据 includeIDs 的顺序排序 Improve `//!js` query embed block result sorting https://github.com/siyuan-note/siyuan/issues/9977
 	m := map[string]int{}
@@ -242,7 +244,7 @@ func SearchEmbedBlock(embedBlockID, stmt string, excludeIDs []string, headingMod
 }
 
 func searchEmbedBlock(embedBlockID, stmt string, excludeIDs []string, headingMode int, breadcrumb bool) (ret []*EmbedBlock) {
-	sqlBlocks := sql.SelectBlocksRawStmtNoParse(stmt, Conf.Search.Limit)
+	sqlBlocks := sql.SelectBlocksRawStmtNoParseReadOnly(stmt, Conf.Search.Limit)
 	ret = buildEmbedBlock(embedBlockID, excludeIDs, headingMode, breadcrumb, sqlBlocks)
 	return
 }
@@ -420,7 +422,171 @@ func prependNotebookNameInHPath(blocks []*Block) {
 	}
 }
 
-func FindReplace(keyword, replacement string, replaceTypes map[string]bool, ids []string, paths, boxes []string, types map[string]bool, method, orderBy, groupBy int) (err error) {
+var ErrFindReplaceNotFound = errors.New("find replace not found")
+
+// ErrFindReplaceMatchChanged 表示预览后内容发生了变化，选中的命中已经不存在。
+var ErrFindReplaceMatchChanged = errors.New("find replace matches changed, please search again")
+
+// 查找替换预览最多返回的命中数
+const findReplacePreviewMaxMatches = 4096
+
+// 查找替换预览中命中前后的上下文长度
+const findReplaceContextLen = 32
+
+// FindReplaceMatch 描述了查找替换的一处命中。
+type FindReplaceMatch struct {
+	ID          string `json:"id"`          // 命中标识，由块 ID、命中序号、命中偏移和命中内容的哈希组成，替换时通过 matchIDs 选择需要替换的命中
+	BlockID     string `json:"blockID"`     // 命中所在的搜索结果块
+	RootID      string `json:"rootID"`      // 命中所在的文档
+	Box         string `json:"box"`         // 命中所在的笔记本
+	Path        string `json:"path"`        // 文档路径
+	HPath       string `json:"hPath"`       // 文档可读路径
+	ReplaceType string `json:"replaceType"` // 命中的元素类型，和 replaceTypes 的键一致
+	Before      string `json:"before"`      // 命中前的上下文
+	Match       string `json:"match"`       // 命中的内容
+	Replacement string `json:"replacement"` // 替换后的内容，正则表达式的捕获组已经展开
+	After       string `json:"after"`       // 命中后的上下文
+}
+
+// FindReplacePreview 返回查找替换的命中，不修改任何数据。
+func FindReplacePreview(keyword, replacement string, replaceTypes map[string]bool, ids []string, paths, boxes []string, types map[string]bool, method, orderBy, groupBy int) (ret []*FindReplaceMatch, matchCount int, err error) {
+	ret = []*FindReplaceMatch{}
+	replacer, err := newFindReplacer(keyword, replacement, method, groupBy, nil)
+	if nil != err || nil == replacer {
+		return
+	}
+
+	replacer.preview = true
+	if _, err = replacer.run(replaceTypes, ids, paths, boxes, types, orderBy, groupBy); nil != err {
+		return
+	}
+	ret = append(ret, replacer.matches...)
+	matchCount = replacer.matchCount
+	return
+}
+
+// FindReplace 查找并替换，matchIDs 不为空时仅替换预览中选中的命中，此时其他参数需要和预览时一致。
+// 预览后内容发生变化导致任意选中的命中不存在时拒绝替换，返回 ErrFindReplaceMatchChanged。
+//
+// 替换涉及的文档会先保存到同一个历史目录下，任意文档写入失败时整体回滚。
+// 返回的 replaceID 为该历史目录名，可以通过 UndoFindReplace 整体撤销这次替换。
+func FindReplace(keyword, replacement string, replaceTypes map[string]bool, ids, matchIDs []string, paths, boxes []string, types map[string]bool, method, orderBy, groupBy int) (replaceID string, err error) {
+	replacer, err := newFindReplacer(keyword, replacement, method, groupBy, matchIDs)
+	if nil != err || nil == replacer {
+		return
+	}
+
+	return replacer.run(replaceTypes, ids, paths, boxes, types, orderBy, groupBy)
+}
+
+// UndoFindReplace 撤销一次查找替换，将替换涉及的文档整体恢复到替换前的内容。
+func UndoFindReplace(replaceID string) (err error) {
+	if "" == replaceID || strings.ContainsAny(replaceID, `/\`) || !strings.HasSuffix(replaceID, "-"+HistoryOpReplace) {
+		err = ErrFindReplaceNotFound
+		return
+	}
+
+	historyDir := filepath.Join(util.HistoryDir, replaceID)
+	if !gulu.File.IsDir(historyDir) {
+		err = ErrFindReplaceNotFound
+		return
+	}
+
+	WaitForWritingFiles()
+	if err = restoreFindReplace(historyDir, true); nil != err {
+		return
+	}
+
+	WaitForWritingFiles()
+	IncSync()
+	go func() {
+		time.Sleep(time.Millisecond * 500)
+		util.ReloadUI()
+	}()
+	return
+}
+
+// restoreFindReplace 使用查找替换前保存的历史文档恢复文档内容，文档标题通过重命名恢复。
+// keepCurrent 为 true 时在恢复前为当前文档生成历史，避免丢失替换后的修改。
+func restoreFindReplace(historyDir string, keepCurrent bool) (err error) {
+	var historyPaths []string
+	err = filepath.Walk(historyDir, func(p string, info os.FileInfo, walkErr error) error {
+		if nil != walkErr {
+			return walkErr
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".sy") {
+			historyPaths = append(historyPaths, p)
+		}
+		return nil
+	})
+	if nil != err {
+		logging.LogErrorf("walk history dir [%s] failed: %s", historyDir, err)
+		return
+	}
+
+	luteEngine := util.NewLute()
+	for _, historyPath := range historyPaths {
+		id := strings.TrimSuffix(filepath.Base(historyPath), ".sy")
+		current, loadErr := LoadTreeByBlockID(id)
+		if nil == current {
+			// 文档已经被删除时跳过，可以通过文档历史恢复
+			logging.LogWarnf("restore replaced doc [%s] failed: %s", id, loadErr)
+			continue
+		}
+
+		if keepCurrent {
+			generateOpTypeHistory(current, HistoryOpUpdate)
+		}
+
+		var data []byte
+		if data, err = os.ReadFile(historyPath); nil != err {
+			logging.LogErrorf("read history [%s] failed: %s", historyPath, err)
+			return
+		}
+
+		var tree *parse.Tree
+		if tree, err = filesys.LoadTreeByData(data, current.Box, current.Path, luteEngine); nil != err {
+			return
+		}
+
+		title := tree.Root.IALAttr("title")
+		currentTitle := current.Root.IALAttr("title")
+		tree.Root.SetIALAttr("title", currentTitle)
+		tree.HPath = current.HPath
+		if err = indexWriteTreeUpsertQueue(tree); nil != err {
+			return
+		}
+
+		if title != currentTitle {
+			if err = RenameDoc(current.Box, current.Path, title); nil != err {
+				return
+			}
+		}
+	}
+	return
+}
+
+// findReplacer 逐个处理查找替换的命中，支持仅预览命中以及仅替换选中的命中。
+type findReplacer struct {
+	method      int // 0：文本，3：正则表达式
+	keyword     string
+	replacement string
+	r           *regexp.Regexp
+	escapedKey  string // 行级代码的内容经过了 HTML 转义，需要使用转义后的关键字匹配
+	escapedR    *regexp.Regexp
+	selected    map[string]bool // 选中的命中，为 nil 时替换所有命中
+	found       map[string]bool // 本次查找中仍然存在的选中命中
+	preview     bool            // 仅收集命中，不修改数据
+	matches     []*FindReplaceMatch
+	matchCount  int
+
+	tree    *parse.Tree
+	block   *ast.Node // 当前处理的搜索结果块
+	seq     int       // 当前块中的命中序号
+	changed bool      // 当前块是否有内容被替换
+}
+
+func newFindReplacer(keyword, replacement string, method, groupBy int, matchIDs []string) (ret *findReplacer, err error) {
 	// method：0：文本，1：查询语法，2：SQL，3：正则表达式
 	if 1 == method || 2 == method {
 		err = errors.New(Conf.Language(132))
@@ -439,66 +605,72 @@ func FindReplace(keyword, replacement string, replaceTypes map[string]bool, ids
 		return
 	}
 
-	r, _ := regexp.Compile(keyword)
-	escapedKey := util.EscapeHTML(keyword)
-	escapedR, _ := regexp.Compile(escapedKey)
-	ids = gulu.Str.RemoveDuplicatedElem(ids)
-	var renameRoots []*ast.Node
-	renameRootTitles := map[string]string{}
-	cachedTrees := map[string]*parse.Tree{}
+	ret = &findReplacer{method: method, keyword: keyword, replacement: replacement, escapedKey: util.EscapeHTML(keyword)}
+	if 3 == method {
+		if ret.r, err = regexp.Compile(keyword); nil != err {
+			ret = nil
+			return
+		}
+		ret.escapedR, _ = regexp.Compile(ret.escapedKey)
+	}
 
-	historyDir, err := getHistoryDir(HistoryOpReplace, time.Now())
-	if nil != err {
-		logging.LogErrorf("get history dir failed: %s", err)
-		return
+	if 0 < len(matchIDs) {
+		ret.selected, ret.found = map[string]bool{}, map[string]bool{}
+		for _, matchID := range matchIDs {
+			ret.selected[matchID] = true
+		}
 	}
+	return
+}
 
+func (replacer *findReplacer) run(replaceTypes map[string]bool, ids []string, paths, boxes []string, types map[string]bool, orderBy, groupBy int) (replaceID string, err error) {
+	ids = gulu.Str.RemoveDuplicatedElem(ids)
 	if 1 > len(ids) {
 		// `Replace All` is no longer affected by pagination https://github.com/siyuan-note/siyuan/issues/8265
-		blocks, _, _, _ := FullTextSearchBlock(keyword, boxes, paths, types, method, orderBy, groupBy, 1, math.MaxInt)
+		blocks, _, _, _ := FullTextSearchBlock(replacer.keyword, boxes, paths, types, nil, replacer.method, orderBy, groupBy, 1, math.MaxInt)
 		for _, block := range blocks {
 			ids = append(ids, block.ID)
 		}
 	}
+	idSet := map[string]bool{}
+	for _, id := range ids {
+		idSet[id] = true
+	}
 
+	cachedTrees := map[string]*parse.Tree{}
+	treeData := map[string][]byte{} // 替换前的文档数据
 	for _, id := range ids {
 		bt := treenode.GetBlockTree(id)
 		if nil == bt {
 			continue
 		}
 
-		tree := cachedTrees[bt.RootID]
-		if nil != tree {
+		if nil != cachedTrees[bt.RootID] {
 			continue
 		}
 
-		tree, _ = LoadTreeByBlockID(id)
+		tree, _ := LoadTreeByBlockID(id)
 		if nil == tree {
 			continue
 		}
 
-		historyPath := filepath.Join(historyDir, tree.Box, tree.Path)
-		if err = os.MkdirAll(filepath.Dir(historyPath), 0755); nil != err {
-			logging.LogErrorf("generate history failed: %s", err)
-			return
-		}
-
-		var data []byte
-		if data, err = filelock.ReadFile(filepath.Join(util.DataDir, tree.Box, tree.Path)); err != nil {
-			logging.LogErrorf("generate history failed: %s", err)
-			return
-		}
-
-		if err = gulu.File.WriteFileSafer(historyPath, data, 0644); err != nil {
-			logging.LogErrorf("generate history failed: %s", err)
-			return
+		if !replacer.preview {
+			var data []byte
+			if data, err = filelock.ReadFile(filepath.Join(util.DataDir, tree.Box, tree.Path)); nil != err {
+				logging.LogErrorf("generate history failed: %s", err)
+				return
+			}
+			treeData[bt.RootID] = data
 		}
-
 		cachedTrees[bt.RootID] = tree
 	}
-	indexHistoryDir(filepath.Base(historyDir), util.NewLute())
 
-	for i, id := range ids {
+	luteEngine := util.NewLute()
+	var renameRoots []*ast.Node
+	renameRootTitles := map[string]string{}
+	var changedRootIDs []string
+	changedRoots := map[string]bool{}
+	for _, id := range ids {
 		bt := treenode.GetBlockTree(id)
 		if nil == bt {
 			continue
@@ -514,234 +686,232 @@ func FindReplace(keyword, replacement string, replaceTypes map[string]bool, ids
 			continue
 		}
 
+		replacer.begin(tree, node)
 		if ast.NodeDocument == node.Type {
 			if !replaceTypes["docTitle"] {
 				continue
 			}
 
 			title := node.IALAttr("title")
-			if 0 == method {
-				if strings.Contains(title, keyword) {
-					docTitleReplacement := strings.ReplaceAll(replacement, "/", "")
-					renameRootTitles[node.ID] = strings.ReplaceAll(title, keyword, docTitleReplacement)
-					renameRoots = append(renameRoots, node)
+			docTitleReplacement := strings.ReplaceAll(replacer.replacement, "/", "")
+			if newTitle := replacer.replaceWith("docTitle", title, replacer.keyword, replacer.r, docTitleReplacement); newTitle != title {
+				renameRootTitles[node.ID] = newTitle
+				renameRoots = append(renameRoots, node)
+			}
+			continue
+		}
+
+		var unlinks []*ast.Node
+		ast.Walk(node, func(n *ast.Node, entering bool) ast.WalkStatus {
+			if !entering {
+				return ast.WalkContinue
+			}
+
+			if n != node && n.IsBlock() && idSet[n.ID] {
+				// 子块也是搜索结果时由子块自己处理，避免重复命中
+				return ast.WalkSkipChildren
+			}
+
+			switch n.Type {
+			case ast.NodeText:
+				if !replaceTypes["text"] {
+					return ast.WalkContinue
 				}
-			} else if 3 == method {
-				if nil != r && r.MatchString(title) {
-					docTitleReplacement := strings.ReplaceAll(replacement, "/", "")
-					renameRootTitles[node.ID] = r.ReplaceAllString(title, docTitleReplacement)
-					renameRoots = append(renameRoots, node)
+
+				if replaceTextNode(n, replacer, luteEngine) {
+					unlinks = append(unlinks, n)
 				}
-			}
-		} else {
-			luteEngine := util.NewLute()
-			var unlinks []*ast.Node
-			ast.Walk(node, func(n *ast.Node, entering bool) ast.WalkStatus {
-				if !entering {
+			case ast.NodeLinkDest:
+				if !replaceTypes["imgSrc"] {
 					return ast.WalkContinue
 				}
 
-				switch n.Type {
-				case ast.NodeText:
-					if !replaceTypes["text"] {
+				replaceNodeTokens(n, "imgSrc", replacer)
+			case ast.NodeLinkText:
+				if !replaceTypes["imgText"] {
+					return ast.WalkContinue
+				}
+
+				replaceNodeTokens(n, "imgText", replacer)
+			case ast.NodeLinkTitle:
+				if !replaceTypes["imgTitle"] {
+					return ast.WalkContinue
+				}
+
+				replaceNodeTokens(n, "imgTitle", replacer)
+			case ast.NodeCodeBlockCode:
+				if !replaceTypes["codeBlock"] {
+					return ast.WalkContinue
+				}
+
+				replaceNodeTokens(n, "codeBlock", replacer)
+			case ast.NodeMathBlockContent:
+				if !replaceTypes["mathBlock"] {
+					return ast.WalkContinue
+				}
+
+				replaceNodeTokens(n, "mathBlock", replacer)
+			case ast.NodeHTMLBlock:
+				if !replaceTypes["htmlBlock"] {
+					return ast.WalkContinue
+				}
+
+				replaceNodeTokens(n, "htmlBlock", replacer)
+			case ast.NodeTextMark:
+				if n.IsTextMarkType("code") {
+					if !replaceTypes["code"] {
 						return ast.WalkContinue
 					}
 
-					if replaceTextNode(n, method, keyword, replacement, r, luteEngine) {
-						unlinks = append(unlinks, n)
+					n.TextMarkTextContent = replacer.replaceWith("code", n.TextMarkTextContent, replacer.escapedKey, replacer.escapedR, replacer.replacement)
+				} else if n.IsTextMarkType("a") {
+					if replaceTypes["aText"] {
+						n.TextMarkTextContent = replacer.replace("aText", n.TextMarkTextContent)
 					}
-				case ast.NodeLinkDest:
-					if !replaceTypes["imgSrc"] {
-						return ast.WalkContinue
+
+					if replaceTypes["aTitle"] {
+						n.TextMarkATitle = replacer.replace("aTitle", n.TextMarkATitle)
 					}
 
-					replaceNodeTokens(n, method, keyword, replacement, r)
-				case ast.NodeLinkText:
-					if !replaceTypes["imgText"] {
+					if replaceTypes["aHref"] {
+						n.TextMarkAHref = replacer.replace("aHref", n.TextMarkAHref)
+					}
+				} else if n.IsTextMarkType("em") {
+					if !replaceTypes["em"] {
 						return ast.WalkContinue
 					}
 
-					replaceNodeTokens(n, method, keyword, replacement, r)
-				case ast.NodeLinkTitle:
-					if !replaceTypes["imgTitle"] {
+					replaceNodeTextMarkTextContent(n, "em", replacer)
+				} else if n.IsTextMarkType("strong") {
+					if !replaceTypes["strong"] {
 						return ast.WalkContinue
 					}
 
-					replaceNodeTokens(n, method, keyword, replacement, r)
-				case ast.NodeCodeBlockCode:
-					if !replaceTypes["codeBlock"] {
+					replaceNodeTextMarkTextContent(n, "strong", replacer)
+				} else if n.IsTextMarkType("kbd") {
+					if !replaceTypes["kbd"] {
 						return ast.WalkContinue
 					}
 
-					replaceNodeTokens(n, method, keyword, replacement, r)
-				case ast.NodeMathBlockContent:
-					if !replaceTypes["mathBlock"] {
+					replaceNodeTextMarkTextContent(n, "kbd", replacer)
+				} else if n.IsTextMarkType("mark") {
+					if !replaceTypes["mark"] {
 						return ast.WalkContinue
 					}
 
-					replaceNodeTokens(n, method, keyword, replacement, r)
-				case ast.NodeHTMLBlock:
-					if !replaceTypes["htmlBlock"] {
+					replaceNodeTextMarkTextContent(n, "mark", replacer)
+				} else if n.IsTextMarkType("s") {
+					if !replaceTypes["s"] {
 						return ast.WalkContinue
 					}
 
-					replaceNodeTokens(n, method, keyword, replacement, r)
-				case ast.NodeTextMark:
-					if n.IsTextMarkType("code") {
-						if !replaceTypes["code"] {
-							return ast.WalkContinue
-						}
-
-						if 0 == method {
-							if strings.Contains(n.TextMarkTextContent, escapedKey) {
-								n.TextMarkTextContent = strings.ReplaceAll(n.TextMarkTextContent, escapedKey, replacement)
-							}
-						} else if 3 == method {
-							if nil != escapedR && escapedR.MatchString(n.TextMarkTextContent) {
-								n.TextMarkTextContent = escapedR.ReplaceAllString(n.TextMarkTextContent, replacement)
-							}
-						}
-					} else if n.IsTextMarkType("a") {
-						if replaceTypes["aText"] {
-							if 0 == method {
-								if strings.Contains(n.TextMarkTextContent, keyword) {
-									n.TextMarkTextContent = strings.ReplaceAll(n.TextMarkTextContent, keyword, replacement)
-								}
-							} else if 3 == method {
-								if nil != r && r.MatchString(n.TextMarkTextContent) {
-									n.TextMarkTextContent = r.ReplaceAllString(n.TextMarkTextContent, replacement)
-								}
-							}
-						}
-
-						if replaceTypes["aTitle"] {
-							if 0 == method {
-								if strings.Contains(n.TextMarkATitle, keyword) {
-									n.TextMarkATitle = strings.ReplaceAll(n.TextMarkATitle, keyword, replacement)
-								}
-							} else if 3 == method {
-								if nil != r && r.MatchString(n.TextMarkATitle) {
-									n.TextMarkATitle = r.ReplaceAllString(n.TextMarkATitle, replacement)
-								}
-							}
-						}
-
-						if replaceTypes["aHref"] {
-							if 0 == method {
-								if strings.Contains(n.TextMarkAHref, keyword) {
-									n.TextMarkAHref = strings.ReplaceAll(n.TextMarkAHref, keyword, replacement)
-								}
-							} else if 3 == method {
-								if nil != r && r.MatchString(n.TextMarkAHref) {
-									n.TextMarkAHref = r.ReplaceAllString(n.TextMarkAHref, replacement)
-								}
-							}
-						}
+					replaceNodeTextMarkTextContent(n, "s", replacer)
+				} else if n.IsTextMarkType("sub") {
+					if !replaceTypes["sub"] {
+						return ast.WalkContinue
+					}
 
-					} else if n.IsTextMarkType("em") {
-						if !replaceTypes["em"] {
-							return ast.WalkContinue
-						}
+					replaceNodeTextMarkTextContent(n, "sub", replacer)
+				} else if n.IsTextMarkType("sup") {
+					if !replaceTypes["sup"] {
+						return ast.WalkContinue
+					}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("strong") {
-						if !replaceTypes["strong"] {
-							return ast.WalkContinue
-						}
+					replaceNodeTextMarkTextContent(n, "sup", replacer)
+				} else if n.IsTextMarkType("tag") {
+					if !replaceTypes["tag"] {
+						return ast.WalkContinue
+					}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("kbd") {
-						if !replaceTypes["kbd"] {
-							return ast.WalkContinue
-						}
+					replaceNodeTextMarkTextContent(n, "tag", replacer)
+				} else if n.IsTextMarkType("u") {
+					if !replaceTypes["u"] {
+						return ast.WalkContinue
+					}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("mark") {
-						if !replaceTypes["mark"] {
-							return ast.WalkContinue
-						}
+					replaceNodeTextMarkTextContent(n, "u", replacer)
+				} else if n.IsTextMarkType("inline-math") {
+					if !replaceTypes["inlineMath"] {
+						return ast.WalkContinue
+					}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("s") {
-						if !replaceTypes["s"] {
-							return ast.WalkContinue
-						}
+					n.TextMarkInlineMathContent = replacer.replace("inlineMath", n.TextMarkInlineMathContent)
+				} else if n.IsTextMarkType("inline-memo") {
+					if !replaceTypes["inlineMemo"] {
+						return ast.WalkContinue
+					}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("sub") {
-						if !replaceTypes["sub"] {
-							return ast.WalkContinue
-						}
+					n.TextMarkInlineMemoContent = replacer.replace("inlineMemo", n.TextMarkInlineMemoContent)
+				} else if n.IsTextMarkType("text") {
+					// Search and replace fails in some cases https://github.com/siyuan-note/siyuan/issues/10016
+					if !replaceTypes["text"] {
+						return ast.WalkContinue
+					}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("sup") {
-						if !replaceTypes["sup"] {
-							return ast.WalkContinue
-						}
+					replaceNodeTextMarkTextContent(n, "text", replacer)
+				}
+			}
+			return ast.WalkContinue
+		})
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("tag") {
-						if !replaceTypes["tag"] {
-							return ast.WalkContinue
-						}
+		for _, unlink := range unlinks {
+			unlink.Unlink()
+		}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("u") {
-						if !replaceTypes["u"] {
-							return ast.WalkContinue
-						}
+		if replacer.changed && !changedRoots[tree.ID] {
+			changedRoots[tree.ID] = true
+			changedRootIDs = append(changedRootIDs, tree.ID)
+		}
+	}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					} else if n.IsTextMarkType("inline-math") {
-						if !replaceTypes["inlineMath"] {
-							return ast.WalkContinue
-						}
+	if nil != replacer.selected && len(replacer.found) < len(replacer.selected) {
+		// 只要有一个选中的命中已经变化就放弃整个替换，此时还没有写入任何文档
+		err = ErrFindReplaceMatchChanged
+		return
+	}
 
-						if 0 == method {
-							if strings.Contains(n.TextMarkInlineMathContent, keyword) {
-								n.TextMarkInlineMathContent = strings.ReplaceAll(n.TextMarkInlineMathContent, keyword, replacement)
-							}
-						} else if 3 == method {
-							if nil != r && r.MatchString(n.TextMarkInlineMathContent) {
-								n.TextMarkInlineMathContent = r.ReplaceAllString(n.TextMarkInlineMathContent, replacement)
-							}
-						}
-					} else if n.IsTextMarkType("inline-memo") {
-						if !replaceTypes["inlineMemo"] {
-							return ast.WalkContinue
-						}
+	if replacer.preview || (1 > len(changedRootIDs) && 1 > len(renameRoots)) {
+		return
+	}
 
-						if 0 == method {
-							if strings.Contains(n.TextMarkInlineMemoContent, keyword) {
-								n.TextMarkInlineMemoContent = strings.ReplaceAll(n.TextMarkInlineMemoContent, keyword, replacement)
-							}
-						} else if 3 == method {
-							if nil != r && r.MatchString(n.TextMarkInlineMemoContent) {
-								n.TextMarkInlineMemoContent = r.ReplaceAllString(n.TextMarkInlineMemoContent, replacement)
-							}
-						}
-					} else if n.IsTextMarkType("text") {
-						// Search and replace fails in some cases https://github.com/siyuan-note/siyuan/issues/10016
-						if !replaceTypes["text"] {
-							return ast.WalkContinue
-						}
+	// 替换前将涉及的文档保存到同一个历史目录下，用于整体撤销
+	historyDir, err := getHistoryDir(HistoryOpReplace, time.Now())
+	if nil != err {
+		logging.LogErrorf("get history dir failed: %s", err)
+		return
+	}
 
-						replaceNodeTextMarkTextContent(n, method, keyword, replacement, r)
-					}
-				}
-				return ast.WalkContinue
-			})
+	historyRootIDs := append([]string{}, changedRootIDs...)
+	for _, renameRoot := range renameRoots {
+		historyRootIDs = append(historyRootIDs, renameRoot.ID)
+	}
+	historyRootIDs = gulu.Str.RemoveDuplicatedElem(historyRootIDs)
+	for _, rootID := range historyRootIDs {
+		tree := cachedTrees[rootID]
+		historyPath := filepath.Join(historyDir, tree.Box, tree.Path)
+		if err = os.MkdirAll(filepath.Dir(historyPath), 0755); nil != err {
+			logging.LogErrorf("generate history failed: %s", err)
+			return
+		}
 
-			for _, unlink := range unlinks {
-				unlink.Unlink()
-			}
+		if err = gulu.File.WriteFileSafer(historyPath, treeData[rootID], 0644); err != nil {
+			logging.LogErrorf("generate history failed: %s", err)
+			return
+		}
+	}
+	indexHistoryDir(filepath.Base(historyDir), luteEngine)
 
-			if err = writeTreeUpsertQueue(tree); nil != err {
-				return
+	for i, rootID := range changedRootIDs {
+		if err = writeTreeUpsertQueue(cachedTrees[rootID]); nil != err {
+			logging.LogErrorf("replace failed, rollback [%s]: %s", filepath.Base(historyDir), err)
+			WaitForWritingFiles()
+			if rollbackErr := restoreFindReplace(historyDir, false); nil != rollbackErr {
+				logging.LogErrorf("rollback replace [%s] failed: %s", filepath.Base(historyDir), rollbackErr)
 			}
+			return
 		}
 
-		util.PushEndlessProgress(fmt.Sprintf(Conf.Language(206), i+1, len(ids)))
+		util.PushEndlessProgress(fmt.Sprintf(Conf.Language(206), i+1, len(changedRootIDs)))
 	}
 
 	for i, renameRoot := range renameRoots {
@@ -752,89 +922,164 @@ func FindReplace(keyword, replacement string, replaceTypes map[string]bool, ids
 	}
 
 	WaitForWritingFiles()
-	if 0 < len(ids) {
-		go func() {
-			time.Sleep(time.Millisecond * 500)
-			util.ReloadUI()
-		}()
-	}
+	replaceID = filepath.Base(historyDir)
+	go func() {
+		time.Sleep(time.Millisecond * 500)
+		util.ReloadUI()
+	}()
 	return
 }
 
-func replaceNodeTextMarkTextContent(n *ast.Node, method int, keyword string, replacement string, r *regexp.Regexp) {
-	if 0 == method {
-		if strings.Contains(n.TextMarkTextContent, keyword) {
-			n.TextMarkTextContent = strings.ReplaceAll(n.TextMarkTextContent, keyword, replacement)
-		}
-	} else if 3 == method {
-		if nil != r && r.MatchString(n.TextMarkTextContent) {
-			n.TextMarkTextContent = r.ReplaceAllString(n.TextMarkTextContent, replacement)
-		}
-	}
+func (replacer *findReplacer) begin(tree *parse.Tree, block *ast.Node) {
+	replacer.tree, replacer.block = tree, block
+	replacer.seq, replacer.changed = 0, false
 }
 
-// replaceTextNode 替换文本节点为其他节点。
-// Supports replacing text elements with other elements https://github.com/siyuan-note/siyuan/issues/11058
-func replaceTextNode(text *ast.Node, method int, keyword string, replacement string, r *regexp.Regexp, luteEngine *lute.Lute) bool {
-	if 0 == method {
-		if bytes.Contains(text.Tokens, []byte(keyword)) {
-			newContent := bytes.ReplaceAll(text.Tokens, []byte(keyword), []byte(replacement))
-			tree := parse.Inline("", newContent, luteEngine.ParseOptions)
-			if nil == tree.Root.FirstChild {
-				return false
-			}
-			parse.NestedInlines2FlattedSpans(tree, false)
+func (replacer *findReplacer) replace(replaceType, s string) string {
+	return replacer.replaceWith(replaceType, s, replacer.keyword, replacer.r, replacer.replacement)
+}
 
-			var replaceNodes []*ast.Node
-			for rNode := tree.Root.FirstChild.FirstChild; nil != rNode; rNode = rNode.Next {
-				replaceNodes = append(replaceNodes, rNode)
-			}
+// replaceWith 替换 s 中选中的命中，预览时仅收集命中。
+func (replacer *findReplacer) replaceWith(replaceType, s, keyword string, r *regexp.Regexp, replacement string) string {
+	var locs [][]int
+	if 0 == replacer.method {
+		if "" == keyword {
+			return s
+		}
 
-			for _, rNode := range replaceNodes {
-				text.InsertBefore(rNode)
+		for start := 0; start < len(s); {
+			i := strings.Index(s[start:], keyword)
+			if 0 > i {
+				break
 			}
-			return true
+			locs = append(locs, []int{start + i, start + i + len(keyword)})
+			start += i + len(keyword)
 		}
-	} else if 3 == method {
-		if nil != r && r.MatchString(string(text.Tokens)) {
-			newContent := bytes.ReplaceAll(text.Tokens, []byte(keyword), []byte(replacement))
-			tree := parse.Inline("", newContent, luteEngine.ParseOptions)
-			if nil == tree.Root.FirstChild {
-				return false
-			}
+	} else if 3 == replacer.method && nil != r {
+		locs = r.FindAllStringSubmatchIndex(s, -1)
+	}
+	if 1 > len(locs) {
+		return s
+	}
 
-			var replaceNodes []*ast.Node
-			for rNode := tree.Root.FirstChild.FirstChild; nil != rNode; rNode = rNode.Next {
-				replaceNodes = append(replaceNodes, rNode)
-			}
+	buf := bytes.Buffer{}
+	last, replaced := 0, false
+	for _, loc := range locs {
+		replacer.seq++
+		matchID := findReplaceMatchID(replacer.block.ID, replacer.seq, loc[0], s[loc[0]:loc[1]])
+		expanded := replacement
+		if 3 == replacer.method {
+			// 展开捕获组 $1、${name}
+			expanded = string(r.ExpandString(nil, replacement, s, loc))
+		}
+
+		if replacer.preview {
+			replacer.addMatch(matchID, replaceType, s, loc[0], loc[1], expanded)
+			continue
+		}
 
-			for _, rNode := range replaceNodes {
-				text.InsertBefore(rNode)
+		if nil != replacer.selected {
+			if !replacer.selected[matchID] {
+				continue
 			}
-			return true
+			replacer.found[matchID] = true
 		}
+
+		buf.WriteString(s[last:loc[0]])
+		buf.WriteString(expanded)
+		last, replaced = loc[1], true
 	}
-	return false
+	if !replaced {
+		return s
+	}
+
+	buf.WriteString(s[last:])
+	replacer.changed = true
+	return buf.String()
 }
 
-func replaceNodeTokens(n *ast.Node, method int, keyword string, replacement string, r *regexp.Regexp) {
-	if 0 == method {
-		if bytes.Contains(n.Tokens, []byte(keyword)) {
-			n.Tokens = bytes.ReplaceAll(n.Tokens, []byte(keyword), []byte(replacement))
-		}
-	} else if 3 == method {
-		if nil != r && r.MatchString(string(n.Tokens)) {
-			n.Tokens = []byte(r.ReplaceAllString(string(n.Tokens), replacement))
-		}
+// findReplaceMatchID 返回命中标识，由块 ID、命中在块中的序号、命中在所在文本中的偏移和命中内容的哈希组成。
+// 预览后块内容发生变化时标识随之变化，替换时据此发现过期的命中。
+func findReplaceMatchID(blockID string, seq, offset int, match string) string {
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(match)))[:7]
+	return blockID + "-" + strconv.Itoa(seq) + "-" + strconv.Itoa(offset) + "-" + hash
+}
+
+func (replacer *findReplacer) addMatch(id, replaceType, s string, start, end int, replacement string) {
+	replacer.matchCount++
+	if findReplacePreviewMaxMatches <= len(replacer.matches) {
+		return
+	}
+
+	before, after := []rune(s[:start]), []rune(s[end:])
+	if findReplaceContextLen < len(before) {
+		before = before[len(before)-findReplaceContextLen:]
+	}
+	if findReplaceContextLen < len(after) {
+		after = after[:findReplaceContextLen]
+	}
+
+	replacer.matches = append(replacer.matches, &FindReplaceMatch{
+		ID:          id,
+		BlockID:     replacer.block.ID,
+		RootID:      replacer.tree.ID,
+		Box:         replacer.tree.Box,
+		Path:        replacer.tree.Path,
+		HPath:       replacer.tree.HPath,
+		ReplaceType: replaceType,
+		Before:      string(before),
+		Match:       s[start:end],
+		Replacement: replacement,
+		After:       string(after),
+	})
+}
+
+func replaceNodeTextMarkTextContent(n *ast.Node, replaceType string, replacer *findReplacer) {
+	n.TextMarkTextContent = replacer.replace(replaceType, n.TextMarkTextContent)
+}
+
+// replaceTextNode 替换文本节点为其他节点。
+// Supports replacing text elements with other elements https://github.com/siyuan-note/siyuan/issues/11058
+func replaceTextNode(text *ast.Node, replacer *findReplacer, luteEngine *lute.Lute) bool {
+	content := string(text.Tokens)
+	newContent := replacer.replace("text", content)
+	if newContent == content {
+		return false
+	}
+
+	tree := parse.Inline("", []byte(newContent), luteEngine.ParseOptions)
+	if nil == tree.Root.FirstChild {
+		return false
+	}
+	parse.NestedInlines2FlattedSpans(tree, false)
+
+	var replaceNodes []*ast.Node
+	for rNode := tree.Root.FirstChild.FirstChild; nil != rNode; rNode = rNode.Next {
+		replaceNodes = append(replaceNodes, rNode)
+	}
+
+	for _, rNode := range replaceNodes {
+		text.InsertBefore(rNode)
+	}
+	return true
+}
+
+func replaceNodeTokens(n *ast.Node, replaceType string, replacer *findReplacer) {
+	content := string(n.Tokens)
+	if newContent := replacer.replace(replaceType, content); newContent != content {
+		n.Tokens = []byte(newContent)
 	}
 }
 
 // FullTextSearchBlock 搜索内容块。
 //
-// method：0：关键字，1：查询语法，2：SQL，3：正则表达式
+// method：0：关键字，1：查询语法，2：SQL，3：正则表达式，4：语义，5：混合（关键字和语义）
+// 开启模糊搜索后关键字搜索会合并模糊匹配的结果并按相关度排序
 // orderBy: 0：按块类型（默认），1：按创建时间升序，2：按创建时间降序，3：按更新时间升序，4：按更新时间降序，5：按内容顺序（仅在按文档分组时），6：按相关度升序，7：按相关度降序
+// 语义和混合搜索总是按相关度排序，orderBy 为 6 时升序，否则降序
 // groupBy：0：不分组，1：按文档分组
-func FullTextSearchBlock(query string, boxes, paths []string, types map[string]bool, method, orderBy, groupBy, page, pageSize int) (ret []*Block, matchedBlockCount, matchedRootCount, pageCount int) {
+// facetFilter 为分面过滤条件，SQL 搜索不支持分面过滤
+func FullTextSearchBlock(query string, boxes, paths []string, types map[string]bool, facetFilter *SearchFacetFilter, method, orderBy, groupBy, page, pageSize int) (ret []*Block, matchedBlockCount, matchedRootCount, pageCount int) {
 	ret = []*Block{}
 	if "" == query {
 		return
@@ -851,21 +1096,35 @@ func FullTextSearchBlock(query string, boxes, paths []string, types map[string]b
 	switch method {
 	case 1: // 查询语法
 		filter := buildTypeFilter(types)
-		boxFilter := buildBoxesFilter(boxes)
+		boxFilter := buildBoxesFilter(boxes) + buildFacetFilter(facetFilter, "")
 		pathFilter := buildPathsFilter(paths)
 		blocks, matchedBlockCount, matchedRootCount = fullTextSearchByQuerySyntax(query, boxFilter, pathFilter, filter, orderByClause, beforeLen, page, pageSize)
 	case 2: // SQL
 		blocks, matchedBlockCount, matchedRootCount = searchBySQL(query, beforeLen, page, pageSize)
 	case 3: // 正则表达式
 		typeFilter := buildTypeFilter(types)
-		boxFilter := buildBoxesFilter(boxes)
+		boxFilter := buildBoxesFilter(boxes) + buildFacetFilter(facetFilter, "")
 		pathFilter := buildPathsFilter(paths)
 		blocks, matchedBlockCount, matchedRootCount = fullTextSearchByRegexp(query, boxFilter, pathFilter, typeFilter, orderByClause, beforeLen, page, pageSize)
+	case 4: // 语义
+		typeFilter := buildTypeFilter(types)
+		boxFilter := buildBoxesFilter(boxes) + buildFacetFilter(facetFilter, "")
+		pathFilter := buildPathsFilter(paths)
+		blocks, matchedBlockCount, matchedRootCount = fullTextSearchBySemantic(query, boxFilter, pathFilter, typeFilter, orderBy, beforeLen, page, pageSize)
+	case 5: // 混合
+		typeFilter := buildTypeFilter(types)
+		boxFilter := buildBoxesFilter(boxes) + buildFacetFilter(facetFilter, "")
+		pathFilter := buildPathsFilter(paths)
+		blocks, matchedBlockCount, matchedRootCount = fullTextSearchByHybrid(query, boxFilter, pathFilter, typeFilter, orderBy, beforeLen, page, pageSize)
 	default: // 关键字
 		filter := buildTypeFilter(types)
-		boxFilter := buildBoxesFilter(boxes)
+		boxFilter := buildBoxesFilter(boxes) + buildFacetFilter(facetFilter, "")
 		pathFilter := buildPathsFilter(paths)
-		blocks, matchedBlockCount, matchedRootCount = fullTextSearchByKeyword(query, boxFilter, pathFilter, filter, orderByClause, beforeLen, page, pageSize)
+		if isFuzzySearch() && !ast.IsNodeIDPattern(query) {
+			blocks, matchedBlockCount, matchedRootCount = fullTextSearchByFuzzy(query, boxFilter, pathFilter, filter, orderBy, beforeLen, page, pageSize)
+		} else {
+			blocks, matchedBlockCount, matchedRootCount = fullTextSearchByKeyword(query, boxFilter, pathFilter, filter, orderByClause, beforeLen, page, pageSize)
+		}
 	}
 	pageCount = (matchedBlockCount + pageSize - 1) / pageSize
 
@@ -1060,7 +1319,7 @@ func buildTypeFilter(types map[string]bool) string {
 func searchBySQL(stmt string, beforeLen, page, pageSize int) (ret []*Block, matchedBlockCount, matchedRootCount int) {
 	stmt = filterQueryInvisibleChars(stmt)
 	stmt = strings.TrimSpace(stmt)
-	blocks := sql.SelectBlocksRawStmt(stmt, page, pageSize)
+	blocks := sql.SelectBlocksRawStmtReadOnly(stmt, page, pageSize)
 	ret = fromSQLBlocks(&blocks, "", beforeLen)
 	if 1 > len(ret) {
 		ret = []*Block{}
@@ -1074,8 +1333,8 @@ func searchBySQL(stmt string, beforeLen, page, pageSize int) (ret []*Block, matc
 		stmt = strings.ReplaceAll(stmt, "select * ", "select COUNT(id) AS `matches`, COUNT(DISTINCT(root_id)) AS `docs` ")
 	}
 	stmt = removeLimitClause(stmt)
-	result, _ := sql.QueryNoLimit(stmt)
-	if 1 > len(ret) {
+	result, _ := sql.QueryNoLimitReadOnly(stmt)
+	if 1 > len(result) {
 		return
 	}
 
@@ -1110,6 +1369,9 @@ func fullTextSearchRefBlock(keyword string, beforeLen int, onlyDoc bool) (ret []
 	}
 
 	quotedKeyword := stringQuery(keyword)
+	if isFuzzySearch() {
+		quotedKeyword = prefixStringQuery(keyword)
+	}
 	table := "blocks_fts" // 大小写敏感
 	if !Conf.Search.CaseSensitive {
 		table = "blocks_fts_case_insensitive"
@@ -1159,6 +1421,9 @@ func fullTextSearchRefBlock(keyword string, beforeLen int, onlyDoc bool) (ret []
 	stmt += orderBy + " LIMIT " + strconv.Itoa(Conf.Search.Limit)
 	blocks := sql.SelectBlocksRawStmtNoParse(stmt, Conf.Search.Limit)
 	ret = fromSQLBlocks(&blocks, "", beforeLen)
+	if isFuzzySearch() {
+		ret = mergeFuzzyRefBlocks(ret, keyword, beforeLen, onlyDoc)
+	}
 	if 1 > len(ret) {
 		ret = []*Block{}
 	}
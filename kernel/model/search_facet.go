@@ -0,0 +1,240 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/88250/lute/ast"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-note/logging"
+)
+
+// 文档和标签分面最多返回的项数
+const searchFacetLimit = 64
+
+// SearchFacetFilter 描述了通过分面缩小搜索范围的条件，同一个分面中的多个值之间为或关系，不同分面之间为与关系。
+type SearchFacetFilter struct {
+	RootIDs  []string `json:"rootIDs"`  // 文档 ID
+	Types    []string `json:"types"`    // 块类型，如 p、h
+	Subtypes []string `json:"subtypes"` // 块子类型，如 h1、o、t
+	Tags     []string `json:"tags"`     // 标签内容，不包含 #
+	Created  []string `json:"created"`  // 创建月份，如 202405
+	Updated  []string `json:"updated"`  // 更新月份，如 202405
+}
+
+type SearchFacet struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// SearchFacets 描述了搜索结果的分面统计。
+//
+// 每个分面的计数都应用了其他分面的过滤条件，但不应用该分面自己的条件，所以选中某个值后仍然可以看到同一个分面中其他值的数量。
+type SearchFacets struct {
+	Boxes    []*SearchFacet `json:"boxes"`
+	Roots    []*SearchFacet `json:"roots"`
+	Types    []*SearchFacet `json:"types"`
+	Subtypes []*SearchFacet `json:"subtypes"`
+	Tags     []*SearchFacet `json:"tags"`
+	Created  []*SearchFacet `json:"created"`
+	Updated  []*SearchFacet `json:"updated"`
+}
+
+// 分面名称，用于构造过滤条件时排除该分面自己的条件
+const (
+	searchFacetBox     = "box"
+	searchFacetRoot    = "root"
+	searchFacetType    = "type"
+	searchFacetSubtype = "subtype"
+	searchFacetTag     = "tag"
+	searchFacetCreated = "created"
+	searchFacetUpdated = "updated"
+)
+
+// GetSearchFacets 统计搜索结果的分面，参数和 FullTextSearchBlock 一致。
+func GetSearchFacets(query string, boxes, paths []string, types map[string]bool, facetFilter *SearchFacetFilter, method int) (ret *SearchFacets) {
+	ret = &SearchFacets{Boxes: []*SearchFacet{}, Roots: []*SearchFacet{}, Types: []*SearchFacet{}, Subtypes: []*SearchFacet{}, Tags: []*SearchFacet{}, Created: []*SearchFacet{}, Updated: []*SearchFacet{}}
+	query = strings.TrimSpace(query)
+	if "" == query {
+		return
+	}
+
+	matched := searchFacetMatchCondition(query, buildPathsFilter(paths), buildTypeFilter(types), method)
+	if "" == matched {
+		return
+	}
+
+	where := func(exclude string) string {
+		ret := matched
+		if searchFacetBox != exclude {
+			ret += buildBoxesFilter(boxes)
+		}
+		return ret + buildFacetFilter(facetFilter, exclude)
+	}
+
+	ret.Boxes = querySearchFacets("box", where(searchFacetBox), 0)
+	var boxIDs []string
+	for _, facet := range ret.Boxes {
+		boxIDs = append(boxIDs, facet.Value)
+	}
+	boxNames := Conf.BoxNames(boxIDs)
+	for _, facet := range ret.Boxes {
+		facet.Label = boxNames[facet.Value]
+	}
+
+	ret.Roots = querySearchFacets("root_id", where(searchFacetRoot), searchFacetLimit)
+	for _, facet := range ret.Roots {
+		if bt := treenode.GetBlockTree(facet.Value); nil != bt {
+			facet.Label = bt.HPath
+		}
+	}
+
+	ret.Types = querySearchFacets("type", where(searchFacetType), 0)
+	ret.Subtypes = querySearchFacets("subtype", where(searchFacetSubtype)+" AND subtype != ''", 0)
+	ret.Created = querySearchFacets("SUBSTR(created, 1, 6)", where(searchFacetCreated), 0)
+	ret.Updated = querySearchFacets("SUBSTR(updated, 1, 6)", where(searchFacetUpdated), 0)
+
+	stmt := "SELECT content AS value, COUNT(DISTINCT block_id) AS count FROM spans WHERE type LIKE '%tag%' AND block_id IN (SELECT id FROM blocks WHERE " + where(searchFacetTag) + ")"
+	stmt += " GROUP BY value ORDER BY count DESC, value LIMIT " + strconv.Itoa(searchFacetLimit)
+	ret.Tags = scanSearchFacets(stmt)
+	return
+}
+
+// searchFacetMatchCondition 返回命中块的 SQL 条件，不包含笔记本和分面过滤条件。
+func searchFacetMatchCondition(query, pathFilter, typeFilter string, method int) string {
+	query = filterQueryInvisibleChars(query)
+	if (0 == method || 1 == method) && ast.IsNodeIDPattern(query) {
+		return "id = '" + query + "'"
+	}
+
+	var scored []*scoredBlock
+	var err error
+	switch method {
+	case 1, 0:
+		if 0 == method && isFuzzySearch() {
+			scored, _ = fuzzyScoredBlocks(query, "", pathFilter, typeFilter)
+			break
+		}
+
+		if 0 == method {
+			query = stringQuery(query)
+		}
+		table := "blocks_fts" // 大小写敏感
+		if !Conf.Search.CaseSensitive {
+			table = "blocks_fts_case_insensitive"
+		}
+		stmt := "SELECT id FROM " + table + " WHERE (`" + table + "` MATCH '" + columnFilter() + ":(" + query + ")'"
+		stmt += ") AND type IN " + typeFilter + pathFilter
+		stmt += ignoreLinesFilter(getSearchIgnoreLines())
+		return "id IN (" + stmt + ")"
+	case 2:
+		// 用户输入的语句嵌入到分面统计语句中，分面统计语句也在只读连接上执行
+		stmt := removeLimitClause(strings.TrimSpace(query))
+		if err = sql.CheckReadOnlyStmt(stmt); nil != err {
+			logging.LogWarnf("search facets failed: %s", err)
+			return ""
+		}
+		return "id IN (SELECT id FROM (" + stmt + "))"
+	case 3:
+		return "id IN (SELECT id FROM blocks WHERE " + fieldRegexp(query) + " AND type IN " + typeFilter + pathFilter + ")"
+	case 4:
+		scored, err = semanticScoredBlocks(query, "", pathFilter, typeFilter)
+	case 5:
+		scored, err = hybridScoredBlocks(query, "", pathFilter, typeFilter)
+	}
+	if nil != err {
+		logging.LogErrorf("search facets failed: %s", err)
+		return ""
+	}
+	if 1 > len(scored) {
+		return ""
+	}
+
+	var ids []string
+	for _, b := range scored {
+		ids = append(ids, b.id)
+	}
+	return "id IN ('" + strings.Join(ids, "','") + "')"
+}
+
+// buildFacetFilter 构造分面过滤条件，exclude 指定的分面不参与过滤。
+func buildFacetFilter(filter *SearchFacetFilter, exclude string) (ret string) {
+	if nil == filter {
+		return
+	}
+
+	var conditions []string
+	if searchFacetRoot != exclude && 0 < len(filter.RootIDs) {
+		conditions = append(conditions, "root_id IN "+facetValues(filter.RootIDs))
+	}
+	if searchFacetType != exclude && 0 < len(filter.Types) {
+		conditions = append(conditions, "type IN "+facetValues(filter.Types))
+	}
+	if searchFacetSubtype != exclude && 0 < len(filter.Subtypes) {
+		conditions = append(conditions, "subtype IN "+facetValues(filter.Subtypes))
+	}
+	if searchFacetCreated != exclude && 0 < len(filter.Created) {
+		conditions = append(conditions, "SUBSTR(created, 1, 6) IN "+facetValues(filter.Created))
+	}
+	if searchFacetUpdated != exclude && 0 < len(filter.Updated) {
+		conditions = append(conditions, "SUBSTR(updated, 1, 6) IN "+facetValues(filter.Updated))
+	}
+	if 0 < len(conditions) {
+		// 使用子查询过滤，这样可以同时作用于块表、全文索引表和三元组索引表
+		ret += " AND id IN (SELECT id FROM blocks WHERE " + strings.Join(conditions, " AND ") + ")"
+	}
+	if searchFacetTag != exclude && 0 < len(filter.Tags) {
+		ret += " AND id IN (SELECT block_id FROM spans WHERE type LIKE '%tag%' AND content IN " + facetValues(filter.Tags) + ")"
+	}
+	return
+}
+
+func facetValues(values []string) string {
+	var escaped []string
+	for _, v := range values {
+		escaped = append(escaped, strings.ReplaceAll(v, "'", "''"))
+	}
+	return "('" + strings.Join(escaped, "','") + "')"
+}
+
+func querySearchFacets(column, where string, limit int) []*SearchFacet {
+	stmt := "SELECT " + column + " AS value, COUNT(id) AS count FROM blocks WHERE " + where + " GROUP BY value ORDER BY count DESC, value"
+	if 0 < limit {
+		stmt += " LIMIT " + strconv.Itoa(limit)
+	}
+	return scanSearchFacets(stmt)
+}
+
+func scanSearchFacets(stmt string) (ret []*SearchFacet) {
+	ret = []*SearchFacet{}
+	rows, err := sql.QueryNoLimitReadOnly(stmt)
+	if nil != err {
+		logging.LogErrorf("query search facets failed: %s", err)
+		return
+	}
+
+	for _, row := range rows {
+		value, _ := row["value"].(string)
+		count, _ := row["count"].(int64)
+		ret = append(ret, &SearchFacet{Value: value, Count: int(count)})
+	}
+	return
+}
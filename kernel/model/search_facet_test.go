@@ -0,0 +1,40 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"testing"
+)
+
+func TestSearchFacetMatchConditionSQL(t *testing.T) {
+	tests := []struct {
+		query   string
+		allowed bool
+	}{
+		{"SELECT * FROM blocks WHERE content LIKE '%foo%' LIMIT 8", true},
+		{"WITH t AS (SELECT id FROM blocks) SELECT * FROM t", true},
+		{"DELETE FROM blocks", false},
+		{"SELECT * FROM blocks; DELETE FROM blocks", false},
+		{"UPDATE blocks SET content = ''", false},
+	}
+	for _, test := range tests {
+		got := searchFacetMatchCondition(test.query, "", "", 2)
+		if test.allowed != ("" != got) {
+			t.Errorf("searchFacetMatchCondition(%q) = %q, allowed %v", test.query, got, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/88250/gulu"
+	"github.com/siyuan-community/siyuan/kernel/search"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-note/logging"
+)
+
+// 模糊搜索的候选块数量上限
+const fuzzySearchCandidates = 512
+
+type fuzzyHit struct {
+	id      string
+	rootID  string
+	score   float64  // (0, 1]，1 表示所有关键字都精确命中标题、命名或者别名
+	matches []string // 命中的原文片段，用于高亮
+}
+
+func isFuzzySearch() bool {
+	return Conf.Search.Fuzzy && sql.IsFuzzySearch()
+}
+
+// fullTextSearchByFuzzy 合并关键字搜索（最后一个关键字按前缀匹配）和模糊搜索的结果，按相关度排序。
+func fullTextSearchByFuzzy(query, boxFilter, pathFilter, typeFilter string, orderBy, beforeLen, page, pageSize int) (ret []*Block, matchedBlockCount, matchedRootCount int) {
+	scored, terms := fuzzyScoredBlocks(query, boxFilter, pathFilter, typeFilter)
+	return pageScoredBlocks(scored, terms, orderBy, beforeLen, page, pageSize)
+}
+
+func fuzzyScoredBlocks(query, boxFilter, pathFilter, typeFilter string) (ret []*scoredBlock, terms string) {
+	query = filterQueryInvisibleChars(query)
+
+	table := "blocks_fts" // 大小写敏感
+	if !Conf.Search.CaseSensitive {
+		table = "blocks_fts_case_insensitive"
+	}
+	stmt := "SELECT id, root_id, rank FROM " + table + " WHERE (`" + table + "` MATCH '" + columnFilter() + ":(" + prefixStringQuery(query) + ")'"
+	stmt += ") AND type IN " + typeFilter
+	stmt += boxFilter + pathFilter
+	ignoreLines := getSearchIgnoreLines()
+	stmt += ignoreLinesFilter(ignoreLines)
+	stmt += " ORDER BY rank LIMIT " + strconv.Itoa(fuzzySearchCandidates)
+	rows, err := sql.QueryNoLimit(stmt)
+	if nil != err {
+		logging.LogErrorf("fuzzy search failed: %s", err)
+	}
+
+	// 关键字命中的分值为 [0.5, 1]，模糊命中的分值为 (0, 1]，同时命中时取较大值
+	candidates := map[string]*scoredBlock{}
+	minRank, maxRank := 0.0, 0.0
+	ranks := map[string]float64{}
+	for i, row := range rows {
+		id, _ := row["id"].(string)
+		rootID, _ := row["root_id"].(string)
+		rank, _ := row["rank"].(float64)
+		ranks[id] = rank
+		candidates[id] = &scoredBlock{id: id, rootID: rootID}
+		if 0 == i || rank < minRank {
+			minRank = rank
+		}
+		if 0 == i || rank > maxRank {
+			maxRank = rank
+		}
+	}
+	for id, b := range candidates {
+		b.score = 1
+		if maxRank > minRank {
+			b.score = 0.5 + 0.5*(maxRank-ranks[id])/(maxRank-minRank)
+		}
+	}
+
+	words := strings.Fields(query)
+	hits := fuzzySearchBlocks(query, " AND type IN "+typeFilter+boxFilter+pathFilter)
+	hits = filterIgnoredFuzzyHits(hits, ignoreLines)
+	for _, hit := range hits {
+		words = append(words, hit.matches...)
+		if b := candidates[hit.id]; nil != b {
+			b.score = max(b.score, hit.score)
+			continue
+		}
+		candidates[hit.id] = &scoredBlock{id: hit.id, rootID: hit.rootID, score: hit.score}
+	}
+
+	for _, b := range candidates {
+		ret = append(ret, b)
+	}
+	words = gulu.Str.RemoveDuplicatedElem(words)
+	terms = strings.Join(words, search.TermSep)
+	return
+}
+
+// fuzzySearchBlocks 通过三元组索引查找候选块，然后按编辑距离校验每个关键字，filter 为附加的 SQL 条件。
+func fuzzySearchBlocks(keyword, filter string) (ret []*fuzzyHit) {
+	words := strings.Fields(strings.ToLower(keyword))
+	if 1 > len(words) {
+		return
+	}
+
+	columns := "{content"
+	if Conf.Search.Name {
+		columns += " name"
+	}
+	if Conf.Search.Alias {
+		columns += " alias"
+	}
+	columns += "}"
+
+	// 三元组分词器只能匹配长度不小于 3 的片段，任意一个三元组命中即作为候选，较短的关键字使用 LIKE 匹配
+	var trigrams, likes []string
+	for _, word := range words {
+		runes := []rune(word)
+		if 3 > len(runes) {
+			w := strings.ReplaceAll(word, "'", "''")
+			w = strings.ReplaceAll(w, "%", "")
+			w = strings.ReplaceAll(w, "_", "")
+			like := "(content LIKE '%" + w + "%'"
+			if Conf.Search.Name {
+				like += " OR name LIKE '%" + w + "%'"
+			}
+			if Conf.Search.Alias {
+				like += " OR alias LIKE '%" + w + "%'"
+			}
+			likes = append(likes, like+")")
+			continue
+		}
+		for i := 0; i+3 <= len(runes); i++ {
+			trigrams = append(trigrams, "\""+strings.ReplaceAll(strings.ReplaceAll(string(runes[i:i+3]), "\"", "\"\""), "'", "''")+"\"")
+		}
+	}
+	trigrams = gulu.Str.RemoveDuplicatedElem(trigrams)
+
+	stmt := "SELECT id, root_id, type, name, alias, content FROM blocks_trigram WHERE 1 = 1"
+	if 0 < len(trigrams) {
+		stmt += " AND blocks_trigram MATCH '" + columns + ":(" + strings.Join(trigrams, " OR ") + ")'"
+	}
+	for _, like := range likes {
+		stmt += " AND " + like
+	}
+	stmt += filter
+	if 0 < len(trigrams) {
+		stmt += " ORDER BY rank"
+	}
+	stmt += " LIMIT " + strconv.Itoa(fuzzySearchCandidates)
+	rows, err := sql.QueryNoLimit(stmt)
+	if nil != err {
+		logging.LogErrorf("fuzzy search failed: %s", err)
+		return
+	}
+
+	for _, row := range rows {
+		id, _ := row["id"].(string)
+		rootID, _ := row["root_id"].(string)
+		typ, _ := row["type"].(string)
+		name, _ := row["name"].(string)
+		alias, _ := row["alias"].(string)
+		content, _ := row["content"].(string)
+
+		// 标题（文档和标题块的内容）、命名和别名命中时权重更高
+		type field struct {
+			text   string
+			weight float64
+		}
+		contentWeight := 0.9
+		if "d" == typ || "h" == typ {
+			contentWeight = 1
+		}
+		fields := []*field{{content, contentWeight}}
+		if Conf.Search.Name {
+			fields = append(fields, &field{name, 1})
+		}
+		if Conf.Search.Alias {
+			fields = append(fields, &field{alias, 1})
+		}
+
+		hit := &fuzzyHit{id: id, rootID: rootID}
+		for _, word := range words {
+			pattern := []rune(word)
+			maxDist := fuzzyMaxDistance(len(pattern))
+			wordScore := 0.0
+			wordMatch := ""
+			for _, f := range fields {
+				if "" == f.text {
+					continue
+				}
+				dist, matched, ok := fuzzyMatch(pattern, []rune(f.text), maxDist)
+				if !ok {
+					continue
+				}
+				score := (1 - float64(dist)/float64(len(pattern)+1)) * f.weight
+				if score > wordScore {
+					wordScore, wordMatch = score, matched
+				}
+			}
+			if 0 == wordScore {
+				hit = nil
+				break
+			}
+			hit.score += wordScore
+			hit.matches = append(hit.matches, wordMatch)
+		}
+		if nil == hit {
+			continue
+		}
+		hit.score /= float64(len(words))
+		ret = append(ret, hit)
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].score > ret[j].score })
+	return
+}
+
+// fuzzyMaxDistance 返回关键字允许的最大编辑距离，较短的关键字需要更严格的匹配，避免命中过多无关内容。
+func fuzzyMaxDistance(length int) int {
+	return min(Conf.Search.FuzzyDistance, (length-1)/3)
+}
+
+// fuzzyMatch 在 text 中查找和 pattern 编辑距离最小的子串（Sellers 算法），忽略大小写，相邻字符交换计为一次编辑。
+func fuzzyMatch(pattern, text []rune, maxDist int) (dist int, matched string, ok bool) {
+	m := len(pattern)
+	if 1 > m {
+		return
+	}
+	lower := []rune(strings.ToLower(string(text)))
+	if len(lower) != len(text) { // 大小写转换后长度变化时无法对应原文位置
+		lower = text
+	}
+
+	// rows[k][i] 为 pattern[:i] 和以当前位置结尾的子串的最小编辑距离，starts[k][i] 记录子串的起始位置，k 为 0、1、2 分别表示前两列、前一列和当前列
+	var rows, starts [3][]int
+	for k := range rows {
+		rows[k], starts[k] = make([]int, m+1), make([]int, m+1)
+	}
+	for i := 0; i <= m; i++ {
+		rows[1][i] = i
+	}
+
+	dist, end, start := m+1, -1, 0
+	for j := 1; j <= len(lower); j++ {
+		prev2, prev, cur := rows[0], rows[1], rows[2]
+		prev2Starts, prevStarts, curStarts := starts[0], starts[1], starts[2]
+		cur[0], curStarts[0] = 0, j
+		for i := 1; i <= m; i++ {
+			cost := 1
+			if pattern[i-1] == lower[j-1] {
+				cost = 0
+			}
+			cur[i], curStarts[i] = prev[i-1]+cost, prevStarts[i-1]
+			if d := prev[i] + 1; d < cur[i] {
+				cur[i], curStarts[i] = d, prevStarts[i]
+			}
+			if d := cur[i-1] + 1; d < cur[i] {
+				cur[i], curStarts[i] = d, curStarts[i-1]
+			}
+			if 1 < i && 1 < j && pattern[i-1] == lower[j-2] && pattern[i-2] == lower[j-1] {
+				if d := prev2[i-2] + 1; d < cur[i] {
+					cur[i], curStarts[i] = d, prev2Starts[i-2]
+				}
+			}
+		}
+		if cur[m] < dist || (cur[m] == dist && curStarts[m] == start && j == end+1) { // 距离相同时尽量延长命中的子串
+			dist, end, start = cur[m], j, curStarts[m]
+		}
+		rows[0], rows[1], rows[2] = prev, cur, prev2
+		starts[0], starts[1], starts[2] = prevStarts, curStarts, prev2Starts
+	}
+
+	if dist > maxDist || 0 > end {
+		return
+	}
+	ok = true
+	matched = string(text[start:end])
+	return
+}
+
+// filterIgnoredFuzzyHits 排除命中搜索忽略规则的块，三元组索引表中没有忽略规则用到的所有字段，所以需要在 blocks 表中检查。
+func filterIgnoredFuzzyHits(hits []*fuzzyHit, ignoreLines []string) (ret []*fuzzyHit) {
+	if 1 > len(ignoreLines) || 1 > len(hits) {
+		return hits
+	}
+
+	var ids []string
+	for _, hit := range hits {
+		ids = append(ids, hit.id)
+	}
+	rows, err := sql.QueryNoLimit("SELECT id FROM blocks WHERE id IN ('" + strings.Join(ids, "','") + "')" + ignoreLinesFilter(ignoreLines))
+	if nil != err {
+		logging.LogErrorf("filter ignored blocks failed: %s", err)
+		return hits
+	}
+
+	kept := map[string]bool{}
+	for _, row := range rows {
+		id, _ := row["id"].(string)
+		kept[id] = true
+	}
+	for _, hit := range hits {
+		if kept[hit.id] {
+			ret = append(ret, hit)
+		}
+	}
+	return
+}
+
+func ignoreLinesFilter(ignoreLines []string) string {
+	buf := bytes.Buffer{}
+	for _, line := range ignoreLines {
+		buf.WriteString(" AND ")
+		buf.WriteString(line)
+	}
+	return buf.String()
+}
+
+// prefixStringQuery 和 stringQuery 相同，但是最后一个关键字按前缀匹配。
+func prefixStringQuery(query string) string {
+	ret := stringQuery(query)
+	if "\"\"" == ret || !strings.HasSuffix(ret, "\"") {
+		return ret
+	}
+	return ret + "*"
+}
+
+// mergeFuzzyRefBlocks 将模糊搜索的结果追加到引用搜索结果后，直到达到搜索结果数量上限。
+func mergeFuzzyRefBlocks(blocks []*Block, keyword string, beforeLen int, onlyDoc bool) (ret []*Block) {
+	ret = blocks
+	if len(ret) >= Conf.Search.Limit {
+		return
+	}
+
+	filter := " AND type IN " + Conf.Search.TypeFilter()
+	if onlyDoc {
+		filter = " AND type = 'd'"
+	}
+	hits := filterIgnoredFuzzyHits(fuzzySearchBlocks(keyword, filter), getRefSearchIgnoreLines())
+
+	exists := map[string]bool{}
+	for _, b := range ret {
+		exists[b.ID] = true
+	}
+	var ids, terms []string
+	for _, hit := range hits {
+		if exists[hit.id] {
+			continue
+		}
+		ids = append(ids, hit.id)
+		terms = append(terms, hit.matches...)
+		if len(ret)+len(ids) >= Conf.Search.Limit {
+			break
+		}
+	}
+	if 1 > len(ids) {
+		return
+	}
+
+	terms = gulu.Str.RemoveDuplicatedElem(terms)
+	for _, sqlBlock := range sql.GetBlocks(ids) {
+		if nil == sqlBlock {
+			continue
+		}
+		ret = append(ret, fromSQLBlock(sqlBlock, strings.Join(terms, search.TermSep), beforeLen))
+	}
+	return
+}
+
+// fuzzySearchRootBlocks 模糊搜索文档标题、命名和别名，排除 excludes 中的文档。
+func fuzzySearchRootBlocks(keyword string, excludes map[string]bool) (ret []*sql.Block) {
+	var ids []string
+	for _, hit := range fuzzySearchBlocks(keyword, " AND type = 'd'") {
+		if excludes[hit.id] {
+			continue
+		}
+		ids = append(ids, hit.id)
+		if len(ids) >= Conf.Search.Limit {
+			break
+		}
+	}
+	for _, b := range sql.GetBlocks(ids) {
+		if nil != b {
+			ret = append(ret, b)
+		}
+	}
+	return
+}
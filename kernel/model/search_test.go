@@ -0,0 +1,75 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+)
+
+func TestFindReplaceMatchIDs(t *testing.T) {
+	const blockID = "20240101000000-aaaaaaa"
+	preview := func(s string) (ret []string) {
+		replacer, err := newFindReplacer("foo", "bar", 0, 0, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		replacer.preview = true
+		replacer.begin(&parse.Tree{ID: blockID}, &ast.Node{ID: blockID})
+		replacer.replace("text", s)
+		for _, match := range replacer.matches {
+			ret = append(ret, match.ID)
+		}
+		return
+	}
+	apply := func(s string, matchIDs []string) (string, bool) {
+		replacer, err := newFindReplacer("foo", "bar", 0, 0, matchIDs)
+		if nil != err {
+			t.Fatal(err)
+		}
+		replacer.begin(&parse.Tree{ID: blockID}, &ast.Node{ID: blockID})
+		ret := replacer.replace("text", s)
+		return ret, len(replacer.found) == len(replacer.selected)
+	}
+
+	ids := preview("foo foo foo")
+	if 3 != len(ids) || ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Fatalf("unexpected match IDs %v", ids)
+	}
+
+	cases := []struct {
+		name     string
+		s        string
+		matchIDs []string
+		expected string
+		found    bool
+	}{
+		{"unchanged", "foo foo foo", ids[1:2], "foo bar foo", true},
+		{"unchanged all", "foo foo foo", ids, "bar bar bar", true},
+		{"text inserted before", "x foo foo foo", ids[1:2], "x foo foo foo", false},
+		{"match removed", "foo foo", ids[2:], "foo foo", false},
+		{"partly changed", "foo fox foo", ids, "bar fox foo", false},
+	}
+	for _, c := range cases {
+		got, found := apply(c.s, c.matchIDs)
+		if got != c.expected || found != c.found {
+			t.Errorf("case [%s]: expected [%s, %v], got [%s, %v]", c.name, c.expected, c.found, got, found)
+		}
+	}
+}
@@ -152,6 +152,12 @@ func GetCaptcha(c *gin.Context) {
 }
 
 func CheckReadonly(c *gin.Context) {
+	if token := getRequestAPIToken(c); nil != token && token.ReadOnly {
+		c.JSON(http.StatusForbidden, map[string]interface{}{"code": -1, "msg": "Access denied [read-only token]"})
+		c.Abort()
+		return
+	}
+
 	if util.ReadOnly {
 		result := util.NewResult()
 		result.Code = -1
@@ -205,6 +211,19 @@ func CheckAuth(c *gin.Context) {
 	//logging.LogInfof("check auth for [%s]", c.Request.RequestURI)
 	localhost := isLocalhost(c)
 
+	// 通过限定权限范围的 API token (header: Authorization)
+	if checkAPIToken(c) {
+		if c.IsAborted() {
+			return
+		}
+
+		if "" != Conf.AccessAuthCode {
+			c.Next()
+			return
+		}
+		// 未设置访问授权码时仍然需要下面的来源检查
+	}
+
 	// 未设置访问授权码
 	if "" == Conf.AccessAuthCode {
 		// Skip the empty access authorization code check https://github.com/siyuan-note/siyuan/issues/9709
@@ -272,18 +291,7 @@ func CheckAuth(c *gin.Context) {
 
 	// 通过 API token (header: Authorization)
 	if authHeader := c.GetHeader("Authorization"); "" != authHeader {
-		var token string
-		if strings.HasPrefix(authHeader, "Token ") {
-			token = strings.TrimPrefix(authHeader, "Token ")
-		} else if strings.HasPrefix(authHeader, "token ") {
-			token = strings.TrimPrefix(authHeader, "token ")
-		} else if strings.HasPrefix(authHeader, "Bearer ") {
-			token = strings.TrimPrefix(authHeader, "Bearer ")
-		} else if strings.HasPrefix(authHeader, "bearer ") {
-			token = strings.TrimPrefix(authHeader, "bearer ")
-		}
-
-		if "" != token {
+		if token := getAuthorizationToken(c); "" != token {
 			if Conf.Api.Token == token {
 				c.Next()
 				return
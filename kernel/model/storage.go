@@ -171,6 +171,8 @@ type Criterion struct {
 	R            string                 `json:"r"`            // 替换关键字
 	Types        *CriterionTypes        `json:"types"`        // 类型过滤选项
 	ReplaceTypes *CriterionReplaceTypes `json:"replaceTypes"` // 替换类型过滤选项
+	Watch        bool                   `json:"watch"`        // 是否在服务端执行并在结果增加时推送通知
+	Interval     int                    `json:"interval"`     // 定时执行间隔，单位：秒，为 0 时仅在数据库索引提交后执行
 }
 
 type CriterionTypes struct {
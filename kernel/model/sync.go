@@ -19,6 +19,7 @@ package model
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -252,7 +253,7 @@ func checkSync(boot, exit, byHand bool) bool {
 		if !IsSubscriber() {
 			return false
 		}
-	case conf.ProviderWebDAV, conf.ProviderS3:
+	case conf.ProviderWebDAV, conf.ProviderS3, conf.ProviderLocal, conf.ProviderSFTP:
 		if !IsPaidUser() {
 			return false
 		}
@@ -448,13 +449,70 @@ func SetSyncProviderWebDAV(webdav *conf.WebDAV) (err error) {
 	return
 }
 
+func SetSyncProviderLocal(local *conf.Local) (err error) {
+	local.Endpoint = strings.TrimSpace(local.Endpoint)
+	if "" != local.Endpoint {
+		// 同步文件夹不能位于工作空间内，否则数据仓库会把同步数据当作工作空间数据处理
+		if !filepath.IsAbs(local.Endpoint) || util.IsSubPath(util.WorkspaceDir, local.Endpoint) || filepath.Clean(util.WorkspaceDir) == filepath.Clean(local.Endpoint) {
+			err = errors.New(Conf.Language(248))
+			return
+		}
+		local.Endpoint = filepath.Clean(local.Endpoint)
+	}
+
+	Conf.Sync.Local = local
+	Conf.Save()
+	return
+}
+
+func SetSyncProviderSFTP(sftp *conf.SFTP) (err error) {
+	sftp.Endpoint = strings.TrimSpace(sftp.Endpoint)
+	sftp.Endpoint = strings.TrimPrefix(sftp.Endpoint, "sftp://")
+	sftp.Endpoint = strings.TrimSuffix(sftp.Endpoint, "/")
+	if "" != sftp.Endpoint {
+		if _, _, splitErr := net.SplitHostPort(sftp.Endpoint); nil != splitErr {
+			sftp.Endpoint = net.JoinHostPort(sftp.Endpoint, "22")
+		}
+	}
+	sftp.Username = strings.TrimSpace(sftp.Username)
+	sftp.PrivateKey = strings.TrimSpace(sftp.PrivateKey)
+	sftp.HostKey = strings.TrimSpace(sftp.HostKey)
+	sftp.Path = strings.TrimSpace(sftp.Path)
+	sftp.Timeout = util.NormalizeTimeout(sftp.Timeout)
+	sftp.HostKey = sftpPinnedHostKey(Conf.Sync.SFTP, sftp)
+
+	Conf.Sync.SFTP = sftp
+	Conf.Save()
+	closeSFTPClient()
+	return
+}
+
+// sftpPinnedHostKey 返回保存 SFTP 配置时固定的主机密钥。
+func sftpPinnedHostKey(old, sftp *conf.SFTP) string {
+	if nil == old {
+		return sftp.HostKey
+	}
+	if old.Endpoint != sftp.Endpoint {
+		if old.HostKey == sftp.HostKey {
+			// 更换服务端后原来固定的主机密钥不再适用，在首次连接新服务端时重新固定
+			return ""
+		}
+		return sftp.HostKey
+	}
+	if "" == sftp.HostKey {
+		// 没有传入主机密钥（比如客户端没有发送该字段）时保留原来固定的主机密钥，否则下次连接时会固定服务端提供的任意密钥
+		return old.HostKey
+	}
+	return sftp.HostKey
+}
+
 var (
 	syncLock  = sync.Mutex{}
 	isSyncing = atomic.Bool{}
 )
 
 func CreateCloudSyncDir(name string) (err error) {
-	if conf.ProviderSiYuan != Conf.Sync.Provider {
+	if !isCloudSyncDirManageable() {
 		err = errors.New(Conf.Language(131))
 		return
 	}
@@ -479,7 +537,7 @@ func CreateCloudSyncDir(name string) (err error) {
 }
 
 func RemoveCloudSyncDir(name string) (err error) {
-	if conf.ProviderSiYuan != Conf.Sync.Provider {
+	if !isCloudSyncDirManageable() {
 		err = errors.New(Conf.Language(131))
 		return
 	}
@@ -542,18 +600,28 @@ func ListCloudSyncDir() (syncDirs []*Sync, hSize string, err error) {
 			Updated:   d.Updated,
 			CloudName: d.Name,
 		}
-		if conf.ProviderSiYuan == Conf.Sync.Provider {
+		if isCloudSyncDirManageable() {
 			sync.HSize = humanize.BytesCustomCeil(uint64(dirSize), 2)
 		}
 		syncDirs = append(syncDirs, sync)
 	}
 	hSize = "-"
-	if conf.ProviderSiYuan == Conf.Sync.Provider {
+	if isCloudSyncDirManageable() {
 		hSize = humanize.BytesCustomCeil(uint64(size), 2)
 	}
 	return
 }
 
+// isCloudSyncDirManageable 判断当前存储服务是否支持管理云端同步目录。
+// S3 和 WebDAV 需要在服务提供商的控制台中管理，本地文件夹和 SFTP 由内核直接管理并能统计目录大小。
+func isCloudSyncDirManageable() bool {
+	switch Conf.Sync.Provider {
+	case conf.ProviderSiYuan, conf.ProviderLocal, conf.ProviderSFTP:
+		return true
+	}
+	return false
+}
+
 func formatRepoErrorMsg(err error) string {
 	msg := html.EscapeString(err.Error())
 	if errors.Is(err, cloud.ErrCloudAuthFailed) {
@@ -638,6 +706,7 @@ func planSyncAfter(d time.Duration) {
 func isProviderOnline(byHand bool) (ret bool) {
 	checkURL := util.GetCloudSyncServer()
 	skipTlsVerify := false
+	checkFS := false
 	switch Conf.Sync.Provider {
 	case conf.ProviderSiYuan:
 	case conf.ProviderS3:
@@ -646,12 +715,19 @@ func isProviderOnline(byHand bool) (ret bool) {
 	case conf.ProviderWebDAV:
 		checkURL = Conf.Sync.WebDAV.Endpoint
 		skipTlsVerify = Conf.Sync.WebDAV.SkipTlsVerify
+	case conf.ProviderLocal, conf.ProviderSFTP:
+		checkFS = true
 	default:
 		logging.LogWarnf("unknown provider: %d", Conf.Sync.Provider)
 		return false
 	}
 
-	if ret = util.IsOnline(checkURL, skipTlsVerify); !ret {
+	if checkFS {
+		ret = isSyncFSOnline()
+	} else {
+		ret = util.IsOnline(checkURL, skipTlsVerify)
+	}
+	if !ret {
 		if 1 > autoSyncErrCount || byHand {
 			util.PushErrMsg(Conf.Language(76)+" (Provider: "+conf.ProviderToStr(Conf.Sync.Provider)+")", 5000)
 		}
@@ -0,0 +1,492 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/88250/go-humanize"
+	"github.com/88250/gulu"
+	"github.com/siyuan-community/siyuan/kernel/av"
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/sql"
+	"github.com/siyuan-community/siyuan/kernel/treenode"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/dejavu"
+	"github.com/siyuan-note/dejavu/cloud"
+	"github.com/siyuan-note/eventbus"
+	"github.com/siyuan-note/logging"
+)
+
+// NormalizeBoxSync 规范化笔记本的数据同步配置。
+func NormalizeBoxSync(boxConf *conf.BoxConf) (err error) {
+	if nil == boxConf.Sync {
+		boxConf.Sync = &conf.BoxSync{}
+	}
+
+	boxSync := boxConf.Sync
+	switch boxSync.Policy {
+	case conf.BoxSyncPolicyDefault, conf.BoxSyncPolicyLocal:
+		boxSync.CloudName = ""
+	case conf.BoxSyncPolicyTarget:
+		boxSync.CloudName = strings.TrimSpace(boxSync.CloudName)
+		if !cloud.IsValidCloudDirName(boxSync.CloudName) {
+			return errors.New(Conf.Language(37))
+		}
+	default:
+		return fmt.Errorf("invalid sync policy [%d]", boxSync.Policy)
+	}
+
+	var ignores []string
+	for _, line := range boxSync.Ignores {
+		line = strings.TrimSpace(line)
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ignores = append(ignores, line)
+	}
+	boxSync.Ignores = gulu.Str.RemoveDuplicatedElem(ignores)
+	return
+}
+
+// BoxSyncInfo 描述了笔记本的数据同步状态。
+type BoxSyncInfo struct {
+	Box       string   `json:"box"`
+	Name      string   `json:"name"`
+	Policy    int      `json:"policy"`
+	CloudName string   `json:"cloudName"` // 实际同步到的云端同步目录名称，仅保存在本地时为空
+	Ignores   []string `json:"ignores"`
+	Synced    int64    `json:"synced"`
+	Stat      string   `json:"stat"`
+}
+
+// GetBoxSyncInfos 返回所有笔记本的数据同步配置和最近一次同步的状态。
+func GetBoxSyncInfos() (ret []*BoxSyncInfo) {
+	ret = []*BoxSyncInfo{}
+	boxes, _ := ListNotebooks()
+	for _, box := range boxes {
+		boxSync := getBoxSync(box)
+		info := &BoxSyncInfo{
+			Box:       box.ID,
+			Name:      box.Name,
+			Policy:    boxSync.Policy,
+			CloudName: boxSyncCloudName(boxSync),
+			Ignores:   boxSync.Ignores,
+		}
+		if nil == info.Ignores {
+			info.Ignores = []string{}
+		}
+
+		switch info.CloudName {
+		case "":
+		case Conf.Sync.CloudName:
+			info.Synced, info.Stat = Conf.Sync.Synced, Conf.Sync.Stat
+		default:
+			if stat, ok := syncTargetStats.Load(info.CloudName); ok {
+				info.Synced, info.Stat = stat.(*syncTargetStat).Synced, stat.(*syncTargetStat).Stat
+			}
+		}
+		ret = append(ret, info)
+	}
+	return
+}
+
+type syncTargetStat struct {
+	Synced int64
+	Stat   string
+}
+
+// syncTargetStats 记录各个指定的云端同步目录最近一次同步的状态，cloudName -> *syncTargetStat
+var syncTargetStats = sync.Map{}
+
+func getBoxSync(box *Box) (ret *conf.BoxSync) {
+	ret = box.GetConf().Sync
+	if nil == ret {
+		ret = &conf.BoxSync{}
+	}
+	return
+}
+
+// boxSyncCloudName 返回笔记本实际同步到的云端同步目录名称，仅保存在本地时返回空。
+func boxSyncCloudName(boxSync *conf.BoxSync) string {
+	switch boxSync.Policy {
+	case conf.BoxSyncPolicyLocal:
+		return ""
+	case conf.BoxSyncPolicyTarget:
+		if cloud.IsValidCloudDirName(boxSync.CloudName) {
+			return boxSync.CloudName
+		}
+	}
+	return Conf.Sync.CloudName
+}
+
+// getBoxSyncs 返回所有笔记本的数据同步配置，boxID -> *conf.BoxSync
+func getBoxSyncs() (ret map[string]*conf.BoxSync) {
+	ret = map[string]*conf.BoxSync{}
+	boxes, _ := ListNotebooks()
+	for _, box := range boxes {
+		ret[box.ID] = getBoxSync(box)
+	}
+	return
+}
+
+// getSyncTargets 返回笔记本指定的工作空间以外的云端同步目录，cloudName -> boxIDs
+func getSyncTargets(boxSyncs map[string]*conf.BoxSync) (ret map[string][]string) {
+	ret = map[string][]string{}
+	for boxID, boxSync := range boxSyncs {
+		if cloudName := boxSyncCloudName(boxSync); "" != cloudName && Conf.Sync.CloudName != cloudName {
+			ret[cloudName] = append(ret[cloudName], boxID)
+		}
+	}
+	for _, boxIDs := range ret {
+		sort.Strings(boxIDs)
+	}
+	return
+}
+
+// getBoxSyncIgnoreLines 返回同步到工作空间的云端同步目录时笔记本的忽略规则。
+func getBoxSyncIgnoreLines(boxSyncs map[string]*conf.BoxSync) (ret []string) {
+	sharedBoxIDs, privateBoxIDs := splitBoxSyncs(boxSyncs)
+	return buildBoxSyncIgnoreLines(boxSyncs, sql.QueryAssetPathsByBoxes(sharedBoxIDs), sql.QueryAssetPathsByBoxes(privateBoxIDs), getAttributeViewDatabaseBoxIDs())
+}
+
+// buildBoxSyncIgnoreLines 返回同步到工作空间的云端同步目录时笔记本的忽略规则。
+//
+// 同步到其他云端同步目录以及仅保存在本地的笔记本只同步笔记本配置，这样其他设备才能知道该笔记本的同步策略。
+// 笔记本切换为仅保存在本地后，下一次同步会从工作空间的云端同步目录中删除该笔记本的其他文件，
+// 其他设备在合并前通过 applyCloudBoxSyncs 使用云端的笔记本配置，不会删除本地的文档，每台设备都保留自己的副本。
+//
+// 只被这些笔记本引用的资源文件（sharedAssets 以外的 privateAssets）以及数据库块只在这些笔记本中的属性视图也不同步。
+func buildBoxSyncIgnoreLines(boxSyncs map[string]*conf.BoxSync, sharedAssets, privateAssets []string, avBoxIDs map[string][]string) (ret []string) {
+	boxIDs := make([]string, 0, len(boxSyncs))
+	for boxID := range boxSyncs {
+		boxIDs = append(boxIDs, boxID)
+	}
+	sort.Strings(boxIDs)
+
+	private := map[string]bool{}
+	for _, boxID := range boxIDs {
+		boxSync := boxSyncs[boxID]
+		if Conf.Sync.CloudName == boxSyncCloudName(boxSync) {
+			ret = append(ret, boxSyncIgnoreLines(boxID, boxSync)...)
+			continue
+		}
+
+		private[boxID] = true
+		ret = append(ret, "/"+boxID+"/**", "!/"+boxID+"/.siyuan/conf.json")
+	}
+
+	shared := map[string]bool{}
+	for _, assetPath := range sharedAssets {
+		shared[assetPath] = true
+	}
+	privateAssets = gulu.Str.RemoveDuplicatedElem(privateAssets)
+	sort.Strings(privateAssets)
+	for _, assetPath := range privateAssets {
+		if !shared[assetPath] {
+			ret = append(ret, "/"+assetPath)
+		}
+	}
+
+	for _, avID := range sortedAttributeViewIDs(avBoxIDs) {
+		onlyPrivate := 0 < len(avBoxIDs[avID])
+		for _, boxID := range avBoxIDs[avID] {
+			if !private[boxID] {
+				onlyPrivate = false
+				break
+			}
+		}
+		if onlyPrivate {
+			ret = append(ret, "/storage/av/"+avID+".json")
+		}
+	}
+	return
+}
+
+// splitBoxSyncs 将笔记本分为同步到工作空间的云端同步目录的笔记本和其他笔记本。
+func splitBoxSyncs(boxSyncs map[string]*conf.BoxSync) (sharedBoxIDs, privateBoxIDs []string) {
+	for boxID, boxSync := range boxSyncs {
+		if Conf.Sync.CloudName == boxSyncCloudName(boxSync) {
+			sharedBoxIDs = append(sharedBoxIDs, boxID)
+		} else {
+			privateBoxIDs = append(privateBoxIDs, boxID)
+		}
+	}
+	sort.Strings(sharedBoxIDs)
+	sort.Strings(privateBoxIDs)
+	return
+}
+
+// getAttributeViewDatabaseBoxIDs 返回属性视图的数据库块所在的笔记本，avID -> boxIDs
+func getAttributeViewDatabaseBoxIDs() (ret map[string][]string) {
+	ret = map[string][]string{}
+	for avID, blockIDs := range av.GetBlockRels() {
+		for _, blockID := range blockIDs {
+			if bt := treenode.GetBlockTree(blockID); nil != bt && !gulu.Str.Contains(bt.BoxID, ret[avID]) {
+				ret[avID] = append(ret[avID], bt.BoxID)
+			}
+		}
+	}
+	return
+}
+
+func sortedAttributeViewIDs(avBoxIDs map[string][]string) (ret []string) {
+	for avID := range avBoxIDs {
+		ret = append(ret, avID)
+	}
+	sort.Strings(ret)
+	return
+}
+
+// getSyncTargetIgnoreLines 返回同步到指定的云端同步目录时的忽略规则，只包含这些笔记本以及它们引用的资源文件和属性视图。
+func getSyncTargetIgnoreLines(boxIDs []string, boxSyncs map[string]*conf.BoxSync) (ret []string) {
+	return buildSyncTargetIgnoreLines(boxIDs, boxSyncs, sql.QueryAssetPathsByBoxes(boxIDs), getAttributeViewDatabaseBoxIDs())
+}
+
+func buildSyncTargetIgnoreLines(boxIDs []string, boxSyncs map[string]*conf.BoxSync, assets []string, avBoxIDs map[string][]string) (ret []string) {
+	ret = append(ret, "/**")
+	for _, boxID := range boxIDs {
+		ret = append(ret, "!/"+boxID+"/**")
+	}
+	for _, assetPath := range assets {
+		ret = append(ret, "!/"+assetPath)
+	}
+	for _, avID := range sortedAttributeViewIDs(avBoxIDs) {
+		for _, boxID := range avBoxIDs[avID] {
+			if gulu.Str.Contains(boxID, boxIDs) {
+				ret = append(ret, "!/storage/av/"+avID+".json")
+				break
+			}
+		}
+	}
+	for _, boxID := range boxIDs {
+		ret = append(ret, boxSyncIgnoreLines(boxID, boxSyncs[boxID])...)
+	}
+
+	// 工作空间的忽略规则中的重新包含规则可能会包含其他笔记本的数据，所以这里只使用忽略规则
+	for _, line := range getSyncIgnoreLines() {
+		if line = strings.TrimSpace(line); "" != line && !strings.HasPrefix(line, "!") && !strings.HasPrefix(line, "#") {
+			ret = append(ret, line)
+		}
+	}
+	return
+}
+
+// boxSyncIgnoreLines 将笔记本内的忽略规则转换为相对于 data 文件夹的规则。
+func boxSyncIgnoreLines(boxID string, boxSync *conf.BoxSync) (ret []string) {
+	for _, line := range boxSync.Ignores {
+		line = strings.TrimSpace(line)
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		negate := strings.HasPrefix(line, "!")
+		line = strings.TrimPrefix(line, "!")
+		if strings.Contains(strings.TrimSuffix(line, "/"), "/") {
+			line = "/" + boxID + "/" + strings.TrimPrefix(line, "/")
+		} else {
+			// 不包含路径分隔符的规则和 .gitignore 一样匹配任意层级
+			line = "/" + boxID + "/**/" + line
+		}
+		if negate {
+			line = "!" + line
+		}
+		ret = append(ret, line)
+	}
+	return
+}
+
+// newSyncRepository 返回用于同步到工作空间的云端同步目录的仓库，忽略规则中加入笔记本的同步配置。
+func newSyncRepository() (ret *dejavu.Repo, err error) {
+	ret, err = newRepository()
+	if nil != err {
+		return
+	}
+
+	cloudConf, err := buildCloudConf()
+	if nil != err {
+		return
+	}
+	cloudConf.RepoPath = ret.Path
+	cloudRepo, err := newCloudRepository(cloudConf)
+	if nil != err {
+		return
+	}
+
+	boxSyncs := getBoxSyncs()
+	if err = applyCloudBoxSyncs(ret, cloudRepo, boxSyncs); nil != err {
+		logging.LogErrorf("apply cloud box sync confs failed: %s", err)
+		return
+	}
+	ret.IgnoreLines = append(ret.IgnoreLines, getBoxSyncIgnoreLines(boxSyncs)...)
+	return
+}
+
+// applyCloudBoxSyncs 在合并前使用云端变更的笔记本配置，其他设备将笔记本切换为不同步到工作空间的云端同步目录后，本地也将其视为私有笔记本。
+// 这样该笔记本的文件在本地索引前就被忽略，云端删除这些文件时不会被合并为本地删除。
+// 只需要读取本地数据仓库中不存在的文件对象，笔记本配置没有变更时本地配置和云端一致。
+func applyCloudBoxSyncs(repo *dejavu.Repo, cloudRepo cloud.Cloud, boxSyncs map[string]*conf.BoxSync) (err error) {
+	cloudLatest, err := downloadSyncPreviewLatest(cloudRepo)
+	if nil != err {
+		return
+	}
+	if "" == cloudLatest.ID {
+		return
+	}
+	if latest, _ := repo.Latest(); nil != latest && latest.ID == cloudLatest.ID {
+		return
+	}
+
+	var fetchIDs []string
+	for _, fileID := range cloudLatest.Files {
+		if !isRepoFileExist(repo, fileID) {
+			fetchIDs = append(fetchIDs, fileID)
+		}
+	}
+	files, err := downloadSyncPreviewFiles(cloudRepo, fetchIDs)
+	if nil != err {
+		return
+	}
+
+	for _, file := range files {
+		// 笔记本配置的路径为 /{boxID}/.siyuan/conf.json
+		parts := strings.Split(file.Path, "/")
+		if 4 != len(parts) || ".siyuan" != parts[2] || "conf.json" != parts[3] {
+			continue
+		}
+		boxID := parts[1]
+		if boxSync := boxSyncs[boxID]; nil == boxSync || Conf.Sync.CloudName != boxSyncCloudName(boxSync) {
+			continue
+		}
+
+		data, openErr := openSyncPreviewFile(repo, cloudRepo, file)
+		if nil != openErr {
+			err = openErr
+			return
+		}
+		boxConf := conf.NewBoxConf()
+		if err = gulu.JSON.UnmarshalJSON(data, boxConf); nil != err {
+			return
+		}
+		if nil != boxConf.Sync && Conf.Sync.CloudName != boxSyncCloudName(boxConf.Sync) {
+			logging.LogInfof("box [%s] is no longer synced to cloud [%s] by other devices, keep its local files", boxID, Conf.Sync.CloudName)
+			boxSyncs[boxID] = boxConf.Sync
+		}
+	}
+	return
+}
+
+// newSyncTargetRepository 返回用于同步到指定的云端同步目录的仓库，每个云端同步目录使用单独的本地仓库。
+func newSyncTargetRepository(cloudName string, boxIDs []string, boxSyncs map[string]*conf.BoxSync) (ret *dejavu.Repo, err error) {
+	cloudConf, err := buildCloudConf()
+	if nil != err {
+		return
+	}
+	cloudConf.Dir = cloudName
+
+	cloudRepo, err := newCloudRepository(cloudConf)
+	if nil != err {
+		return
+	}
+
+	repoPath := filepath.Join(util.RepoDir, "targets", cloudName)
+	ignoreLines := getSyncTargetIgnoreLines(boxIDs, boxSyncs)
+	ret, err = dejavu.NewRepo(util.DataDir, repoPath, util.HistoryDir, util.TempDir, Conf.System.ID, Conf.System.Name, Conf.System.OS, Conf.Repo.Key, ignoreLines, cloudRepo)
+	if nil != err {
+		logging.LogErrorf("init data repo target [%s] failed: %s", cloudName, err)
+		return
+	}
+	return
+}
+
+// syncRepoTargets 同步指定到其他云端同步目录的笔记本，需要在同步工作空间的云端同步目录之后调用。
+// 任意云端同步目录的数据有变更时 dataChanged 为 true。
+func syncRepoTargets(exit, byHand bool, mode string) (dataChanged bool) {
+	boxSyncs := getBoxSyncs()
+	targets := getSyncTargets(boxSyncs)
+	cloudNames := make([]string, 0, len(targets))
+	for cloudName := range targets {
+		cloudNames = append(cloudNames, cloudName)
+	}
+	sort.Strings(cloudNames)
+
+	for _, cloudName := range cloudNames {
+		boxIDs := targets[cloudName]
+		changed, err := syncRepoTarget(exit, byHand, mode, cloudName, boxIDs, boxSyncs)
+		dataChanged = dataChanged || changed
+		if nil != err {
+			msg := fmt.Sprintf(Conf.Language(80), formatRepoErrorMsg(err))
+			syncTargetStats.Store(cloudName, &syncTargetStat{Synced: util.CurrentTimeMillis(), Stat: msg})
+			util.PushStatusBar(msg)
+			if byHand {
+				util.PushErrMsg("["+cloudName+"] "+msg, 0)
+			}
+		}
+	}
+	return
+}
+
+func syncRepoTarget(exit, byHand bool, mode, cloudName string, boxIDs []string, boxSyncs map[string]*conf.BoxSync) (dataChanged bool, err error) {
+	repo, err := newSyncTargetRepository(cloudName, boxIDs, boxSyncs)
+	if nil != err {
+		return
+	}
+
+	logging.LogInfof("syncing data repo target [cloud=%s, boxes=%s, mode=%s/%t]", cloudName, strings.Join(boxIDs, ","), mode, byHand)
+	start := time.Now()
+	beforeIndex, afterIndex, err := indexRepoBeforeCloudSync(repo)
+	if nil != err {
+		logging.LogErrorf("sync data repo target [%s] failed: %s", cloudName, err)
+		return
+	}
+
+	syncContext := map[string]interface{}{eventbus.CtxPushMsg: eventbus.CtxPushMsgToStatusBar}
+	baseIndex := getLatestSyncIndex(repo)
+	mergeResult := &dejavu.MergeResult{}
+	var trafficStat *dejavu.TrafficStat
+	switch mode {
+	case "d":
+		mergeResult, trafficStat, err = repo.SyncDownload(syncContext)
+	case "u":
+		trafficStat, err = repo.SyncUpload(syncContext)
+	default:
+		mergeResult, trafficStat, err = repo.Sync(syncContext)
+	}
+	elapsed := time.Since(start)
+	if nil != err {
+		logging.LogErrorf("sync data repo target [%s] failed: %s", cloudName, err)
+		return
+	}
+
+	dataChanged = nil == beforeIndex || beforeIndex.ID != afterIndex.ID || mergeResult.DataChanged()
+	msg := fmt.Sprintf(Conf.Language(150), trafficStat.UploadFileCount, trafficStat.DownloadFileCount, trafficStat.UploadChunkCount, trafficStat.DownloadChunkCount, humanize.BytesCustomCeil(uint64(trafficStat.UploadBytes), 2), humanize.BytesCustomCeil(uint64(trafficStat.DownloadBytes), 2))
+	syncTargetStats.Store(cloudName, &syncTargetStat{Synced: util.CurrentTimeMillis(), Stat: msg})
+
+	if 1 > len(mergeResult.Upserts) && 1 > len(mergeResult.Removes) && 1 > len(mergeResult.Conflicts) {
+		// 没有数据变更时不需要处理合并结果，避免影响自动同步的间隔
+		logging.LogInfof("synced data repo target [cloud=%s] in [%.2fs] without data changes", cloudName, elapsed.Seconds())
+		return
+	}
+	processSyncMergeResult(exit, byHand, repo, baseIndex, mergeResult, trafficStat, mode, elapsed)
+	return
+}
@@ -0,0 +1,147 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-community/siyuan/kernel/util"
+)
+
+func TestBuildBoxSyncIgnoreLines(t *testing.T) {
+	oldConf := Conf
+	Conf = &AppConf{Sync: conf.NewSync()}
+	Conf.Sync.CloudName = "main"
+	defer func() { Conf = oldConf }()
+
+	boxSyncs := map[string]*conf.BoxSync{
+		"a": {Policy: conf.BoxSyncPolicyDefault, Ignores: []string{"tmp", "/drafts/", "!keep.sy"}},
+		"b": {Policy: conf.BoxSyncPolicyTarget, CloudName: "work"},
+		"c": {Policy: conf.BoxSyncPolicyLocal},
+		"d": {Policy: conf.BoxSyncPolicyTarget, CloudName: "main"},
+	}
+	sharedAssets := []string{"assets/shared.png", "assets/a.png"}
+	privateAssets := []string{"assets/shared.png", "assets/c.png", "assets/b.png", "assets/c.png"}
+	avBoxIDs := map[string][]string{
+		"av1": {"a"},
+		"av2": {"b"},
+		"av3": {"b", "c"},
+		"av4": {"a", "c"},
+		"av5": {},
+	}
+
+	expected := []string{
+		"/a/**/tmp",
+		"/a/drafts/",
+		"!/a/**/keep.sy",
+		"/b/**",
+		"!/b/.siyuan/conf.json",
+		"/c/**",
+		"!/c/.siyuan/conf.json",
+		"/assets/b.png",
+		"/assets/c.png",
+		"/storage/av/av2.json",
+		"/storage/av/av3.json",
+	}
+	got := buildBoxSyncIgnoreLines(boxSyncs, sharedAssets, privateAssets, avBoxIDs)
+	if strings.Join(expected, "\n") != strings.Join(got, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	shared, private := splitBoxSyncs(boxSyncs)
+	if "a,d" != strings.Join(shared, ",") || "b,c" != strings.Join(private, ",") {
+		t.Errorf("unexpected split [%v] [%v]", shared, private)
+	}
+}
+
+func TestBuildSyncTargetIgnoreLines(t *testing.T) {
+	oldConf, dataDir := Conf, util.DataDir
+	Conf = &AppConf{Sync: conf.NewSync()}
+	Conf.Sync.CloudName = "main"
+	util.DataDir = t.TempDir() // 工作空间的忽略规则文件不存在时会被创建
+	defer func() { Conf, util.DataDir = oldConf, dataDir }()
+
+	boxSyncs := map[string]*conf.BoxSync{
+		"b": {Policy: conf.BoxSyncPolicyTarget, CloudName: "work", Ignores: []string{"tmp"}},
+	}
+	avBoxIDs := map[string][]string{
+		"av1": {"a"},
+		"av2": {"a", "b"},
+	}
+
+	expected := []string{
+		"/**",
+		"!/b/**",
+		"!/assets/b.png",
+		"!/storage/av/av2.json",
+		"/b/**/tmp",
+	}
+	got := buildSyncTargetIgnoreLines([]string{"b"}, boxSyncs, []string{"assets/b.png"}, avBoxIDs)
+	if !strings.HasPrefix(strings.Join(got, "\n"), strings.Join(expected, "\n")) {
+		t.Errorf("expected prefix\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// TestApplyCloudBoxSyncs 检查其他设备将笔记本切换为仅保存在本地后，本设备同步时保留该笔记本的文档。
+func TestApplyCloudBoxSyncs(t *testing.T) {
+	oldConf := Conf
+	Conf = &AppConf{Sync: conf.NewSync(), Repo: &conf.Repo{Key: []byte("0123456789abcdef0123456789abcdef")}}
+	Conf.Sync.Provider = conf.ProviderLocal
+	Conf.Sync.CloudName = "main"
+	defer func() { Conf = oldConf }()
+
+	const boxID = "20240101000000-boxxxxx"
+	confPath, docPath := "/"+boxID+"/.siyuan/conf.json", "/"+boxID+"/20240101000001-docxxxx.sy"
+	dir := t.TempDir()
+	a, _ := newTestSyncDevice(t, dir, "a")
+	b, bCloud := newTestSyncDevice(t, dir, "b")
+	writeTestSyncFile(t, a, confPath, `{"sync":{"policy":0}}`)
+	writeTestSyncFile(t, a, docPath, "{}")
+	syncTestRepo(t, a)
+	writeTestSyncFile(t, b, "init.txt", "init") // dejavu 不允许创建空索引
+	syncTestRepo(t, b)
+
+	time.Sleep(1100 * time.Millisecond) // 修改时间只比较到秒
+	writeTestSyncFile(t, a, confPath, `{"sync":{"policy":2}}`)
+	a.IgnoreLines = buildBoxSyncIgnoreLines(map[string]*conf.BoxSync{boxID: {Policy: conf.BoxSyncPolicyLocal}}, nil, nil, nil)
+	syncTestRepo(t, a)
+
+	boxSyncs := map[string]*conf.BoxSync{boxID: {Policy: conf.BoxSyncPolicyDefault}}
+	if err := applyCloudBoxSyncs(b, bCloud, boxSyncs); nil != err {
+		t.Fatal(err)
+	}
+	if conf.BoxSyncPolicyLocal != boxSyncs[boxID].Policy {
+		t.Fatalf("expected cloud policy [%d], got [%d]", conf.BoxSyncPolicyLocal, boxSyncs[boxID].Policy)
+	}
+
+	b.IgnoreLines = buildBoxSyncIgnoreLines(boxSyncs, nil, nil, nil)
+	mergeResult := syncTestRepo(t, b)
+	for _, remove := range mergeResult.Removes {
+		t.Errorf("unexpected remove [%s]", remove.Path)
+	}
+	if _, err := os.Stat(filepath.Join(b.DataPath, docPath)); nil != err {
+		t.Errorf("local doc removed: %s", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(b.DataPath, confPath)); `{"sync":{"policy":2}}` != string(data) {
+		t.Errorf("box conf not synced: %s", data)
+	}
+}
@@ -0,0 +1,776 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/sftp"
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-note/dejavu/cloud"
+	"github.com/siyuan-note/dejavu/entity"
+	"github.com/siyuan-note/logging"
+	"golang.org/x/crypto/ssh"
+)
+
+// 云端快照分页大小，和 dejavu 中 S3/WebDAV 的实现保持一致
+const syncFSIndexPageSize = 32
+
+var syncFSCompressDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(16*1024*1024*1024))
+
+// syncFS 描述了本地文件夹和 SFTP 存储服务的文件操作，参数中的路径都是相对于存储根目录、使用 / 分隔的路径。
+type syncFS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	MkdirAll(name string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+
+	// Walk 遍历 name 下的所有文件，回调参数中的路径是相对于 name 的路径。
+	Walk(name string, fn func(rel string, info os.FileInfo) error) error
+}
+
+// syncFSCloud 描述了基于文件系统的云端存储服务实现，用于本地文件夹和 SFTP。
+// 数据目录结构和 dejavu 中的 WebDAV 实现保持一致：<根目录>/<云端同步目录名>/siyuan/repo/，
+// 这样同一个 NAS 上的数据可以在 WebDAV 和 SFTP 之间直接切换使用。
+type syncFSCloud struct {
+	*cloud.BaseCloud
+	fs syncFS
+
+	dirs sync.Map // 已经创建的目录
+}
+
+func newSyncFSCloud(cloudConf *cloud.Conf) (ret *syncFSCloud, err error) {
+	var fs syncFS
+	switch Conf.Sync.Provider {
+	case conf.ProviderLocal:
+		if "" == Conf.Sync.Local.Endpoint {
+			err = errors.New("local sync folder is not configured")
+			return
+		}
+		fs = &localSyncFS{root: Conf.Sync.Local.Endpoint}
+	case conf.ProviderSFTP:
+		client, getErr := getSFTPClient()
+		if nil != getErr {
+			err = getErr
+			return
+		}
+		fs = &sftpSyncFS{client: client, root: Conf.Sync.SFTP.Path}
+	default:
+		err = fmt.Errorf("invalid provider [%d]", Conf.Sync.Provider)
+		return
+	}
+
+	ret = &syncFSCloud{BaseCloud: &cloud.BaseCloud{Conf: cloudConf}, fs: fs}
+	return
+}
+
+func (c *syncFSCloud) CreateRepo(name string) (err error) {
+	err = c.fs.MkdirAll(path.Join(name, "siyuan", "repo"))
+	return
+}
+
+func (c *syncFSCloud) RemoveRepo(name string) (err error) {
+	if !cloud.IsValidCloudDirName(name) {
+		err = fmt.Errorf("invalid cloud repo name [%s]", name)
+		return
+	}
+
+	err = c.fs.RemoveAll(name)
+	if nil != err {
+		logging.LogErrorf("remove repo [%s] failed: %s", name, err)
+		return
+	}
+	c.dirs.Range(func(key, value any) bool {
+		c.dirs.Delete(key)
+		return true
+	})
+	return
+}
+
+func (c *syncFSCloud) GetRepos() (repos []*cloud.Repo, size int64, err error) {
+	repos = []*cloud.Repo{}
+	infos, err := c.fs.ReadDir("")
+	if nil != err {
+		if isSyncFSNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	for _, info := range infos {
+		if !info.IsDir() || !cloud.IsValidCloudDirName(info.Name()) {
+			continue
+		}
+
+		repo := &cloud.Repo{Name: info.Name(), Updated: info.ModTime().Format("2006-01-02 15:04:05")}
+		if latest, statErr := c.fs.Stat(path.Join(info.Name(), "siyuan", "repo", "refs", "latest")); nil == statErr {
+			repo.Updated = latest.ModTime().Format("2006-01-02 15:04:05")
+		}
+		walkErr := c.fs.Walk(info.Name(), func(rel string, fileInfo os.FileInfo) error {
+			repo.Size += fileInfo.Size()
+			return nil
+		})
+		if nil != walkErr {
+			logging.LogWarnf("stat repo [%s] size failed: %s", info.Name(), walkErr)
+		}
+		size += repo.Size
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	return
+}
+
+func (c *syncFSCloud) UploadObject(filePath string, overwrite bool) (length int64, err error) {
+	data, err := os.ReadFile(filepath.Join(c.Conf.RepoPath, filePath))
+	if nil != err {
+		logging.LogErrorf("read object [%s] failed: %s", filePath, err)
+		return
+	}
+	length = int64(len(data))
+
+	key := c.key(filePath)
+	if err = c.mkdirAll(path.Dir(key)); nil != err {
+		return
+	}
+
+	if err = c.fs.WriteFile(key, data); nil != err {
+		logging.LogErrorf("upload object [%s] failed: %s", key, err)
+		return
+	}
+	logging.LogInfof("uploaded object [%s]", key)
+	return
+}
+
+func (c *syncFSCloud) DownloadObject(filePath string) (data []byte, err error) {
+	key := c.key(filePath)
+	data, err = c.fs.ReadFile(key)
+	if nil != err {
+		if isSyncFSNotExist(err) {
+			err = cloud.ErrCloudObjectNotFound
+		}
+		return
+	}
+	logging.LogInfof("downloaded object [%s]", key)
+	return
+}
+
+func (c *syncFSCloud) RemoveObject(filePath string) (err error) {
+	key := c.key(filePath)
+	if err = c.fs.Remove(key); nil != err {
+		if isSyncFSNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	logging.LogInfof("removed object [%s]", key)
+	return
+}
+
+func (c *syncFSCloud) GetTags() (tags []*cloud.Ref, err error) {
+	tags, err = c.listRefs("tags")
+	if 1 > len(tags) {
+		tags = []*cloud.Ref{}
+	}
+	return
+}
+
+func (c *syncFSCloud) GetIndexes(page int) (ret []*entity.Index, pageCount, totalCount int, err error) {
+	ret = []*entity.Index{}
+	data, err := c.DownloadObject("indexes-v2.json")
+	if nil != err {
+		if errors.Is(err, cloud.ErrCloudObjectNotFound) {
+			err = nil
+		}
+		return
+	}
+
+	data, err = syncFSCompressDecoder.DecodeAll(data, nil)
+	if nil != err {
+		return
+	}
+
+	indexesJSON := &cloud.Indexes{}
+	if err = gulu.JSON.UnmarshalJSON(data, indexesJSON); nil != err {
+		return
+	}
+
+	totalCount = len(indexesJSON.Indexes)
+	pageCount = int(math.Ceil(float64(totalCount) / float64(syncFSIndexPageSize)))
+	start := max((page-1)*syncFSIndexPageSize, 0)
+	end := min(page*syncFSIndexPageSize, totalCount)
+	for i := start; i < end; i++ {
+		index, getErr := c.repoIndex(indexesJSON.Indexes[i].ID)
+		if nil != getErr || nil == index {
+			logging.LogWarnf("get index [%s] failed: %v", indexesJSON.Indexes[i].ID, getErr)
+			continue
+		}
+
+		index.Files = nil
+		ret = append(ret, index)
+	}
+	return
+}
+
+func (c *syncFSCloud) GetRefsFiles() (fileIDs []string, refs []*cloud.Ref, err error) {
+	refs, err = c.listRefs("")
+	if nil != err {
+		return
+	}
+
+	var files []string
+	for _, ref := range refs {
+		index, getErr := c.repoIndex(ref.ID)
+		if nil != getErr {
+			err = getErr
+			return
+		}
+		if nil == index {
+			continue
+		}
+		files = append(files, index.Files...)
+	}
+	fileIDs = gulu.Str.RemoveDuplicatedElem(files)
+	if 1 > len(fileIDs) {
+		fileIDs = []string{}
+	}
+	return
+}
+
+func (c *syncFSCloud) GetChunks(checkChunkIDs []string) (chunkIDs []string, err error) {
+	chunkIDs = []string{}
+	for _, chunkID := range gulu.Str.RemoveDuplicatedElem(checkChunkIDs) {
+		if _, statErr := c.fs.Stat(c.key(path.Join("objects", chunkID[:2], chunkID[2:]))); nil != statErr {
+			if !isSyncFSNotExist(statErr) {
+				err = statErr
+				return
+			}
+			chunkIDs = append(chunkIDs, chunkID)
+		}
+	}
+	return
+}
+
+func (c *syncFSCloud) GetStat() (stat *cloud.Stat, err error) {
+	stat = &cloud.Stat{Sync: &cloud.StatSync{}, Backup: &cloud.StatBackup{}}
+
+	err = c.fs.Walk(c.key(""), func(rel string, info os.FileInfo) error {
+		stat.Sync.Size += info.Size()
+		if strings.HasPrefix(rel, "objects/") {
+			stat.Sync.FileCount++
+		}
+		return nil
+	})
+	if nil != err {
+		if isSyncFSNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	if latest, statErr := c.fs.Stat(c.key("refs/latest")); nil == statErr {
+		stat.Sync.Updated = latest.ModTime().Format("2006-01-02 15:04:05")
+	}
+
+	tags, err := c.GetTags()
+	if nil != err {
+		return
+	}
+	stat.Backup.Count = len(tags)
+	for _, tag := range tags {
+		if tag.Updated > stat.Backup.Updated {
+			stat.Backup.Updated = tag.Updated
+		}
+	}
+
+	if infos, readErr := c.fs.ReadDir(""); nil == readErr {
+		for _, info := range infos {
+			if info.IsDir() && cloud.IsValidCloudDirName(info.Name()) {
+				stat.RepoCount++
+			}
+		}
+	}
+	return
+}
+
+func (c *syncFSCloud) GetIndex(id string) (index *entity.Index, err error) {
+	index, err = c.repoIndex(id)
+	if nil != err {
+		logging.LogErrorf("get index [%s] failed: %s", id, err)
+		return
+	}
+	if nil == index {
+		err = cloud.ErrCloudObjectNotFound
+	}
+	return
+}
+
+func (c *syncFSCloud) ListObjects(pathPrefix string) (ret map[string]*entity.ObjectInfo, err error) {
+	ret = map[string]*entity.ObjectInfo{}
+	err = c.fs.Walk(c.key(pathPrefix), func(rel string, info os.FileInfo) error {
+		ret[rel] = &entity.ObjectInfo{Path: rel, Size: info.Size()}
+		return nil
+	})
+	if nil != err {
+		if isSyncFSNotExist(err) {
+			err = nil
+			return
+		}
+		logging.LogErrorf("list objects failed: %s", err)
+	}
+	return
+}
+
+func (c *syncFSCloud) key(filePath string) string {
+	return path.Join(c.Dir, "siyuan", "repo", filePath)
+}
+
+func (c *syncFSCloud) mkdirAll(dir string) (err error) {
+	if _, ok := c.dirs.Load(dir); ok {
+		return
+	}
+
+	if err = c.fs.MkdirAll(dir); nil != err {
+		logging.LogErrorf("mkdir [%s] failed: %s", dir, err)
+		return
+	}
+	c.dirs.Store(dir, true)
+	return
+}
+
+func (c *syncFSCloud) listRefs(refPrefix string) (ret []*cloud.Ref, err error) {
+	refsDir := c.key(path.Join("refs", refPrefix))
+	infos, err := c.fs.ReadDir(refsDir)
+	if nil != err {
+		if isSyncFSNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+
+		data, readErr := c.fs.ReadFile(path.Join(refsDir, info.Name()))
+		if nil != readErr {
+			err = readErr
+			return
+		}
+		ret = append(ret, &cloud.Ref{
+			Name:    info.Name(),
+			ID:      strings.TrimSpace(string(data)),
+			Updated: info.ModTime().Format("2006-01-02 15:04:05"),
+		})
+	}
+	return
+}
+
+func (c *syncFSCloud) repoIndex(id string) (ret *entity.Index, err error) {
+	data, err := c.fs.ReadFile(c.key(path.Join("indexes", id)))
+	if nil != err {
+		if isSyncFSNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if 1 > len(data) {
+		return
+	}
+
+	data, err = syncFSCompressDecoder.DecodeAll(data, nil)
+	if nil != err {
+		return
+	}
+	ret = &entity.Index{}
+	err = gulu.JSON.UnmarshalJSON(data, ret)
+	return
+}
+
+func isSyncFSNotExist(err error) bool {
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+
+	var statusErr *sftp.StatusError
+	return errors.As(err, &statusErr) && sftp.ErrSSHFxNoSuchFile == statusErr.FxCode()
+}
+
+// isSyncFSOnline 检查本地文件夹是否可以访问（比如网络驱动器是否已经挂载）或者 SFTP 服务是否可以连接。
+func isSyncFSOnline() bool {
+	switch Conf.Sync.Provider {
+	case conf.ProviderLocal:
+		if "" == Conf.Sync.Local.Endpoint {
+			return false
+		}
+
+		// 文件夹不存在时可能是网络驱动器没有挂载，不能创建该文件夹，否则数据会同步到本地磁盘上
+		info, err := os.Stat(Conf.Sync.Local.Endpoint)
+		if nil != err {
+			logging.LogWarnf("stat local sync folder [%s] failed: %s", Conf.Sync.Local.Endpoint, err)
+			return false
+		}
+		return info.IsDir()
+	case conf.ProviderSFTP:
+		client, err := getSFTPClient()
+		if nil != err {
+			logging.LogWarnf("connect sftp [%s] failed: %s", Conf.Sync.SFTP.Endpoint, err)
+			return false
+		}
+		if _, err = client.Getwd(); nil != err {
+			// 连接可能已经失效，重新连接一次
+			closeSFTPClient()
+			if client, err = getSFTPClient(); nil != err {
+				logging.LogWarnf("connect sftp [%s] failed: %s", Conf.Sync.SFTP.Endpoint, err)
+				return false
+			}
+			if _, err = client.Getwd(); nil != err {
+				logging.LogWarnf("check sftp [%s] failed: %s", Conf.Sync.SFTP.Endpoint, err)
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// localSyncFS 描述了本地文件夹存储。
+type localSyncFS struct {
+	root string
+}
+
+func (fs *localSyncFS) abs(name string) string {
+	return filepath.Join(fs.root, filepath.FromSlash(name))
+}
+
+func (fs *localSyncFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(fs.abs(name))
+}
+
+func (fs *localSyncFS) WriteFile(name string, data []byte) (err error) {
+	// 先写临时文件再重命名，避免其他设备（比如通过 Syncthing）读取到写了一半的文件
+	absPath := fs.abs(name)
+	f, err := os.CreateTemp(filepath.Dir(absPath), "."+filepath.Base(absPath)+".*.tmp")
+	if nil != err {
+		return
+	}
+	tmp := f.Name()
+	if _, err = f.Write(data); nil != err {
+		f.Close()
+		os.Remove(tmp)
+		return
+	}
+	if err = f.Close(); nil != err {
+		os.Remove(tmp)
+		return
+	}
+	if err = os.Rename(tmp, absPath); nil != err {
+		os.Remove(tmp)
+	}
+	return
+}
+
+func (fs *localSyncFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(fs.abs(name))
+}
+
+func (fs *localSyncFS) ReadDir(name string) (ret []os.FileInfo, err error) {
+	entries, err := os.ReadDir(fs.abs(name))
+	if nil != err {
+		return
+	}
+
+	for _, entry := range entries {
+		info, infoErr := entry.Info()
+		if nil != infoErr {
+			continue
+		}
+		ret = append(ret, info)
+	}
+	return
+}
+
+func (fs *localSyncFS) MkdirAll(name string) error {
+	return os.MkdirAll(fs.abs(name), 0755)
+}
+
+func (fs *localSyncFS) Remove(name string) error {
+	return os.Remove(fs.abs(name))
+}
+
+func (fs *localSyncFS) RemoveAll(name string) error {
+	return os.RemoveAll(fs.abs(name))
+}
+
+func (fs *localSyncFS) Walk(name string, fn func(rel string, info os.FileInfo) error) error {
+	root := fs.abs(name)
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if nil != err {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), info)
+	})
+}
+
+// sftpSyncFS 描述了 SFTP 存储。
+type sftpSyncFS struct {
+	client *sftp.Client
+	root   string
+}
+
+func (fs *sftpSyncFS) abs(name string) string {
+	if "" == fs.root {
+		if "" == name {
+			return "."
+		}
+		return name
+	}
+	return path.Join(fs.root, name)
+}
+
+func (fs *sftpSyncFS) ReadFile(name string) (ret []byte, err error) {
+	f, err := fs.client.Open(fs.abs(name))
+	if nil != err {
+		return
+	}
+	defer f.Close()
+
+	buf := &bytes.Buffer{}
+	if _, err = f.WriteTo(buf); nil != err {
+		return
+	}
+	ret = buf.Bytes()
+	return
+}
+
+func (fs *sftpSyncFS) WriteFile(name string, data []byte) (err error) {
+	absPath := fs.abs(name)
+	tmp := path.Join(path.Dir(absPath), "."+path.Base(absPath)+"."+gulu.Rand.String(7)+".tmp")
+	f, err := fs.client.Create(tmp)
+	if nil != err {
+		return
+	}
+	if _, err = f.ReadFrom(bytes.NewReader(data)); nil != err {
+		f.Close()
+		fs.client.Remove(tmp)
+		return
+	}
+	if err = f.Close(); nil != err {
+		fs.client.Remove(tmp)
+		return
+	}
+
+	if err = fs.client.PosixRename(tmp, absPath); nil != err {
+		// 服务端不支持 posix-rename 扩展时先删除再重命名
+		if removeErr := fs.client.Remove(absPath); nil != removeErr && !isSyncFSNotExist(removeErr) {
+			fs.client.Remove(tmp)
+			return removeErr
+		}
+		if err = fs.client.Rename(tmp, absPath); nil != err {
+			fs.client.Remove(tmp)
+		}
+	}
+	return
+}
+
+func (fs *sftpSyncFS) Stat(name string) (os.FileInfo, error) {
+	return fs.client.Stat(fs.abs(name))
+}
+
+func (fs *sftpSyncFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return fs.client.ReadDir(fs.abs(name))
+}
+
+func (fs *sftpSyncFS) MkdirAll(name string) error {
+	return fs.client.MkdirAll(fs.abs(name))
+}
+
+func (fs *sftpSyncFS) Remove(name string) error {
+	return fs.client.Remove(fs.abs(name))
+}
+
+func (fs *sftpSyncFS) RemoveAll(name string) error {
+	return fs.client.RemoveAll(fs.abs(name))
+}
+
+func (fs *sftpSyncFS) Walk(name string, fn func(rel string, info os.FileInfo) error) error {
+	root := fs.abs(name)
+	walker := fs.client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); nil != err {
+			return err
+		}
+
+		info := walker.Stat()
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".tmp") {
+			continue
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/")
+		if err := fn(rel, info); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	sftpClient     *sftp.Client
+	sftpSSHClient  *ssh.Client
+	sftpClientConf conf.SFTP // 当前连接使用的配置，配置变更后需要重新连接
+	sftpClientLock = sync.Mutex{}
+)
+
+// getSFTPClient 返回复用的 SFTP 客户端，连接断开或者配置变更后会重新连接。
+func getSFTPClient() (ret *sftp.Client, err error) {
+	sftpClientLock.Lock()
+	defer sftpClientLock.Unlock()
+
+	sftpConf := *Conf.Sync.SFTP
+	if nil != sftpClient && sftpClientConf == sftpConf {
+		ret = sftpClient
+		return
+	}
+	closeSFTPClient0()
+
+	if "" == sftpConf.Endpoint {
+		err = errors.New("sftp endpoint is not configured")
+		return
+	}
+
+	var auths []ssh.AuthMethod
+	if "" != sftpConf.PrivateKey {
+		var signer ssh.Signer
+		if "" != sftpConf.Passphrase {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(sftpConf.PrivateKey), []byte(sftpConf.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(sftpConf.PrivateKey))
+		}
+		if nil != err {
+			err = fmt.Errorf("parse sftp private key failed: %s", err)
+			return
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if "" != sftpConf.Password {
+		password := sftpConf.Password
+		auths = append(auths, ssh.Password(password), ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) (answers []string, err error) {
+			for range questions {
+				answers = append(answers, password)
+			}
+			return
+		}))
+	}
+
+	var pinnedHostKey string
+	sshClient, err := ssh.Dial("tcp", sftpConf.Endpoint, &ssh.ClientConfig{
+		User:            sftpConf.Username,
+		Auth:            auths,
+		HostKeyCallback: sftpHostKeyCallback(sftpConf.HostKey, &pinnedHostKey),
+		Timeout:         time.Duration(sftpConf.Timeout) * time.Second,
+	})
+	if nil != err {
+		return
+	}
+
+	client, err := sftp.NewClient(sshClient)
+	if nil != err {
+		sshClient.Close()
+		return
+	}
+
+	if "" != pinnedHostKey {
+		// 首次连接时固定服务端主机密钥，保存到配置中
+		sftpConf.HostKey = pinnedHostKey
+		if current := Conf.Sync.SFTP; nil != current && current.Endpoint == sftpConf.Endpoint && "" == current.HostKey {
+			current.HostKey = pinnedHostKey
+			Conf.Save()
+		}
+		logging.LogInfof("pinned sftp [%s] host key [%s]", sftpConf.Endpoint, pinnedHostKey)
+	}
+
+	sftpClient, sftpSSHClient, sftpClientConf = client, sshClient, sftpConf
+	go func() {
+		// 连接断开后清理客户端，下次使用时重新连接
+		sshClient.Wait()
+		sftpClientLock.Lock()
+		defer sftpClientLock.Unlock()
+		if sftpSSHClient == sshClient {
+			sftpClient, sftpSSHClient = nil, nil
+		}
+	}()
+	ret = client
+	logging.LogInfof("connected sftp [%s]", sftpConf.Endpoint)
+	return
+}
+
+// sftpHostKeyCallback 返回校验服务端主机密钥的回调，hostKey 为空时接受首次连接的主机密钥并通过 pinned 返回其指纹，
+// 否则主机密钥指纹和 hostKey 不一致时拒绝连接。
+func sftpHostKeyCallback(hostKey string, pinned *string) ssh.HostKeyCallback {
+	expected := strings.TrimPrefix(hostKey, "SHA256:")
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+		if "" == expected {
+			*pinned = fingerprint
+			return nil
+		}
+		if strings.TrimPrefix(fingerprint, "SHA256:") != expected {
+			return fmt.Errorf("sftp host key mismatch [%s]", fingerprint)
+		}
+		return nil
+	}
+}
+
+func closeSFTPClient() {
+	sftpClientLock.Lock()
+	defer sftpClientLock.Unlock()
+	closeSFTPClient0()
+}
+
+func closeSFTPClient0() {
+	if nil != sftpClient {
+		sftpClient.Close()
+	}
+	if nil != sftpSSHClient {
+		sftpSSHClient.Close()
+	}
+	sftpClient, sftpSSHClient = nil, nil
+}
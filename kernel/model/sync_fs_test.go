@@ -0,0 +1,87 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSFTPHostKeyCallback(t *testing.T) {
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if nil != err {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return key
+	}
+	key, otherKey := newKey(), newKey()
+	fingerprint := ssh.FingerprintSHA256(key)
+
+	cases := []struct {
+		name    string
+		hostKey string
+		key     ssh.PublicKey
+		ok      bool
+		pinned  string
+	}{
+		{"pin on first use", "", key, true, fingerprint},
+		{"pinned", fingerprint, key, true, ""},
+		{"pinned without prefix", fingerprint[len("SHA256:"):], key, true, ""},
+		{"mismatch", fingerprint, otherKey, false, ""},
+	}
+
+	for _, c := range cases {
+		var pinned string
+		err := sftpHostKeyCallback(c.hostKey, &pinned)("example.com:22", nil, c.key)
+		if c.ok != (nil == err) || pinned != c.pinned {
+			t.Errorf("case [%s]: expected [%v, %s], got [%v, %s]", c.name, c.ok, c.pinned, err, pinned)
+		}
+	}
+}
+
+func TestSFTPPinnedHostKey(t *testing.T) {
+	old := &conf.SFTP{Endpoint: "example.com:22", HostKey: "SHA256:old"}
+
+	cases := []struct {
+		name     string
+		old      *conf.SFTP
+		sftp     *conf.SFTP
+		expected string
+	}{
+		{"first save", nil, &conf.SFTP{Endpoint: "example.com:22"}, ""},
+		{"same endpoint without host key", old, &conf.SFTP{Endpoint: "example.com:22"}, "SHA256:old"},
+		{"same endpoint with host key", old, &conf.SFTP{Endpoint: "example.com:22", HostKey: "SHA256:new"}, "SHA256:new"},
+		{"new endpoint", old, &conf.SFTP{Endpoint: "example.org:22", HostKey: "SHA256:old"}, ""},
+		{"new endpoint without host key", old, &conf.SFTP{Endpoint: "example.org:22"}, ""},
+		{"new endpoint with host key", old, &conf.SFTP{Endpoint: "example.org:22", HostKey: "SHA256:new"}, "SHA256:new"},
+	}
+
+	for _, c := range cases {
+		if got := sftpPinnedHostKey(c.old, c.sftp); c.expected != got {
+			t.Errorf("case [%s]: expected [%s], got [%s]", c.name, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/88250/lute"
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/siyuan-community/siyuan/kernel/filesys"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/dejavu"
+	"github.com/siyuan-note/dejavu/entity"
+	"github.com/siyuan-note/logging"
+)
+
+var errSyncMergeBaseNotFound = errors.New("sync merge base not found")
+
+// getLatestSyncIndex 返回本地最近一次同步点的索引，需要在同步前调用，同步冲突时作为三方合并的共同祖先。
+func getLatestSyncIndex(repo *dejavu.Repo) (ret *entity.Index) {
+	data, err := os.ReadFile(filepath.Join(repo.Path, "refs", "latest-sync"))
+	if nil != err {
+		return
+	}
+
+	id := strings.TrimSpace(string(data))
+	if "" == id {
+		return
+	}
+	ret, err = repo.GetIndex(id)
+	if nil != err {
+		logging.LogWarnf("get latest sync index [%s] failed: %s", id, err)
+		return nil
+	}
+	return
+}
+
+// mergeSyncConflictDoc 对同步冲突的文档进行块级三方合并，合并结果写入工作空间。
+// 工作空间中的文档是同步保留的一方，conflictPath 是同步覆盖的一方，共同祖先是同步前的同步点中的文档。
+// 两方都修改了的块以保留的一方为准，被覆盖的一方的这些块放在返回的冲突文档中，没有这样的块时返回 nil。
+func mergeSyncConflictDoc(repo *dejavu.Repo, baseFile *entity.File, boxID, filePath, conflictPath string, luteEngine *lute.Lute) (conflictTree *parse.Tree, err error) {
+	if nil == repo || nil == baseFile {
+		err = errSyncMergeBaseNotFound
+		return
+	}
+
+	data, err := repo.OpenFile(baseFile)
+	if nil != err {
+		return
+	}
+	base, err := filesys.ParseJSONWithoutFix(data, luteEngine.ParseOptions)
+	if nil != err {
+		return
+	}
+	theirs, err := loadTree(conflictPath, luteEngine)
+	if nil != err {
+		return
+	}
+
+	// 文档可能在编辑器中打开着，读取、合并和写入期间和事务提交互斥，避免合并结果和编辑器提交的修改互相覆盖。
+	// 编辑器在同步完成后通过 syncMergeResult 事件重新加载合并后的文档
+	flushLock.Lock()
+	defer flushLock.Unlock()
+
+	ours, err := loadTree(filepath.Join(util.DataDir, filePath), luteEngine)
+	if nil != err {
+		return
+	}
+	if base.ID != ours.ID || ours.ID != theirs.ID {
+		err = fmt.Errorf("sync merge trees [%s, %s, %s] mismatch", base.ID, ours.ID, theirs.ID)
+		return
+	}
+
+	conflictIDs := mergeSyncTrees(base, ours, theirs, luteEngine)
+	ours.Box = boxID
+	ours.Path = strings.TrimPrefix(filePath, "/"+boxID)
+	if err = filesys.WriteTree(ours); nil != err {
+		return
+	}
+	logging.LogInfof("merged sync conflicted doc [%s], conflicted blocks [%d]", filePath, len(conflictIDs))
+
+	if 1 > len(conflictIDs) {
+		return
+	}
+
+	// 冲突文档使用被覆盖一方的完整文档裁剪得到
+	conflictTree, err = loadTree(conflictPath, luteEngine)
+	if nil != err {
+		return
+	}
+	pruneSyncConflictTree(conflictTree.Root, conflictIDs)
+	conflictTree.Box = boxID
+	conflictTree.Path = ours.Path
+	return
+}
+
+// syncMergeBlock 描述了三方合并时文档中的一个块。
+type syncMergeBlock struct {
+	node       *ast.Node
+	parentID   string
+	previousID string
+	sig        string // 块自身内容的签名，容器块不包含子块
+}
+
+type syncMergeSide struct {
+	blocks map[string]*syncMergeBlock
+	order  []string // 按文档先序排列的块 ID
+}
+
+func newSyncMergeSide(tree *parse.Tree, luteEngine *lute.Lute) (ret *syncMergeSide) {
+	ret = &syncMergeSide{blocks: map[string]*syncMergeBlock{}}
+	var walk func(parent *ast.Node)
+	walk = func(parent *ast.Node) {
+		previousID := ""
+		for c := parent.FirstChild; nil != c; c = c.Next {
+			if "" == c.ID {
+				continue
+			}
+
+			ret.blocks[c.ID] = &syncMergeBlock{node: c, parentID: parent.ID, previousID: previousID, sig: syncMergeSig(c, luteEngine)}
+			ret.order = append(ret.order, c.ID)
+			previousID = c.ID
+			if c.IsContainerBlock() {
+				walk(c)
+			}
+		}
+	}
+	walk(tree.Root)
+	return
+}
+
+// moved 判断块相对于共同祖先是否移动过，前一个块是新插入的或者共同祖先中的前一个块被删除时不认为是移动。
+func (side *syncMergeSide) moved(id string, base *syncMergeSide) bool {
+	b, s := base.blocks[id], side.blocks[id]
+	if nil == b || nil == s {
+		return false
+	}
+	if b.parentID != s.parentID {
+		return true
+	}
+	if b.previousID == s.previousID {
+		return false
+	}
+	if _, ok := base.blocks[s.previousID]; "" != s.previousID && !ok {
+		return false
+	}
+	if _, ok := side.blocks[b.previousID]; "" != b.previousID && !ok {
+		return false
+	}
+	return true
+}
+
+// mergeSyncTrees 将 theirs 相对于 base 的块级修改合并到 ours 中，返回两方都修改了的块 ID。
+// 一方修改、另一方删除的块保留修改；两方都修改的块保留 ours 的版本。
+func mergeSyncTrees(base, ours, theirs *parse.Tree, luteEngine *lute.Lute) (conflictIDs map[string]bool) {
+	conflictIDs = map[string]bool{}
+	b, o, t := newSyncMergeSide(base, luteEngine), newSyncMergeSide(ours, luteEngine), newSyncMergeSide(theirs, luteEngine)
+
+	// 合并结果中的块，包括文档块
+	nodes := map[string]*ast.Node{ours.ID: ours.Root}
+	for id, block := range o.blocks {
+		nodes[id] = block.node
+	}
+
+	mergeSyncDocAttrs(base.Root, ours.Root, theirs.Root)
+
+	// 插入 theirs 新增的块，以及 ours 删除但 theirs 修改了的块
+	for _, id := range t.order {
+		if _, ok := nodes[id]; ok {
+			continue
+		}
+
+		theirsBlock := t.blocks[id]
+		if baseBlock := b.blocks[id]; nil != baseBlock && baseBlock.sig == theirsBlock.sig {
+			continue
+		}
+
+		node := theirsBlock.node
+		node.Unlink()
+		if node.IsContainerBlock() {
+			// 子块按照各自的合并结果插入或者移动
+			for c := node.FirstChild; nil != c; {
+				next := c.Next
+				if "" != c.ID {
+					c.Unlink()
+				}
+				c = next
+			}
+		}
+		placeSyncMergeNode(nodes, ours.Root, node, theirsBlock.parentID, theirsBlock.previousID)
+		nodes[id] = node
+	}
+
+	// 移动 theirs 移动过而 ours 没有移动过的块
+	for _, id := range t.order {
+		oursBlock := o.blocks[id]
+		if nil == oursBlock || !t.moved(id, b) || o.moved(id, b) {
+			continue
+		}
+
+		theirsBlock := t.blocks[id]
+		placeSyncMergeNode(nodes, ours.Root, oursBlock.node, theirsBlock.parentID, theirsBlock.previousID)
+	}
+
+	// 合并块内容
+	for _, id := range t.order {
+		oursBlock, theirsBlock := o.blocks[id], t.blocks[id]
+		if nil == oursBlock || oursBlock.sig == theirsBlock.sig {
+			continue
+		}
+
+		baseBlock := b.blocks[id]
+		if nil != baseBlock && baseBlock.sig == theirsBlock.sig {
+			continue
+		}
+		if nil == baseBlock || baseBlock.sig != oursBlock.sig {
+			conflictIDs[id] = true
+			continue
+		}
+
+		if oursBlock.node.IsContainerBlock() {
+			replaceSyncMergeContainer(oursBlock.node, theirsBlock.node)
+			continue
+		}
+		node := theirsBlock.node
+		node.Unlink()
+		oursBlock.node.InsertBefore(node)
+		oursBlock.node.Unlink()
+		nodes[id] = node
+	}
+
+	// 删除 theirs 删除了而 ours 没有修改过的块，从后往前删除，容器块只有在子块都被删除后才删除
+	for i := len(o.order) - 1; 0 <= i; i-- {
+		id := o.order[i]
+		baseBlock := b.blocks[id]
+		if _, ok := t.blocks[id]; ok || nil == baseBlock || baseBlock.sig != o.blocks[id].sig {
+			continue
+		}
+
+		node := nodes[id]
+		if nil == node || (node.IsContainerBlock() && nil != firstSyncMergeChild(node)) {
+			continue
+		}
+		node.Unlink()
+		delete(nodes, id)
+	}
+
+	// 清理合并后没有子块的容器块，移除后父块可能也变为空，所以需要重复检查
+	for {
+		var empties []*ast.Node
+		ast.Walk(ours.Root, func(n *ast.Node, entering bool) ast.WalkStatus {
+			if entering && ast.NodeDocument != n.Type && n.IsContainerBlock() && nil == firstSyncMergeChild(n) {
+				empties = append(empties, n)
+				return ast.WalkSkipChildren
+			}
+			return ast.WalkContinue
+		})
+		if 1 > len(empties) {
+			break
+		}
+		for _, n := range empties {
+			n.Unlink()
+		}
+	}
+	return
+}
+
+// mergeSyncDocAttrs 按属性合并文档块属性，两方都修改了的属性以 ours 为准。
+func mergeSyncDocAttrs(base, ours, theirs *ast.Node) {
+	keys := map[string]bool{}
+	for _, kv := range theirs.KramdownIAL {
+		keys[kv[0]] = true
+	}
+	for _, kv := range base.KramdownIAL {
+		keys[kv[0]] = true
+	}
+
+	for key := range keys {
+		baseVal, oursVal, theirsVal := base.IALAttr(key), ours.IALAttr(key), theirs.IALAttr(key)
+		if oursVal == theirsVal || baseVal == theirsVal || baseVal != oursVal {
+			continue
+		}
+
+		if "" == theirsVal {
+			ours.RemoveIALAttr(key)
+		} else {
+			ours.SetIALAttr(key, theirsVal)
+		}
+	}
+}
+
+// placeSyncMergeNode 将块放到前一个块之后，前一个块不存在时放到父块的开头，父块也不存在时放到文档末尾。
+func placeSyncMergeNode(nodes map[string]*ast.Node, root, node *ast.Node, parentID, previousID string) {
+	if previous := nodes[previousID]; "" != previousID && nil != previous && !isSyncMergeAncestor(node, previous) {
+		previous.InsertAfter(node)
+		return
+	}
+
+	if parent := nodes[parentID]; nil != parent && !isSyncMergeAncestor(node, parent) {
+		// 跳过父块开头的标记节点，比如任务列表项标记、超级块开始和布局标记
+		var anchor *ast.Node
+		for c := parent.FirstChild; nil != c && "" == c.ID; c = c.Next {
+			if ast.NodeSuperBlockCloseMarker == c.Type {
+				break
+			}
+			anchor = c
+		}
+		if nil != anchor {
+			anchor.InsertAfter(node)
+		} else {
+			parent.PrependChild(node)
+		}
+		return
+	}
+
+	if !isSyncMergeAncestor(node, root) {
+		root.AppendChild(node)
+	}
+}
+
+// replaceSyncMergeContainer 使用 theirs 容器块自身的内容（属性、列表数据和标记节点）替换 ours 容器块，子块保持不变。
+func replaceSyncMergeContainer(ours, theirs *ast.Node) {
+	ours.KramdownIAL = theirs.KramdownIAL
+	ours.ListData = theirs.ListData
+
+	var oursMarkers, theirsMarkers []*ast.Node
+	for c := ours.FirstChild; nil != c; c = c.Next {
+		if "" == c.ID {
+			oursMarkers = append(oursMarkers, c)
+		}
+	}
+	for c := theirs.FirstChild; nil != c; c = c.Next {
+		if "" == c.ID {
+			theirsMarkers = append(theirsMarkers, c)
+		}
+	}
+	if len(oursMarkers) != len(theirsMarkers) {
+		return
+	}
+	for i, marker := range oursMarkers {
+		if marker.Type != theirsMarkers[i].Type {
+			return
+		}
+	}
+	for i, marker := range oursMarkers {
+		theirsMarker := theirsMarkers[i]
+		theirsMarker.Unlink()
+		marker.InsertBefore(theirsMarker)
+		marker.Unlink()
+	}
+}
+
+// pruneSyncConflictTree 只保留冲突的块以及它们的父块，返回 node 下是否有需要保留的块。
+func pruneSyncConflictTree(node *ast.Node, conflictIDs map[string]bool) (keep bool) {
+	for c := node.FirstChild; nil != c; {
+		next := c.Next
+		if "" != c.ID {
+			if conflictIDs[c.ID] || (c.IsContainerBlock() && pruneSyncConflictTree(c, conflictIDs)) {
+				keep = true
+			} else {
+				c.Unlink()
+			}
+		}
+		c = next
+	}
+	return
+}
+
+func firstSyncMergeChild(node *ast.Node) *ast.Node {
+	for c := node.FirstChild; nil != c; c = c.Next {
+		if "" != c.ID {
+			return c
+		}
+	}
+	return nil
+}
+
+func isSyncMergeAncestor(ancestor, node *ast.Node) bool {
+	for n := node; nil != n; n = n.Parent {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// 块属性中的更新时间不参与比较，否则只是更新时间不同的块也会被当作冲突
+var syncMergeUpdatedAttr = regexp.MustCompile(`\s*updated="\d+"`)
+
+// syncMergeSig 返回块自身内容的签名。叶子块使用 kramdown，容器块使用类型、属性、列表数据和标记节点。
+func syncMergeSig(node *ast.Node, luteEngine *lute.Lute) string {
+	if !node.IsContainerBlock() {
+		return syncMergeUpdatedAttr.ReplaceAllString(blockHistoryKramdown(node, luteEngine), "")
+	}
+
+	buf := bytes.Buffer{}
+	buf.WriteString(node.Type.String())
+	for _, kv := range node.KramdownIAL {
+		if "updated" != kv[0] {
+			buf.WriteString(" " + kv[0] + "=" + kv[1])
+		}
+	}
+	if nil != node.ListData {
+		buf.WriteString(fmt.Sprintf(" list=%d,%t,%s", node.ListData.Typ, node.ListData.Checked, node.ListData.Marker))
+	}
+	for c := node.FirstChild; nil != c; c = c.Next {
+		if "" == c.ID {
+			buf.WriteString(fmt.Sprintf(" %s:%s:%t", c.Type.String(), c.Tokens, c.TaskListItemChecked))
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,200 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/88250/lute/ast"
+	"github.com/88250/lute/parse"
+	"github.com/siyuan-community/siyuan/kernel/util"
+)
+
+func TestMergeSyncTrees(t *testing.T) {
+	cases := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		expected  string
+		conflicts string
+	}{
+		{"theirs edit",
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a2"), paraKramdown("b", "b")),
+			"a:a2 b:b", ""},
+		{"insert vs insert",
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("c", "c"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b"), paraKramdown("d", "d")),
+			"a:a c:c b:b d:d", ""},
+		{"insert at same place",
+			syncMergeDoc(paraKramdown("a", "a")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("c", "c")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("d", "d")),
+			"a:a d:d c:c", ""},
+		{"ours edit vs theirs delete",
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b2")),
+			syncMergeDoc(paraKramdown("a", "a")),
+			"a:a b:b2", ""},
+		{"ours delete vs theirs edit",
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b"), paraKramdown("c", "c")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("c", "c")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b2"), paraKramdown("c", "c")),
+			"a:a b:b2 c:c", ""},
+		{"theirs delete",
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a")),
+			"a:a", ""},
+		{"move into new container",
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b"), paraKramdown("c", "c")),
+			syncMergeDoc(quoteKramdown("q", paraKramdown("a", "a")), paraKramdown("b", "b")),
+			"q:[a:a] b:b c:c", ""},
+		{"move and edit",
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b"), paraKramdown("c", "c")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b2"), paraKramdown("c", "c")),
+			syncMergeDoc(paraKramdown("b", "b"), paraKramdown("c", "c"), paraKramdown("a", "a")),
+			"b:b2 c:c a:a", ""},
+		{"container attr edit",
+			syncMergeDoc(quoteKramdown("q", paraKramdown("a", "a"), paraKramdown("b", "b"))),
+			syncMergeDoc(quoteKramdown("q", paraKramdown("a", "a2"), paraKramdown("b", "b"))),
+			syncMergeDoc(strings.Replace(quoteKramdown("q", paraKramdown("a", "a"), paraKramdown("b", "b")), `id="20240101000000-qqqqqqq"`, `id="20240101000000-qqqqqqq" custom-x="1"`, 1)),
+			"q{custom-x=1}:[a:a2 b:b]", ""},
+		{"container emptied",
+			syncMergeDoc(quoteKramdown("q", paraKramdown("a", "a")), paraKramdown("b", "b")),
+			syncMergeDoc(quoteKramdown("q", paraKramdown("a", "a")), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("b", "b")),
+			"b:b", ""},
+		{"both edit",
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a1"), paraKramdown("b", "b")),
+			syncMergeDoc(paraKramdown("a", "a2"), paraKramdown("b", "b2")),
+			"a:a1 b:b2", "a"},
+		{"both edit same content",
+			syncMergeDoc(paraKramdown("a", "a")),
+			syncMergeDoc(paraKramdown("a", "a2")),
+			syncMergeDoc(paraKramdown("a", "a2")),
+			"a:a2", ""},
+		{"both insert same block",
+			syncMergeDoc(paraKramdown("a", "a")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b1")),
+			syncMergeDoc(paraKramdown("a", "a"), paraKramdown("b", "b2")),
+			"a:a b:b1", "b"},
+	}
+
+	luteEngine := util.NewLute()
+	for _, c := range cases {
+		base, ours, theirs := parseSyncMergeTree(c.base), parseSyncMergeTree(c.ours), parseSyncMergeTree(c.theirs)
+		conflictIDs := mergeSyncTrees(base, ours, theirs, luteEngine)
+		if got := syncMergeOutline(ours.Root); got != c.expected {
+			t.Errorf("case [%s]: expected [%s], got [%s]", c.name, c.expected, got)
+		}
+
+		var conflicts []string
+		for id := range conflictIDs {
+			conflicts = append(conflicts, syncMergeShortID(id))
+		}
+		sort.Strings(conflicts)
+		if got := strings.Join(conflicts, " "); got != c.conflicts {
+			t.Errorf("case [%s]: expected conflicts [%s], got [%s]", c.name, c.conflicts, got)
+		}
+	}
+}
+
+func TestPruneSyncConflictTree(t *testing.T) {
+	tree := parseSyncMergeTree(syncMergeDoc(paraKramdown("a", "a"), quoteKramdown("q", paraKramdown("b", "b"), paraKramdown("c", "c")), paraKramdown("d", "d")))
+	pruneSyncConflictTree(tree.Root, map[string]bool{syncMergeID("c"): true})
+	if got := syncMergeOutline(tree.Root); "q:[c:c]" != got {
+		t.Errorf("expected [q:[c:c]], got [%s]", got)
+	}
+}
+
+func syncMergeID(s string) string {
+	return "20240101000000-" + strings.Repeat(s, 7)
+}
+
+func syncMergeShortID(id string) string {
+	return id[len(id)-1:]
+}
+
+// paraKramdown 返回一个段落块的 kramdown。
+func paraKramdown(id, content string) string {
+	return content + "\n{: id=\"" + syncMergeID(id) + "\"}\n\n"
+}
+
+// quoteKramdown 返回一个包含 blocks 的引述块的 kramdown。
+func quoteKramdown(id string, blocks ...string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(strings.Join(blocks, "")), "\n") {
+		lines = append(lines, strings.TrimSpace("> "+line))
+	}
+	return strings.Join(lines, "\n") + "\n{: id=\"" + syncMergeID(id) + "\"}\n\n"
+}
+
+func syncMergeDoc(blocks ...string) string {
+	return strings.Join(blocks, "") + "{: id=\"" + syncMergeID("z") + "\" type=\"doc\"}"
+}
+
+// parseSyncMergeTree 解析 kramdown 并去掉块级属性节点，和从 .sy 加载的文档结构保持一致。
+func parseSyncMergeTree(kramdown string) *parse.Tree {
+	tree := parse.Parse("", []byte(kramdown), util.NewLute().ParseOptions)
+	var ials []*ast.Node
+	ast.Walk(tree.Root, func(n *ast.Node, entering bool) ast.WalkStatus {
+		if entering && ast.NodeKramdownBlockIAL == n.Type {
+			ials = append(ials, n)
+		}
+		return ast.WalkContinue
+	})
+	for _, ial := range ials {
+		ial.Unlink()
+	}
+	return tree
+}
+
+// syncMergeOutline 返回文档结构的简写，叶子块为 短 ID:内容，容器块为 短 ID{自定义属性}:[子块]。
+func syncMergeOutline(node *ast.Node) string {
+	var ret []string
+	for c := node.FirstChild; nil != c; c = c.Next {
+		if "" == c.ID {
+			continue
+		}
+
+		item := syncMergeShortID(c.ID)
+		if c.IsContainerBlock() {
+			var attrs []string
+			for _, kv := range c.KramdownIAL {
+				if strings.HasPrefix(kv[0], "custom-") {
+					attrs = append(attrs, kv[0]+"="+kv[1])
+				}
+			}
+			if 0 < len(attrs) {
+				item += "{" + strings.Join(attrs, " ") + "}"
+			}
+			item += ":[" + syncMergeOutline(c) + "]"
+		} else {
+			item += ":" + c.Text()
+		}
+		ret = append(ret, item)
+	}
+	return strings.Join(ret, " ")
+}
@@ -0,0 +1,455 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/88250/go-humanize"
+	"github.com/88250/gulu"
+	"github.com/88250/lute"
+	"github.com/panjf2000/ants/v2"
+	ignore "github.com/sabhiram/go-gitignore"
+	"github.com/siyuan-community/siyuan/kernel/filesys"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/dejavu"
+	"github.com/siyuan-note/dejavu/cloud"
+	"github.com/siyuan-note/dejavu/entity"
+	"github.com/siyuan-note/encryption"
+	"github.com/siyuan-note/logging"
+)
+
+// SyncPreviewFile 描述了数据同步预览中的一个文件。
+type SyncPreviewFile struct {
+	Path    string `json:"path"`
+	Type    string `json:"type"` // 文件类型，doc：文档，asset：资源文件，av：属性视图，other：其他文件
+	Title   string `json:"title"`
+	HSize   string `json:"hSize"`
+	Updated int64  `json:"updated"`
+}
+
+// SyncPreview 描述了同步一个云端同步目录时的合并预览。
+type SyncPreview struct {
+	CloudName    string             `json:"cloudName"`
+	Upserts      []*SyncPreviewFile `json:"upserts"`      // 同步后将迁出到本地的云端文件
+	Removes      []*SyncPreviewFile `json:"removes"`      // 同步后将从本地删除的文件
+	Conflicts    []*SyncPreviewFile `json:"conflicts"`    // 本地和云端都修改了的文件
+	LocalUpserts int                `json:"localUpserts"` // 将上传到云端的本地新增或者修改的文件数
+	LocalRemoves int                `json:"localRemoves"` // 将从云端删除的本地已删除的文件数
+}
+
+// PreviewSync 按照数据同步的方式计算合并结果，但是不迁出也不上传任何文件，以便用户在同步前确认变更。
+// 除了创建同步前的数据快照以外，云端的索引和文件只下载到内存中，不会写入本地数据仓库，以免影响后续同步的冲突判断。
+func PreviewSync() (ret []*SyncPreview, err error) {
+	ret = []*SyncPreview{}
+	if 1 > len(Conf.Repo.Key) {
+		err = errors.New(Conf.Language(26))
+		return
+	}
+	if !checkSync(false, false, true) {
+		err = errors.New(Conf.Language(53))
+		return
+	}
+
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	repo, err := newSyncRepository()
+	if nil != err {
+		return
+	}
+	preview, err := previewSyncRepo(repo, Conf.Sync.CloudName)
+	if nil != err {
+		return
+	}
+	ret = append(ret, preview)
+
+	boxSyncs := getBoxSyncs()
+	targets := getSyncTargets(boxSyncs)
+	cloudNames := make([]string, 0, len(targets))
+	for cloudName := range targets {
+		cloudNames = append(cloudNames, cloudName)
+	}
+	sort.Strings(cloudNames)
+	for _, cloudName := range cloudNames {
+		repo, err = newSyncTargetRepository(cloudName, targets[cloudName], boxSyncs)
+		if nil != err {
+			return
+		}
+		if preview, err = previewSyncRepo(repo, cloudName); nil != err {
+			return
+		}
+		ret = append(ret, preview)
+	}
+	return
+}
+
+func previewSyncRepo(repo *dejavu.Repo, cloudName string) (ret *SyncPreview, err error) {
+	ret = &SyncPreview{CloudName: cloudName, Upserts: []*SyncPreviewFile{}, Removes: []*SyncPreviewFile{}, Conflicts: []*SyncPreviewFile{}}
+
+	cloudConf, err := buildCloudConf()
+	if nil != err {
+		return
+	}
+	cloudConf.Dir = cloudName
+	cloudConf.RepoPath = repo.Path
+	cloudRepo, err := newCloudRepository(cloudConf)
+	if nil != err {
+		return
+	}
+
+	if _, _, err = indexRepoBeforeCloudSync(repo); nil != err {
+		return
+	}
+	return previewSyncRepoLatest(repo, cloudRepo, cloudName)
+}
+
+// previewSyncRepoLatest 使用本地数据仓库最新的索引计算合并预览。
+func previewSyncRepoLatest(repo *dejavu.Repo, cloudRepo cloud.Cloud, cloudName string) (ret *SyncPreview, err error) {
+	ret = &SyncPreview{CloudName: cloudName, Upserts: []*SyncPreviewFile{}, Removes: []*SyncPreviewFile{}, Conflicts: []*SyncPreviewFile{}}
+	latest, err := repo.Latest()
+	if nil != err {
+		return
+	}
+
+	cloudLatest, err := downloadSyncPreviewLatest(cloudRepo)
+	if nil != err {
+		logging.LogErrorf("download cloud [%s] latest failed: %s", cloudName, err)
+		return
+	}
+	if cloudLatest.ID == latest.ID {
+		return
+	}
+
+	// 本地不存在的云端文件只下载到内存中，这些文件在同步时会被视为发生了实际下载
+	// 不能使用 repo.GetFile 判断，它会命中进程内所有仓库共用的文件缓存
+	fetched := map[string]bool{}
+	var cloudLatestFiles []*entity.File
+	var fetchIDs []string
+	for _, fileID := range cloudLatest.Files {
+		if !isRepoFileExist(repo, fileID) {
+			fetchIDs = append(fetchIDs, fileID)
+			fetched[fileID] = true
+			continue
+		}
+		file, getErr := repo.GetFile(fileID)
+		if nil != getErr {
+			err = getErr
+			return
+		}
+		cloudLatestFiles = append(cloudLatestFiles, file)
+	}
+	fetchedFiles, err := downloadSyncPreviewFiles(cloudRepo, fetchIDs)
+	if nil != err {
+		logging.LogErrorf("download cloud [%s] files failed: %s", cloudName, err)
+		return
+	}
+	cloudLatestFiles = append(cloudLatestFiles, fetchedFiles...)
+
+	latestFiles, err := repo.GetFiles(latest)
+	if nil != err {
+		return
+	}
+	var latestSyncFiles []*entity.File
+	if latestSync := getLatestSyncIndex(repo); nil != latestSync {
+		if latestSyncFiles, err = repo.GetFiles(latestSync); nil != err {
+			return
+		}
+	}
+
+	// 以下合并计算和 dejavu 同步保持一致
+	localUpserts, localRemoves := diffSyncPreviewFiles(latestFiles, latestSyncFiles)
+	var cloudUpserts, cloudRemoves []*entity.File
+	if "" != cloudLatest.ID {
+		cloudUpserts, cloudRemoves = diffSyncPreviewFiles(cloudLatestFiles, latestFiles)
+	}
+	localUpserts = filterSyncPreviewLocalUpserts(localUpserts, cloudUpserts)
+
+	var upserts, removes, conflicts []*entity.File
+	var cloudUpsertIgnore *entity.File
+	for _, cloudUpsert := range cloudUpserts {
+		if "/.siyuan/syncignore" == cloudUpsert.Path {
+			cloudUpsertIgnore = cloudUpsert
+		}
+
+		if nil != getSyncPreviewFile(localUpserts, cloudUpsert) {
+			if fetched[cloudUpsert.ID] {
+				conflicts = append(conflicts, cloudUpsert)
+			}
+			continue
+		}
+		if nil == getSyncPreviewFile(localRemoves, cloudUpsert) && !strings.HasSuffix(cloudUpsert.Path, ".tmp") {
+			upserts = append(upserts, cloudUpsert)
+		}
+	}
+	for _, cloudRemove := range cloudRemoves {
+		if nil == getSyncPreviewFile(localUpserts, cloudRemove) {
+			removes = append(removes, cloudRemove)
+		}
+	}
+	if nil != cloudUpsertIgnore {
+		data, openErr := openSyncPreviewFile(repo, cloudRepo, cloudUpsertIgnore)
+		if nil != openErr {
+			err = openErr
+			return
+		}
+		ignoreMatcher := ignore.CompileIgnoreLines(strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")...)
+		var tmp []*entity.File
+		for _, remove := range removes {
+			if !ignoreMatcher.MatchesPath(remove.Path) {
+				tmp = append(tmp, remove)
+			}
+		}
+		removes = tmp
+	}
+
+	luteEngine := util.NewLute()
+	ret.Upserts = buildSyncPreviewFiles(repo, cloudRepo, upserts, luteEngine)
+	ret.Removes = buildSyncPreviewFiles(repo, cloudRepo, removes, luteEngine)
+	ret.Conflicts = buildSyncPreviewFiles(repo, cloudRepo, conflicts, luteEngine)
+	ret.LocalUpserts, ret.LocalRemoves = len(localUpserts), len(localRemoves)
+	return
+}
+
+func buildSyncPreviewFiles(repo *dejavu.Repo, cloudRepo cloud.Cloud, files []*entity.File, luteEngine *lute.Lute) (ret []*SyncPreviewFile) {
+	ret = []*SyncPreviewFile{}
+	for _, file := range files {
+		ret = append(ret, &SyncPreviewFile{
+			Path:    file.Path,
+			Type:    syncPreviewFileType(file.Path),
+			Title:   parseTitleInSyncPreview(repo, cloudRepo, file, luteEngine),
+			HSize:   humanize.BytesCustomCeil(uint64(file.Size), 2),
+			Updated: file.Updated,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return
+}
+
+func syncPreviewFileType(p string) string {
+	switch {
+	case strings.HasSuffix(p, ".sy"):
+		return "doc"
+	case strings.HasPrefix(p, "/assets/"):
+		return "asset"
+	case strings.HasPrefix(p, "/storage/av/") && strings.HasSuffix(p, ".json"):
+		return "av"
+	}
+	return "other"
+}
+
+// parseTitleInSyncPreview 解析文件标题，文档使用文档标题，属性视图使用属性视图名称，其他文件使用文件名。
+func parseTitleInSyncPreview(repo *dejavu.Repo, cloudRepo cloud.Cloud, file *entity.File, luteEngine *lute.Lute) (title string) {
+	title = path.Base(file.Path)
+	fileType := syncPreviewFileType(file.Path)
+	if "doc" != fileType && "av" != fileType {
+		return
+	}
+
+	data, err := openSyncPreviewFile(repo, cloudRepo, file)
+	if nil != err {
+		logging.LogWarnf("open sync preview file [%s] failed: %s", file.Path, err)
+		return
+	}
+
+	if "doc" == fileType {
+		tree, parseErr := filesys.ParseJSONWithoutFix(data, luteEngine.ParseOptions)
+		if nil != parseErr {
+			logging.LogWarnf("parse sync preview file [%s] failed: %s", file.Path, parseErr)
+			return
+		}
+		title = tree.Root.IALAttr("title")
+		return
+	}
+
+	av := map[string]interface{}{}
+	if err = gulu.JSON.UnmarshalJSON(data, &av); nil != err {
+		return
+	}
+	if name, ok := av["name"].(string); ok && "" != name {
+		title = name
+	}
+	return
+}
+
+// openSyncPreviewFile 读取文件内容，本地数据仓库中不存在的分块从云端下载。
+func openSyncPreviewFile(repo *dejavu.Repo, cloudRepo cloud.Cloud, file *entity.File) (ret []byte, err error) {
+	if ret, err = repo.OpenFile(file); nil == err {
+		return
+	}
+
+	buf := bytes.Buffer{}
+	for _, chunkID := range file.Chunks {
+		data, downloadErr := downloadSyncPreviewObject(cloudRepo, path.Join("objects", chunkID[:2], chunkID[2:]))
+		if nil != downloadErr {
+			err = downloadErr
+			return
+		}
+		buf.Write(data)
+	}
+	ret, err = buf.Bytes(), nil
+	return
+}
+
+// isRepoFileExist 检查本地数据仓库中是否存在文件对象，和 dejavu 一样检查对象文件而不是文件缓存。
+func isRepoFileExist(repo *dejavu.Repo, fileID string) bool {
+	return gulu.File.IsExist(filepath.Join(repo.Path, "objects", fileID[:2], fileID[2:]))
+}
+
+func downloadSyncPreviewLatest(cloudRepo cloud.Cloud) (ret *entity.Index, err error) {
+	ret = &entity.Index{}
+	data, err := cloudRepo.DownloadObject("refs/latest")
+	if nil != err {
+		if errors.Is(err, cloud.ErrCloudObjectNotFound) {
+			err = nil
+		}
+		return
+	}
+
+	latestID := strings.TrimSpace(string(data))
+	if 40 != len(latestID) {
+		return
+	}
+	if data, err = downloadSyncPreviewObject(cloudRepo, path.Join("indexes", latestID)); nil != err {
+		if errors.Is(err, cloud.ErrCloudObjectNotFound) {
+			err = nil
+		}
+		return
+	}
+	err = gulu.JSON.UnmarshalJSON(data, ret)
+	return
+}
+
+// downloadSyncPreviewFiles 并发下载云端的文件对象，任意文件下载失败时返回错误。
+func downloadSyncPreviewFiles(cloudRepo cloud.Cloud, fileIDs []string) (ret []*entity.File, err error) {
+	if 1 > len(fileIDs) {
+		return
+	}
+
+	lock := sync.Mutex{}
+	waitGroup := &sync.WaitGroup{}
+	p, _ := ants.NewPoolWithFunc(8, func(arg interface{}) {
+		defer waitGroup.Done()
+
+		fileID := arg.(string)
+		file, downloadErr := downloadSyncPreviewFile(cloudRepo, fileID)
+		lock.Lock()
+		defer lock.Unlock()
+		if nil != downloadErr {
+			if nil == err {
+				err = fmt.Errorf("download file [%s] failed: %s", fileID, downloadErr)
+			}
+			return
+		}
+		ret = append(ret, file)
+	})
+	for _, fileID := range fileIDs {
+		waitGroup.Add(1)
+		if invokeErr := p.Invoke(fileID); nil != invokeErr {
+			waitGroup.Done()
+			lock.Lock()
+			if nil == err {
+				err = invokeErr
+			}
+			lock.Unlock()
+			break
+		}
+	}
+	waitGroup.Wait()
+	p.Release()
+	return
+}
+
+func downloadSyncPreviewFile(cloudRepo cloud.Cloud, fileID string) (ret *entity.File, err error) {
+	data, err := downloadSyncPreviewObject(cloudRepo, path.Join("objects", fileID[:2], fileID[2:]))
+	if nil != err {
+		return
+	}
+	ret = &entity.File{}
+	err = gulu.JSON.UnmarshalJSON(data, ret)
+	return
+}
+
+// downloadSyncPreviewObject 下载并解码云端对象，数据对象经过压缩和加密，索引只经过压缩。
+func downloadSyncPreviewObject(cloudRepo cloud.Cloud, key string) (ret []byte, err error) {
+	ret, err = cloudRepo.DownloadObject(key)
+	if nil != err {
+		return
+	}
+
+	if strings.HasPrefix(key, "objects") {
+		if ret, err = encryption.AesDecrypt(ret, Conf.Repo.Key); nil != err {
+			return
+		}
+	}
+	ret, err = syncFSCompressDecoder.DecodeAll(ret, nil)
+	return
+}
+
+func diffSyncPreviewFiles(left, right []*entity.File) (upserts, removes []*entity.File) {
+	l, r := map[string]*entity.File{}, map[string]*entity.File{}
+	for _, f := range left {
+		l[f.Path] = f
+	}
+	for _, f := range right {
+		r[f.Path] = f
+	}
+
+	for p, lFile := range l {
+		// 更新时间只比较到秒 https://github.com/siyuan-note/siyuan/issues/8573
+		if rFile := r[p]; nil == rFile || lFile.Updated/1000 != rFile.Updated/1000 {
+			upserts = append(upserts, lFile)
+		}
+	}
+	for p, rFile := range r {
+		if nil == l[p] {
+			removes = append(removes, rFile)
+		}
+	}
+	return
+}
+
+// filterSyncPreviewLocalUpserts 本地早于云端 7 分钟的修改使用云端数据覆盖 https://github.com/siyuan-note/siyuan/issues/7403
+func filterSyncPreviewLocalUpserts(localUpserts, cloudUpserts []*entity.File) (ret []*entity.File) {
+	cloudUpsertsMap := map[string]*entity.File{}
+	for _, cloudUpsert := range cloudUpserts {
+		cloudUpsertsMap[cloudUpsert.Path] = cloudUpsert
+	}
+	for _, localUpsert := range localUpserts {
+		if cloudUpsert := cloudUpsertsMap[localUpsert.Path]; nil != cloudUpsert && localUpsert.Updated < cloudUpsert.Updated-1000*60*7 {
+			continue
+		}
+		ret = append(ret, localUpsert)
+	}
+	return
+}
+
+func getSyncPreviewFile(files []*entity.File, file *entity.File) *entity.File {
+	for _, f := range files {
+		if f.ID == file.ID || f.Path == file.Path {
+			return f
+		}
+	}
+	return nil
+}
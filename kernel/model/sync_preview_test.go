@@ -0,0 +1,143 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siyuan-community/siyuan/kernel/conf"
+	"github.com/siyuan-note/dejavu"
+	"github.com/siyuan-note/dejavu/cloud"
+	"github.com/siyuan-note/eventbus"
+)
+
+// TestPreviewSyncRepoLatest 使用两台设备同步同一个本地文件夹，检查预览和 dejavu 实际同步的合并结果一致。
+// 合并计算复制自 dejavu，升级 dejavu 后如果这里失败需要同步修改 previewSyncRepoLatest。
+func TestPreviewSyncRepoLatest(t *testing.T) {
+	oldConf := Conf
+	Conf = &AppConf{Sync: conf.NewSync(), Repo: &conf.Repo{Key: []byte("0123456789abcdef0123456789abcdef")}}
+	Conf.Sync.Provider = conf.ProviderLocal
+	defer func() { Conf = oldConf }()
+
+	dir := t.TempDir()
+	newDevice := func(name string) (*dejavu.Repo, cloud.Cloud) { return newTestSyncDevice(t, dir, name) }
+	write := func(repo *dejavu.Repo, p, content string) { writeTestSyncFile(t, repo, p, content) }
+	sync := func(repo *dejavu.Repo) *dejavu.MergeResult { return syncTestRepo(t, repo) }
+
+	a, _ := newDevice("a")
+	b, bCloud := newDevice("b")
+	write(a, "keep.txt", "keep")
+	write(a, "edit.txt", "edit")
+	write(a, "remove.txt", "remove")
+	write(a, "conflict.txt", "conflict")
+	write(a, "local-remove.txt", "local-remove")
+	sync(a)
+	write(b, "init.txt", "init") // dejavu 不允许创建空索引
+	sync(b)
+
+	// 修改时间只比较到秒
+	time.Sleep(1100 * time.Millisecond)
+	write(a, "edit.txt", "edit a")
+	write(a, "add.txt", "add")
+	write(a, "conflict.txt", "conflict a")
+	write(a, "local-remove.txt", "local-remove a")
+	os.Remove(filepath.Join(a.DataPath, "remove.txt"))
+	sync(a)
+
+	time.Sleep(1100 * time.Millisecond) // 两台设备的修改不在同一秒，否则云端修改不会被视为 upsert
+	write(b, "conflict.txt", "conflict b")
+	write(b, "local.txt", "local")
+	os.Remove(filepath.Join(b.DataPath, "local-remove.txt"))
+	if _, err := b.Index("", testSyncContext); nil != err {
+		t.Fatal(err)
+	}
+	preview, err := previewSyncRepoLatest(b, bCloud, "main")
+	if nil != err {
+		t.Fatal(err)
+	}
+	mergeResult := sync(b)
+
+	check := func(name string, got []*SyncPreviewFile, expected []string) {
+		var paths []string
+		for _, f := range got {
+			paths = append(paths, f.Path)
+		}
+		sort.Strings(expected)
+		if strings.Join(paths, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: preview [%s], sync [%s]", name, strings.Join(paths, ","), strings.Join(expected, ","))
+		}
+	}
+	var upserts, removes, conflicts []string
+	for _, f := range mergeResult.Upserts {
+		upserts = append(upserts, f.Path)
+	}
+	for _, f := range mergeResult.Removes {
+		removes = append(removes, f.Path)
+	}
+	for _, f := range mergeResult.Conflicts {
+		conflicts = append(conflicts, f.Path)
+	}
+	check("upserts", preview.Upserts, upserts)
+	check("removes", preview.Removes, removes)
+	check("conflicts", preview.Conflicts, conflicts)
+	if 0 == len(upserts) || 0 == len(removes) || 0 == len(conflicts) {
+		t.Errorf("sync result [%v] [%v] [%v] does not cover all merge cases", upserts, removes, conflicts)
+	}
+	if 2 != preview.LocalUpserts || 1 != preview.LocalRemoves {
+		t.Errorf("expected local changes [2, 1], got [%d, %d]", preview.LocalUpserts, preview.LocalRemoves)
+	}
+}
+
+var testSyncContext = map[string]interface{}{eventbus.CtxPushMsg: eventbus.CtxPushMsgToNone}
+
+// newTestSyncDevice 返回一台使用本地文件夹作为云端的设备，同一个 dir 下的设备同步到同一个云端同步目录。
+func newTestSyncDevice(t *testing.T, dir, name string) (*dejavu.Repo, cloud.Cloud) {
+	repoPath := filepath.Join(dir, name, "repo")
+	cloudRepo := &syncFSCloud{BaseCloud: &cloud.BaseCloud{Conf: &cloud.Conf{Dir: "main", UserID: "0", RepoPath: repoPath, AvailableSize: math.MaxInt64}}, fs: &localSyncFS{root: filepath.Join(dir, "cloud")}}
+	repo, err := dejavu.NewRepo(filepath.Join(dir, name, "data"), repoPath, filepath.Join(dir, name, "history"), filepath.Join(dir, name, "temp"), name, name, "linux", Conf.Repo.Key, nil, cloudRepo)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return repo, cloudRepo
+}
+
+func writeTestSyncFile(t *testing.T, repo *dejavu.Repo, p, content string) {
+	absPath := filepath.Join(repo.DataPath, p)
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); nil != err {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(absPath, []byte(content), 0644); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func syncTestRepo(t *testing.T, repo *dejavu.Repo) *dejavu.MergeResult {
+	if _, err := repo.Index("", testSyncContext); nil != err {
+		t.Fatal(err)
+	}
+	mergeResult, _, err := repo.Sync(testSyncContext)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return mergeResult
+}
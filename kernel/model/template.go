@@ -411,14 +411,14 @@ func SQLTemplateFuncs(templateFuncMap *template.FuncMap) {
 		for _, arg := range args {
 			stmt = strings.Replace(stmt, "?", arg, 1)
 		}
-		retBlocks = sql.SelectBlocksRawStmt(stmt, 1, 512)
+		retBlocks = sql.SelectBlocksRawStmtReadOnly(stmt, 1, 512)
 		return
 	}
 	(*templateFuncMap)["querySpans"] = func(stmt string, args ...string) (retSpans []*sql.Span) {
 		for _, arg := range args {
 			stmt = strings.Replace(stmt, "?", arg, 1)
 		}
-		retSpans = sql.SelectSpansRawStmt(stmt, 512)
+		retSpans = sql.SelectSpansRawStmtReadOnly(stmt, 512)
 		return
 	}
 }
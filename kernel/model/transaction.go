@@ -195,6 +195,7 @@ func performTx(tx *Transaction) (ret *TxErr) {
 	}()
 
 	for _, op := range tx.DoOperations {
+		blockHistory := tx.snapshotBlock(op)
 		switch op.Action {
 		case "create":
 			ret = tx.doCreate(op)
@@ -274,6 +275,10 @@ func performTx(tx *Transaction) (ret *TxErr) {
 			ret = tx.doReplaceAttrViewBlock(op)
 		case "updateAttrViewColTemplate":
 			ret = tx.doUpdateAttrViewColTemplate(op)
+		case "updateAttrViewColUniqueID":
+			ret = tx.doUpdateAttrViewColUniqueID(op)
+		case "updateAttrViewColFormula":
+			ret = tx.doUpdateAttrViewColFormula(op)
 		case "addAttrViewView":
 			ret = tx.doAddAttrViewView(op)
 		case "removeAttrViewView":
@@ -296,18 +301,44 @@ func performTx(tx *Transaction) (ret *TxErr) {
 			ret = tx.doSetAttrViewColDate(op)
 		case "unbindAttrViewBlock":
 			ret = tx.doUnbindAttrViewBlock(op)
+		case "setAttrViewBoardGroupKey":
+			ret = tx.doSetAttrViewBoardGroupKey(op)
+		case "setAttrViewBoardLaneHidden":
+			ret = tx.doSetAttrViewBoardLaneHidden(op)
+		case "sortAttrViewBoardLane":
+			ret = tx.doSortAttrViewBoardLane(op)
+		case "setAttrViewGroup":
+			ret = tx.doSetAttrViewGroup(op)
+		case "foldAttrViewGroup":
+			ret = tx.doFoldAttrViewGroup(op)
+		case "hideAttrViewGroup":
+			ret = tx.doHideAttrViewGroup(op)
+		case "sortAttrViewGroup":
+			ret = tx.doSortAttrViewGroup(op)
+		case "moveAttrViewBoardCard":
+			ret = tx.doMoveAttrViewBoardCard(op)
+		case "setAttrViewDateLayoutKeys":
+			ret = tx.doSetAttrViewDateLayoutKeys(op)
+		case "setAttrViewCalendarMode":
+			ret = tx.doSetAttrViewCalendarMode(op)
+		case "setAttrViewTimelineScale":
+			ret = tx.doSetAttrViewTimelineScale(op)
+		case "importAttrView":
+			ret = tx.doImportAttrView(op)
 		}
 
 		if nil != ret {
 			tx.rollback()
 			return
 		}
+		tx.recordBlock(op, blockHistory)
 	}
 
 	if cr := tx.commit(); nil != cr {
 		logging.LogErrorf("commit tx failed: %s", cr)
 		return &TxErr{msg: cr.Error()}
 	}
+	appendBlockHistories(tx.blockHistories)
 	return
 }
 
@@ -1288,15 +1319,18 @@ type Operation struct {
 	RowID               string                   `json:"rowID"`             // 属性视图行 ID
 	IsTwoWay            bool                     `json:"isTwoWay"`          // 属性视图关联列是否是双向关系
 	BackRelationKeyID   string                   `json:"backRelationKeyID"` // 属性视图关联列回链关联列的 ID
+	Layout              av.LayoutType            `json:"layout"`            // 属性视图视图布局类型
 }
 
 type Transaction struct {
 	Timestamp      int64        `json:"timestamp"`
 	DoOperations   []*Operation `json:"doOperations"`
 	UndoOperations []*Operation `json:"undoOperations"`
+	Session        string       `json:"-"` // 发起事务的编辑器会话 ID，用于块修改记录
 
-	trees map[string]*parse.Tree
-	nodes map[string]*ast.Node
+	trees          map[string]*parse.Tree
+	nodes          map[string]*ast.Node
+	blockHistories []*sql.BlockHistory
 
 	luteEngine *lute.Lute
 	m          *sync.Mutex
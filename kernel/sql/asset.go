@@ -116,6 +116,30 @@ func QueryAssetByHash(hash string) (ret *Asset) {
 	return
 }
 
+func QueryAssetPathsByBoxes(boxIDs []string) (ret []string) {
+	ret = []string{}
+	if 1 > len(boxIDs) {
+		return
+	}
+
+	sqlStmt := "SELECT DISTINCT path FROM assets WHERE box IN ('" + strings.Join(boxIDs, "','") + "')"
+	rows, err := query(sqlStmt)
+	if nil != err {
+		logging.LogErrorf("sql query [%s] failed: %s", sqlStmt, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p string
+		if err = rows.Scan(&p); nil != err {
+			logging.LogErrorf("query scan field failed: %s", err)
+			return
+		}
+		ret = append(ret, p)
+	}
+	return
+}
+
 func scanAssetRows(rows *sql.Rows) (ret *Asset) {
 	var asset Asset
 	if err := rows.Scan(&asset.ID, &asset.BlockID, &asset.RootID, &asset.Box, &asset.DocPath, &asset.Path, &asset.Name, &asset.Title, &asset.Hash); nil != err {
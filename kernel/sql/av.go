@@ -0,0 +1,194 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/siyuan-community/siyuan/kernel/av"
+	"github.com/siyuan-note/eventbus"
+)
+
+const (
+	AttributeViewsPlaceholder = "(?, ?, ?)"
+	AvKeysPlaceholder         = "(?, ?, ?, ?, ?)"
+	AvValuesPlaceholder       = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+)
+
+func init() {
+	eventbus.Subscribe(av.EvtAttributeViewSaved, func(avID string) {
+		IndexAttributeViewQueue(avID)
+	})
+}
+
+// IndexAttributeViewQueue 将属性视图（数据库）的键值重新索引到 attribute_views、av_keys 和 av_values 表。
+func IndexAttributeViewQueue(avID string) {
+	dbQueueLock.Lock()
+	defer dbQueueLock.Unlock()
+
+	newOp := &dbQueueOperation{avID: avID, inQueueTime: time.Now(), action: "index_av"}
+	for i, op := range operationQueue {
+		if ("index_av" == op.action || "delete_av" == op.action) && op.avID == avID {
+			operationQueue[i] = newOp
+			return
+		}
+	}
+	operationQueue = append(operationQueue, newOp)
+}
+
+func RemoveAttributeViewQueue(avID string) {
+	dbQueueLock.Lock()
+	defer dbQueueLock.Unlock()
+
+	newOp := &dbQueueOperation{avID: avID, inQueueTime: time.Now(), action: "delete_av"}
+	for i, op := range operationQueue {
+		if ("index_av" == op.action || "delete_av" == op.action) && op.avID == avID {
+			operationQueue[i] = newOp
+			return
+		}
+	}
+	operationQueue = append(operationQueue, newOp)
+}
+
+func indexAttributeView(tx *sql.Tx, avID string) (err error) {
+	attrView, err := av.ParseAttributeView(avID)
+	if nil != err {
+		if av.ErrViewNotFound == err {
+			return deleteAttributeView(tx, avID)
+		}
+		return
+	}
+	if nil == attrView {
+		// 读取文件失败时不返回错误，保留已有的索引
+		return
+	}
+
+	if err = deleteAttributeView(tx, avID); nil != err {
+		return
+	}
+
+	if err = execStmtTx(tx, "INSERT INTO attribute_views (id, name, updated) VALUES "+AttributeViewsPlaceholder, attrView.ID, attrView.Name, time.Now().Format("20060102150405")); nil != err {
+		return
+	}
+
+	var keyArgs []interface{}
+	for i, kv := range attrView.KeyValues {
+		keyArgs = append(keyArgs, kv.Key.ID, attrView.ID, kv.Key.Name, string(kv.Key.Type), i)
+	}
+	if err = insertAvRows(tx, "av_keys (id, av_id, name, type, sort)", AvKeysPlaceholder, keyArgs); nil != err {
+		return
+	}
+
+	blockValues := map[string]*av.Value{}
+	if blockKeyValues := attrView.GetBlockKeyValues(); nil != blockKeyValues {
+		for _, v := range blockKeyValues.Values {
+			blockValues[v.BlockID] = v
+		}
+	}
+
+	var valueArgs []interface{}
+	for _, kv := range attrView.KeyValues {
+		for _, v := range kv.Values {
+			valueArgs = append(valueArgs, avValueArgs(attrView.ID, kv.Key, v, blockValues[v.BlockID])...)
+		}
+	}
+	err = insertAvRows(tx, "av_values (id, av_id, key_id, block_id, type, content, number, date, date_end, checked, created, updated)", AvValuesPlaceholder, valueArgs)
+	return
+}
+
+// avValueArgs 返回值的插入参数，number、date、date_end 和 checked 列使用数值类型以便比较，空值时为 NULL。
+func avValueArgs(avID string, key *av.Key, value, blockValue *av.Value) []interface{} {
+	var number, date, dateEnd, checked interface{}
+	content := value.String(false)
+	switch key.Type {
+	case av.KeyTypeNumber:
+		if nil != value.Number && value.Number.IsNotEmpty {
+			number = value.Number.Content
+		}
+	case av.KeyTypeDate:
+		if nil != value.Date && value.Date.IsNotEmpty {
+			date = value.Date.Content
+			if value.Date.HasEndDate && value.Date.IsNotEmpty2 {
+				dateEnd = value.Date.Content2
+			}
+		}
+	case av.KeyTypeCreated:
+		if nil != value.Created && value.Created.IsNotEmpty {
+			date = value.Created.Content
+		} else if nil != blockValue && nil != blockValue.Block {
+			date = blockValue.Block.Created
+		}
+	case av.KeyTypeUpdated:
+		if nil != value.Updated && value.Updated.IsNotEmpty {
+			date = value.Updated.Content
+		} else if nil != blockValue && nil != blockValue.Block {
+			date = blockValue.Block.Updated
+		}
+	case av.KeyTypeCheckbox:
+		checked = 0
+		if nil != value.Checkbox && value.Checkbox.Checked {
+			checked = 1
+		}
+	case av.KeyTypeRelation:
+		// 关联的内容在保存时会被清空，这里索引关联的块 ID
+		if nil != value.Relation {
+			content = strings.Join(value.Relation.BlockIDs, " ")
+		}
+	case av.KeyTypeUniqueID:
+		if nil != value.UniqueID {
+			number = value.UniqueID.Number
+		}
+	case av.KeyTypeCreatedBy:
+		if nil != value.CreatedBy {
+			content = value.CreatedBy.Content
+		}
+	}
+
+	return []interface{}{value.ID, avID, key.ID, value.BlockID, string(key.Type), content, number, date, dateEnd, checked,
+		time.UnixMilli(value.CreatedAt).Format("20060102150405"), time.UnixMilli(value.UpdatedAt).Format("20060102150405")}
+}
+
+func insertAvRows(tx *sql.Tx, table, placeholder string, args []interface{}) (err error) {
+	columnCount := strings.Count(placeholder, "?")
+	batch := 512 * columnCount
+	for start := 0; start < len(args); start += batch {
+		end := min(start+batch, len(args))
+		valueStrings := make([]string, 0, (end-start)/columnCount)
+		for i := start; i < end; i += columnCount {
+			valueStrings = append(valueStrings, placeholder)
+		}
+		stmt := fmt.Sprintf("INSERT INTO %s VALUES %s", table, strings.Join(valueStrings, ","))
+		if err = prepareExecInsertTx(tx, stmt, args[start:end]); nil != err {
+			return
+		}
+	}
+	return
+}
+
+func deleteAttributeView(tx *sql.Tx, avID string) (err error) {
+	if err = execStmtTx(tx, "DELETE FROM attribute_views WHERE id = ?", avID); nil != err {
+		return
+	}
+	if err = execStmtTx(tx, "DELETE FROM av_keys WHERE av_id = ?", avID); nil != err {
+		return
+	}
+	err = execStmtTx(tx, "DELETE FROM av_values WHERE av_id = ?", avID)
+	return
+}
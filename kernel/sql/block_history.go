@@ -0,0 +1,138 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/siyuan-note/logging"
+)
+
+// BlockHistory 描述了事务对一个块的一次修改。
+type BlockHistory struct {
+	ID          string `json:"id"`          // 块 ID
+	RootID      string `json:"rootID"`      // 文档 ID
+	Box         string `json:"box"`         // 笔记本 ID
+	Op          string `json:"op"`          // 事务操作，如 update、insert、delete、move
+	OldHash     string `json:"oldHash"`     // 修改前的 kramdown 哈希，新建时为空
+	NewHash     string `json:"newHash"`     // 修改后的 kramdown 哈希，删除时为空
+	OldKramdown string `json:"oldKramdown"` // 修改前的 kramdown
+	NewKramdown string `json:"newKramdown"` // 修改后的 kramdown
+	ParentID    string `json:"parentID"`    // 修改前的父块 ID，用于恢复已经删除的块
+	PreviousID  string `json:"previousID"`  // 修改前的前一个兄弟块 ID，用于恢复已经删除的块
+	Device      string `json:"device"`      // 设备 ID
+	DeviceName  string `json:"deviceName"`  // 设备名称
+	Session     string `json:"session"`     // 编辑器会话 ID
+	Created     int64  `json:"created"`     // 修改时间，单位为毫秒
+}
+
+const (
+	BlockHistoriesInsert      = "INSERT INTO block_histories (id, root_id, box, op, old_hash, new_hash, old_kramdown, new_kramdown, parent_id, previous_id, device, device_name, session, created) VALUES %s"
+	BlockHistoriesPlaceholder = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+)
+
+func initBlockHistoryTable() {
+	_, err := historyDB.Exec("CREATE TABLE IF NOT EXISTS block_histories (id, root_id, box, op, old_hash, new_hash, old_kramdown, new_kramdown, parent_id, previous_id, device, device_name, session, created)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [block_histories] failed: %s", err)
+	}
+	_, err = historyDB.Exec("CREATE INDEX IF NOT EXISTS idx_block_histories_id ON block_histories(id, created)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create index [idx_block_histories_id] failed: %s", err)
+	}
+}
+
+// GetBlockHistories 返回块的修改记录，按修改时间降序排列。
+func GetBlockHistories(id string, limit int) (ret []*BlockHistory) {
+	ret = []*BlockHistory{}
+	rows, err := queryHistory("SELECT id, root_id, box, op, old_hash, new_hash, old_kramdown, new_kramdown, parent_id, previous_id, device, device_name, session, created FROM block_histories WHERE id = ? ORDER BY created DESC LIMIT ?", id, limit)
+	if nil != err {
+		logging.LogErrorf("query block histories failed: %s", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if history := scanBlockHistoryRows(rows); nil != history {
+			ret = append(ret, history)
+		}
+	}
+	return
+}
+
+// GetBlockHistoryVersion 返回块的指定版本，以及该版本对应的修改记录。
+func GetBlockHistoryVersion(id, hash string) (kramdown string, history *BlockHistory) {
+	rows, err := queryHistory("SELECT id, root_id, box, op, old_hash, new_hash, old_kramdown, new_kramdown, parent_id, previous_id, device, device_name, session, created FROM block_histories WHERE id = ? AND (new_hash = ? OR old_hash = ?) ORDER BY created DESC LIMIT 1", id, hash, hash)
+	if nil != err {
+		logging.LogErrorf("query block history version failed: %s", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		history = scanBlockHistoryRows(rows)
+	}
+	if nil == history {
+		return
+	}
+
+	if hash == history.NewHash {
+		kramdown = history.NewKramdown
+	} else {
+		kramdown = history.OldKramdown
+	}
+	return
+}
+
+func scanBlockHistoryRows(rows *sql.Rows) (ret *BlockHistory) {
+	var history BlockHistory
+	if err := rows.Scan(&history.ID, &history.RootID, &history.Box, &history.Op, &history.OldHash, &history.NewHash, &history.OldKramdown, &history.NewKramdown, &history.ParentID, &history.PreviousID, &history.Device, &history.DeviceName, &history.Session, &history.Created); nil != err {
+		logging.LogErrorf("query scan field failed: %s\n%s", err, logging.ShortStack())
+		return
+	}
+	ret = &history
+	return
+}
+
+func IndexBlockHistoriesQueue(histories []*BlockHistory) {
+	historyDBQueueLock.Lock()
+	defer historyDBQueueLock.Unlock()
+
+	newOp := &historyDBQueueOperation{inQueueTime: time.Now(), action: "indexBlock", blockHistories: histories}
+	historyOperationQueue = append(historyOperationQueue, newOp)
+}
+
+func insertBlockHistories(tx *sql.Tx, histories []*BlockHistory) (err error) {
+	for i := 0; i < len(histories); i += 256 {
+		bulk := histories[i:min(i+256, len(histories))]
+		valueStrings := make([]string, 0, len(bulk))
+		valueArgs := make([]interface{}, 0, len(bulk)*strings.Count(BlockHistoriesPlaceholder, "?"))
+		for _, h := range bulk {
+			valueStrings = append(valueStrings, BlockHistoriesPlaceholder)
+			valueArgs = append(valueArgs, h.ID, h.RootID, h.Box, h.Op, h.OldHash, h.NewHash, h.OldKramdown, h.NewKramdown, h.ParentID, h.PreviousID, h.Device, h.DeviceName, h.Session, h.Created)
+		}
+
+		stmt := fmt.Sprintf(BlockHistoriesInsert, strings.Join(valueStrings, ","))
+		if err = prepareExecInsertTx(tx, stmt, valueArgs); nil != err {
+			return
+		}
+	}
+	return
+}
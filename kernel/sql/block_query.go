@@ -381,7 +381,12 @@ func QueryBookmarkLabels() (ret []string) {
 }
 
 func QueryNoLimit(stmt string) (ret []map[string]interface{}, err error) {
-	return queryRawStmt(stmt, math.MaxInt)
+	return queryRawStmt(stmt, math.MaxInt, false)
+}
+
+// QueryNoLimitReadOnly 在只读连接上执行单条 SELECT 或者 WITH 语句，用于执行包含用户输入的语句。
+func QueryNoLimitReadOnly(stmt string) (ret []map[string]interface{}, err error) {
+	return queryRawStmt(stmt, math.MaxInt, true)
 }
 
 func Query(stmt string, limit int) (ret []map[string]interface{}, err error) {
@@ -395,7 +400,7 @@ func Query(stmt string, limit int) (ret []map[string]interface{}, err error) {
 			// 这个解析器无法处理 || 连接字符串操作符
 			parsedStmt, err2 := sqlparser.Parse(stmt)
 			if nil != err2 {
-				return queryRawStmt(stmt, limit)
+				return queryRawStmt(stmt, limit, false)
 			}
 
 			switch parsedStmt.(type) {
@@ -411,10 +416,10 @@ func Query(stmt string, limit int) (ret []map[string]interface{}, err error) {
 				union.Limit = limitClause
 				stmt = sqlparser.String(union)
 			default:
-				return queryRawStmt(stmt, limit)
+				return queryRawStmt(stmt, limit, false)
 			}
 		} else {
-			return queryRawStmt(stmt, limit)
+			return queryRawStmt(stmt, limit, false)
 		}
 	} else {
 		switch parsedStmt2.(type) {
@@ -425,7 +430,7 @@ func Query(stmt string, limit int) (ret []map[string]interface{}, err error) {
 			}
 			stmt = slct.String()
 		default:
-			return queryRawStmt(stmt, limit)
+			return queryRawStmt(stmt, limit, false)
 		}
 	}
 
@@ -488,8 +493,8 @@ func getLimitClause(parsedStmt sqlparser.Statement, limit int) (ret *sqlparser.L
 	return
 }
 
-func queryRawStmt(stmt string, limit int) (ret []map[string]interface{}, err error) {
-	rows, err := query(stmt)
+func queryRawStmt(stmt string, limit int, readOnly bool) (ret []map[string]interface{}, err error) {
+	rows, err := queryStmt(stmt, readOnly)
 	if nil != err {
 		if strings.Contains(err.Error(), "syntax error") {
 			return
@@ -532,13 +537,28 @@ func queryRawStmt(stmt string, limit int) (ret []map[string]interface{}, err err
 }
 
 func SelectBlocksRawStmtNoParse(stmt string, limit int) (ret []*Block) {
-	return selectBlocksRawStmt(stmt, limit)
+	return selectBlocksRawStmt(stmt, limit, false)
+}
+
+// SelectBlocksRawStmtNoParseReadOnly 和 SelectBlocksRawStmtNoParse 一样，但是只允许在只读连接上执行单条 SELECT 或者 WITH 语句。
+func SelectBlocksRawStmtNoParseReadOnly(stmt string, limit int) (ret []*Block) {
+	return selectBlocksRawStmt(stmt, limit, true)
 }
 
 func SelectBlocksRawStmt(stmt string, page, limit int) (ret []*Block) {
+	return selectBlocksRawStmtPage(stmt, page, limit, false)
+}
+
+// SelectBlocksRawStmtReadOnly 和 SelectBlocksRawStmt 一样，但是只允许在只读连接上执行单条 SELECT 或者 WITH 语句，
+// 用于执行嵌入块、模板和搜索中由用户编写的语句。
+func SelectBlocksRawStmtReadOnly(stmt string, page, limit int) (ret []*Block) {
+	return selectBlocksRawStmtPage(stmt, page, limit, true)
+}
+
+func selectBlocksRawStmtPage(stmt string, page, limit int, readOnly bool) (ret []*Block) {
 	parsedStmt, err := sqlparser.Parse(stmt)
 	if nil != err {
-		return selectBlocksRawStmt(stmt, limit)
+		return selectBlocksRawStmt(stmt, limit, readOnly)
 	}
 
 	switch parsedStmt.(type) {
@@ -582,7 +602,7 @@ func SelectBlocksRawStmt(stmt string, page, limit int) (ret []*Block) {
 	stmt = strings.ReplaceAll(stmt, "\\\"", "\"")
 	stmt = strings.ReplaceAll(stmt, "\\\\*", "\\*")
 	stmt = strings.ReplaceAll(stmt, "from dual", "")
-	rows, err := query(stmt)
+	rows, err := queryStmt(stmt, readOnly)
 	if nil != err {
 		if strings.Contains(err.Error(), "syntax error") {
 			return
@@ -599,8 +619,8 @@ func SelectBlocksRawStmt(stmt string, page, limit int) (ret []*Block) {
 	return
 }
 
-func selectBlocksRawStmt(stmt string, limit int) (ret []*Block) {
-	rows, err := query(stmt)
+func selectBlocksRawStmt(stmt string, limit int, readOnly bool) (ret []*Block) {
+	rows, err := queryStmt(stmt, readOnly)
 	if nil != err {
 		if strings.Contains(err.Error(), "syntax error") {
 			return
@@ -215,6 +215,54 @@ func initDBTables() {
 	if nil != err {
 		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [refs] failed: %s", err)
 	}
+
+	_, err = db.Exec("DROP TABLE IF EXISTS attribute_views")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "drop table [attribute_views] failed: %s", err)
+	}
+	_, err = db.Exec("CREATE TABLE attribute_views (id, name, updated)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [attribute_views] failed: %s", err)
+	}
+
+	_, err = db.Exec("DROP TABLE IF EXISTS av_keys")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "drop table [av_keys] failed: %s", err)
+	}
+	_, err = db.Exec("CREATE TABLE av_keys (id, av_id, name, type, sort INTEGER)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [av_keys] failed: %s", err)
+	}
+	_, err = db.Exec("CREATE INDEX idx_av_keys_av_id ON av_keys(av_id)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create index [idx_av_keys_av_id] failed: %s", err)
+	}
+
+	_, err = db.Exec("DROP TABLE IF EXISTS av_values")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "drop table [av_values] failed: %s", err)
+	}
+	// number、date（毫秒时间戳）和 checked 使用数值类型，以便在 SQL 中比较
+	_, err = db.Exec("CREATE TABLE av_values (id, av_id, key_id, block_id, type, content, number REAL, date INTEGER, date_end INTEGER, checked INTEGER, created, updated)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [av_values] failed: %s", err)
+	}
+	_, err = db.Exec("CREATE INDEX idx_av_values_av_id ON av_values(av_id)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create index [idx_av_values_av_id] failed: %s", err)
+	}
+	_, err = db.Exec("CREATE INDEX idx_av_values_block_id ON av_values(block_id)")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create index [idx_av_values_block_id] failed: %s", err)
+	}
+
+	_, err = db.Exec("DROP TABLE IF EXISTS blocks_trigram")
+	if nil != err {
+		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "drop table [blocks_trigram] failed: %s", err)
+	}
+	if fuzzySearch {
+		initTrigramTable()
+	}
 }
 
 func initDBConnection() {
@@ -239,6 +287,8 @@ func initDBConnection() {
 	db.SetMaxIdleConns(20)
 	db.SetMaxOpenConns(20)
 	db.SetConnMaxLifetime(365 * 24 * time.Hour)
+
+	initReadOnlyDBConnection()
 }
 
 var initHistoryDatabaseLock = sync.Mutex{}
@@ -250,6 +300,7 @@ func InitHistoryDatabase(forceRebuild bool) {
 	initHistoryDBConnection()
 
 	if !forceRebuild && gulu.File.IsExist(util.HistoryDBPath) {
+		initBlockHistoryTable()
 		return
 	}
 
@@ -294,6 +345,7 @@ func initHistoryDBTables() {
 	if nil != err {
 		logging.LogFatalf(logging.ExitCodeReadOnlyDatabase, "create table [histories_fts_case_insensitive] failed: %s", err)
 	}
+	initBlockHistoryTable()
 }
 
 var initAssetContentDatabaseLock = sync.Mutex{}
@@ -1456,6 +1508,7 @@ func closeDatabase() (err error) {
 		return
 	}
 
+	closeReadOnlyDatabase()
 	err = db.Close()
 	debug.FreeOSMemory()
 	runtime.GC() // 没有这句的话文件句柄不会释放，后面就无法删除文件
@@ -0,0 +1,373 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/88250/gulu"
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// EmbeddingProvider 将文本转换为向量，返回的向量和输入的文本一一对应。
+type EmbeddingProvider func(texts []string) ([][]float32, error)
+
+// vectorEntry 描述了向量索引中的一个块。
+type vectorEntry struct {
+	ID     string    `msgpack:"id"`
+	RootID string    `msgpack:"rootID"`
+	Box    string    `msgpack:"box"`
+	Hash   string    `msgpack:"hash"`
+	Vector []float32 `msgpack:"vector"`
+}
+
+type vectorIndexData struct {
+	Model   string         `msgpack:"model"`
+	Entries []*vectorEntry `msgpack:"entries"`
+}
+
+type VectorHit struct {
+	ID    string
+	Score float64 // 余弦相似度
+}
+
+const (
+	embeddingBatchSize   = 32   // 每次请求向量化的块数
+	embeddingMaxRunes    = 2048 // 向量化的块内容最大长度
+	embeddingRetryPeriod = time.Minute
+)
+
+// embeddingBlockTypes 描述了需要向量化的块类型，容器块的内容和子块重复所以不需要向量化。
+var embeddingBlockTypes = map[string]bool{"d": true, "h": true, "p": true, "t": true, "c": true}
+
+var errEmbeddingCountMismatch = errors.New("embedding count mismatch")
+
+var (
+	vectorIndex        = map[string]*vectorEntry{}
+	vectorIndexModel   string
+	vectorIndexChanged bool
+	vectorIndexLoaded  bool
+	vectorIndexLock    = sync.RWMutex{}
+
+	embeddingQueue     = map[string]*Block{}
+	embeddingQueueLock = sync.Mutex{}
+
+	embeddingProvider     EmbeddingProvider
+	embeddingProviderLock = sync.RWMutex{}
+	embeddingFailedTime   time.Time // 最近一次向量化失败的时间，和 embeddingProvider 一样由 embeddingProviderLock 保护
+)
+
+// SetEmbeddingProvider 设置向量化服务，provider 为 nil 时关闭向量化。model 用于标识向量空间，变更后会清空已有的向量索引并重新向量化。
+func SetEmbeddingProvider(model string, provider EmbeddingProvider) {
+	embeddingProviderLock.Lock()
+	embeddingProvider = provider
+	embeddingFailedTime = time.Time{}
+	embeddingProviderLock.Unlock()
+
+	if nil == provider {
+		return
+	}
+
+	loadVectorIndex()
+	vectorIndexLock.Lock()
+	if model != vectorIndexModel {
+		if 0 < len(vectorIndex) {
+			logging.LogInfof("embedding model changed [%s -> %s], clear vector index", vectorIndexModel, model)
+		}
+		vectorIndex = map[string]*vectorEntry{}
+		vectorIndexModel = model
+		vectorIndexChanged = true
+	}
+	vectorIndexLock.Unlock()
+
+	go EmbeddingFullQueue()
+}
+
+func getEmbeddingProvider() EmbeddingProvider {
+	embeddingProviderLock.RLock()
+	defer embeddingProviderLock.RUnlock()
+	return embeddingProvider
+}
+
+func IsEmbeddingEnabled() bool {
+	return nil != getEmbeddingProvider()
+}
+
+// EmbeddingFullQueue 将向量索引中缺失或者已经过期的块加入向量化队列。
+func EmbeddingFullQueue() {
+	if !IsEmbeddingEnabled() {
+		return
+	}
+
+	var types []string
+	for t := range embeddingBlockTypes {
+		types = append(types, "'"+t+"'")
+	}
+	sort.Strings(types)
+	rows, err := query("SELECT id, parent_id, root_id, hash, box, path, hpath, name, alias, memo, tag, content, fcontent, markdown, length, type, subtype, ial, sort, created, updated FROM blocks WHERE type IN (" + strings.Join(types, ",") + ")")
+	if nil != err {
+		logging.LogErrorf("query blocks for embedding failed: %s", err)
+		return
+	}
+	defer rows.Close()
+
+	var blocks []*Block
+	for rows.Next() {
+		if block := scanBlockRows(rows); nil != block {
+			blocks = append(blocks, block)
+		}
+	}
+	queueEmbeddingBlocks(blocks)
+}
+
+// queueEmbeddingBlocks 将写入数据库的块加入向量化队列，向量索引中哈希一致的块会被跳过。
+func queueEmbeddingBlocks(blocks []*Block) {
+	if !IsEmbeddingEnabled() {
+		return
+	}
+
+	vectorIndexLock.RLock()
+	var toEmbeds []*Block
+	for _, block := range blocks {
+		if !embeddingBlockTypes[block.Type] || "" == strings.TrimSpace(block.Content) {
+			continue
+		}
+		if entry := vectorIndex[block.ID]; nil != entry && entry.Hash == block.Hash {
+			continue
+		}
+		toEmbeds = append(toEmbeds, block)
+	}
+	vectorIndexLock.RUnlock()
+
+	embeddingQueueLock.Lock()
+	for _, block := range toEmbeds {
+		embeddingQueue[block.ID] = block
+	}
+	embeddingQueueLock.Unlock()
+}
+
+// EmbeddingJob 分批向量化队列中的块，并持久化向量索引。
+func EmbeddingJob() {
+	provider := getEmbeddingProvider()
+	if nil == provider {
+		saveVectorIndex()
+		return
+	}
+
+	embeddingProviderLock.RLock()
+	failedTime := embeddingFailedTime
+	embeddingProviderLock.RUnlock()
+	if time.Since(failedTime) < embeddingRetryPeriod {
+		return
+	}
+
+	for i := 0; i < 16 && !util.IsExiting.Load(); i++ {
+		var blocks []*Block
+		embeddingQueueLock.Lock()
+		for id, block := range embeddingQueue {
+			blocks = append(blocks, block)
+			delete(embeddingQueue, id)
+			if embeddingBatchSize <= len(blocks) {
+				break
+			}
+		}
+		embeddingQueueLock.Unlock()
+		if 1 > len(blocks) {
+			break
+		}
+
+		var texts []string
+		for _, block := range blocks {
+			texts = append(texts, EmbeddingText(block.Content))
+		}
+		vectors, err := provider(texts)
+		if nil == err && len(vectors) != len(blocks) {
+			err = errEmbeddingCountMismatch
+		}
+		if nil != err {
+			logging.LogErrorf("embedding [%d] blocks failed: %s", len(blocks), err)
+			embeddingProviderLock.Lock()
+			embeddingFailedTime = time.Now()
+			embeddingProviderLock.Unlock()
+			queueEmbeddingBlocks(blocks)
+			break
+		}
+
+		vectorIndexLock.Lock()
+		for j, block := range blocks {
+			if 1 > len(vectors[j]) {
+				continue
+			}
+			vectorIndex[block.ID] = &vectorEntry{ID: block.ID, RootID: block.RootID, Box: block.Box, Hash: block.Hash, Vector: normalizeVector(vectors[j])}
+		}
+		vectorIndexChanged = true
+		vectorIndexLock.Unlock()
+	}
+	saveVectorIndex()
+}
+
+// EmbeddingText 返回用于向量化的文本。
+func EmbeddingText(content string) string {
+	content = strings.TrimSpace(strings.ReplaceAll(content, "\n", " "))
+	if runes := []rune(content); embeddingMaxRunes < len(runes) {
+		content = string(runes[:embeddingMaxRunes])
+	}
+	return content
+}
+
+// SearchVectors 返回和 vector 最相似的 limit 个块，相似度从高到低排列。
+func SearchVectors(vector []float32, minScore float64, limit int) (ret []*VectorHit) {
+	vector = normalizeVector(vector)
+	vectorIndexLock.RLock()
+	for id, entry := range vectorIndex {
+		if len(entry.Vector) != len(vector) {
+			continue
+		}
+		if score := dotProduct(vector, entry.Vector); score >= minScore {
+			ret = append(ret, &VectorHit{ID: id, Score: score})
+		}
+	}
+	vectorIndexLock.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Score > ret[j].Score })
+	if 0 < limit && limit < len(ret) {
+		ret = ret[:limit]
+	}
+	return
+}
+
+// GetVectorScores 返回 vector 和指定块的相似度，没有向量的块不会出现在结果中。
+func GetVectorScores(vector []float32, ids []string) (ret map[string]float64) {
+	ret = map[string]float64{}
+	vector = normalizeVector(vector)
+	vectorIndexLock.RLock()
+	defer vectorIndexLock.RUnlock()
+	for _, id := range ids {
+		if entry := vectorIndex[id]; nil != entry && len(entry.Vector) == len(vector) {
+			ret[id] = dotProduct(vector, entry.Vector)
+		}
+	}
+	return
+}
+
+// RemoveVectors 从向量索引中移除已经不存在的块。
+func RemoveVectors(ids []string) {
+	vectorIndexLock.Lock()
+	defer vectorIndexLock.Unlock()
+	for _, id := range ids {
+		if nil != vectorIndex[id] {
+			delete(vectorIndex, id)
+			vectorIndexChanged = true
+		}
+	}
+}
+
+func normalizeVector(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if 0 == sum {
+		return vector
+	}
+
+	norm := math.Sqrt(sum)
+	ret := make([]float32, len(vector))
+	for i, v := range vector {
+		ret[i] = float32(float64(v) / norm)
+	}
+	return ret
+}
+
+func dotProduct(a, b []float32) (ret float64) {
+	for i := range a {
+		ret += float64(a[i]) * float64(b[i])
+	}
+	return
+}
+
+func getVectorIndexPath() string {
+	return filepath.Join(util.TempDir, "vectors.msgpack")
+}
+
+func loadVectorIndex() {
+	vectorIndexLock.Lock()
+	defer vectorIndexLock.Unlock()
+
+	if vectorIndexLoaded {
+		return
+	}
+	vectorIndexLoaded = true
+
+	p := getVectorIndexPath()
+	if !gulu.File.IsExist(p) {
+		return
+	}
+
+	data, err := os.ReadFile(p)
+	if nil != err {
+		logging.LogErrorf("read vector index [%s] failed: %s", p, err)
+		return
+	}
+
+	indexData := &vectorIndexData{}
+	if err = msgpack.Unmarshal(data, indexData); nil != err {
+		logging.LogErrorf("unmarshal vector index [%s] failed: %s", p, err)
+		return
+	}
+
+	vectorIndexModel = indexData.Model
+	for _, entry := range indexData.Entries {
+		vectorIndex[entry.ID] = entry
+	}
+	logging.LogInfof("loaded vector index [model=%s, count=%d]", vectorIndexModel, len(vectorIndex))
+}
+
+func saveVectorIndex() {
+	vectorIndexLock.Lock()
+	defer vectorIndexLock.Unlock()
+
+	if !vectorIndexChanged {
+		return
+	}
+
+	indexData := &vectorIndexData{Model: vectorIndexModel}
+	for _, entry := range vectorIndex {
+		indexData.Entries = append(indexData.Entries, entry)
+	}
+	data, err := msgpack.Marshal(indexData)
+	if nil != err {
+		logging.LogErrorf("marshal vector index failed: %s", err)
+		return
+	}
+
+	p := getVectorIndexPath()
+	if err = gulu.File.WriteFileSafer(p, data, 0644); nil != err {
+		logging.LogErrorf("write vector index [%s] failed: %s", p, err)
+		return
+	}
+	vectorIndexChanged = false
+}
@@ -0,0 +1,84 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"github.com/siyuan-note/logging"
+)
+
+var fuzzySearch bool
+
+// blocksTrigramTriggers 通过触发器让 blocks_trigram 和 blocks 保持一致，两表使用相同的 rowid。
+var blocksTrigramTriggers = []string{
+	"CREATE TRIGGER IF NOT EXISTS blocks_trigram_insert AFTER INSERT ON blocks BEGIN " +
+		"INSERT INTO blocks_trigram (rowid, id, root_id, box, path, type, name, alias, content) VALUES (new.rowid, new.id, new.root_id, new.box, new.path, new.type, new.name, new.alias, new.content); END",
+	"CREATE TRIGGER IF NOT EXISTS blocks_trigram_delete AFTER DELETE ON blocks BEGIN " +
+		"DELETE FROM blocks_trigram WHERE rowid = old.rowid; END",
+	"CREATE TRIGGER IF NOT EXISTS blocks_trigram_update AFTER UPDATE ON blocks BEGIN " +
+		"UPDATE blocks_trigram SET id = new.id, root_id = new.root_id, box = new.box, path = new.path, type = new.type, name = new.name, alias = new.alias, content = new.content WHERE rowid = old.rowid; END",
+}
+
+// SetFuzzySearch 开启或关闭模糊搜索。开启时创建三元组（trigram）索引表 blocks_trigram，关闭时删除该表以节省空间。
+func SetFuzzySearch(b bool) {
+	fuzzySearch = b
+	if b {
+		initTrigramTable()
+	} else {
+		dropTrigramTable()
+	}
+}
+
+func IsFuzzySearch() bool {
+	return fuzzySearch
+}
+
+func initTrigramTable() {
+	var name string
+	exist := nil == db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'blocks_trigram'").Scan(&name)
+	if !exist {
+		if _, err := db.Exec("CREATE VIRTUAL TABLE blocks_trigram USING fts5(id UNINDEXED, root_id UNINDEXED, box UNINDEXED, path UNINDEXED, type UNINDEXED, name, alias, content, tokenize=\"trigram\")"); nil != err {
+			logging.LogErrorf("create table [blocks_trigram] failed: %s", err)
+			return
+		}
+	}
+
+	for _, trigger := range blocksTrigramTriggers {
+		if _, err := db.Exec(trigger); nil != err {
+			logging.LogErrorf("create trigger failed: %s", err)
+			return
+		}
+	}
+
+	if !exist {
+		if _, err := db.Exec("INSERT INTO blocks_trigram (rowid, id, root_id, box, path, type, name, alias, content) SELECT rowid, id, root_id, box, path, type, name, alias, content FROM blocks"); nil != err {
+			logging.LogErrorf("init table [blocks_trigram] failed: %s", err)
+			return
+		}
+		logging.LogInfof("initialized table [blocks_trigram]")
+	}
+}
+
+func dropTrigramTable() {
+	for _, trigger := range []string{"blocks_trigram_insert", "blocks_trigram_delete", "blocks_trigram_update"} {
+		if _, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger); nil != err {
+			logging.LogErrorf("drop trigger [%s] failed: %s", trigger, err)
+		}
+	}
+	if _, err := db.Exec("DROP TABLE IF EXISTS blocks_trigram"); nil != err {
+		logging.LogErrorf("drop table [blocks_trigram] failed: %s", err)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/siyuan-note/eventbus"
@@ -104,10 +105,25 @@ func queryHistory(query string, args ...interface{}) (*sql.Rows, error) {
 	return historyDB.Query(query, args...)
 }
 
-func deleteOutdatedHistories(tx *sql.Tx, before string, context map[string]interface{}) (err error) {
-	stmt := "DELETE FROM histories_fts_case_insensitive WHERE created < ?"
-	if err = execStmtTx(tx, stmt, before); nil != err {
-		return
+func deleteBlockHistoriesBefore(tx *sql.Tx, before string) (err error) {
+	// before 的时间单位为秒，块修改记录的时间单位为毫秒
+	beforeSeconds, _ := strconv.ParseInt(before, 10, 64)
+	stmt := "DELETE FROM block_histories WHERE created < ?"
+	err = execStmtTx(tx, stmt, beforeSeconds*1000)
+	return
+}
+
+func deleteHistoriesByPaths(tx *sql.Tx, paths []string) (err error) {
+	for i := 0; i < len(paths); i += 512 {
+		bulk := paths[i:min(i+512, len(paths))]
+		args := make([]interface{}, 0, len(bulk))
+		for _, p := range bulk {
+			args = append(args, p)
+		}
+		stmt := "DELETE FROM histories_fts_case_insensitive WHERE path IN (?" + strings.Repeat(", ?", len(bulk)-1) + ")"
+		if err = execStmtTx(tx, stmt, args...); nil != err {
+			return
+		}
 	}
 	return
 }
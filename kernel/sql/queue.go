@@ -40,7 +40,7 @@ var (
 
 type dbQueueOperation struct {
 	inQueueTime                   time.Time
-	action                        string      // upsert/delete/delete_id/rename/rename_sub_tree/delete_box/delete_box_refs/insert_refs/index/delete_ids/update_block_content/delete_assets
+	action                        string      // upsert/delete/delete_id/rename/rename_sub_tree/delete_box/delete_box_refs/insert_refs/index/delete_ids/update_block_content/delete_assets/index_av/delete_av
 	indexTree                     *parse.Tree // index
 	upsertTree                    *parse.Tree // upsert/insert_refs/update_refs/delete_refs
 	removeTreeBox, removeTreePath string      // delete
@@ -51,6 +51,7 @@ type dbQueueOperation struct {
 	block                         *Block      // update_block_content
 	id                            string      // index_node
 	removeAssetHashes             []string    // delete_assets
+	avID                          string      // index_av/delete_av
 }
 
 func FlushTxJob() {
@@ -159,6 +160,7 @@ func FlushQueue() {
 
 	// Push database index commit event https://github.com/siyuan-note/siyuan/issues/8814
 	util.BroadcastByType("main", "databaseIndexCommit", 0, "", nil)
+	eventbus.Publish(util.EvtSQLIndexCommitted)
 }
 
 func execOp(op *dbQueueOperation, tx *sql.Tx, context map[string]interface{}) (err error) {
@@ -197,6 +199,10 @@ func execOp(op *dbQueueOperation, tx *sql.Tx, context map[string]interface{}) (e
 		err = deleteAssetsByHashes(tx, op.removeAssetHashes)
 	case "index_node":
 		err = indexNode(tx, op.id)
+	case "index_av":
+		err = indexAttributeView(tx, op.avID)
+	case "delete_av":
+		err = deleteAttributeView(tx, op.avID)
 	default:
 		msg := fmt.Sprintf("unknown operation [%s]", op.action)
 		logging.LogErrorf(msg)
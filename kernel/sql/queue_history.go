@@ -38,10 +38,12 @@ var (
 
 type historyDBQueueOperation struct {
 	inQueueTime time.Time
-	action      string // index/deleteOutdated
+	action      string // index/indexBlock/deleteOutdated/deletePaths/deleteBlockBefore
 
-	histories []*History // index
-	before    string     // deleteOutdated
+	histories      []*History      // index
+	blockHistories []*BlockHistory // indexBlock
+	before         string          // deleteOutdated/deleteBlockBefore
+	paths          []string        // deletePaths
 }
 
 func FlushHistoryTxJob() {
@@ -111,8 +113,12 @@ func execHistoryOp(op *historyDBQueueOperation, tx *sql.Tx, context map[string]i
 	switch op.action {
 	case "index":
 		err = insertHistories(tx, op.histories, context)
-	case "deleteOutdated":
-		err = deleteOutdatedHistories(tx, op.before, context)
+	case "indexBlock":
+		err = insertBlockHistories(tx, op.blockHistories)
+	case "deletePaths":
+		err = deleteHistoriesByPaths(tx, op.paths)
+	case "deleteBlockBefore":
+		err = deleteBlockHistoriesBefore(tx, op.before)
 	default:
 		msg := fmt.Sprintf("unknown history operation [%s]", op.action)
 		logging.LogErrorf(msg)
@@ -121,11 +127,19 @@ func execHistoryOp(op *historyDBQueueOperation, tx *sql.Tx, context map[string]i
 	return
 }
 
-func DeleteOutdatedHistories(before string) {
+func DeleteHistoriesByPathsQueue(paths []string) {
 	historyDBQueueLock.Lock()
 	defer historyDBQueueLock.Unlock()
 
-	newOp := &historyDBQueueOperation{inQueueTime: time.Now(), action: "deleteOutdated", before: before}
+	newOp := &historyDBQueueOperation{inQueueTime: time.Now(), action: "deletePaths", paths: paths}
+	historyOperationQueue = append(historyOperationQueue, newOp)
+}
+
+func DeleteBlockHistoriesBeforeQueue(before string) {
+	historyDBQueueLock.Lock()
+	defer historyDBQueueLock.Unlock()
+
+	newOp := &historyDBQueueOperation{inQueueTime: time.Now(), action: "deleteBlockBefore", before: before}
 	historyOperationQueue = append(historyOperationQueue, newOp)
 }
 
@@ -0,0 +1,246 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/siyuan-community/siyuan/kernel/util"
+	"github.com/siyuan-note/logging"
+)
+
+var (
+	ErrStmtNotReadOnly  = errors.New("only a single SELECT or WITH statement is allowed")
+	ErrStmtMultiple     = errors.New("multiple statements are not allowed")
+	ErrQueryTimeout     = errors.New("query timeout")
+	ErrReadOnlyDBClosed = errors.New("read-only database is not ready")
+)
+
+// readOnlyDB 是设置了 PRAGMA query_only 的连接，用于执行外部提交的查询，即使语句检查被绕过也无法修改数据库。
+var readOnlyDB *sql.DB
+
+func initReadOnlyDBConnection() {
+	if nil != readOnlyDB {
+		readOnlyDB.Close()
+	}
+	dsn := util.DBPath + "?_journal_mode=WAL" +
+		"&_busy_timeout=7000" +
+		"&_temp_store=MEMORY" +
+		"&_case_sensitive_like=OFF" +
+		"&_query_only=true"
+	var err error
+	readOnlyDB, err = sql.Open("sqlite3_extended", dsn)
+	if nil != err {
+		logging.LogErrorf("create read-only database failed: %s", err)
+		readOnlyDB = nil
+		return
+	}
+	readOnlyDB.SetMaxIdleConns(2)
+	readOnlyDB.SetMaxOpenConns(4)
+	readOnlyDB.SetConnMaxLifetime(365 * 24 * time.Hour)
+}
+
+func closeReadOnlyDatabase() {
+	if nil != readOnlyDB {
+		readOnlyDB.Close()
+		readOnlyDB = nil
+	}
+}
+
+// QueryArgs 使用绑定参数执行查询。
+//
+// readOnly 为 true 时只允许执行单条 SELECT 或者 WITH 语句，并且在只读连接上执行；
+// 语句中没有 LIMIT 子句时最多返回 limit 行，任何情况下最多返回 maxRows 行；timeout 为 0 时不限制执行时间。
+func QueryArgs(stmt string, args []interface{}, readOnly bool, limit, maxRows int, timeout time.Duration) (ret []map[string]interface{}, err error) {
+	ret = []map[string]interface{}{}
+	stmt = strings.TrimSpace(stmt)
+	if "" == stmt {
+		err = errors.New("statement is empty")
+		return
+	}
+
+	conn := db
+	if readOnly {
+		if err = CheckReadOnlyStmt(stmt); nil != err {
+			return
+		}
+		if conn = readOnlyDB; nil == conn {
+			err = ErrReadOnlyDBClosed
+			return
+		}
+	}
+
+	rowCap := maxRows
+	if !containsLimitClause(stmt) && 0 < limit && (1 > rowCap || limit < rowCap) {
+		rowCap = limit
+	}
+	return queryContext(conn, stmt, args, rowCap, timeout)
+}
+
+// queryStmt 执行查询，readOnly 为 true 时只允许在只读连接上执行单条 SELECT 或者 WITH 语句。
+func queryStmt(stmt string, readOnly bool) (*sql.Rows, error) {
+	if !readOnly {
+		return query(stmt)
+	}
+
+	stmt = strings.TrimSpace(stmt)
+	if "" == stmt {
+		return nil, errors.New("statement is empty")
+	}
+	if err := CheckReadOnlyStmt(stmt); nil != err {
+		return nil, err
+	}
+	if nil == readOnlyDB {
+		return nil, ErrReadOnlyDBClosed
+	}
+	return readOnlyDB.Query(stmt)
+}
+
+// ExplainQueryPlan 返回 EXPLAIN QUERY PLAN 的结果，语句不会被执行。
+func ExplainQueryPlan(stmt string, args []interface{}, timeout time.Duration) (ret []map[string]interface{}, err error) {
+	ret = []map[string]interface{}{}
+	stmt = strings.TrimSpace(stmt)
+	if err = checkSingleStmt(stmt); nil != err {
+		return
+	}
+	if nil == readOnlyDB {
+		err = ErrReadOnlyDBClosed
+		return
+	}
+	return queryContext(readOnlyDB, "EXPLAIN QUERY PLAN "+stmt, args, 0, timeout)
+}
+
+func queryContext(conn *sql.DB, stmt string, args []interface{}, rowCap int, timeout time.Duration) (ret []map[string]interface{}, err error) {
+	ret = []map[string]interface{}{}
+	ctx := context.Background()
+	if 0 < timeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if nil != err && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = ErrQueryTimeout
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, stmt, args...)
+	if nil != err {
+		return
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if nil != err || nil == cols {
+		return
+	}
+
+	for rows.Next() {
+		columns := make([]interface{}, len(cols))
+		columnPointers := make([]interface{}, len(cols))
+		for i := range columns {
+			columnPointers[i] = &columns[i]
+		}
+
+		if err = rows.Scan(columnPointers...); nil != err {
+			return
+		}
+
+		m := make(map[string]interface{})
+		for i, colName := range cols {
+			val := columnPointers[i].(*interface{})
+			m[colName] = *val
+		}
+		ret = append(ret, m)
+		if 0 < rowCap && rowCap <= len(ret) {
+			break
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// CheckReadOnlyStmt 检查语句是否是单条 SELECT 或者 WITH 语句。
+func CheckReadOnlyStmt(stmt string) (err error) {
+	if err = checkSingleStmt(stmt); nil != err {
+		return
+	}
+
+	code := strings.TrimSpace(stripStmtLiterals(stmt))
+	end := strings.IndexFunc(code, func(r rune) bool { return !unicode.IsLetter(r) })
+	if 0 > end {
+		end = len(code)
+	}
+	switch strings.ToUpper(code[:end]) {
+	case "SELECT", "WITH":
+		return
+	}
+	return ErrStmtNotReadOnly
+}
+
+func checkSingleStmt(stmt string) error {
+	code := strings.TrimSpace(stripStmtLiterals(stmt))
+	code = strings.TrimRight(code, "; \t\r\n")
+	if strings.Contains(code, ";") {
+		return ErrStmtMultiple
+	}
+	return nil
+}
+
+// stripStmtLiterals 将语句中的字符串、标识符和注释替换为空格，以便检查语句结构。
+func stripStmtLiterals(stmt string) string {
+	buf := strings.Builder{}
+	runes := []rune(stmt)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case '\'' == r || '"' == r || '`' == r || '[' == r:
+			closing := r
+			if '[' == r {
+				closing = ']'
+			}
+			for i++; i < len(runes); i++ {
+				if runes[i] == closing {
+					if ']' != closing && i+1 < len(runes) && runes[i+1] == closing { // 转义的引号
+						i++
+						continue
+					}
+					break
+				}
+			}
+			buf.WriteByte(' ')
+		case '-' == r && i+1 < len(runes) && '-' == runes[i+1]:
+			for i += 2; i < len(runes) && '\n' != runes[i]; i++ {
+			}
+			buf.WriteByte(' ')
+		case '/' == r && i+1 < len(runes) && '*' == runes[i+1]:
+			for i += 2; i+1 < len(runes) && !('*' == runes[i] && '/' == runes[i+1]); i++ {
+			}
+			i++
+			buf.WriteByte(' ')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,107 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sql
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/siyuan-community/siyuan/kernel/util"
+)
+
+func TestCheckReadOnlyStmt(t *testing.T) {
+	cases := []struct {
+		stmt string
+		err  error
+	}{
+		{"SELECT * FROM blocks", nil},
+		{"  select * from blocks;", nil},
+		{"WITH t AS (SELECT id FROM blocks) SELECT * FROM t", nil},
+		{"SELECT * FROM blocks WHERE content = 'a; DELETE FROM blocks'", nil},
+		{"SELECT * FROM blocks -- ; DELETE FROM blocks", nil},
+		{"SELECT * FROM blocks; DELETE FROM blocks", ErrStmtMultiple},
+		{"DELETE FROM blocks", ErrStmtNotReadOnly},
+		{"UPDATE blocks SET content = ''", ErrStmtNotReadOnly},
+		{"INSERT INTO blocks (id) VALUES ('a')", ErrStmtNotReadOnly},
+		{"DROP TABLE blocks", ErrStmtNotReadOnly},
+		{"PRAGMA query_only = false", ErrStmtNotReadOnly},
+		{"ATTACH DATABASE 'a.db' AS a", ErrStmtNotReadOnly},
+		{"/* SELECT */ DELETE FROM blocks", ErrStmtNotReadOnly},
+	}
+
+	for _, c := range cases {
+		if err := CheckReadOnlyStmt(c.stmt); err != c.err {
+			t.Errorf("statement [%s]: expected [%v], got [%v]", c.stmt, c.err, err)
+		}
+	}
+}
+
+func TestReadOnlyQueries(t *testing.T) {
+	dbPath := util.DBPath
+	util.DBPath = filepath.Join(t.TempDir(), "siyuan.db")
+	defer func() {
+		closeDatabase()
+		db = nil
+		util.DBPath = dbPath
+	}()
+
+	// 只创建查询用到的表，全文索引表依赖 fts5 构建标签
+	initDBConnection()
+	for _, stmt := range []string{
+		"CREATE TABLE blocks (id, parent_id, root_id, hash, box, path, hpath, name, alias, memo, tag, content, fcontent, markdown, length, type, subtype, ial, sort, created, updated)",
+		"CREATE TABLE spans (id, block_id, root_id, box, path, content, markdown, type, ial)",
+	} {
+		if _, err := db.Exec(stmt); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO blocks VALUES ('20240101000000-aaaaaaa', '', '20240101000000-aaaaaaa', '', '', '', '', '', '', '', '', 'foo', '', '', 3, 'd', '', '', 0, '20240101000000', '20240101000000')"); nil != err {
+		t.Fatal(err)
+	}
+
+	if blocks := SelectBlocksRawStmtReadOnly("SELECT * FROM blocks", 1, 10); 1 != len(blocks) {
+		t.Fatalf("expected 1 block, got [%d]", len(blocks))
+	}
+	if rows, err := QueryNoLimitReadOnly("SELECT COUNT(*) AS c FROM blocks"); nil != err || 1 != len(rows) {
+		t.Fatalf("count blocks failed: %v", err)
+	}
+
+	writes := []func() bool{
+		func() bool { return nil == SelectBlocksRawStmtReadOnly("DELETE FROM blocks", 1, 10) },
+		func() bool {
+			return nil == SelectBlocksRawStmtNoParseReadOnly("SELECT * FROM blocks; DELETE FROM blocks", 10)
+		},
+		func() bool { return nil == SelectSpansRawStmtReadOnly("DELETE FROM spans", 10) },
+		func() bool { _, err := QueryNoLimitReadOnly("UPDATE blocks SET content = 'bar'"); return nil != err },
+		func() bool { _, err := QueryArgs("DELETE FROM blocks", nil, true, 10, 10, 0); return nil != err },
+	}
+	for i, write := range writes {
+		if !write() {
+			t.Errorf("write [%d] should be rejected", i)
+		}
+	}
+
+	// 语句检查允许 WITH 开头的语句，这类语句中的写入由只读连接拒绝
+	if _, err := readOnlyDB.Exec("WITH t AS (SELECT 1) DELETE FROM blocks"); nil == err {
+		t.Errorf("read-only connection should reject writes")
+	}
+
+	rows, err := QueryNoLimit("SELECT content FROM blocks")
+	if nil != err || 1 != len(rows) || "foo" != rows[0]["content"] {
+		t.Fatalf("blocks changed by read-only queries: %v %v", rows, err)
+	}
+}
@@ -38,6 +38,15 @@ type Span struct {
 }
 
 func SelectSpansRawStmt(stmt string, limit int) (ret []*Span) {
+	return selectSpansRawStmt(stmt, limit, false)
+}
+
+// SelectSpansRawStmtReadOnly 和 SelectSpansRawStmt 一样，但是只允许在只读连接上执行单条 SELECT 或者 WITH 语句。
+func SelectSpansRawStmtReadOnly(stmt string, limit int) (ret []*Span) {
+	return selectSpansRawStmt(stmt, limit, true)
+}
+
+func selectSpansRawStmt(stmt string, limit int, readOnly bool) (ret []*Span) {
 	parsedStmt, err := sqlparser.Parse(stmt)
 	if nil != err {
 		//logging.LogErrorf("select [%s] failed: %s", stmt, err)
@@ -64,7 +73,7 @@ func SelectSpansRawStmt(stmt string, limit int) (ret []*Span) {
 	stmt = strings.ReplaceAll(stmt, "\\\"", "\"")
 	stmt = strings.ReplaceAll(stmt, "\\\\*", "\\*")
 	stmt = strings.ReplaceAll(stmt, "from dual", "")
-	rows, err := query(stmt)
+	rows, err := queryStmt(stmt, readOnly)
 	if nil != err {
 		if strings.Contains(err.Error(), "syntax error") {
 			return
@@ -79,6 +79,7 @@ func insertBlocks(tx *sql.Tx, blocks []*Block, context map[string]interface{}) (
 			return
 		}
 	}
+	queueEmbeddingBlocks(blocks)
 	return
 }
 
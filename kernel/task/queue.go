@@ -18,11 +18,17 @@ package task
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime/debug"
 	"sync"
 	"time"
 
 	"github.com/88250/gulu"
+	"github.com/88250/lute/ast"
 	"github.com/siyuan-community/siyuan/kernel/util"
 	"github.com/siyuan-note/logging"
 )
@@ -32,49 +38,97 @@ var (
 	queueLock = sync.Mutex{}
 )
 
+const (
+	StatePending  = "pending"  // 排队中
+	StateRunning  = "running"  // 执行中
+	StateFailed   = "failed"   // 执行失败（包括超时）
+	StateCanceled = "canceled" // 已取消
+)
+
+var (
+	ErrTaskNotFound      = errors.New("task not found")
+	ErrTaskNotCancelable = errors.New("task can not be canceled")
+	ErrTaskNotRetryable  = errors.New("task can not be retried")
+	ErrTaskExists        = errors.New("task is already in queue")
+)
+
 type Task struct {
-	Action  string
-	Handler reflect.Value
-	Args    []interface{}
-	Created time.Time
-	Timeout time.Duration
+	ID      string        `json:"id"`
+	Action  string        `json:"action"`
+	Name    string        `json:"name"` // 任务的本地化名称，仅用于展示
+	Handler reflect.Value `json:"-"`
+	Args    []interface{} `json:"args"`
+	Created time.Time     `json:"created"`
+	Timeout time.Duration `json:"timeout"`
+
+	State      string    `json:"state"`
+	Started    time.Time `json:"started"`
+	Ended      time.Time `json:"ended"`
+	Current    int       `json:"current"`    // 当前进度
+	Total      int       `json:"total"`      // 总进度，为 0 时表示进度未知
+	Error      string    `json:"error"`      // 失败或取消的原因
+	Cancelable bool      `json:"cancelable"` // 执行中是否可以取消，处理函数的第一个参数为 context.Context 时可以取消
+
+	cancel context.CancelFunc
 }
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 func AppendTask(action string, handler interface{}, args ...interface{}) {
 	AppendTaskWithTimeout(action, 24*time.Hour, handler, args...)
 }
 
+// AppendTaskWithTimeout 添加任务到队列。
+// 如果处理函数的第一个参数为 context.Context，执行时会传入任务的上下文（args 中不需要包含该参数），处理函数需要在上下文取消后尽快返回；
+// 如果处理函数的最后一个返回值为 error，返回非 nil 时任务会被标记为执行失败。
 func AppendTaskWithTimeout(action string, timeout time.Duration, handler interface{}, args ...interface{}) {
 	if util.IsExiting.Load() {
 		//logging.LogWarnf("task queue is paused, action [%s] will be ignored", action)
 		return
 	}
 
+	appendTask(newTask(ast.NewNodeID(), action, timeout, reflect.ValueOf(handler), args))
+}
+
+func newTask(id, action string, timeout time.Duration, handler reflect.Value, args []interface{}) *Task {
+	handlerType := handler.Type()
+	return &Task{
+		ID:         id,
+		Action:     action,
+		Timeout:    timeout,
+		Handler:    handler,
+		Args:       args,
+		Created:    time.Now(),
+		State:      StatePending,
+		Cancelable: 0 < handlerType.NumIn() && contextType == handlerType.In(0),
+	}
+}
+
+func appendTask(task *Task) bool {
 	currentActions := getCurrentActions()
-	if gulu.Str.Contains(action, currentActions) && gulu.Str.Contains(action, uniqueActions) {
+	if gulu.Str.Contains(task.Action, currentActions) && gulu.Str.Contains(task.Action, uniqueActions) {
 		//logging.LogWarnf("task [%s] is already in queue, will be ignored", action)
-		return
+		return false
 	}
 
 	queueLock.Lock()
-	defer queueLock.Unlock()
-	taskQueue = append(taskQueue, &Task{
-		Action:  action,
-		Timeout: timeout,
-		Handler: reflect.ValueOf(handler),
-		Args:    args,
-		Created: time.Now(),
-	})
+	taskQueue = append(taskQueue, task)
+	queueLock.Unlock()
+
+	if isResumable(task.Action) {
+		saveTasks()
+	}
+	return true
 }
 
 func getCurrentActions() (ret []string) {
 	queueLock.Lock()
 
-	currentTaskActionLock.Lock()
-	if "" != currentTaskAction {
-		ret = append(ret, currentTaskAction)
+	currentTaskLock.Lock()
+	if nil != currentTask {
+		ret = append(ret, currentTask.Action)
 	}
-	currentTaskActionLock.Unlock()
+	currentTaskLock.Unlock()
 
 	for _, task := range taskQueue {
 		ret = append(ret, task.Action)
@@ -144,20 +198,21 @@ func StatusJob() {
 			}
 		}
 
-		item := map[string]interface{}{"action": action}
+		item := map[string]interface{}{"action": action, "id": task.ID}
 		items = append(items, item)
 	}
 	defer queueLock.Unlock()
 
-	currentTaskActionLock.Lock()
-	if "" != currentTaskAction {
+	currentTaskLock.Lock()
+	if nil != currentTask {
 		if nil != actionLangs {
-			if label := actionLangs[currentTaskAction]; nil != label {
-				items = append([]map[string]interface{}{{"action": label.(string)}}, items...)
+			if label := actionLangs[currentTask.Action]; nil != label {
+				item := map[string]interface{}{"action": label.(string), "id": currentTask.ID, "current": currentTask.Current, "total": currentTask.Total}
+				items = append([]map[string]interface{}{item}, items...)
 			}
 		}
 	}
-	currentTaskActionLock.Unlock()
+	currentTaskLock.Unlock()
 
 	if 1 > len(items) {
 		items = []map[string]interface{}{}
@@ -168,12 +223,13 @@ func StatusJob() {
 }
 
 func ExecTaskJob() {
-	task := popTask()
-	if nil == task {
+	if util.IsExiting.Load() {
+		// 退出时不再出队，以便可恢复的任务在下次启动后继续执行
 		return
 	}
 
-	if util.IsExiting.Load() {
+	task := popTask()
+	if nil == task {
 		return
 	}
 
@@ -194,42 +250,360 @@ func popTask() (ret *Task) {
 }
 
 var (
-	currentTaskAction     string
-	currentTaskActionLock = sync.Mutex{}
+	currentTask     *Task
+	currentTaskLock = sync.Mutex{}
 )
 
+// SetProgress 设置当前正在执行的任务的进度。
+func SetProgress(current, total int) {
+	currentTaskLock.Lock()
+	defer currentTaskLock.Unlock()
+
+	if nil != currentTask {
+		currentTask.Current, currentTask.Total = current, total
+	}
+}
+
+// taskCancelGracePeriod 是任务取消或者超时后等待处理函数退出的最长时间。
+const taskCancelGracePeriod = 30 * time.Second
+
 func execTask(task *Task) {
 	defer logging.Recover()
 
-	args := make([]reflect.Value, len(task.Args))
+	ctx, cancel := context.WithTimeout(context.Background(), task.Timeout)
+	defer cancel()
+
+	handlerType := task.Handler.Type()
+	var args []reflect.Value
+	offset := 0
+	if task.Cancelable {
+		args = append(args, reflect.ValueOf(ctx))
+		offset = 1
+	}
 	for i, v := range task.Args {
 		if nil == v {
-			args[i] = reflect.New(task.Handler.Type().In(i)).Elem()
+			args = append(args, reflect.New(handlerType.In(i+offset)).Elem())
 		} else {
-			args[i] = reflect.ValueOf(v)
+			args = append(args, reflect.ValueOf(v))
 		}
 	}
 
-	currentTaskActionLock.Lock()
-	currentTaskAction = task.Action
-	currentTaskActionLock.Unlock()
+	currentTaskLock.Lock()
+	task.State = StateRunning
+	task.Started = time.Now()
+	task.cancel = cancel
+	currentTask = task
+	currentTaskLock.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), task.Timeout)
-	defer cancel()
-	ch := make(chan bool, 1)
+	ch := make(chan error, 1)
 	go func() {
-		task.Handler.Call(args)
-		ch <- true
+		defer func() {
+			if e := recover(); nil != e {
+				logging.LogErrorf("task [%s] panic: %v\n%s", task.Action, e, debug.Stack())
+				ch <- fmt.Errorf("%v", e)
+			}
+		}()
+
+		rets := task.Handler.Call(args)
+		var err error
+		if n := len(rets); 0 < n {
+			err, _ = rets[n-1].Interface().(error)
+		}
+		ch <- err
 	}()
 
+	var err error
 	select {
 	case <-ctx.Done():
-		logging.LogWarnf("task [%s] timeout", task.Action)
-	case <-ch:
+		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			logging.LogWarnf("task [%s] timeout", task.Action)
+		}
+
+		// 等待处理函数退出后再执行下一个任务，避免和仍在执行的处理函数并发修改数据
+		select {
+		case <-ch:
+		case <-time.After(taskCancelGracePeriod):
+			logging.LogWarnf("task [%s] is still running after [%s], continue with the next task", task.Action, taskCancelGracePeriod)
+		}
+	case err = <-ch:
 		//logging.LogInfof("task [%s] done", task.Action)
 	}
 
-	currentTaskActionLock.Lock()
-	currentTaskAction = ""
-	currentTaskActionLock.Unlock()
+	currentTaskLock.Lock()
+	task.Ended = time.Now()
+	task.cancel = nil
+	currentTask = nil
+	currentTaskLock.Unlock()
+
+	if nil != err {
+		task.State = StateFailed
+		if errors.Is(err, context.Canceled) {
+			task.State = StateCanceled
+		}
+		task.Error = err.Error()
+		addFinishedTask(task)
+	}
+
+	if isResumable(task.Action) {
+		saveTasks()
+	}
+}
+
+var (
+	finishedTasks     []*Task // 最近执行失败或者被取消的任务，用于重试
+	finishedTasksLock = sync.Mutex{}
+)
+
+const maxFinishedTasks = 32
+
+func addFinishedTask(task *Task) {
+	finishedTasksLock.Lock()
+	defer finishedTasksLock.Unlock()
+
+	finishedTasks = append([]*Task{task}, finishedTasks...)
+	if maxFinishedTasks < len(finishedTasks) {
+		finishedTasks = finishedTasks[:maxFinishedTasks]
+	}
+}
+
+// GetTasks 返回正在执行、排队中以及最近执行失败或者被取消的任务。
+func GetTasks() (ret []*Task) {
+	ret = []*Task{}
+	actionLangs := util.TaskActionLangs[util.Lang]
+	appendCopy := func(task *Task) {
+		t := *task
+		t.cancel = nil
+		t.Name = t.Action
+		if nil != actionLangs {
+			if label := actionLangs[t.Action]; nil != label {
+				t.Name = label.(string)
+			}
+		}
+		ret = append(ret, &t)
+	}
+
+	queueLock.Lock()
+	currentTaskLock.Lock()
+	if nil != currentTask {
+		appendCopy(currentTask)
+	}
+	currentTaskLock.Unlock()
+	for _, task := range taskQueue {
+		appendCopy(task)
+	}
+	queueLock.Unlock()
+
+	finishedTasksLock.Lock()
+	for _, task := range finishedTasks {
+		appendCopy(task)
+	}
+	finishedTasksLock.Unlock()
+	return
+}
+
+// CancelTask 取消任务，排队中的任务直接出队，执行中的任务通过取消上下文来通知处理函数退出。
+func CancelTask(id string) (err error) {
+	currentTaskLock.Lock()
+	if nil != currentTask && id == currentTask.ID {
+		defer currentTaskLock.Unlock()
+		if !currentTask.Cancelable || nil == currentTask.cancel {
+			return ErrTaskNotCancelable
+		}
+		currentTask.cancel()
+		return
+	}
+	currentTaskLock.Unlock()
+
+	var canceled *Task
+	queueLock.Lock()
+	for i, task := range taskQueue {
+		if id == task.ID {
+			canceled = task
+			taskQueue = append(taskQueue[:i], taskQueue[i+1:]...)
+			break
+		}
+	}
+	queueLock.Unlock()
+
+	if nil == canceled {
+		return ErrTaskNotFound
+	}
+
+	canceled.State = StateCanceled
+	canceled.Error = context.Canceled.Error()
+	canceled.Ended = time.Now()
+	addFinishedTask(canceled)
+	if isResumable(canceled.Action) {
+		saveTasks()
+	}
+	return
+}
+
+// RetryTask 将执行失败或者被取消的任务重新加入队列。
+func RetryTask(id string) (err error) {
+	finishedTasksLock.Lock()
+	var task *Task
+	for i, t := range finishedTasks {
+		if id == t.ID {
+			task = t
+			finishedTasks = append(finishedTasks[:i], finishedTasks[i+1:]...)
+			break
+		}
+	}
+	finishedTasksLock.Unlock()
+
+	if nil == task {
+		return ErrTaskNotRetryable
+	}
+
+	if !appendTask(newTask(task.ID, task.Action, task.Timeout, task.Handler, task.Args)) {
+		addFinishedTask(task)
+		return ErrTaskExists
+	}
+	return
+}
+
+var (
+	resumableHandlers     = map[string]interface{}{}
+	resumableHandlersLock = sync.Mutex{}
+	tasksResumed          bool
+)
+
+// RegisterResumable 注册可恢复的任务，这类任务会被持久化，因为退出而中断或者未执行的任务在下次启动后继续执行。
+// 可恢复任务的参数需要能够通过 JSON 序列化。
+func RegisterResumable(action string, handler interface{}) {
+	resumableHandlersLock.Lock()
+	defer resumableHandlersLock.Unlock()
+	resumableHandlers[action] = handler
+}
+
+func isResumable(action string) bool {
+	resumableHandlersLock.Lock()
+	defer resumableHandlersLock.Unlock()
+	return nil != resumableHandlers[action]
+}
+
+func getTasksPath() string {
+	return filepath.Join(util.TempDir, "tasks.json")
+}
+
+// ResumeTasks 恢复上次退出时中断或者未执行的任务，需要在内核启动完成后调用。
+func ResumeTasks() {
+	defer logging.Recover()
+
+	var tasks []*Task
+	tasksPath := getTasksPath()
+	if gulu.File.IsExist(tasksPath) {
+		data, err := os.ReadFile(tasksPath)
+		if nil != err {
+			logging.LogErrorf("read tasks [%s] failed: %s", tasksPath, err)
+		} else if err = gulu.JSON.UnmarshalJSON(data, &tasks); nil != err {
+			logging.LogErrorf("unmarshal tasks [%s] failed: %s", tasksPath, err)
+		}
+	}
+
+	resumableHandlersLock.Lock()
+	tasksResumed = true
+	var resumed []*Task
+	for _, t := range tasks {
+		handler := resumableHandlers[t.Action]
+		if nil == handler {
+			continue
+		}
+
+		task := newTask(t.ID, t.Action, t.Timeout, reflect.ValueOf(handler), nil)
+		if err := task.setJSONArgs(t.Args); nil != err {
+			logging.LogErrorf("resume task [%s] failed: %s", t.Action, err)
+			continue
+		}
+		task.Created = t.Created
+		resumed = append(resumed, task)
+	}
+	resumableHandlersLock.Unlock()
+
+	if 0 < len(resumed) {
+		queueLock.Lock()
+		taskQueue = append(resumed, taskQueue...)
+		queueLock.Unlock()
+		logging.LogInfof("resumed [%d] tasks", len(resumed))
+	}
+	saveTasks()
+}
+
+// setJSONArgs 将 JSON 反序列化得到的参数转换为处理函数的参数类型。
+func (task *Task) setJSONArgs(args []interface{}) (err error) {
+	handlerType := task.Handler.Type()
+	offset := 0
+	if task.Cancelable {
+		offset = 1
+	}
+	if len(args)+offset != handlerType.NumIn() {
+		return fmt.Errorf("args count mismatch [%d]", len(args))
+	}
+
+	for i, arg := range args {
+		v := reflect.New(handlerType.In(i + offset))
+		if nil != arg {
+			data, marshalErr := gulu.JSON.MarshalJSON(arg)
+			if nil != marshalErr {
+				return marshalErr
+			}
+			if err = gulu.JSON.UnmarshalJSON(data, v.Interface()); nil != err {
+				return
+			}
+		}
+		task.Args = append(task.Args, v.Elem().Interface())
+	}
+	return
+}
+
+var saveTasksLock = sync.Mutex{}
+
+// saveTasks 持久化排队中和执行中的可恢复任务。
+func saveTasks() {
+	resumableHandlersLock.Lock()
+	resumed := tasksResumed
+	resumableHandlersLock.Unlock()
+	if !resumed {
+		// 恢复之前不能覆盖上次持久化的任务
+		return
+	}
+
+	var tasks []*Task
+	queueLock.Lock()
+	currentTaskLock.Lock()
+	if nil != currentTask {
+		tasks = append(tasks, currentTask)
+	}
+	currentTaskLock.Unlock()
+	tasks = append(tasks, taskQueue...)
+	queueLock.Unlock()
+
+	var persisted []*Task
+	for _, task := range tasks {
+		if isResumable(task.Action) {
+			persisted = append(persisted, &Task{ID: task.ID, Action: task.Action, Args: task.Args, Created: task.Created, Timeout: task.Timeout})
+		}
+	}
+
+	saveTasksLock.Lock()
+	defer saveTasksLock.Unlock()
+
+	tasksPath := getTasksPath()
+	if 1 > len(persisted) {
+		if gulu.File.IsExist(tasksPath) {
+			os.Remove(tasksPath)
+		}
+		return
+	}
+
+	data, err := gulu.JSON.MarshalJSON(persisted)
+	if nil != err {
+		logging.LogErrorf("marshal tasks failed: %s", err)
+		return
+	}
+	if err = gulu.File.WriteFileSafer(tasksPath, data, 0644); nil != err {
+		logging.LogErrorf("write tasks [%s] failed: %s", tasksPath, err)
+	}
 }
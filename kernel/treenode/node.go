@@ -572,7 +572,7 @@ func getAttributeViewContent(avID string) (content string) {
 
 	var view *av.View
 	for _, v := range attrView.Views {
-		if av.LayoutTypeTable == v.LayoutType {
+		if nil != v.GetLayoutTable() {
 			view = v
 			break
 		}
@@ -632,6 +632,7 @@ func renderAttributeViewTable(attrView *av.AttributeView, view *av.View) (ret *a
 			Options:      key.Options,
 			NumberFormat: key.NumberFormat,
 			Template:     key.Template,
+			Formula:      key.Formula,
 			Relation:     key.Relation,
 			Rollup:       key.Rollup,
 			Date:         key.Date,
@@ -714,6 +715,8 @@ func renderAttributeViewTable(attrView *av.AttributeView, view *av.View) (ret *a
 				}
 			case av.KeyTypeTemplate: // 渲染模板列
 				tableCell.Value = &av.Value{ID: tableCell.ID, KeyID: col.ID, BlockID: rowID, Type: av.KeyTypeTemplate, Template: &av.ValueTemplate{Content: col.Template}}
+			case av.KeyTypeFormula: // 填充公式列值，后面再计算
+				tableCell.Value = &av.Value{ID: tableCell.ID, KeyID: col.ID, BlockID: rowID, Type: av.KeyTypeFormula, Formula: &av.ValueFormula{}}
 			case av.KeyTypeCreated: // 填充创建时间列值，后面再渲染
 				tableCell.Value = &av.Value{ID: tableCell.ID, KeyID: col.ID, BlockID: rowID, Type: av.KeyTypeCreated}
 			case av.KeyTypeUpdated: // 填充更新时间列值，后面再渲染
@@ -865,6 +868,9 @@ func renderAttributeViewTable(attrView *av.AttributeView, view *av.View) (ret *a
 			}
 		}
 	}
+
+	// 计算公式列，公式可以引用包括模板列在内的所有列值
+	av.RenderTableFormulaCols(attrView, ret, rows)
 	return
 }
 
@@ -936,6 +942,18 @@ func FillAttributeViewTableCellNilValue(tableCell *av.TableCell, rowID, colID st
 		if nil == tableCell.Value.Rollup {
 			tableCell.Value.Rollup = &av.ValueRollup{}
 		}
+	case av.KeyTypeFormula:
+		if nil == tableCell.Value.Formula {
+			tableCell.Value.Formula = &av.ValueFormula{}
+		}
+	case av.KeyTypeUniqueID:
+		if nil == tableCell.Value.UniqueID {
+			tableCell.Value.UniqueID = &av.ValueUniqueID{}
+		}
+	case av.KeyTypeCreatedBy:
+		if nil == tableCell.Value.CreatedBy {
+			tableCell.Value.CreatedBy = &av.ValueCreatedBy{}
+		}
 	}
 }
 
@@ -0,0 +1,160 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron 描述了解析后的 cron 表达式，字段依次为：分 时 日 月 周。
+type Cron struct {
+	minute, hour, dom, month, dow uint64 // 每个字段允许的值，按位表示
+
+	domStar, dowStar bool // 日和周字段是否为 *，两者都不为 * 时满足其一即可
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron 解析标准的 5 字段 cron 表达式，支持 *、-、,、/ 以及 @daily 等宏。
+func ParseCron(expr string) (ret *Cron, err error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if 5 != len(fields) {
+		err = fmt.Errorf("cron expression [%s] must have 5 fields", expr)
+		return
+	}
+
+	ret = &Cron{}
+	if ret.minute, err = parseCronField(fields[0], 0, 59); nil != err {
+		return
+	}
+	if ret.hour, err = parseCronField(fields[1], 0, 23); nil != err {
+		return
+	}
+	if ret.dom, err = parseCronField(fields[2], 1, 31); nil != err {
+		return
+	}
+	if ret.month, err = parseCronField(fields[3], 1, 12); nil != err {
+		return
+	}
+	if ret.dow, err = parseCronField(fields[4], 0, 7); nil != err {
+		return
+	}
+	if 0 != ret.dow&(1<<7) {
+		// 周日可以写作 0 或者 7
+		ret.dow |= 1
+	}
+	ret.domStar = strings.HasPrefix(fields[2], "*")
+	ret.dowStar = strings.HasPrefix(fields[4], "*")
+	return
+}
+
+func parseCronField(field string, min, max int) (ret uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); -1 < i {
+			if step, err = strconv.Atoi(part[i+1:]); nil != err || 1 > step {
+				err = fmt.Errorf("invalid cron step [%s]", part)
+				return
+			}
+			part = part[:i]
+		}
+
+		start, end := min, max
+		if "*" != part {
+			if i := strings.Index(part, "-"); -1 < i {
+				if start, err = strconv.Atoi(part[:i]); nil != err {
+					err = fmt.Errorf("invalid cron range [%s]", part)
+					return
+				}
+				if end, err = strconv.Atoi(part[i+1:]); nil != err {
+					err = fmt.Errorf("invalid cron range [%s]", part)
+					return
+				}
+			} else {
+				if start, err = strconv.Atoi(part); nil != err {
+					err = fmt.Errorf("invalid cron value [%s]", part)
+					return
+				}
+				end = start
+				if 1 < step {
+					// 5/15 表示从 5 开始每 15 个单位
+					end = max
+				}
+			}
+		}
+
+		if start < min || end > max || start > end {
+			err = fmt.Errorf("cron value [%s] out of range [%d-%d]", part, min, max)
+			return
+		}
+		for v := start; v <= end; v += step {
+			ret |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+// Next 返回 t 之后（不包含 t）第一个满足表达式的时间，精确到分钟，5 年内没有满足的时间时返回零值。
+func (cron *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if 0 == cron.month&(1<<uint(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !cron.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if 0 == cron.hour&(1<<uint(t.Hour())) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if 0 == cron.minute&(1<<uint(t.Minute())) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (cron *Cron) matchDay(t time.Time) bool {
+	domMatch := 0 != cron.dom&(1<<uint(t.Day()))
+	dowMatch := 0 != cron.dow&(1<<uint(t.Weekday()))
+	if cron.domStar || cron.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,75 @@
+// SiYuan - Refactor your thinking
+// Copyright (c) 2020-present, b3log.org
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC) // 周一
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9,18 * * *", time.Date(2024, 1, 15, 18, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 12 13 * 5", time.Date(2024, 1, 19, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@YEARLY", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, c := range cases {
+		cron, err := ParseCron(c.expr)
+		if nil != err {
+			t.Fatalf("parse cron [%s] failed: %s", c.expr, err)
+		}
+		if next := cron.Next(from); !next.Equal(c.next) {
+			t.Errorf("cron [%s] next: expected [%s], got [%s]", c.expr, c.next, next)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	}
+
+	for _, expr := range cases {
+		if _, err := ParseCron(expr); nil == err {
+			t.Errorf("cron [%s] should be invalid", expr)
+		}
+	}
+}
@@ -17,12 +17,16 @@
 package util
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/88250/gulu"
 	"github.com/sashabaranov/go-openai"
 	"github.com/siyuan-note/logging"
 )
@@ -76,6 +80,84 @@ func ChatGPT(msg string, contextMsgs []string, c *openai.Client, model string, m
 	return
 }
 
+// OpenAIEmbeddings 调用 OpenAI 兼容接口将文本转换为向量。
+func OpenAIEmbeddings(texts []string, c *openai.Client, model string, timeout int) (ret [][]float32, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	resp, err := c.CreateEmbeddings(ctx, openai.EmbeddingRequest{Input: texts, Model: openai.EmbeddingModel(model)})
+	if nil != err {
+		logging.LogErrorf("create embeddings failed: %s", err)
+		return
+	}
+
+	ret = make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if 0 > data.Index || len(ret) <= data.Index {
+			continue
+		}
+		ret[data.Index] = data.Embedding
+	}
+	return
+}
+
+// LocalEmbeddings 调用本地 HTTP 服务将文本转换为向量。
+//
+// 请求体为 {"model": "", "input": [""]}，响应体兼容 OpenAI 格式 {"data": [{"index": 0, "embedding": []}]} 和 {"embeddings": [[]]}。
+func LocalEmbeddings(texts []string, serviceURL, model string, timeout int) (ret [][]float32, err error) {
+	body, err := gulu.JSON.MarshalJSON(map[string]interface{}{"model": model, "input": texts})
+	if nil != err {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serviceURL, bytes.NewReader(body))
+	if nil != err {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if nil != err {
+		logging.LogErrorf("request local embedding service [%s] failed: %s", serviceURL, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if nil != err {
+		return
+	}
+	if http.StatusOK != resp.StatusCode {
+		err = fmt.Errorf("local embedding service [%s] responded with status code [%d]", serviceURL, resp.StatusCode)
+		return
+	}
+
+	result := &struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Embeddings [][]float32 `json:"embeddings"`
+	}{}
+	if err = gulu.JSON.UnmarshalJSON(data, result); nil != err {
+		return
+	}
+
+	if 0 < len(result.Embeddings) {
+		ret = result.Embeddings
+		return
+	}
+	ret = make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if 0 > d.Index || len(ret) <= d.Index {
+			continue
+		}
+		ret[d.Index] = d.Embedding
+	}
+	return
+}
+
 func NewOpenAIClient(apiKey, apiProxy, apiBaseURL, apiUserAgent, apiVersion, apiProvider string) *openai.Client {
 	config := openai.DefaultConfig(apiKey)
 	if "Azure" == apiProvider {
@@ -67,7 +67,7 @@ var IsExiting = atomic.Bool{}
 var MobileOSVer string
 
 // DatabaseVer 数据库版本。修改表结构的话需要修改这里。
-const DatabaseVer = "20220501"
+const DatabaseVer = "20261017"
 
 func logBootInfo() {
 	plat := GetOSPlatform()
@@ -418,4 +418,5 @@ const (
 
 	EvtSQLHistoryRebuild      = "sql.history.rebuild"
 	EvtSQLAssetContentRebuild = "sql.assetContent.rebuild"
+	EvtSQLIndexCommitted      = "sql.index.committed"
 )